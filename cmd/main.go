@@ -6,23 +6,38 @@ import (
 	"log/slog"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/uptrace/opentelemetry-go-extra/otelgorm"
 
 	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 	"gorm.io/gorm"
 
 	"todo-api-go/api"
+	"todo-api-go/apikeys"
 	"todo-api-go/entities"
+	"todo-api-go/events"
 	"todo-api-go/oidc"
 	"todo-api-go/persistence"
+	"todo-api-go/ratelimit"
+	"todo-api-go/reminders"
 	"todo-api-go/telemetry"
+	"todo-api-go/webhooks"
 )
 
 func main() {
 	// Initialize the OpenTelemetry SDK
-	otelShutdown, err := telemetry.SetupOTelSDK(context.Background())
+	serviceInfo, err := telemetry.NewServiceInfoFromEnv()
+	if err != nil {
+		fatalError(err)
+	}
+
+	sampler, err := telemetry.NewSamplerFromEnv()
+	if err != nil {
+		fatalError(err)
+	}
+
+	otelShutdown, err := telemetry.SetupOTelSDK(context.Background(), sampler, serviceInfo)
 	if err != nil {
 		fatalError(err)
 	}
@@ -32,37 +47,124 @@ func main() {
 		err = errors.Join(err, otelShutdown(context.Background()))
 	}()
 
+	// Initialize the database connectivity
+	db := openDatabase()
+	entityManager := persistence.New(db)
+	apiKeyManager := persistence.NewApiKeyManager(db)
+	auditManager := persistence.NewAuditManager(db)
+	webhookManager, err := persistence.NewWebhookManagerFromEnv(db)
+	if err != nil {
+		fatalError(err)
+	}
+	reminderManager := persistence.NewReminderManager(db)
+
+	// Record the metrics of the to-do domain, counting open items at most every 30 seconds
+	domainMetrics, err := telemetry.NewDomainMetrics(entityManager, 30*time.Second)
+	if err != nil {
+		fatalError(err)
+	}
+	entityManager.AddObserver(domainMetrics)
+
+	// Publish the changes of items made through any instance to the event streams and WebSocket
+	// channels of the callers allowed to see them
+	hub, err := events.NewHubFromEnv()
+	if err != nil {
+		fatalError(err)
+	}
+	feed, err := events.NewFeed(db, func(ctx context.Context, id uint) (*entities.ToDoItemEntity, error) {
+		return entityManager.WithContext(ctx).FineOne(int(id))
+	}, func(ctx context.Context, id uint) (*persistence.ItemAudience, error) {
+		return entityManager.WithContext(ctx).FindAudience(id)
+	})
+	if err != nil {
+		fatalError(err)
+	}
+	entityManager.AddAudienceObserver(events.NewRelay(feed))
+	go feed.Run(context.Background(), hub)
+
+	// Deliver the webhooks queued in the outbox in the background
+	dispatcher, err := webhooks.NewFromEnv(webhookManager)
+	if err != nil {
+		fatalError(err)
+	}
+	go dispatcher.Run(context.Background())
+
+	// Send the reminders of items approaching or past their due dates in the background
+	scheduler, err := reminders.NewFromEnv(reminderManager)
+	if err != nil {
+		fatalError(err)
+	}
+	go scheduler.Run(context.Background())
+
 	// Initialize the HTTP middleware for authorization
 	slog.Info("Initializing HTTP middleware for authorization")
-	authz, err := oidc.New()
+	oidcAuthz, err := oidc.New()
 	if err != nil {
 		fatalError(err)
 	}
+	authz := apikeys.New(apiKeyManager, oidcAuthz)
 
-	// Initialize the database connectivity
-	entityManager := createEntityManager()
+	// Initialize the HTTP middleware for rate limiting
+	limiter, err := ratelimit.NewFromEnv(ratelimit.NewMemoryBackend())
+	if err != nil {
+		fatalError(err)
+	}
+
+	// Initialize the HTTP middleware for server metrics
+	httpMetrics, err := telemetry.HTTPServerMetrics()
+	if err != nil {
+		fatalError(err)
+	}
+
+	// Initialize the response compression
+	compression, err := api.NewCompressionFromEnv()
+	if err != nil {
+		fatalError(err)
+	}
 
 	// Register the routes
 	slog.Info("Registering routes")
-	router := gin.Default()
+	router := gin.New()
+	err = api.ConfigureProxiesFromEnv(router)
+	if err != nil {
+		fatalError(err)
+	}
+	router.Use(gin.Recovery())
 	router.Use(otelgin.Middleware("todo-api-go"))
-	api.RegisterRoutes(router, entityManager, authz)
+	router.Use(httpMetrics)
+	router.Use(api.RequestID())
+	router.Use(api.RequestLogger())
+	router.Use(compression)
+	router.Use(limiter.AddressMiddleware())
+	api.RegisterRoutes(router, entityManager, authz, limiter.Middleware())
+	api.RegisterEventRoutes(router, hub, authz, limiter.Middleware())
+	api.RegisterWebSocketRoutes(router, entityManager, hub, authz, limiter.Middleware())
+	api.RegisterDavRoutes(router, entityManager, authz, limiter.Middleware())
+	api.RegisterApiKeyRoutes(router, apiKeyManager, authz, limiter.Middleware())
+	api.RegisterAuditRoutes(router, auditManager, authz, limiter.Middleware())
+	api.RegisterWebhookRoutes(router, webhookManager, authz, limiter.Middleware())
+	api.RegisterInboxRoutes(router, reminderManager, authz, limiter.Middleware())
+	api.RegisterAdminRoutes(router, sampler, authz, limiter.Middleware())
+	api.RegisterHealthRoutes(router)
+	api.RegisterVersionRoutes(router, serviceInfo)
 
 	// Start the server
 	slog.Info("Starting server")
 	router.Run(":8080")
 }
 
-// createEntityManager creates and returns a configured instance of ToDoEntityManager.
+// openDatabase opens and returns a configured gorm DB connection.
 //
 // It opens a dialector from the environment variables and uses it to open a new gorm DB connection.
-// If the connection is successful, it checks if the DB_AUTO_MIGRATE environment variable is set to "true".
-// If it is, it auto migrates the entities.ToDoItemEntity table.
-// Finally, it returns a new instance of ToDoEntityManager using the created DB connection.
+// If the connection is successful, it instruments the connection with spans and metrics of the queries
+// and checks if the DB_AUTO_MIGRATE environment variable is set to "true".
+// If it is, it auto migrates the tables of all persistent entities.
+// If the DB_UNOWNED_ITEMS_OWNER environment variable is set, items without owner are assigned
+// to the subject it names.
 //
 // Returns:
-// *persistence.ToDoEntityManager - The newly created instance of ToDoEntityManager.
-func createEntityManager() *persistence.ToDoEntityManager {
+// *gorm.DB - The newly opened DB connection, shared by all entity managers.
+func openDatabase() *gorm.DB {
 	dialector, err := persistence.OpenDialectorFromEnv()
 	if err != nil {
 		fatalError(err)
@@ -75,19 +177,28 @@ func createEntityManager() *persistence.ToDoEntityManager {
 		fatalError(err)
 	}
 
-	err = db.Use(otelgorm.NewPlugin(otelgorm.WithDBName("todo-api-go")))
+	err = persistence.Instrument(db, "todo-api-go")
 	if err != nil {
 		fatalError(err)
 	}
 
 	if strings.ToLower(os.Getenv("DB_AUTO_MIGRATE")) == "true" {
-		err = db.AutoMigrate(&entities.ToDoItemEntity{})
+		err = persistence.Migrate(db)
+		if err != nil {
+			fatalError(err)
+		}
+	}
+
+	// Items created before items were owned are only visible to admins unless they are assigned
+	if owner := os.Getenv("DB_UNOWNED_ITEMS_OWNER"); owner != "" {
+		assigned, err := persistence.AssignUnownedItems(db, owner)
 		if err != nil {
 			fatalError(err)
 		}
+		slog.Info("Assigned items without owner", "owner", owner, "count", assigned)
 	}
 
-	return persistence.New(db)
+	return db
 }
 
 // Log a fatal error message and exits the program.
@@ -95,6 +206,6 @@ func createEntityManager() *persistence.ToDoEntityManager {
 // It takes an error as a parameter and logs the error message using the slog.Error function.
 // It then exits the program with a status code of 1 using os.Exit.
 func fatalError(err error) {
-	slog.Error(err.Error(), err)
+	slog.Error(err.Error(), "error", err)
 	os.Exit(1)
 }
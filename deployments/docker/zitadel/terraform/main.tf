@@ -40,7 +40,7 @@ resource "zitadel_project" "default" {
 variable "roles" {
   description = "Roles for testing"
   type        = list(string)
-  default     = ["create", "retrieve", "update", "delete"]
+  default     = ["create", "retrieve", "update", "delete", "keys", "webhooks", "admin"]
 }
 
 resource "zitadel_project_role" "name" {
@@ -115,7 +115,7 @@ resource "zitadel_user_grant" "readwrite" {
   project_id = zitadel_project.default.id
   org_id     = zitadel_org.default.id
   user_id    = zitadel_human_user.readwrite.id
-  role_keys  = ["create", "retrieve", "update", "delete"]
+  role_keys  = ["create", "retrieve", "update", "delete", "keys", "webhooks", "admin"]
 }
 
 #
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SamplingController gives access to the trace sampling ratio, which may be changed at runtime.
+type SamplingController interface {
+	Ratio() float64
+	SetRatio(ratio float64) error
+}
+
+type SamplingRequest struct {
+	Ratio *float64 `binding:"required"`
+}
+
+type SamplingResponse struct {
+	Ratio float64
+}
+
+// RegisterAdminRoutes registers the operational administration routes for the Gin engine.
+//
+// gin: The Gin engine to register the routes with.
+// sampling: The controller of the trace sampling ratio.
+// authFactory: The factory for the authorization middleware.
+// middleware: Handlers to run on every route once the caller has been authorized.
+// Returns the registered Gin engine.
+func RegisterAdminRoutes(gin *gin.Engine, sampling SamplingController, authFactory AuthorizerFactory, middleware ...gin.HandlerFunc) *gin.Engine {
+	gin.GET("/api/admin/sampling", secured(authFactory, "admin", middleware, getSamplingHandler(sampling))...)
+	gin.PUT("/api/admin/sampling", secured(authFactory, "admin", middleware, updateSamplingHandler(sampling))...)
+
+	return gin
+}
+
+// RegisterHealthRoutes registers the unauthenticated health check route for the Gin engine.
+//
+// gin: The Gin engine to register the routes with.
+// Returns the registered Gin engine.
+func RegisterHealthRoutes(gin *gin.Engine) *gin.Engine {
+	gin.GET("/health", healthHandler())
+
+	return gin
+}
+
+// RegisterVersionRoutes registers the unauthenticated route reporting the version of the service.
+//
+// gin: The Gin engine to register the routes with.
+// version: The description of the service and its build, serialized as JSON.
+// Returns the registered Gin engine.
+func RegisterVersionRoutes(gin *gin.Engine, version any) *gin.Engine {
+	gin.GET("/version", versionHandler(version))
+
+	return gin
+}
+
+// versionHandler creates a HandlerFunc function reporting the version of the service.
+//
+// It takes the description of the service as a parameter.
+// The function returns a gin.HandlerFunc.
+func versionHandler(version any) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		writeJSON(c, http.StatusOK, version)
+	})
+}
+
+// healthHandler creates a HandlerFunc function reporting that the service is up.
+//
+// The function returns a gin.HandlerFunc.
+func healthHandler() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": "UP"})
+	})
+}
+
+// getSamplingHandler creates a HandlerFunc function for retrieving the trace sampling ratio.
+//
+// It takes a controller of type SamplingController as a parameter.
+// The function returns a gin.HandlerFunc.
+func getSamplingHandler(sampling SamplingController) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		writeJSON(c, http.StatusOK, SamplingResponse{Ratio: sampling.Ratio()})
+	})
+}
+
+// updateSamplingHandler creates a HandlerFunc function for changing the trace sampling ratio.
+//
+// It takes a controller of type SamplingController as a parameter.
+// The function returns a gin.HandlerFunc.
+func updateSamplingHandler(sampling SamplingController) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		var request SamplingRequest
+		err := c.BindJSON(&request)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		err = sampling.SetRatio(*request.Ratio)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		writeJSON(c, http.StatusOK, SamplingResponse{Ratio: sampling.Ratio()})
+	})
+}
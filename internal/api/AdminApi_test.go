@@ -0,0 +1,84 @@
+package api_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"todo-api-go/api"
+)
+
+type MockSampling struct {
+	ratio float64
+}
+
+func (mock *MockSampling) Ratio() float64 {
+	return mock.ratio
+}
+
+func (mock *MockSampling) SetRatio(ratio float64) error {
+	if ratio < 0 || ratio > 1 {
+		return errors.New("invalid sampling ratio")
+	}
+
+	mock.ratio = ratio
+	return nil
+}
+
+func TestSampling(t *testing.T) {
+	assert := assert.New(t)
+
+	sampling := &MockSampling{ratio: 1}
+	router := gin.Default()
+	api.RegisterAdminRoutes(router, sampling, &MockAuthorizer{})
+
+	req, _ := http.NewRequest("PUT", "/api/admin/sampling", bytes.NewBufferString(`{"Ratio": 0.25}`))
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	assert.Equalf(200, recorder.Code, "Expected successful response")
+	assert.Equalf(0.25, sampling.ratio, "ratio should be changed")
+
+	req, _ = http.NewRequest("GET", "/api/admin/sampling", nil)
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	assert.Equalf(200, recorder.Code, "Expected successful response")
+
+	var response api.SamplingResponse
+	err := json.Unmarshal(recorder.Body.Bytes(), &response)
+	assert.Nilf(err, "error should be nil")
+	assert.Equalf(0.25, response.Ratio, "ratio should match")
+
+	req, _ = http.NewRequest("PUT", "/api/admin/sampling", bytes.NewBufferString(`{"Ratio": 2}`))
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	assert.Equalf(400, recorder.Code, "Expected bad request response")
+
+	req, _ = http.NewRequest("PUT", "/api/admin/sampling", bytes.NewBufferString(`{}`))
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	assert.Equalf(400, recorder.Code, "Expected bad request response")
+	assert.Equalf(0.25, sampling.ratio, "ratio should be unchanged")
+}
+
+func TestVersion(t *testing.T) {
+	assert := assert.New(t)
+
+	router := gin.Default()
+	api.RegisterVersionRoutes(router, map[string]string{"Version": "v1.2.3"})
+
+	req, _ := http.NewRequest("GET", "/version", nil)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	assert.Equalf(200, recorder.Code, "Expected successful response")
+
+	var response map[string]string
+	err := json.Unmarshal(recorder.Body.Bytes(), &response)
+	assert.Nilf(err, "error should be nil")
+	assert.Equalf("v1.2.3", response["Version"], "version should match")
+}
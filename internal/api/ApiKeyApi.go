@@ -0,0 +1,106 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"todo-api-go/entities"
+	"todo-api-go/persistence"
+)
+
+type ApiKeyRequest struct {
+	Name      string   `binding:"required"`
+	Scopes    []string `binding:"required"`
+	ExpiresAt time.Time
+}
+
+type ApiKeyResponse struct {
+	// The plain text key. It is only returned when the key is created.
+	Key  string
+	Data entities.ApiKeyEntity
+}
+
+// RegisterApiKeyRoutes registers the API key management routes for the Gin engine.
+//
+// gin: The Gin engine to register the routes with.
+// mgr: The API key manager.
+// authFactory: The factory for the authorization middleware.
+// middleware: Handlers to run on every route once the caller has been authorized.
+// Returns the registered Gin engine.
+func RegisterApiKeyRoutes(gin *gin.Engine, mgr *persistence.ApiKeyManager, authFactory AuthorizerFactory, middleware ...gin.HandlerFunc) *gin.Engine {
+	gin.GET("/api/keys", secured(authFactory, "keys", middleware, getAllApiKeysHandler(mgr))...)
+	gin.POST("/api/keys", secured(authFactory, "keys", middleware, createApiKeyHandler(mgr))...)
+	gin.DELETE("/api/keys/:id", secured(authFactory, "keys", middleware, revokeApiKeyHandler(mgr))...)
+
+	return gin
+}
+
+// createApiKeyHandler creates a HandlerFunc function for issuing an API key to the caller.
+//
+// It takes a manager of type *persistence.ApiKeyManager as a parameter.
+// The function returns a gin.HandlerFunc.
+func createApiKeyHandler(manager *persistence.ApiKeyManager) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		var request ApiKeyRequest
+		err := c.BindJSON(&request)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		key := entities.ApiKeyEntity{
+			Name:      request.Name,
+			Scopes:    request.Scopes,
+			ExpiresAt: request.ExpiresAt,
+		}
+
+		plain, err := manager.WithContext(c.Request.Context()).Create(&key)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		writeJSON(c, http.StatusCreated, ApiKeyResponse{Key: plain, Data: key})
+	})
+}
+
+// getAllApiKeysHandler creates a HandlerFunc function for listing the API keys of the caller.
+//
+// It takes a manager of type *persistence.ApiKeyManager as a parameter.
+// The function returns a gin.HandlerFunc.
+func getAllApiKeysHandler(manager *persistence.ApiKeyManager) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		keys, err := manager.WithContext(c.Request.Context()).FindAll()
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		writeJSON(c, http.StatusOK, keys)
+	})
+}
+
+// revokeApiKeyHandler creates a HandlerFunc function for revoking an API key of the caller.
+//
+// It takes a manager of type *persistence.ApiKeyManager as a parameter.
+// The function returns a gin.HandlerFunc.
+func revokeApiKeyHandler(manager *persistence.ApiKeyManager) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		key, err := manager.WithContext(c.Request.Context()).Revoke(uint(id))
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		writeJSON(c, http.StatusOK, key)
+	})
+}
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"todo-api-go/entities"
+	"todo-api-go/persistence"
+)
+
+type AuditResponse struct {
+	Meta ListMetadata
+	Data []entities.AuditEntryEntity
+}
+
+// RegisterAuditRoutes registers the audit log routes for the Gin engine.
+//
+// gin: The Gin engine to register the routes with.
+// mgr: The audit manager.
+// authFactory: The factory for the authorization middleware.
+// middleware: Handlers to run on every route once the caller has been authorized.
+// Returns the registered Gin engine.
+func RegisterAuditRoutes(gin *gin.Engine, mgr *persistence.AuditManager, authFactory AuthorizerFactory, middleware ...gin.HandlerFunc) *gin.Engine {
+	gin.GET("/api/audit", secured(authFactory, "admin", middleware, getAuditEntriesHandler(mgr))...)
+
+	return gin
+}
+
+// getAuditEntriesHandler creates a HandlerFunc function for querying the audit log with
+// filtering and pagination.
+//
+// It takes a manager of type *persistence.AuditManager as a parameter.
+// The function returns a gin.HandlerFunc.
+func getAuditEntriesHandler(manager *persistence.AuditManager) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		filter, err := getAuditFilter(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		entries, total, err := manager.WithContext(c.Request.Context()).FindAll(filter, getPagingConfigurator(c))
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		response := AuditResponse{
+			Meta: ListMetadata{Total: total},
+			Data: entries,
+		}
+		writeJSON(c, http.StatusOK, response)
+	})
+}
+
+// getAuditFilter generates a function that configures the audit filter for a given Gin request context.
+//
+// The filter is configured from the "actor", "action", "item_id", "request_id", "trace_id",
+// "since" and "until" query parameters. Timestamps are expected in RFC 3339 format.
+// It returns an error if a query parameter can not be parsed.
+func getAuditFilter(c *gin.Context) (persistence.AuditFilterConfigurator, error) {
+	filter := persistence.AuditFilter{
+		Actor:     c.Query("actor"),
+		Action:    c.Query("action"),
+		RequestID: c.Query("request_id"),
+		TraceID:   c.Query("trace_id"),
+	}
+
+	if value := c.Query("item_id"); value != "" {
+		itemID, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, err
+		}
+		filter.ItemID = uint(itemID)
+	}
+
+	if value := c.Query("since"); value != "" {
+		since, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return nil, err
+		}
+		filter.Since = since
+	}
+
+	if value := c.Query("until"); value != "" {
+		until, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return nil, err
+		}
+		filter.Until = until
+	}
+
+	return func(options *persistence.AuditFilter) {
+		*options = filter
+	}, nil
+}
@@ -0,0 +1,51 @@
+package api_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"todo-api-go/api"
+	"todo-api-go/entities"
+	"todo-api-go/persistence"
+	"todo-api-go/testsupport"
+)
+
+func TestAuditLog(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testsupport.CreateTestDatabase(t)
+	router := gin.Default()
+	router.Use(api.RequestID())
+	api.RegisterRoutes(router, persistence.New(db), &MockAuthorizer{})
+	api.RegisterAuditRoutes(router, persistence.NewAuditManager(db), &MockAuthorizer{})
+
+	marshalled, _ := json.Marshal(&entities.ToDoItemEntity{Description: "Audited Todo Item"})
+	req, _ := http.NewRequest("POST", "/api/todo", bytes.NewBuffer(marshalled))
+	req.Header.Set(api.RequestIDHeader, "audited-request")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	assert.Equalf(201, recorder.Code, "Expected successful response")
+	assert.Equalf("audited-request", recorder.Header().Get(api.RequestIDHeader), "request ID should be echoed")
+
+	req, _ = http.NewRequest("GET", "/api/audit?request_id=audited-request&action=todo.create", nil)
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	assert.Equalf(200, recorder.Code, "Expected successful response")
+
+	var response api.AuditResponse
+	err := json.Unmarshal(recorder.Body.Bytes(), &response)
+	assert.Nilf(err, "error should be nil")
+	assert.Equalf(1, int(response.Meta.Total), "total length should be 1")
+	assert.Equalf(persistence.SystemActor, response.Data[0].Actor, "actor should match")
+
+	req, _ = http.NewRequest("GET", "/api/audit?since=yesterday", nil)
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	assert.Equalf(400, recorder.Code, "Expected bad request response")
+}
@@ -0,0 +1,267 @@
+package api
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+	"github.com/kelseyhightower/envconfig"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Content codings supported by the compression middleware
+const (
+	EncodingBrotli = "br"
+	EncodingZstd   = "zstd"
+	EncodingGzip   = "gzip"
+)
+
+type CompressionParameters struct {
+	// Content codings offered to clients, in order of preference
+	Encodings []string `default:"br,zstd,gzip"`
+
+	// Responses smaller than this many bytes are sent uncompressed
+	MinSize int `split_words:"true" default:"1024"`
+}
+
+// NewCompressionFromEnv creates the compression middleware configured from the
+// "COMPRESSION_***" environment variables.
+//
+// Returns a gin.HandlerFunc and an error.
+func NewCompressionFromEnv() (gin.HandlerFunc, error) {
+	var params CompressionParameters
+
+	err := envconfig.Process("compression", &params)
+	if err != nil {
+		return nil, err
+	}
+
+	return Compression(params)
+}
+
+// Compression returns a gin.HandlerFunc compressing responses with the content coding
+// negotiated from the Accept-Encoding header of the request.
+//
+// The response is buffered until it reaches the minimum size, so that small responses are
+// sent as they are. Responses which already carry a content coding, partial content and
+// media types that are compressed by nature, such as images, are not compressed either.
+// Flushing the response, as streaming handlers do, starts compression regardless of its size.
+//
+// params: The offered content codings and the size threshold.
+// Returns a gin.HandlerFunc and an error if a content coding is not supported.
+func Compression(params CompressionParameters) (gin.HandlerFunc, error) {
+	var encodings []string
+	for _, encoding := range params.Encodings {
+		encoding = strings.ToLower(strings.TrimSpace(encoding))
+		switch encoding {
+		case EncodingBrotli, EncodingZstd, EncodingGzip:
+			encodings = append(encodings, encoding)
+		case "":
+		default:
+			return nil, fmt.Errorf("unsupported content coding %q", encoding)
+		}
+	}
+
+	return func(c *gin.Context) {
+		c.Writer.Header().Add("Vary", "Accept-Encoding")
+
+		encoding := negotiateEncoding(c.GetHeader("Accept-Encoding"), encodings)
+		if encoding == "" || c.Request.Method == http.MethodHead || c.GetHeader("Upgrade") != "" {
+			c.Next()
+			return
+		}
+
+		writer := &compressWriter{ResponseWriter: c.Writer, encoding: encoding, minSize: params.MinSize}
+		c.Writer = writer
+		defer func() {
+			writer.finish()
+			c.Writer = writer.ResponseWriter
+		}()
+
+		c.Next()
+	}, nil
+}
+
+// negotiateEncoding selects the content coding with the highest quality value in the
+// Accept-Encoding header among the offered ones, preferring earlier offers on ties.
+//
+// It returns an empty string if none of the offered content codings is acceptable.
+func negotiateEncoding(header string, offered []string) string {
+	qualities := map[string]float64{}
+	wildcard := -1.0
+
+	for _, entry := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(entry, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		quality := 1.0
+		if key, value, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(key) == "q" {
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil {
+				continue
+			}
+			quality = parsed
+		}
+
+		if name == "*" {
+			wildcard = quality
+		} else {
+			qualities[name] = quality
+		}
+	}
+
+	best, bestQuality := "", 0.0
+	for _, encoding := range offered {
+		quality, ok := qualities[encoding]
+		if !ok {
+			quality = wildcard
+		}
+
+		if quality > bestQuality {
+			best, bestQuality = encoding, quality
+		}
+	}
+
+	return best
+}
+
+// compressible reports whether a response with the specified status and headers benefits
+// from compression.
+func compressible(status int, header http.Header) bool {
+	if status < http.StatusOK || status == http.StatusNoContent || status == http.StatusNotModified ||
+		status == http.StatusPartialContent {
+		return false
+	}
+
+	if header.Get("Content-Encoding") != "" || header.Get("Content-Range") != "" {
+		return false
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	switch {
+	case strings.HasPrefix(mediaType, "image/") && mediaType != "image/svg+xml",
+		strings.HasPrefix(mediaType, "audio/"),
+		strings.HasPrefix(mediaType, "video/"),
+		mediaType == "application/zip", mediaType == "application/gzip", mediaType == "application/zstd":
+		return false
+	}
+
+	return true
+}
+
+// compressWriter buffers the start of a response until it is known whether it is worth
+// compressing, and compresses the remainder of the response if it is.
+type compressWriter struct {
+	gin.ResponseWriter
+	encoding string
+	minSize  int
+	buffer   []byte
+	decided  bool
+	encoder  io.WriteCloser
+}
+
+// Write implements http.ResponseWriter.
+func (writer *compressWriter) Write(data []byte) (int, error) {
+	if writer.decided {
+		if writer.encoder != nil {
+			return writer.encoder.Write(data)
+		}
+		return writer.ResponseWriter.Write(data)
+	}
+
+	writer.buffer = append(writer.buffer, data...)
+	if len(writer.buffer) >= writer.minSize {
+		err := writer.decide(true)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(data), nil
+}
+
+// WriteString implements io.StringWriter.
+func (writer *compressWriter) WriteString(data string) (int, error) {
+	return writer.Write([]byte(data))
+}
+
+// Written reports whether any part of the response has been accepted, including buffered data.
+func (writer *compressWriter) Written() bool {
+	return len(writer.buffer) > 0 || writer.ResponseWriter.Written()
+}
+
+// Flush implements http.Flusher by sending the data written so far, compressing it if the
+// response is compressible.
+func (writer *compressWriter) Flush() {
+	if !writer.decided {
+		_ = writer.decide(true)
+	}
+
+	if flusher, ok := writer.encoder.(interface{ Flush() error }); ok {
+		_ = flusher.Flush()
+	}
+
+	writer.ResponseWriter.Flush()
+}
+
+// decide determines whether the response is compressed and writes the buffered data.
+func (writer *compressWriter) decide(compress bool) error {
+	writer.decided = true
+
+	header := writer.Header()
+	if compress && compressible(writer.Status(), header) {
+		header.Set("Content-Encoding", writer.encoding)
+		header.Del("Content-Length")
+		writer.encoder = newEncoder(writer.encoding, writer.ResponseWriter)
+	}
+
+	buffered := writer.buffer
+	writer.buffer = nil
+	if len(buffered) == 0 {
+		return nil
+	}
+
+	var err error
+	if writer.encoder != nil {
+		_, err = writer.encoder.Write(buffered)
+	} else {
+		_, err = writer.ResponseWriter.Write(buffered)
+	}
+
+	return err
+}
+
+// finish sends a response that remained below the size threshold as it is, or completes
+// the compressed response.
+func (writer *compressWriter) finish() {
+	if !writer.decided {
+		_ = writer.decide(false)
+	}
+
+	if writer.encoder != nil {
+		_ = writer.encoder.Close()
+	}
+}
+
+// newEncoder creates a writer compressing into w with the specified content coding.
+func newEncoder(encoding string, w io.Writer) io.WriteCloser {
+	switch encoding {
+	case EncodingBrotli:
+		return brotli.NewWriterLevel(w, brotli.DefaultCompression)
+	case EncodingZstd:
+		// Options are constant and valid, so creating the encoder can not fail
+		encoder, _ := zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.SpeedDefault))
+		return encoder
+	default:
+		return gzip.NewWriter(w)
+	}
+}
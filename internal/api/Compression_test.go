@@ -0,0 +1,115 @@
+package api_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+
+	"todo-api-go/api"
+)
+
+func compressionRouter(t *testing.T, body string) *gin.Engine {
+	compression, err := api.Compression(api.CompressionParameters{
+		Encodings: []string{api.EncodingBrotli, api.EncodingZstd, api.EncodingGzip},
+		MinSize:   64,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := gin.New()
+	router.Use(compression)
+	router.GET("/text", func(c *gin.Context) {
+		c.String(http.StatusOK, body)
+	})
+	router.GET("/image", func(c *gin.Context) {
+		c.Data(http.StatusOK, "image/png", []byte(body))
+	})
+
+	return router
+}
+
+func TestCompression(t *testing.T) {
+	assert := assert.New(t)
+
+	body := strings.Repeat("compressible ", 100)
+	router := compressionRouter(t, body)
+
+	decoders := map[string]func(io.Reader) (io.Reader, error){
+		"gzip": func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+		"br":   func(r io.Reader) (io.Reader, error) { return brotli.NewReader(r), nil },
+		"zstd": func(r io.Reader) (io.Reader, error) { return zstd.NewReader(r) },
+	}
+
+	for _, test := range []struct {
+		accept   string
+		encoding string
+	}{
+		{"gzip", "gzip"},
+		{"gzip, deflate, br", "br"},
+		{"br;q=0.5, zstd", "zstd"},
+		{"*", "br"},
+		{"*;q=0.1, gzip;q=0.5", "gzip"},
+		{"identity", ""},
+		{"br;q=0, gzip;q=0", ""},
+	} {
+		req, _ := http.NewRequest("GET", "/text", nil)
+		req.Header.Set("Accept-Encoding", test.accept)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+
+		assert.Equalf(200, recorder.Code, "Expected successful response")
+		assert.Equalf(test.encoding, recorder.Header().Get("Content-Encoding"), "encoding for %q should match", test.accept)
+		assert.Equalf("Accept-Encoding", recorder.Header().Get("Vary"), "responses should vary by encoding")
+
+		if test.encoding == "" {
+			assert.Equalf(body, recorder.Body.String(), "body should not be compressed for %q", test.accept)
+			continue
+		}
+
+		assert.Lessf(recorder.Body.Len(), len(body), "body should be compressed for %q", test.accept)
+		reader, err := decoders[test.encoding](bytes.NewReader(recorder.Body.Bytes()))
+		assert.Nilf(err, "error should be nil, not %s", err)
+		decoded, err := io.ReadAll(reader)
+		assert.Nilf(err, "error should be nil, not %s", err)
+		assert.Equalf(body, string(decoded), "decoded body should match for %q", test.accept)
+	}
+}
+
+func TestCompressionThreshold(t *testing.T) {
+	assert := assert.New(t)
+
+	router := compressionRouter(t, "small")
+
+	req, _ := http.NewRequest("GET", "/text", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+
+	assert.Equalf("", recorder.Header().Get("Content-Encoding"), "small responses should not be compressed")
+	assert.Equalf("small", recorder.Body.String(), "body should match")
+
+	router = compressionRouter(t, strings.Repeat("x", 1000))
+
+	req, _ = http.NewRequest("GET", "/image", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+
+	assert.Equalf("", recorder.Header().Get("Content-Encoding"), "images should not be compressed")
+	assert.Equalf(1000, recorder.Body.Len(), "body should match")
+}
+
+func TestUnsupportedEncoding(t *testing.T) {
+	_, err := api.Compression(api.CompressionParameters{Encodings: []string{"deflate"}})
+	assert.NotNilf(t, err, "unsupported encodings should be rejected")
+}
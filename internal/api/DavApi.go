@@ -0,0 +1,1075 @@
+package api
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"todo-api-go/entities"
+	"todo-api-go/persistence"
+	"todo-api-go/reqctx"
+)
+
+// Paths of the CalDAV resources: the principal, which doubles as calendar home, and the
+// calendar collection holding the items
+const (
+	davHomePath     = "/dav/"
+	davCalendarPath = "/dav/todo/"
+)
+
+// Namespaces of the properties and reports served over CalDAV
+const (
+	davNamespace            = "DAV:"
+	calDavNamespace         = "urn:ietf:params:xml:ns:caldav"
+	calendarServerNamespace = "http://calendarserver.org/ns/"
+)
+
+// Prefix of the sync tokens of the calendar collection
+const davSyncTokenPrefix = "urn:x-todo-api-go:sync:"
+
+// Media type of calendar objects, which hold a single VTODO component
+const davObjectContentType = MIMECalendar + "; charset=utf-8; component=VTODO"
+
+// Largest calendar object accepted by PUT
+const maxCalendarObjectSize = 1 << 20
+
+// Realm of the basic authentication challenge sent to CalDAV clients
+const davRealm = "todo-api-go"
+
+// Methods allowed on the CalDAV resources
+const davAllowedMethods = "OPTIONS, GET, HEAD, PUT, DELETE, PROPFIND, REPORT"
+
+// Prefixes of the namespaces declared on every multistatus response
+var davPrefixes = map[string]string{
+	davNamespace:            "D",
+	calDavNamespace:         "C",
+	calendarServerNamespace: "CS",
+}
+
+// Names of the properties served over CalDAV
+var (
+	davResourceType             = xml.Name{Space: davNamespace, Local: "resourcetype"}
+	davDisplayName              = xml.Name{Space: davNamespace, Local: "displayname"}
+	davCurrentUserPrincipal     = xml.Name{Space: davNamespace, Local: "current-user-principal"}
+	davPrincipalURL             = xml.Name{Space: davNamespace, Local: "principal-URL"}
+	davCurrentUserPrivilegeSet  = xml.Name{Space: davNamespace, Local: "current-user-privilege-set"}
+	davSupportedReportSet       = xml.Name{Space: davNamespace, Local: "supported-report-set"}
+	davSyncTokenProperty        = xml.Name{Space: davNamespace, Local: "sync-token"}
+	davGetETag                  = xml.Name{Space: davNamespace, Local: "getetag"}
+	davGetContentType           = xml.Name{Space: davNamespace, Local: "getcontenttype"}
+	davGetLastModified          = xml.Name{Space: davNamespace, Local: "getlastmodified"}
+	calDavCalendarHomeSet       = xml.Name{Space: calDavNamespace, Local: "calendar-home-set"}
+	calDavSupportedComponentSet = xml.Name{Space: calDavNamespace, Local: "supported-calendar-component-set"}
+	calDavCalendarData          = xml.Name{Space: calDavNamespace, Local: "calendar-data"}
+	calendarServerGetCTag       = xml.Name{Space: calendarServerNamespace, Local: "getctag"}
+)
+
+// Properties returned for allprop requests, by resource. Calendar data is only returned when
+// requested explicitly.
+var (
+	davHomeProperties     = []xml.Name{davResourceType, davDisplayName, davCurrentUserPrincipal, davPrincipalURL, calDavCalendarHomeSet}
+	davCalendarProperties = []xml.Name{davResourceType, davDisplayName, davCurrentUserPrincipal, calDavSupportedComponentSet, calendarServerGetCTag, davSyncTokenProperty}
+	davObjectProperties   = []xml.Name{davResourceType, davGetETag, davGetContentType, davGetLastModified}
+)
+
+// davPropertyRequest is the body of a PROPFIND request, or the part of a REPORT request
+// selecting the properties to return.
+type davPropertyRequest struct {
+	AllProp  *struct{}        `xml:"DAV: allprop"`
+	PropName *struct{}        `xml:"DAV: propname"`
+	Prop     *davPropertyList `xml:"DAV: prop"`
+}
+
+// davPropertyList lists the names of properties, ignoring any content such as the component
+// selection of calendar-data.
+type davPropertyList struct {
+	Properties []struct {
+		XMLName xml.Name
+	} `xml:",any"`
+}
+
+// davReport is the body of a REPORT request: a calendar-query, calendar-multiget or
+// sync-collection report.
+type davReport struct {
+	XMLName xml.Name
+	davPropertyRequest
+
+	// Component filter of calendar-query
+	Filter *davCompFilter `xml:"urn:ietf:params:xml:ns:caldav filter>comp-filter"`
+
+	// Resources of calendar-multiget
+	Hrefs []string `xml:"DAV: href"`
+
+	// Token of sync-collection
+	SyncToken string `xml:"DAV: sync-token"`
+}
+
+// davCompFilter is a comp-filter of a calendar-query.
+type davCompFilter struct {
+	Name         string          `xml:"name,attr"`
+	IsNotDefined *struct{}       `xml:"urn:ietf:params:xml:ns:caldav is-not-defined"`
+	TimeRange    *davTimeRange   `xml:"urn:ietf:params:xml:ns:caldav time-range"`
+	CompFilters  []davCompFilter `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+	PropFilters  []davPropFilter `xml:"urn:ietf:params:xml:ns:caldav prop-filter"`
+}
+
+// davPropFilter is a prop-filter of a calendar-query.
+type davPropFilter struct {
+	Name         string        `xml:"name,attr"`
+	IsNotDefined *struct{}     `xml:"urn:ietf:params:xml:ns:caldav is-not-defined"`
+	TextMatch    *davTextMatch `xml:"urn:ietf:params:xml:ns:caldav text-match"`
+}
+
+// davTextMatch is a text-match of a prop-filter.
+type davTextMatch struct {
+	Value           string `xml:",chardata"`
+	NegateCondition string `xml:"negate-condition,attr"`
+}
+
+// davTimeRange is a time-range of a comp-filter, whose bounds are DATE-TIME values in UTC.
+type davTimeRange struct {
+	Start string `xml:"start,attr"`
+	End   string `xml:"end,attr"`
+}
+
+// davProperty is a property of a resource, whose value is XML content.
+type davProperty struct {
+	Name  xml.Name
+	Value string
+}
+
+// davResponse describes a resource in a multistatus response: either its properties, or its
+// status if it could not be found.
+type davResponse struct {
+	Href     string
+	Found    []davProperty
+	NotFound []xml.Name
+	Status   int
+}
+
+// davProperties resolves a property of a resource to its XML content, reporting whether the
+// resource has the property.
+type davProperties func(name xml.Name) (string, bool)
+
+// RegisterDavRoutes registers the routes of the CalDAV server exposing ToDo items as VTODO
+// components of a calendar, for use by calendar applications.
+//
+// The calendar supports PROPFIND, the calendar-query, calendar-multiget and sync-collection
+// reports, and GET, PUT and DELETE of its objects. Clients are challenged for basic
+// authentication, as calendar applications commonly support nothing else.
+//
+// gin: The Gin engine to register the routes with.
+// mgr: The ToDo entity manager.
+// authFactory: The factory for the authorization middleware.
+// middleware: Handlers to run on every route once the caller has been authorized.
+// Returns the registered Gin engine.
+func RegisterDavRoutes(gin *gin.Engine, mgr *persistence.ToDoEntityManager, authFactory AuthorizerFactory, middleware ...gin.HandlerFunc) *gin.Engine {
+	for _, path := range []string{davHomePath, davCalendarPath, davCalendarPath + ":name"} {
+		gin.OPTIONS(path, davOptionsHandler())
+	}
+
+	gin.GET("/.well-known/caldav", davWellKnownHandler())
+	gin.Handle("PROPFIND", "/.well-known/caldav", davWellKnownHandler())
+
+	gin.Handle("PROPFIND", davHomePath, davSecured(authFactory, "retrieve", middleware, propfindHomeHandler(mgr))...)
+	gin.Handle("PROPFIND", davCalendarPath, davSecured(authFactory, "retrieve", middleware, propfindCalendarHandler(mgr))...)
+	gin.Handle("PROPFIND", davCalendarPath+":name", davSecured(authFactory, "retrieve", middleware, propfindObjectHandler(mgr))...)
+	gin.Handle("REPORT", davCalendarPath, davSecured(authFactory, "retrieve", middleware, reportHandler(mgr))...)
+
+	gin.GET(davCalendarPath+":name", davSecured(authFactory, "retrieve", middleware, getObjectHandler(mgr))...)
+	gin.HEAD(davCalendarPath+":name", davSecured(authFactory, "retrieve", middleware, getObjectHandler(mgr))...)
+	gin.DELETE(davCalendarPath+":name", davSecured(authFactory, "delete", middleware, deleteObjectHandler(mgr))...)
+
+	// PUT creates or updates objects, which is not known before the object has been looked up
+	gin.PUT(davCalendarPath+":name", davSecured(authFactory, "update", requiringRole(authFactory, "create", middleware), putObjectHandler(mgr))...)
+
+	return gin
+}
+
+// davSecured assembles the handler chain of a CalDAV route like secured does, preceded by the
+// authentication challenge.
+func davSecured(authFactory AuthorizerFactory, role string, middleware []gin.HandlerFunc, handler gin.HandlerFunc) []gin.HandlerFunc {
+	return append([]gin.HandlerFunc{davChallenge()}, secured(authFactory, role, middleware, handler)...)
+}
+
+// requiringRole prepends the authorization check for an additional role to route middleware.
+func requiringRole(authFactory AuthorizerFactory, role string, middleware []gin.HandlerFunc) []gin.HandlerFunc {
+	return append([]gin.HandlerFunc{authFactory.RequiresRole(role)}, middleware...)
+}
+
+// davChallenge creates a HandlerFunc adding a basic authentication challenge to unauthorized
+// responses, which prompts calendar applications for credentials.
+func davChallenge() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Writer = &challengeWriter{ResponseWriter: c.Writer}
+		c.Next()
+	}
+}
+
+// challengeWriter adds the basic authentication challenge when the status is set to 401.
+type challengeWriter struct {
+	gin.ResponseWriter
+}
+
+// WriteHeader adds the challenge to unauthorized responses.
+func (writer *challengeWriter) WriteHeader(status int) {
+	if status == http.StatusUnauthorized {
+		writer.Header().Set("WWW-Authenticate", `Basic realm="`+davRealm+`", charset="UTF-8"`)
+	}
+
+	writer.ResponseWriter.WriteHeader(status)
+}
+
+// davOptionsHandler creates a HandlerFunc advertising the DAV capabilities of the server.
+//
+// It does not require authentication, as clients probe the capabilities before authenticating.
+func davOptionsHandler() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		c.Header("DAV", "1, 3, calendar-access")
+		c.Header("Allow", davAllowedMethods)
+		c.Status(http.StatusOK)
+	})
+}
+
+// davWellKnownHandler creates a HandlerFunc redirecting the well-known CalDAV location to the
+// principal, as described by RFC 6764.
+func davWellKnownHandler() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		c.Redirect(http.StatusMovedPermanently, davHomePath)
+	})
+}
+
+// propfindHomeHandler creates a HandlerFunc for PROPFIND requests on the principal, which is
+// also the calendar home. With depth 1, the calendar collection is described as well.
+//
+// It takes a manager of type *persistence.ToDoEntityManager as a parameter.
+// The function returns a gin.HandlerFunc.
+func propfindHomeHandler(manager *persistence.ToDoEntityManager) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		request, ok := readPropertyRequest(c)
+		if !ok {
+			return
+		}
+
+		principal := reqctx.PrincipalFrom(c.Request.Context())
+		responses := []davResponse{describe(davHomePath, homeProperties(principal), davHomeProperties, request)}
+
+		if davDepth(c) > 0 {
+			token, err := manager.WithContext(c.Request.Context()).SyncToken()
+			if err != nil {
+				writeError(c, err)
+				return
+			}
+
+			responses = append(responses, describe(davCalendarPath, calendarProperties(principal, token), davCalendarProperties, request))
+		}
+
+		writeMultistatus(c, responses, "")
+	})
+}
+
+// propfindCalendarHandler creates a HandlerFunc for PROPFIND requests on the calendar collection.
+// With depth 1, every visible item is described as well.
+//
+// It takes a manager of type *persistence.ToDoEntityManager as a parameter.
+// The function returns a gin.HandlerFunc.
+func propfindCalendarHandler(manager *persistence.ToDoEntityManager) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		request, ok := readPropertyRequest(c)
+		if !ok {
+			return
+		}
+
+		mgr := manager.WithContext(c.Request.Context())
+		principal := reqctx.PrincipalFrom(c.Request.Context())
+
+		token, err := mgr.SyncToken()
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		responses := []davResponse{describe(davCalendarPath, calendarProperties(principal, token), davCalendarProperties, request)}
+
+		if davDepth(c) > 0 {
+			objects, err := findCalendarObjects(mgr, persistence.ItemFilter{}, nil)
+			if err != nil {
+				writeError(c, err)
+				return
+			}
+
+			for i := range objects {
+				responses = append(responses, describe(objectHref(objects[i].Name), objectProperties(principal, &objects[i]), davObjectProperties, request))
+			}
+		}
+
+		writeMultistatus(c, responses, "")
+	})
+}
+
+// propfindObjectHandler creates a HandlerFunc for PROPFIND requests on a calendar object.
+//
+// It takes a manager of type *persistence.ToDoEntityManager as a parameter.
+// The function returns a gin.HandlerFunc.
+func propfindObjectHandler(manager *persistence.ToDoEntityManager) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		request, ok := readPropertyRequest(c)
+		if !ok {
+			return
+		}
+
+		object, err := manager.WithContext(c.Request.Context()).FindCalendarObject(c.Param("name"))
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		principal := reqctx.PrincipalFrom(c.Request.Context())
+		writeMultistatus(c, []davResponse{describe(objectHref(object.Name), objectProperties(principal, object), davObjectProperties, request)}, "")
+	})
+}
+
+// reportHandler creates a HandlerFunc for REPORT requests on the calendar collection.
+//
+// The calendar-query report supports the VTODO component filter with time ranges, which are
+// matched against the due date, and the COMPLETED, STATUS and SUMMARY property filters. Other
+// property filters are ignored, so that the report may contain more objects than requested.
+//
+// It takes a manager of type *persistence.ToDoEntityManager as a parameter.
+// The function returns a gin.HandlerFunc.
+func reportHandler(manager *persistence.ToDoEntityManager) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		var report davReport
+		err := readDavBody(c, &report)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid report: " + err.Error()})
+			return
+		}
+
+		mgr := manager.WithContext(c.Request.Context())
+		principal := reqctx.PrincipalFrom(c.Request.Context())
+
+		switch report.XMLName {
+		case xml.Name{Space: calDavNamespace, Local: "calendar-query"}:
+			var responses []davResponse
+
+			filter, matches, ok := queryFilter(report.Filter)
+			if ok {
+				objects, err := findCalendarObjects(mgr, filter, matches)
+				if err != nil {
+					writeError(c, err)
+					return
+				}
+
+				for i := range objects {
+					responses = append(responses, describe(objectHref(objects[i].Name), objectProperties(principal, &objects[i]), davObjectProperties, report.davPropertyRequest))
+				}
+			}
+
+			writeMultistatus(c, responses, "")
+
+		case xml.Name{Space: calDavNamespace, Local: "calendar-multiget"}:
+			responses := make([]davResponse, 0, len(report.Hrefs))
+			for _, href := range report.Hrefs {
+				object, err := findCalendarObjectByHref(mgr, href)
+				switch {
+				case err == nil:
+					responses = append(responses, describe(href, objectProperties(principal, object), davObjectProperties, report.davPropertyRequest))
+				case errors.Is(err, persistence.ErrNotFound):
+					responses = append(responses, davResponse{Href: href, Status: http.StatusNotFound})
+				default:
+					writeError(c, err)
+					return
+				}
+			}
+
+			writeMultistatus(c, responses, "")
+
+		case xml.Name{Space: davNamespace, Local: "sync-collection"}:
+			syncCollection(c, mgr, &report)
+
+		default:
+			writeDavError(c, http.StatusForbidden, "<D:supported-report/>")
+		}
+	})
+}
+
+// syncCollection responds to a sync-collection report with the objects changed and deleted
+// since the sync token of the report, as described by RFC 6578.
+func syncCollection(c *gin.Context, mgr *persistence.ToDoEntityManager, report *davReport) {
+	since, ok := parseSyncToken(report.SyncToken)
+	if !ok {
+		writeDavError(c, http.StatusForbidden, "<D:valid-sync-token/>")
+		return
+	}
+
+	changes, err := mgr.FindChanges(since)
+	if errors.Is(err, persistence.ErrInvalid) {
+		writeDavError(c, http.StatusForbidden, "<D:valid-sync-token/>")
+		return
+	}
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	objects, err := mgr.CalendarObjects(changes.Changed)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	deletedIDs := make([]uint, len(changes.Deleted))
+	for i := range changes.Deleted {
+		deletedIDs[i] = changes.Deleted[i].ID
+	}
+
+	deleted, err := mgr.CalendarObjectNames(deletedIDs)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	principal := reqctx.PrincipalFrom(c.Request.Context())
+	responses := make([]davResponse, 0, len(objects)+len(deleted))
+	for i := range objects {
+		responses = append(responses, describe(objectHref(objects[i].Name), objectProperties(principal, &objects[i]), davObjectProperties, report.davPropertyRequest))
+	}
+	for _, name := range deleted {
+		responses = append(responses, davResponse{Href: objectHref(name), Status: http.StatusNotFound})
+	}
+
+	writeMultistatus(c, responses, davSyncToken(changes.Token))
+}
+
+// getObjectHandler creates a HandlerFunc for retrieving a calendar object as an iCalendar document.
+//
+// It takes a manager of type *persistence.ToDoEntityManager as a parameter.
+// The function returns a gin.HandlerFunc.
+func getObjectHandler(manager *persistence.ToDoEntityManager) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		object, err := manager.WithContext(c.Request.Context()).FindCalendarObject(c.Param("name"))
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		etag := objectETag(&object.Item)
+		c.Header("ETag", etag)
+		if modified := lastModified(&object.Item); !modified.IsZero() {
+			c.Header("Last-Modified", modified.UTC().Format(http.TimeFormat))
+		}
+
+		if noneMatch := c.GetHeader("If-None-Match"); noneMatch != "" && etagMatches(noneMatch, etag) {
+			c.Status(http.StatusNotModified)
+			return
+		}
+
+		c.Data(http.StatusOK, davObjectContentType, []byte(calendarData(object)))
+	})
+}
+
+// putObjectHandler creates a HandlerFunc for creating or updating a calendar object from an
+// iCalendar document holding a single VTODO component.
+//
+// The If-Match and If-None-Match headers are honored, so that clients can avoid overwriting
+// changes of others. No ETag is returned, as the stored object differs from the document.
+//
+// It takes a manager of type *persistence.ToDoEntityManager as a parameter.
+// The function returns a gin.HandlerFunc.
+func putObjectHandler(manager *persistence.ToDoEntityManager) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		rows, err := parseCalendar(http.MaxBytesReader(c.Writer, c.Request.Body, maxCalendarObjectSize))
+		if err != nil {
+			writeDavError(c, http.StatusBadRequest, "<C:valid-calendar-data/>")
+			return
+		}
+
+		switch {
+		case len(rows) == 0:
+			writeDavError(c, http.StatusForbidden, "<C:supported-calendar-component/>")
+			return
+		case len(rows) > 1:
+			writeDavError(c, http.StatusForbidden, "<C:valid-calendar-object-resource/>")
+			return
+		case rows[0].Err != nil:
+			writeDavError(c, http.StatusBadRequest, "<C:valid-calendar-data/>")
+			return
+		}
+
+		name := c.Param("name")
+		item := rows[0].Item
+		mgr := manager.WithContext(c.Request.Context())
+
+		var status int
+		existing, err := mgr.FindCalendarObject(name)
+		switch {
+		case err == nil:
+			etag := objectETag(&existing.Item)
+			if c.GetHeader("If-None-Match") == "*" || !etagMatches(c.GetHeader("If-Match"), etag) {
+				c.Status(http.StatusPreconditionFailed)
+				return
+			}
+
+			item.ID = existing.Item.ID
+			err = mgr.Update(&item)
+			status = http.StatusNoContent
+
+		case errors.Is(err, persistence.ErrNotFound):
+			if c.GetHeader("If-Match") != "" {
+				c.Status(http.StatusPreconditionFailed)
+				return
+			}
+
+			if item.Completed && item.CompletedAt.IsZero() {
+				item.CompletedAt = time.Now()
+			}
+
+			err = mgr.CreateCalendarObject(&persistence.CalendarObject{Name: name, UID: rows[0].UID, Item: item})
+			status = http.StatusCreated
+		}
+
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.Status(status)
+	})
+}
+
+// deleteObjectHandler creates a HandlerFunc for deleting a calendar object, honoring the
+// If-Match header.
+//
+// It takes a manager of type *persistence.ToDoEntityManager as a parameter.
+// The function returns a gin.HandlerFunc.
+func deleteObjectHandler(manager *persistence.ToDoEntityManager) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		mgr := manager.WithContext(c.Request.Context())
+
+		object, err := mgr.FindCalendarObject(c.Param("name"))
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		if !etagMatches(c.GetHeader("If-Match"), objectETag(&object.Item)) {
+			c.Status(http.StatusPreconditionFailed)
+			return
+		}
+
+		err = mgr.Delete(object.Item.ID)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	})
+}
+
+// findCalendarObjects retrieves the visible items matching a filter and an optional match
+// function as calendar objects.
+func findCalendarObjects(mgr *persistence.ToDoEntityManager, filter persistence.ItemFilter, matches func(item *entities.ToDoItemEntity) bool) ([]persistence.CalendarObject, error) {
+	var items []entities.ToDoItemEntity
+	err := mgr.Export(filter, func(item *entities.ToDoItemEntity) error {
+		if matches == nil || matches(item) {
+			items = append(items, *item)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return mgr.CalendarObjects(items)
+}
+
+// findCalendarObjectByHref retrieves the calendar object referenced by an absolute URL or path.
+func findCalendarObjectByHref(mgr *persistence.ToDoEntityManager, href string) (*persistence.CalendarObject, error) {
+	parsed, err := url.Parse(href)
+	if err != nil {
+		return nil, persistence.ErrNotFound
+	}
+
+	name, found := strings.CutPrefix(parsed.Path, davCalendarPath)
+	if !found || name == "" || strings.Contains(name, "/") {
+		return nil, persistence.ErrNotFound
+	}
+
+	return mgr.FindCalendarObject(name)
+}
+
+// queryFilter translates the component filter of a calendar-query into an item filter and a
+// function matching the conditions the item filter cannot express.
+//
+// It returns false if no calendar object can match the filter.
+func queryFilter(calendar *davCompFilter) (persistence.ItemFilter, func(item *entities.ToDoItemEntity) bool, bool) {
+	var filter persistence.ItemFilter
+	var conditions []func(item *entities.ToDoItemEntity) bool
+
+	if calendar == nil {
+		return filter, nil, true
+	}
+
+	if !strings.EqualFold(calendar.Name, "VCALENDAR") || calendar.IsNotDefined != nil {
+		return filter, nil, false
+	}
+
+	for _, component := range calendar.CompFilters {
+		if !strings.EqualFold(component.Name, "VTODO") {
+			// Calendar objects hold nothing but VTODO components
+			if component.IsNotDefined == nil {
+				return filter, nil, false
+			}
+			continue
+		}
+
+		if component.IsNotDefined != nil {
+			return filter, nil, false
+		}
+
+		if component.TimeRange != nil {
+			start, startErr := parseTimeRangeBound(component.TimeRange.Start)
+			end, endErr := parseTimeRangeBound(component.TimeRange.End)
+			if startErr != nil || endErr != nil {
+				return filter, nil, false
+			}
+
+			conditions = append(conditions, dueWithin(start, end))
+		}
+
+		for _, property := range component.PropFilters {
+			if !applyPropFilter(&filter, property) {
+				return filter, nil, false
+			}
+		}
+	}
+
+	matches := func(item *entities.ToDoItemEntity) bool {
+		for _, condition := range conditions {
+			if !condition(item) {
+				return false
+			}
+		}
+		return true
+	}
+
+	return filter, matches, true
+}
+
+// applyPropFilter restricts an item filter by a property filter of the VTODO component.
+//
+// It returns false if no calendar object can match the filter.
+func applyPropFilter(filter *persistence.ItemFilter, property davPropFilter) bool {
+	restrict := func(completed bool) bool {
+		if filter.Completed != nil && *filter.Completed != completed {
+			return false
+		}
+		filter.Completed = &completed
+		return true
+	}
+
+	negate := property.TextMatch != nil && property.TextMatch.NegateCondition == "yes"
+
+	switch strings.ToUpper(property.Name) {
+	case "COMPLETED":
+		return restrict(property.IsNotDefined == nil)
+
+	case "STATUS":
+		if property.IsNotDefined != nil {
+			return false
+		}
+		if property.TextMatch == nil {
+			return true
+		}
+
+		value := strings.ToUpper(strings.TrimSpace(property.TextMatch.Value))
+		completed := strings.Contains("COMPLETED", value) != negate
+		open := strings.Contains("NEEDS-ACTION", value) != negate
+
+		switch {
+		case completed && open:
+			return true
+		case completed || open:
+			return restrict(completed)
+		}
+		return false
+
+	case "SUMMARY":
+		if property.IsNotDefined != nil {
+			return false
+		}
+		if property.TextMatch != nil && !negate {
+			filter.Search = property.TextMatch.Value
+		}
+	}
+
+	return true
+}
+
+// dueWithin returns a function matching the items whose VTODO component overlaps a time range,
+// as defined by RFC 4791 for components with a due date only. Items without due date overlap
+// any time range. Zero bounds are unbounded.
+func dueWithin(start time.Time, end time.Time) func(item *entities.ToDoItemEntity) bool {
+	return func(item *entities.ToDoItemEntity) bool {
+		due := item.DueDate
+		if due.IsZero() {
+			return true
+		}
+
+		return (start.IsZero() || start.Before(due)) && (end.IsZero() || !end.Before(due))
+	}
+}
+
+// parseTimeRangeBound parses a bound of a time-range, leaving empty bounds unset.
+func parseTimeRangeBound(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	return time.Parse(calendarUTCFormat, value)
+}
+
+// homeProperties returns the properties of the principal, which is also the calendar home.
+func homeProperties(principal *reqctx.Principal) davProperties {
+	return func(name xml.Name) (string, bool) {
+		switch name {
+		case davResourceType:
+			return "<D:collection/><D:principal/>", true
+		case davDisplayName:
+			if principal == nil {
+				return "", false
+			}
+			if principal.Name != "" {
+				return escapeXML(principal.Name), true
+			}
+			return escapeXML(principal.Subject), true
+		case davCurrentUserPrincipal, davPrincipalURL, calDavCalendarHomeSet:
+			return hrefElement(davHomePath), true
+		case davCurrentUserPrivilegeSet:
+			return privilegeSet(principal), true
+		}
+
+		return "", false
+	}
+}
+
+// calendarProperties returns the properties of the calendar collection in the state identified
+// by a sync token.
+func calendarProperties(principal *reqctx.Principal, token uint) davProperties {
+	return func(name xml.Name) (string, bool) {
+		switch name {
+		case davResourceType:
+			return "<D:collection/><C:calendar/>", true
+		case davDisplayName:
+			return "To-Do", true
+		case davCurrentUserPrincipal:
+			return hrefElement(davHomePath), true
+		case calDavSupportedComponentSet:
+			return `<C:comp name="VTODO"/>`, true
+		case calendarServerGetCTag, davSyncTokenProperty:
+			return escapeXML(davSyncToken(token)), true
+		case davSupportedReportSet:
+			var reports strings.Builder
+			for _, report := range []string{"C:calendar-query", "C:calendar-multiget", "D:sync-collection"} {
+				reports.WriteString("<D:supported-report><D:report><" + report + "/></D:report></D:supported-report>")
+			}
+			return reports.String(), true
+		case davCurrentUserPrivilegeSet:
+			return privilegeSet(principal), true
+		}
+
+		return "", false
+	}
+}
+
+// objectProperties returns the properties of a calendar object.
+func objectProperties(principal *reqctx.Principal, object *persistence.CalendarObject) davProperties {
+	return func(name xml.Name) (string, bool) {
+		switch name {
+		case davResourceType:
+			return "", true
+		case davGetETag:
+			return escapeXML(objectETag(&object.Item)), true
+		case davGetContentType:
+			return davObjectContentType, true
+		case davGetLastModified:
+			modified := lastModified(&object.Item)
+			if modified.IsZero() {
+				return "", false
+			}
+			return modified.UTC().Format(http.TimeFormat), true
+		case calDavCalendarData:
+			return escapeXML(calendarData(object)), true
+		case davCurrentUserPrivilegeSet:
+			return privilegeSet(principal), true
+		}
+
+		return "", false
+	}
+}
+
+// privilegeSet describes the privileges granted by the roles of the principal. Without a
+// principal, authorization is not enforced and every privilege is granted.
+func privilegeSet(principal *reqctx.Principal) string {
+	privileges := []string{"D:read"}
+	if principal == nil || principal.HasRole("create") {
+		privileges = append(privileges, "D:bind")
+	}
+	if principal == nil || principal.HasRole("update") {
+		privileges = append(privileges, "D:write-content")
+	}
+	if principal == nil || principal.HasRole("delete") {
+		privileges = append(privileges, "D:unbind")
+	}
+
+	var set strings.Builder
+	for _, privilege := range privileges {
+		set.WriteString("<D:privilege><" + privilege + "/></D:privilege>")
+	}
+
+	return set.String()
+}
+
+// describe describes a resource in a multistatus response with the properties selected by
+// the request: the requested properties, the names of the properties, or all properties.
+func describe(href string, properties davProperties, all []xml.Name, request davPropertyRequest) davResponse {
+	response := davResponse{Href: href}
+
+	switch {
+	case request.PropName != nil:
+		for _, name := range all {
+			response.Found = append(response.Found, davProperty{Name: name})
+		}
+
+	case request.Prop != nil:
+		for _, property := range request.Prop.Properties {
+			if value, ok := properties(property.XMLName); ok {
+				response.Found = append(response.Found, davProperty{Name: property.XMLName, Value: value})
+			} else {
+				response.NotFound = append(response.NotFound, property.XMLName)
+			}
+		}
+
+	default:
+		for _, name := range all {
+			if value, ok := properties(name); ok {
+				response.Found = append(response.Found, davProperty{Name: name, Value: value})
+			}
+		}
+	}
+
+	return response
+}
+
+// writeMultistatus writes a multistatus response describing resources, followed by a sync
+// token unless it is empty.
+func writeMultistatus(c *gin.Context, responses []davResponse, syncToken string) {
+	var body strings.Builder
+	body.WriteString(xml.Header)
+	body.WriteString(`<D:multistatus` + davNamespaceDeclarations() + `>`)
+
+	for _, response := range responses {
+		body.WriteString("<D:response>" + hrefElement(response.Href))
+
+		if response.Status != 0 {
+			body.WriteString("<D:status>" + statusLine(response.Status) + "</D:status>")
+		}
+
+		if len(response.Found) > 0 {
+			body.WriteString("<D:propstat><D:prop>")
+			for _, property := range response.Found {
+				writeDavElement(&body, property.Name, property.Value)
+			}
+			body.WriteString("</D:prop><D:status>" + statusLine(http.StatusOK) + "</D:status></D:propstat>")
+		}
+
+		if len(response.NotFound) > 0 {
+			body.WriteString("<D:propstat><D:prop>")
+			for _, name := range response.NotFound {
+				writeDavElement(&body, name, "")
+			}
+			body.WriteString("</D:prop><D:status>" + statusLine(http.StatusNotFound) + "</D:status></D:propstat>")
+		}
+
+		body.WriteString("</D:response>")
+	}
+
+	if syncToken != "" {
+		body.WriteString("<D:sync-token>" + escapeXML(syncToken) + "</D:sync-token>")
+	}
+
+	body.WriteString("</D:multistatus>\n")
+
+	c.Data(http.StatusMultiStatus, gin.MIMEXML+"; charset=utf-8", []byte(body.String()))
+}
+
+// writeDavError writes a DAV error response reporting the failed precondition, an element
+// in one of the namespaces declared on every response.
+func writeDavError(c *gin.Context, status int, condition string) {
+	body := xml.Header + `<D:error` + davNamespaceDeclarations() + `>` + condition + "</D:error>\n"
+	c.Data(status, gin.MIMEXML+"; charset=utf-8", []byte(body))
+}
+
+// writeDavElement writes an element with XML content, using the declared prefix of its
+// namespace or declaring the namespace on the element.
+func writeDavElement(body *strings.Builder, name xml.Name, value string) {
+	prefix, declared := davPrefixes[name.Space]
+	declaration := ""
+	if !declared {
+		prefix = "X"
+		declaration = ` xmlns:X="` + escapeXML(name.Space) + `"`
+	}
+
+	element := prefix + ":" + name.Local
+	if value == "" {
+		body.WriteString("<" + element + declaration + "/>")
+		return
+	}
+
+	body.WriteString("<" + element + declaration + ">" + value + "</" + element + ">")
+}
+
+// davNamespaceDeclarations declares the prefixes of davPrefixes.
+func davNamespaceDeclarations() string {
+	return ` xmlns:D="` + davNamespace + `" xmlns:C="` + calDavNamespace + `" xmlns:CS="` + calendarServerNamespace + `"`
+}
+
+// readPropertyRequest reads the body of a PROPFIND request, defaulting to all properties if
+// the body is empty. It responds with 400 Bad Request and returns false if the body is malformed.
+func readPropertyRequest(c *gin.Context) (davPropertyRequest, bool) {
+	var request davPropertyRequest
+
+	err := readDavBody(c, &request)
+	if err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body: " + err.Error()})
+		return request, false
+	}
+
+	return request, true
+}
+
+// readDavBody decodes the XML body of a request. It returns io.EOF if the body is empty.
+func readDavBody(c *gin.Context, v any) error {
+	if c.Request.Body == nil {
+		return io.EOF
+	}
+
+	return xml.NewDecoder(http.MaxBytesReader(c.Writer, c.Request.Body, maxCalendarObjectSize)).Decode(v)
+}
+
+// davDepth returns the depth of a PROPFIND request. Infinite depth is treated as depth 1, which
+// covers every resource of the calendar.
+func davDepth(c *gin.Context) int {
+	if c.GetHeader("Depth") == "0" {
+		return 0
+	}
+
+	return 1
+}
+
+// davSyncToken formats a sync token of the persistence layer as a sync token URI.
+func davSyncToken(token uint) string {
+	return davSyncTokenPrefix + strconv.FormatUint(uint64(token), 10)
+}
+
+// parseSyncToken parses a sync token URI, mapping the empty token of an initial
+// synchronization onto 0. It returns false if the token was not issued by davSyncToken.
+func parseSyncToken(value string) (uint, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, true
+	}
+
+	digits, found := strings.CutPrefix(value, davSyncTokenPrefix)
+	if !found {
+		return 0, false
+	}
+
+	token, err := strconv.ParseUint(digits, 10, 0)
+	if err != nil || token == 0 {
+		return 0, false
+	}
+
+	return uint(token), true
+}
+
+// objectHref returns the path of a calendar object.
+func objectHref(name string) string {
+	return davCalendarPath + url.PathEscape(name)
+}
+
+// objectETag returns the entity tag of a calendar object, which changes with every update of
+// its item.
+func objectETag(item *entities.ToDoItemEntity) string {
+	return fmt.Sprintf(`"%d-%d-%d"`, item.ID, item.UpdatedAt.Unix(), item.UpdatedAt.Nanosecond())
+}
+
+// etagMatches reports whether an If-Match or If-None-Match header matches an entity tag.
+// Empty headers and "*" match any entity tag.
+func etagMatches(header string, etag string) bool {
+	if header == "" {
+		return true
+	}
+
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// lastModified returns the time an item was last modified, or zero if it is unknown.
+func lastModified(item *entities.ToDoItemEntity) time.Time {
+	if !item.UpdatedAt.IsZero() {
+		return item.UpdatedAt
+	}
+
+	return item.CreatedAt
+}
+
+// calendarData returns the iCalendar document of a calendar object.
+func calendarData(object *persistence.CalendarObject) string {
+	uid := object.UID
+	if uid == "" {
+		uid = calendarUID(object.Item.ID)
+	}
+
+	// Writing to a strings.Builder cannot fail
+	var data strings.Builder
+	encoder := newCalendarEncoder(&data)
+	_ = encoder.Begin()
+	_ = encoder.EncodeWithUID(&object.Item, uid)
+	_ = encoder.End()
+
+	return data.String()
+}
+
+// hrefElement returns a DAV:href element referencing a path.
+func hrefElement(path string) string {
+	return "<D:href>" + escapeXML(path) + "</D:href>"
+}
+
+// statusLine returns the HTTP status line of a status code, as used in multistatus responses.
+func statusLine(status int) string {
+	return fmt.Sprintf("HTTP/1.1 %d %s", status, http.StatusText(status))
+}
+
+// escapeXML escapes text for use in XML content and attribute values.
+func escapeXML(value string) string {
+	var escaped strings.Builder
+	_ = xml.EscapeText(&escaped, []byte(value))
+	return escaped.String()
+}
@@ -0,0 +1,212 @@
+package api_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"todo-api-go/api"
+	"todo-api-go/entities"
+	"todo-api-go/persistence"
+	"todo-api-go/testsupport"
+)
+
+type UnauthorizedAuthorizer struct {
+}
+
+func (unauthorized *UnauthorizedAuthorizer) RequiresRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+	}
+}
+
+const calendarObject = "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//test//EN\r\n" +
+	"BEGIN:VTODO\r\nUID:abc@example.com\r\nSUMMARY:From the calendar\r\nDUE:20250301T120000Z\r\nEND:VTODO\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestDavDiscovery(t *testing.T) {
+	assert := assert.New(t)
+
+	mgr := testsupport.CreateTestManager(t)
+
+	req, _ := http.NewRequest("OPTIONS", "/dav/todo/", nil)
+	recorder := makeDavRequest(mgr, req, &UnauthorizedAuthorizer{})
+	assert.Equalf(200, recorder.Code, "Expected successful response")
+	assert.Containsf(recorder.Header().Get("DAV"), "calendar-access", "calendar access should be advertised")
+
+	req, _ = http.NewRequest("PROPFIND", "/dav/todo/", nil)
+	recorder = makeDavRequest(mgr, req, &UnauthorizedAuthorizer{})
+	assert.Equalf(401, recorder.Code, "Expected unauthorized response")
+	assert.Containsf(recorder.Header().Get("WWW-Authenticate"), "Basic", "clients should be challenged")
+
+	req, _ = http.NewRequest("PROPFIND", "/.well-known/caldav", nil)
+	recorder = makeDavRequest(mgr, req, &MockAuthorizer{})
+	assert.Equalf(301, recorder.Code, "Expected redirect")
+	assert.Equalf("/dav/", recorder.Header().Get("Location"), "the principal should be the target")
+
+	req, _ = http.NewRequest("PROPFIND", "/dav/", strings.NewReader(
+		`<propfind xmlns="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav"><prop><current-user-principal/><C:calendar-home-set/><quota-used-bytes/></prop></propfind>`))
+	req.Header.Set("Depth", "0")
+	recorder = makeDavRequest(mgr, req, &MockAuthorizer{})
+	assert.Equalf(207, recorder.Code, "Expected multistatus response")
+	body := recorder.Body.String()
+	assert.Containsf(body, "<D:current-user-principal><D:href>/dav/</D:href></D:current-user-principal>", "principal should be reported")
+	assert.Containsf(body, "<C:calendar-home-set><D:href>/dav/</D:href></C:calendar-home-set>", "calendar home should be reported")
+	assert.Containsf(body, "<D:quota-used-bytes/></D:prop><D:status>HTTP/1.1 404 Not Found</D:status>", "unknown properties should not be found")
+
+	req, _ = http.NewRequest("PROPFIND", "/dav/todo/", nil)
+	req.Header.Set("Depth", "1")
+	recorder = makeDavRequest(mgr, req, &MockAuthorizer{})
+	assert.Equalf(207, recorder.Code, "Expected multistatus response")
+	body = recorder.Body.String()
+	assert.Containsf(body, `<C:supported-calendar-component-set><C:comp name="VTODO"/></C:supported-calendar-component-set>`, "VTODO should be supported")
+	assert.Containsf(body, "<D:sync-token>urn:x-todo-api-go:sync:1</D:sync-token>", "sync token should be reported")
+	assert.Equalf(11, strings.Count(body, "<D:response>"), "every item should be described")
+	assert.Containsf(body, "<D:href>/dav/todo/10.ics</D:href>", "items should be named by their ID")
+	assert.NotContainsf(body, "<C:calendar-data>", "calendar data should only be returned on request")
+}
+
+func TestDavObjects(t *testing.T) {
+	assert := assert.New(t)
+
+	mgr := testsupport.CreateTestManager(t)
+
+	req, _ := http.NewRequest("GET", "/dav/todo/3.ics", nil)
+	recorder := makeDavRequest(mgr, req, &MockAuthorizer{})
+	assert.Equalf(200, recorder.Code, "Expected successful response")
+	assert.Containsf(recorder.Body.String(), "SUMMARY:Todo Item 2\r\n", "item should be returned as VTODO")
+	etag := recorder.Header().Get("ETag")
+	assert.NotEmptyf(etag, "ETag should be set")
+
+	req, _ = http.NewRequest("GET", "/dav/todo/3.ics", nil)
+	req.Header.Set("If-None-Match", etag)
+	recorder = makeDavRequest(mgr, req, &MockAuthorizer{})
+	assert.Equalf(304, recorder.Code, "Expected not modified response")
+
+	req, _ = http.NewRequest("PUT", "/dav/todo/3.ics", strings.NewReader(strings.Replace(calendarObject, "UID:abc@example.com", "UID:3@todo-api-go\r\nSTATUS:COMPLETED", 1)))
+	req.Header.Set("If-Match", `"stale"`)
+	recorder = makeDavRequest(mgr, req, &MockAuthorizer{})
+	assert.Equalf(412, recorder.Code, "Expected precondition failed response")
+
+	req, _ = http.NewRequest("PUT", "/dav/todo/3.ics", strings.NewReader(strings.Replace(calendarObject, "UID:abc@example.com", "UID:3@todo-api-go\r\nSTATUS:COMPLETED", 1)))
+	req.Header.Set("If-Match", etag)
+	recorder = makeDavRequest(mgr, req, &MockAuthorizer{})
+	assert.Equalf(204, recorder.Code, "Expected no content response")
+
+	item, err := mgr.FineOne(3)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf("From the calendar", item.Description, "item should be updated")
+	assert.Truef(item.Completed, "item should be completed")
+
+	req, _ = http.NewRequest("PUT", "/dav/todo/abc.ics", strings.NewReader(calendarObject))
+	req.Header.Set("If-None-Match", "*")
+	recorder = makeDavRequest(mgr, req, &MockAuthorizer{})
+	assert.Equalf(201, recorder.Code, "Expected created response")
+
+	req, _ = http.NewRequest("PUT", "/dav/todo/abc.ics", strings.NewReader(calendarObject))
+	req.Header.Set("If-None-Match", "*")
+	recorder = makeDavRequest(mgr, req, &MockAuthorizer{})
+	assert.Equalf(412, recorder.Code, "Expected precondition failed response")
+
+	req, _ = http.NewRequest("GET", "/dav/todo/abc.ics", nil)
+	recorder = makeDavRequest(mgr, req, &MockAuthorizer{})
+	assert.Equalf(200, recorder.Code, "Expected successful response")
+	assert.Containsf(recorder.Body.String(), "UID:abc@example.com\r\n", "UID of the client should be kept")
+
+	req, _ = http.NewRequest("PUT", "/dav/todo/two.ics", strings.NewReader(strings.Replace(calendarObject, "END:VCALENDAR", "BEGIN:VTODO\r\nSUMMARY:Second\r\nEND:VTODO\r\nEND:VCALENDAR", 1)))
+	recorder = makeDavRequest(mgr, req, &MockAuthorizer{})
+	assert.Equalf(403, recorder.Code, "Expected forbidden response")
+	assert.Containsf(recorder.Body.String(), "<C:valid-calendar-object-resource/>", "precondition should be reported")
+
+	req, _ = http.NewRequest("DELETE", "/dav/todo/abc.ics", nil)
+	recorder = makeDavRequest(mgr, req, &MockAuthorizer{})
+	assert.Equalf(204, recorder.Code, "Expected no content response")
+
+	_, err = mgr.FineOne(11)
+	assert.ErrorIsf(err, persistence.ErrNotFound, "item should be deleted")
+}
+
+func TestDavReports(t *testing.T) {
+	assert := assert.New(t)
+
+	mgr := testsupport.CreateTestManager(t)
+	err := mgr.Update(&entities.ToDoItemEntity{ID: 4, Description: "Done", Completed: true, DueDate: testsupport.ParseTestDate("2025-01-01")})
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	req, _ := http.NewRequest("REPORT", "/dav/todo/", strings.NewReader(`<C:calendar-query xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+		<D:prop><D:getetag/><C:calendar-data/></D:prop>
+		<C:filter><C:comp-filter name="VCALENDAR"><C:comp-filter name="VTODO">
+			<C:prop-filter name="COMPLETED"><C:is-not-defined/></C:prop-filter>
+			<C:time-range start="20241201T000000Z" end="20250201T000000Z"/>
+		</C:comp-filter></C:comp-filter></C:filter>
+	</C:calendar-query>`))
+	recorder := makeDavRequest(mgr, req, &MockAuthorizer{})
+	assert.Equalf(207, recorder.Code, "Expected multistatus response")
+	body := recorder.Body.String()
+	assert.Equalf(9, strings.Count(body, "<D:response>"), "only open items should match")
+	assert.NotContainsf(body, "/dav/todo/4.ics", "completed items should not match")
+	assert.Containsf(body, "BEGIN:VTODO&#xD;&#xA;", "calendar data should be returned")
+
+	req, _ = http.NewRequest("REPORT", "/dav/todo/", strings.NewReader(`<C:calendar-query xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+		<D:prop><D:getetag/></D:prop>
+		<C:filter><C:comp-filter name="VCALENDAR"><C:comp-filter name="VTODO">
+			<C:time-range start="20250201T000000Z"/>
+		</C:comp-filter></C:comp-filter></C:filter>
+	</C:calendar-query>`))
+	recorder = makeDavRequest(mgr, req, &MockAuthorizer{})
+	assert.Equalf(207, recorder.Code, "Expected multistatus response")
+	assert.NotContainsf(recorder.Body.String(), "<D:response>", "items due before the time range should not match")
+
+	req, _ = http.NewRequest("REPORT", "/dav/todo/", strings.NewReader(`<C:calendar-multiget xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+		<D:prop><D:getetag/></D:prop>
+		<D:href>/dav/todo/4.ics</D:href>
+		<D:href>/dav/todo/missing.ics</D:href>
+	</C:calendar-multiget>`))
+	recorder = makeDavRequest(mgr, req, &MockAuthorizer{})
+	assert.Equalf(207, recorder.Code, "Expected multistatus response")
+	body = recorder.Body.String()
+	assert.Containsf(body, "<D:href>/dav/todo/4.ics</D:href><D:propstat><D:prop><D:getetag>", "requested objects should be described")
+	assert.Containsf(body, "<D:href>/dav/todo/missing.ics</D:href><D:status>HTTP/1.1 404 Not Found</D:status>", "missing objects should not be found")
+
+	syncCollection := func(token string) string {
+		req, _ := http.NewRequest("REPORT", "/dav/todo/", strings.NewReader(`<D:sync-collection xmlns:D="DAV:">
+			<D:sync-token>`+token+`</D:sync-token><D:sync-level>1</D:sync-level><D:prop><D:getetag/></D:prop>
+		</D:sync-collection>`))
+		recorder := makeDavRequest(mgr, req, &MockAuthorizer{})
+		assert.Equalf(207, recorder.Code, "Expected multistatus response")
+		return recorder.Body.String()
+	}
+
+	body = syncCollection("")
+	assert.Equalf(10, strings.Count(body, "<D:response>"), "initial synchronization should report all items")
+	assert.Containsf(body, "<D:sync-token>urn:x-todo-api-go:sync:2</D:sync-token>", "sync token should be reported")
+
+	err = mgr.Update(&entities.ToDoItemEntity{ID: 5, Description: "Changed"})
+	assert.Nilf(err, "error should be nil, not %s", err)
+	err = mgr.Delete(6)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	body = syncCollection("urn:x-todo-api-go:sync:2")
+	assert.Equalf(2, strings.Count(body, "<D:response>"), "only changes should be reported")
+	assert.Containsf(body, "<D:href>/dav/todo/5.ics</D:href><D:propstat>", "changed items should be reported")
+	assert.Containsf(body, "<D:href>/dav/todo/6.ics</D:href><D:status>HTTP/1.1 404 Not Found</D:status>", "deleted items should be reported")
+
+	req, _ = http.NewRequest("REPORT", "/dav/todo/", strings.NewReader(`<D:sync-collection xmlns:D="DAV:"><D:sync-token>urn:x-todo-api-go:sync:99</D:sync-token></D:sync-collection>`))
+	recorder = makeDavRequest(mgr, req, &MockAuthorizer{})
+	assert.Equalf(403, recorder.Code, "Expected forbidden response")
+	assert.Containsf(recorder.Body.String(), "<D:valid-sync-token/>", "precondition should be reported")
+}
+
+func makeDavRequest(mgr *persistence.ToDoEntityManager, request *http.Request, authorizer api.AuthorizerFactory) *httptest.ResponseRecorder {
+	router := gin.Default()
+	api.RegisterDavRoutes(router, mgr, authorizer)
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+
+	return recorder
+}
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"todo-api-go/events"
+	"todo-api-go/reqctx"
+)
+
+// Header carrying the ID of the last event received by a reconnecting EventSource
+const LastEventIDHeader = "Last-Event-ID"
+
+// Type of the event telling subscribers that events were missed, and the items should be reloaded
+const eventStreamReset = "reset"
+
+// Delay before an EventSource reconnects after losing the stream, in milliseconds
+const eventStreamRetry = 3000
+
+// RegisterEventRoutes registers the Server-Sent Events stream of item changes for the Gin engine.
+//
+// gin: The Gin engine to register the routes with.
+// hub: The hub publishing the changes.
+// authFactory: The factory for the authorization middleware.
+// middleware: Handlers to run on every route once the caller has been authorized.
+// Returns the registered Gin engine.
+func RegisterEventRoutes(gin *gin.Engine, hub *events.Hub, authFactory AuthorizerFactory, middleware ...gin.HandlerFunc) *gin.Engine {
+	gin.GET("/api/todo/events", secured(authFactory, "retrieve", middleware, streamEventsHandler(hub))...)
+
+	return gin
+}
+
+// streamEventsHandler creates a HandlerFunc function streaming the changes of the items visible
+// to the caller as Server-Sent Events, until the caller disconnects.
+//
+// Every event carries its type, its ID and the item as JSON. Callers resume an interrupted
+// stream by passing the ID of the last event received in the "Last-Event-ID" header, as
+// EventSource does, or the "lastEventId" query parameter. If events were missed that can not
+// be replayed, a "reset" event is sent first, telling the caller to reload the items.
+// Comments are sent as heartbeats while no events occur.
+//
+// It takes a hub of type *events.Hub as a parameter.
+// The function returns a gin.HandlerFunc.
+func streamEventsHandler(hub *events.Hub) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		lastEventID, err := getLastEventID(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx := c.Request.Context()
+		subscription, missed, complete := hub.Subscribe(reqctx.PrincipalFrom(ctx), lastEventID)
+		defer subscription.Close()
+
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		c.Header("X-Accel-Buffering", "no")
+		c.Status(http.StatusOK)
+
+		fmt.Fprintf(c.Writer, "retry: %d\n\n", eventStreamRetry)
+		if !complete {
+			fmt.Fprintf(c.Writer, "event: %s\ndata: {}\n\n", eventStreamReset)
+		}
+		for i := range missed {
+			writeEvent(c, &missed[i])
+		}
+		c.Writer.Flush()
+
+		heartbeat := time.NewTicker(hub.Heartbeat())
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+
+			case event, ok := <-subscription.Events():
+				// The subscription was dropped for falling behind; the caller resumes on reconnect
+				if !ok {
+					return
+				}
+				writeEvent(c, &event)
+
+			case <-heartbeat.C:
+				fmt.Fprint(c.Writer, ": heartbeat\n\n")
+			}
+
+			c.Writer.Flush()
+		}
+	})
+}
+
+// writeEvent writes an event to the stream in the Server-Sent Events format.
+func writeEvent(c *gin.Context, event *events.Event) {
+	data, err := json.Marshal(&event.Item)
+	if err != nil {
+		reqctx.LoggerFrom(c.Request.Context(), logComponent).
+			ErrorContext(c.Request.Context(), "event could not be encoded", "error", err)
+		return
+	}
+
+	fmt.Fprintf(c.Writer, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+}
+
+// getLastEventID returns the ID of the last event received by a resuming caller, or zero.
+func getLastEventID(c *gin.Context) (uint64, error) {
+	value := c.GetHeader(LastEventIDHeader)
+	if value == "" {
+		value = c.Query("lastEventId")
+	}
+	if value == "" {
+		return 0, nil
+	}
+
+	return strconv.ParseUint(value, 10, 64)
+}
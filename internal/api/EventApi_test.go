@@ -0,0 +1,215 @@
+package api_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"todo-api-go/api"
+	"todo-api-go/entities"
+	"todo-api-go/events"
+	"todo-api-go/persistence"
+	"todo-api-go/reqctx"
+	"todo-api-go/testsupport"
+)
+
+// streamedEvent is an event read from a Server-Sent Events stream
+type streamedEvent struct {
+	ID   string
+	Type string
+	Data string
+}
+
+func TestEventStream(t *testing.T) {
+	assert := assert.New(t)
+
+	hub := events.NewHub(events.HubParameters{LogSize: 100, BufferSize: 10, Heartbeat: 50 * time.Millisecond})
+	mgr := testsupport.CreateTestManager(t)
+	mgr.AddAudienceObserver(hub)
+
+	alice := &reqctx.Principal{Subject: "alice"}
+	items := mgr.WithContext(reqctx.WithPrincipal(context.Background(), alice))
+
+	router := gin.Default()
+	api.RegisterEventRoutes(router, hub, &MockAuthorizer{Principal: alice})
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	stream := openEventStream(t, server.URL+"/api/todo/events", "")
+	assert.Equalf("text/event-stream", stream.header.Get("Content-Type"), "content type should match")
+
+	item := &entities.ToDoItemEntity{Description: "Streamed Todo Item"}
+	err := items.Create(item)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	created := stream.next(t)
+	assert.Equalf(events.ItemCreated, created.Type, "creation should be streamed")
+
+	var streamed entities.ToDoItemEntity
+	err = json.Unmarshal([]byte(created.Data), &streamed)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf(item.ID, streamed.ID, "item should match")
+
+	assert.Truef(stream.heartbeat(t), "heartbeats should be sent while idle")
+	stream.close()
+
+	// Changes made while disconnected are replayed on resumption
+	item.Completed = true
+	err = items.Update(item)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	err = items.Delete(item.ID)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	stream = openEventStream(t, server.URL+"/api/todo/events", created.ID)
+	assert.Equalf(events.ItemUpdated, stream.next(t).Type, "missed update should be replayed")
+	assert.Equalf(events.ItemDeleted, stream.next(t).Type, "missed deletion should be replayed")
+	stream.close()
+
+	stream = openEventStream(t, server.URL+"/api/todo/events?lastEventId=1", "")
+	assert.Equalf("reset", stream.next(t).Type, "unknown events should reset the caller")
+	stream.close()
+
+	req, _ := http.NewRequest("GET", "/api/todo/events?lastEventId=latest", nil)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	assert.Equalf(400, recorder.Code, "Expected bad request response")
+}
+
+func TestEventStreamVisibility(t *testing.T) {
+	assert := assert.New(t)
+
+	hub := events.NewHub(events.HubParameters{LogSize: 100, BufferSize: 10, Heartbeat: time.Second})
+	mgr := testsupport.CreateTestManager(t)
+	mgr.AddAudienceObserver(hub)
+
+	router := gin.Default()
+	api.RegisterEventRoutes(router, hub, &MockAuthorizer{Principal: &reqctx.Principal{Subject: "bob", Roles: []string{persistence.RoleAdmin}}})
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	stream := openEventStream(t, server.URL+"/api/todo/events", "")
+	defer stream.close()
+
+	alice := mgr.WithContext(reqctx.WithPrincipal(context.Background(), &reqctx.Principal{Subject: "alice"}))
+	err := alice.Create(&entities.ToDoItemEntity{Description: "Private Todo Item"})
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	public := &entities.ToDoItemEntity{ID: 1, Description: "Public Todo Item"}
+	err = mgr.Update(public)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	event := stream.next(t)
+	assert.Equalf(events.ItemUpdated, event.Type, "only visible changes should be streamed")
+	assert.Containsf(event.Data, "Public Todo Item", "item should match")
+}
+
+// eventStream reads the events of a Server-Sent Events response
+type eventStream struct {
+	header http.Header
+	reader *bufio.Reader
+	cancel context.CancelFunc
+}
+
+func openEventStream(t *testing.T, url string, lastEventID string) *eventStream {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	req, _ := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if lastEventID != "" {
+		req.Header.Set(api.LastEventIDHeader, lastEventID)
+	}
+
+	response, err := http.DefaultClient.Do(req)
+	if err != nil {
+		cancel()
+		t.Fatal(err)
+	}
+	if response.StatusCode != http.StatusOK {
+		cancel()
+		t.Fatalf("unexpected status %d", response.StatusCode)
+	}
+
+	return &eventStream{
+		header: response.Header,
+		reader: bufio.NewReader(response.Body),
+		cancel: func() {
+			cancel()
+			response.Body.Close()
+		},
+	}
+}
+
+// next returns the next event of the stream, skipping comments and retry instructions
+func (stream *eventStream) next(t *testing.T) streamedEvent {
+	for {
+		block := stream.block(t)
+		var event streamedEvent
+		for _, line := range block {
+			field, value, _ := strings.Cut(line, ": ")
+			switch field {
+			case "id":
+				event.ID = value
+			case "event":
+				event.Type = value
+			case "data":
+				event.Data = value
+			}
+		}
+
+		if event.Type != "" {
+			return event
+		}
+	}
+}
+
+// heartbeat reports whether the next block of the stream is a heartbeat comment
+func (stream *eventStream) heartbeat(t *testing.T) bool {
+	block := stream.block(t)
+	return len(block) == 1 && strings.HasPrefix(block[0], ":")
+}
+
+// block reads the lines up to the next blank line, failing the test if none arrives in time
+func (stream *eventStream) block(t *testing.T) []string {
+	lines := make(chan []string, 1)
+	go func() {
+		var block []string
+		for {
+			line, err := stream.reader.ReadString('\n')
+			if err != nil {
+				lines <- nil
+				return
+			}
+
+			line = strings.TrimSuffix(line, "\n")
+			if line == "" && len(block) > 0 {
+				lines <- block
+				return
+			}
+			if line != "" {
+				block = append(block, line)
+			}
+		}
+	}()
+
+	select {
+	case block := <-lines:
+		if block == nil {
+			t.Fatal("stream ended")
+		}
+		return block
+	case <-time.After(2 * time.Second):
+		t.Fatal("no event received")
+	}
+	return nil
+}
+
+func (stream *eventStream) close() {
+	stream.cancel()
+}
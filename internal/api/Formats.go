@@ -0,0 +1,214 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"todo-api-go/entities"
+)
+
+// Media types of item lists besides JSON
+const (
+	MIMECSV    = "text/csv"
+	MIMENDJSON = "application/x-ndjson"
+)
+
+// Header carrying the total number of items of a list, for formats without metadata
+const TotalCountHeader = "X-Total-Count"
+
+// Columns of the CSV representation of items
+var itemColumns = []string{"id", "description", "completed", "due_date", "completed_at", "created_at", "updated_at", "owner_id"}
+
+// writeJSON writes a JSON response, which is compact unless the "pretty" query parameter
+// asks for indentation.
+func writeJSON(c *gin.Context, status int, obj any) {
+	if pretty, _ := strconv.ParseBool(c.Query("pretty")); pretty {
+		c.IndentedJSON(status, obj)
+		return
+	}
+
+	c.JSON(status, obj)
+}
+
+// writeItems writes a page of items in the format negotiated from the Accept header of the
+// request: JSON with list metadata, CSV or newline delimited JSON. The total number of items
+// is passed in a header as well, as CSV and NDJSON lack the metadata.
+//
+// It responds with 406 Not Acceptable if none of the formats is acceptable.
+func writeItems(c *gin.Context, items []entities.ToDoItemEntity, total int64) {
+	c.Header(TotalCountHeader, strconv.FormatInt(total, 10))
+
+	switch c.NegotiateFormat(gin.MIMEJSON, MIMECSV, MIMENDJSON) {
+	case gin.MIMEJSON:
+		writeJSON(c, http.StatusOK, FindResponse{
+			Meta: ListMetadata{Total: total},
+			Data: items,
+		})
+
+	case MIMECSV:
+		c.Header("Content-Type", MIMECSV+"; charset=utf-8")
+		c.Status(http.StatusOK)
+		if err := writeItemsCSV(c.Writer, items); err != nil {
+			_ = c.Error(err)
+		}
+
+	case MIMENDJSON:
+		c.Header("Content-Type", MIMENDJSON)
+		c.Status(http.StatusOK)
+		if err := writeItemsNDJSON(c.Writer, items); err != nil {
+			_ = c.Error(err)
+		}
+
+	default:
+		c.JSON(http.StatusNotAcceptable, gin.H{"error": "acceptable formats are " + gin.MIMEJSON + ", " + MIMECSV + " and " + MIMENDJSON})
+	}
+}
+
+// itemEncoder writes a sequence of items in a format.
+type itemEncoder interface {
+	// Begin writes the start of the sequence
+	Begin() error
+
+	// Encode writes an item
+	Encode(item *entities.ToDoItemEntity) error
+
+	// End writes the end of the sequence and flushes any buffered data
+	End() error
+}
+
+// writeItemsCSV writes items as CSV with a header row naming the columns.
+func writeItemsCSV(w io.Writer, items []entities.ToDoItemEntity) error {
+	return encodeItems(newCSVEncoder(w), items)
+}
+
+// writeItemsNDJSON writes items as newline delimited JSON, one item per line.
+func writeItemsNDJSON(w io.Writer, items []entities.ToDoItemEntity) error {
+	return encodeItems(&ndjsonEncoder{encoder: json.NewEncoder(w)}, items)
+}
+
+// encodeItems writes a complete sequence of items with an itemEncoder.
+func encodeItems(encoder itemEncoder, items []entities.ToDoItemEntity) error {
+	err := encoder.Begin()
+	if err != nil {
+		return err
+	}
+
+	for i := range items {
+		err = encoder.Encode(&items[i])
+		if err != nil {
+			return err
+		}
+	}
+
+	return encoder.End()
+}
+
+// csvEncoder writes items as CSV with a header row naming the columns.
+type csvEncoder struct {
+	writer *csv.Writer
+}
+
+// newCSVEncoder creates an itemEncoder writing CSV.
+func newCSVEncoder(w io.Writer) *csvEncoder {
+	return &csvEncoder{writer: csv.NewWriter(w)}
+}
+
+// Begin implements itemEncoder by writing the header row.
+func (encoder *csvEncoder) Begin() error {
+	return encoder.writer.Write(itemColumns)
+}
+
+// Encode implements itemEncoder.
+func (encoder *csvEncoder) Encode(item *entities.ToDoItemEntity) error {
+	return encoder.writer.Write(itemRecord(item))
+}
+
+// End implements itemEncoder.
+func (encoder *csvEncoder) End() error {
+	encoder.writer.Flush()
+	return encoder.writer.Error()
+}
+
+// ndjsonEncoder writes items as newline delimited JSON.
+type ndjsonEncoder struct {
+	encoder *json.Encoder
+}
+
+// Begin implements itemEncoder.
+func (encoder *ndjsonEncoder) Begin() error {
+	return nil
+}
+
+// Encode implements itemEncoder.
+func (encoder *ndjsonEncoder) Encode(item *entities.ToDoItemEntity) error {
+	return encoder.encoder.Encode(item)
+}
+
+// End implements itemEncoder.
+func (encoder *ndjsonEncoder) End() error {
+	return nil
+}
+
+// jsonArrayEncoder writes items as a JSON array, one item per line.
+type jsonArrayEncoder struct {
+	w     io.Writer
+	count int
+}
+
+// Begin implements itemEncoder.
+func (encoder *jsonArrayEncoder) Begin() error {
+	_, err := io.WriteString(encoder.w, "[")
+	return err
+}
+
+// Encode implements itemEncoder.
+func (encoder *jsonArrayEncoder) Encode(item *entities.ToDoItemEntity) error {
+	separator := "\n"
+	if encoder.count > 0 {
+		separator = ",\n"
+	}
+	encoder.count++
+
+	encoded, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(encoder.w, separator+string(encoded))
+	return err
+}
+
+// End implements itemEncoder.
+func (encoder *jsonArrayEncoder) End() error {
+	_, err := io.WriteString(encoder.w, "\n]\n")
+	return err
+}
+
+// itemRecord converts an item into a CSV record matching itemColumns.
+func itemRecord(item *entities.ToDoItemEntity) []string {
+	return []string{
+		strconv.FormatUint(uint64(item.ID), 10),
+		item.Description,
+		strconv.FormatBool(item.Completed),
+		formatTime(item.DueDate),
+		formatTime(item.CompletedAt),
+		formatTime(item.CreatedAt),
+		formatTime(item.UpdatedAt),
+		item.OwnerID,
+	}
+}
+
+// formatTime formats a timestamp as RFC 3339, leaving unset timestamps empty.
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.Format(time.RFC3339)
+}
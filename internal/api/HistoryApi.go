@@ -0,0 +1,81 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"todo-api-go/persistence"
+)
+
+type HistoryResponse struct {
+	Meta ListMetadata
+	Data []persistence.ItemRevision
+}
+
+// registerHistoryRoutes registers the routes for the revision history of a ToDo item.
+//
+// gin: The Gin engine to register the routes with.
+// mgr: The ToDo entity manager.
+// authFactory: The factory for the authorization middleware.
+// middleware: Handlers to run on every route once the caller has been authorized.
+func registerHistoryRoutes(gin *gin.Engine, mgr *persistence.ToDoEntityManager, authFactory AuthorizerFactory, middleware []gin.HandlerFunc) {
+	gin.GET("/api/todo/:id/history", secured(authFactory, "retrieve", middleware, getHistoryHandler(mgr))...)
+	gin.POST("/api/todo/:id/history/:revision/revert", secured(authFactory, "update", middleware, revertHandler(mgr))...)
+}
+
+// getHistoryHandler creates a HandlerFunc function for listing the revisions of a ToDoItemEntity
+// with pagination.
+//
+// It takes a manager of type *persistence.ToDoEntityManager as a parameter.
+// The function returns a gin.HandlerFunc.
+func getHistoryHandler(manager *persistence.ToDoEntityManager) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		revisions, total, err := manager.WithContext(c.Request.Context()).FindHistory(uint(id), getPagingConfigurator(c))
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		response := HistoryResponse{
+			Meta: ListMetadata{Total: total},
+			Data: revisions,
+		}
+		writeJSON(c, http.StatusOK, response)
+	})
+}
+
+// revertHandler creates a HandlerFunc function for reverting a ToDoItemEntity to an earlier revision.
+//
+// It takes a manager of type *persistence.ToDoEntityManager as a parameter.
+// The function returns a gin.HandlerFunc.
+func revertHandler(manager *persistence.ToDoEntityManager) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		revision, err := strconv.Atoi(c.Param("revision"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		item, err := manager.WithContext(c.Request.Context()).Revert(uint(id), uint(revision))
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		writeJSON(c, http.StatusOK, item)
+	})
+}
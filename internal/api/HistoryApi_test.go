@@ -0,0 +1,67 @@
+package api_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"todo-api-go/api"
+	"todo-api-go/entities"
+	"todo-api-go/testsupport"
+)
+
+func TestHistory(t *testing.T) {
+	assert := assert.New(t)
+
+	mgr := testsupport.CreateTestManager(t)
+	assert.NotNilf(mgr, "manager should not be nil")
+
+	item := &entities.ToDoItemEntity{Description: "Original Todo Item"}
+	err := mgr.Create(item)
+	assert.Nilf(err, "error should be nil")
+
+	time.Sleep(10 * time.Millisecond)
+	beforeUpdate := time.Now()
+	time.Sleep(10 * time.Millisecond)
+
+	marshalled, _ := json.Marshal(&entities.ToDoItemEntity{Description: "Updated Todo Item"})
+	req, _ := http.NewRequest("PUT", "/api/todo/11", bytes.NewBuffer(marshalled))
+	recorder := makeRequest(mgr, req)
+	assert.Equalf(200, recorder.Code, "Expected successful response")
+
+	req, _ = http.NewRequest("GET", "/api/todo/11/history", nil)
+	recorder = makeRequest(mgr, req)
+	assert.Equalf(200, recorder.Code, "Expected successful response")
+
+	var response api.HistoryResponse
+	err = json.Unmarshal(recorder.Body.Bytes(), &response)
+	assert.Nilf(err, "error should be nil")
+	assert.Equalf(2, int(response.Meta.Total), "total length should be 2")
+	assert.Equalf("Description", response.Data[1].Changes[0].Field, "changed field should match")
+
+	req, _ = http.NewRequest("GET", "/api/todo/11?as_of="+url.QueryEscape(beforeUpdate.Format(time.RFC3339Nano)), nil)
+	recorder = makeRequest(mgr, req)
+	assert.Equalf(200, recorder.Code, "Expected successful response")
+
+	var found entities.ToDoItemEntity
+	err = json.Unmarshal(recorder.Body.Bytes(), &found)
+	assert.Nilf(err, "error should be nil")
+	assert.Equalf("Original Todo Item", found.Description, "descriptions should match")
+
+	req, _ = http.NewRequest("POST", "/api/todo/11/history/1/revert", nil)
+	recorder = makeRequest(mgr, req)
+	assert.Equalf(200, recorder.Code, "Expected successful response")
+
+	err = json.Unmarshal(recorder.Body.Bytes(), &found)
+	assert.Nilf(err, "error should be nil")
+	assert.Equalf("Original Todo Item", found.Description, "descriptions should match")
+
+	req, _ = http.NewRequest("POST", "/api/todo/11/history/99/revert", nil)
+	recorder = makeRequest(mgr, req)
+	assert.Equalf(404, recorder.Code, "Expected not found response")
+}
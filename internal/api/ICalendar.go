@@ -0,0 +1,355 @@
+package api
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"todo-api-go/entities"
+)
+
+// Media type of iCalendar documents
+const MIMECalendar = "text/calendar"
+
+// Product identifier of the iCalendar documents written by the API
+const calendarProductID = "-//todo-api-go//EN"
+
+// Suffix of the UIDs identifying items in iCalendar documents
+const calendarUIDSuffix = "@todo-api-go"
+
+// Formats of iCalendar DATE-TIME values in UTC, floating DATE-TIME values and DATE values
+const (
+	calendarUTCFormat      = "20060102T150405Z"
+	calendarFloatingFormat = "20060102T150405"
+	calendarDateFormat     = "20060102"
+)
+
+// Longest content line in octets, excluding the line break, before it is folded
+const calendarLineLength = 75
+
+// calendarEncoder writes items as VTODO components of an iCalendar document.
+type calendarEncoder struct {
+	w   *bufio.Writer
+	now time.Time
+}
+
+// newCalendarEncoder creates an itemEncoder writing an iCalendar document.
+func newCalendarEncoder(w io.Writer) *calendarEncoder {
+	return &calendarEncoder{w: bufio.NewWriter(w), now: time.Now()}
+}
+
+// Begin implements itemEncoder by writing the start of the calendar.
+func (encoder *calendarEncoder) Begin() error {
+	encoder.line("BEGIN", "VCALENDAR")
+	encoder.line("VERSION", "2.0")
+	encoder.line("PRODID", calendarProductID)
+
+	return nil
+}
+
+// Encode implements itemEncoder by writing a VTODO component describing the item.
+func (encoder *calendarEncoder) Encode(item *entities.ToDoItemEntity) error {
+	return encoder.EncodeWithUID(item, calendarUID(item.ID))
+}
+
+// EncodeWithUID writes a VTODO component describing the item, identified by the specified UID.
+//
+// The due date, recurrence rule, completion state and completion timestamp of the item are
+// mapped onto the DUE, RRULE, STATUS and COMPLETED properties.
+func (encoder *calendarEncoder) EncodeWithUID(item *entities.ToDoItemEntity, uid string) error {
+	stamp := item.UpdatedAt
+	if stamp.IsZero() {
+		stamp = encoder.now
+	}
+
+	encoder.line("BEGIN", "VTODO")
+	encoder.line("UID", uid)
+	encoder.line("DTSTAMP", formatCalendarTime(stamp))
+	if !item.CreatedAt.IsZero() {
+		encoder.line("CREATED", formatCalendarTime(item.CreatedAt))
+	}
+	if !item.UpdatedAt.IsZero() {
+		encoder.line("LAST-MODIFIED", formatCalendarTime(item.UpdatedAt))
+	}
+	encoder.line("SUMMARY", escapeCalendarText(item.Description))
+	if !item.DueDate.IsZero() {
+		encoder.line("DUE", formatCalendarTime(item.DueDate))
+	}
+	if item.Recurrence != "" {
+		encoder.line("RRULE", item.Recurrence)
+	}
+
+	if item.Completed {
+		encoder.line("STATUS", "COMPLETED")
+		if !item.CompletedAt.IsZero() {
+			encoder.line("COMPLETED", formatCalendarTime(item.CompletedAt))
+		}
+	} else {
+		encoder.line("STATUS", "NEEDS-ACTION")
+	}
+
+	encoder.line("END", "VTODO")
+
+	return encoder.w.Flush()
+}
+
+// End implements itemEncoder by writing the end of the calendar.
+func (encoder *calendarEncoder) End() error {
+	encoder.line("END", "VCALENDAR")
+
+	return encoder.w.Flush()
+}
+
+// line writes a content line, folding it into lines of at most calendarLineLength octets.
+// Errors are reported by the next flush.
+func (encoder *calendarEncoder) line(name string, value string) {
+	line := name + ":" + value
+
+	for len(line) > calendarLineLength {
+		// Fold at a character boundary, as continuation lines start with a space
+		cut := calendarLineLength
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+
+		encoder.w.WriteString(line[:cut])
+		encoder.w.WriteString("\r\n ")
+		line = line[cut:]
+	}
+
+	encoder.w.WriteString(line)
+	encoder.w.WriteString("\r\n")
+}
+
+// calendarUID returns the UID identifying an item in iCalendar documents.
+func calendarUID(id uint) string {
+	return strconv.FormatUint(uint64(id), 10) + calendarUIDSuffix
+}
+
+// formatCalendarTime formats a timestamp as an iCalendar DATE-TIME value in UTC.
+func formatCalendarTime(t time.Time) string {
+	return t.UTC().Format(calendarUTCFormat)
+}
+
+// escapeCalendarText escapes a TEXT value.
+func escapeCalendarText(value string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(value)
+}
+
+// unescapeCalendarText reverses escapeCalendarText.
+func unescapeCalendarText(value string) string {
+	var unescaped strings.Builder
+
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' || i+1 == len(value) {
+			unescaped.WriteByte(value[i])
+			continue
+		}
+
+		i++
+		switch value[i] {
+		case 'n', 'N':
+			unescaped.WriteByte('\n')
+		default:
+			unescaped.WriteByte(value[i])
+		}
+	}
+
+	return unescaped.String()
+}
+
+// calendarProperty is a content line of an iCalendar document.
+type calendarProperty struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// parseCalendar reads the VTODO components of an iCalendar document as import rows, numbered
+// in the order of the components.
+//
+// SUMMARY, or DESCRIPTION in its absence, is mapped onto the description of the item. A STATUS
+// of COMPLETED or a COMPLETED property mark the item as completed. Components nested in a VTODO,
+// such as alarms, are ignored.
+//
+// It returns an error if the document is not an iCalendar document.
+func parseCalendar(r io.Reader) ([]importRow, error) {
+	lines, err := unfoldCalendarLines(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(lines) == 0 || !strings.EqualFold(lines[0], "BEGIN:VCALENDAR") {
+		return nil, errors.New("not an iCalendar document: expected BEGIN:VCALENDAR")
+	}
+
+	var rows []importRow
+	var todo []calendarProperty
+	var todoErr error
+	inTodo := false
+	depth := 0
+
+	for _, line := range lines {
+		property, err := parseCalendarLine(line)
+		if err != nil {
+			if inTodo && depth == 0 && todoErr == nil {
+				todoErr = err
+			}
+			continue
+		}
+
+		switch {
+		case property.name == "BEGIN" && !inTodo && strings.EqualFold(property.value, "VTODO"):
+			inTodo = true
+			todo = nil
+			todoErr = nil
+
+		case property.name == "BEGIN" && inTodo:
+			depth++
+
+		case property.name == "END" && inTodo && depth > 0:
+			depth--
+
+		case property.name == "END" && inTodo:
+			row := importRow{Row: len(rows) + 1}
+			row.Item, row.Err = todoItem(todo)
+			for _, property := range todo {
+				if property.name == "UID" {
+					row.UID = property.value
+				}
+			}
+			if todoErr != nil {
+				row.Err = todoErr
+			}
+			rows = append(rows, row)
+			inTodo = false
+
+		case inTodo && depth == 0:
+			todo = append(todo, property)
+		}
+	}
+
+	return rows, nil
+}
+
+// todoItem maps the properties of a VTODO component onto an item.
+func todoItem(properties []calendarProperty) (entities.ToDoItemEntity, error) {
+	var item entities.ToDoItemEntity
+	var description string
+	var err error
+
+	for _, property := range properties {
+		switch property.name {
+		case "SUMMARY":
+			item.Description = unescapeCalendarText(property.value)
+		case "DESCRIPTION":
+			description = unescapeCalendarText(property.value)
+		case "DUE":
+			item.DueDate, err = parseCalendarTime(property)
+			item.TimeZone = property.params["TZID"]
+		case "RRULE":
+			item.Recurrence = property.value
+		case "STATUS":
+			item.Completed = item.Completed || strings.EqualFold(property.value, "COMPLETED")
+		case "COMPLETED":
+			item.Completed = true
+			item.CompletedAt, err = parseCalendarTime(property)
+		}
+
+		if err != nil {
+			return item, fmt.Errorf("invalid %s: %w", property.name, err)
+		}
+	}
+
+	if item.Description == "" {
+		item.Description = description
+	}
+
+	return item, nil
+}
+
+// parseCalendarTime parses a DATE or DATE-TIME value. Floating times are interpreted in the
+// time zone named by the TZID parameter, or in UTC.
+func parseCalendarTime(property calendarProperty) (time.Time, error) {
+	value := property.value
+
+	if strings.EqualFold(property.params["VALUE"], "DATE") || len(value) == len(calendarDateFormat) {
+		return time.Parse(calendarDateFormat, value)
+	}
+
+	if strings.HasSuffix(value, "Z") {
+		return time.Parse(calendarUTCFormat, value)
+	}
+
+	location := time.UTC
+	if tzid := property.params["TZID"]; tzid != "" {
+		loaded, err := time.LoadLocation(tzid)
+		if err != nil {
+			return time.Time{}, err
+		}
+		location = loaded
+	}
+
+	return time.ParseInLocation(calendarFloatingFormat, value, location)
+}
+
+// unfoldCalendarLines reads the content lines of an iCalendar document, joining folded lines.
+func unfoldCalendarLines(r io.Reader) ([]string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	var lines []string
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	return lines, scanner.Err()
+}
+
+// parseCalendarLine splits a content line into its name, parameters and value.
+func parseCalendarLine(line string) (calendarProperty, error) {
+	property := calendarProperty{params: map[string]string{}}
+
+	// The value starts at the first colon outside of quoted parameter values
+	quoted := false
+	colon := -1
+	for i := 0; i < len(line) && colon < 0; i++ {
+		switch line[i] {
+		case '"':
+			quoted = !quoted
+		case ':':
+			if !quoted {
+				colon = i
+			}
+		}
+	}
+
+	if colon < 0 {
+		return property, fmt.Errorf("invalid content line %q", line)
+	}
+
+	property.value = line[colon+1:]
+
+	parts := strings.Split(line[:colon], ";")
+	property.name = strings.ToUpper(strings.TrimSpace(parts[0]))
+	for _, param := range parts[1:] {
+		name, value, _ := strings.Cut(param, "=")
+		property.params[strings.ToUpper(name)] = strings.Trim(value, `"`)
+	}
+
+	return property, nil
+}
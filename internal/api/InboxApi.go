@@ -0,0 +1,86 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"todo-api-go/entities"
+	"todo-api-go/persistence"
+)
+
+type InboxResponse struct {
+	Meta ListMetadata
+	Data []entities.InboxMessageEntity
+}
+
+// RegisterInboxRoutes registers the routes of the in-app inbox, which holds the reminders sent
+// to the caller, for the Gin engine.
+//
+// gin: The Gin engine to register the routes with.
+// mgr: The reminder manager.
+// authFactory: The factory for the authorization middleware.
+// middleware: Handlers to run on every route once the caller has been authorized.
+// Returns the registered Gin engine.
+func RegisterInboxRoutes(gin *gin.Engine, mgr *persistence.ReminderManager, authFactory AuthorizerFactory, middleware ...gin.HandlerFunc) *gin.Engine {
+	gin.GET("/api/inbox", secured(authFactory, "retrieve", middleware, getInboxHandler(mgr))...)
+	gin.POST("/api/inbox/:id/read", secured(authFactory, "update", middleware, markInboxMessageReadHandler(mgr))...)
+
+	return gin
+}
+
+// getInboxHandler creates a HandlerFunc function for listing the messages in the inbox of the
+// caller, newest first, with pagination. The "unread" query parameter restricts the list to
+// the messages that have not been read.
+//
+// It takes a manager of type *persistence.ReminderManager as a parameter.
+// The function returns a gin.HandlerFunc.
+func getInboxHandler(manager *persistence.ReminderManager) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		var filter persistence.InboxFilter
+		if value := c.Query("unread"); value != "" {
+			unread, err := strconv.ParseBool(value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			filter.Unread = unread
+		}
+
+		messages, total, err := manager.WithContext(c.Request.Context()).FindInbox(filter, getPagingConfigurator(c))
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		response := InboxResponse{
+			Meta: ListMetadata{Total: total},
+			Data: messages,
+		}
+		writeJSON(c, http.StatusOK, response)
+	})
+}
+
+// markInboxMessageReadHandler creates a HandlerFunc function for marking a message in the inbox
+// of the caller as read.
+//
+// It takes a manager of type *persistence.ReminderManager as a parameter.
+// The function returns a gin.HandlerFunc.
+func markInboxMessageReadHandler(manager *persistence.ReminderManager) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		message, err := manager.WithContext(c.Request.Context()).MarkRead(uint(id))
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		writeJSON(c, http.StatusOK, message)
+	})
+}
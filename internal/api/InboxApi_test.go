@@ -0,0 +1,85 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"todo-api-go/api"
+	"todo-api-go/entities"
+	"todo-api-go/persistence"
+	"todo-api-go/reqctx"
+	"todo-api-go/testsupport"
+)
+
+func TestInbox(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testsupport.CreateTestDatabase(t)
+	reminders := persistence.NewReminderManager(db)
+
+	alice := &reqctx.Principal{Subject: "alice"}
+	due := time.Date(2030, time.January, 1, 10, 0, 0, 0, time.UTC)
+	err := persistence.New(db).WithContext(reqctx.WithPrincipal(context.Background(), alice)).Create(&entities.ToDoItemEntity{Description: "Reminded", DueDate: due})
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	_, err = reminders.Schedule([]time.Duration{0}, []string{"inbox"}, due.Add(-time.Hour), due)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	pending, err := reminders.Claim("test", due, 10, time.Minute)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	for i := range pending {
+		err = reminders.Complete(&pending[i], func(outbox *persistence.ReminderOutbox) error {
+			return outbox.AddToInbox("Reminder: Reminded", "Reminded is due")
+		})
+		assert.Nilf(err, "error should be nil, not %s", err)
+	}
+
+	inbox := getInbox(t, reminders, alice, "")
+	if !assert.Lenf(inbox.Data, 1, "the reminder should be in the inbox") {
+		return
+	}
+	assert.Equalf("Reminder: Reminded", inbox.Data[0].Subject, "the message should be returned")
+	assert.Emptyf(getInbox(t, reminders, &reqctx.Principal{Subject: "bob"}, "").Data, "messages of other principals should not be listed")
+
+	router := gin.Default()
+	api.RegisterInboxRoutes(router, reminders, &MockAuthorizer{Principal: alice})
+
+	req, _ := http.NewRequest("POST", fmt.Sprintf("/api/inbox/%d/read", inbox.Data[0].ID), nil)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	assert.Equalf(200, recorder.Code, "Expected successful response")
+
+	assert.Emptyf(getInbox(t, reminders, alice, "?unread=true").Data, "read messages should be filtered")
+
+	req, _ = http.NewRequest("GET", "/api/inbox?unread=maybe", nil)
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	assert.Equalf(400, recorder.Code, "Expected invalid filters to be rejected")
+}
+
+func getInbox(t *testing.T, reminders *persistence.ReminderManager, principal *reqctx.Principal, query string) api.InboxResponse {
+	router := gin.Default()
+	api.RegisterInboxRoutes(router, reminders, &MockAuthorizer{Principal: principal})
+
+	req, _ := http.NewRequest("GET", "/api/inbox"+query, nil)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d", recorder.Code)
+	}
+
+	var response api.InboxResponse
+	err := json.Unmarshal(recorder.Body.Bytes(), &response)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return response
+}
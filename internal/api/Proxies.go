@@ -0,0 +1,32 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/kelseyhightower/envconfig"
+)
+
+type ProxyParameters struct {
+	// Addresses or CIDR blocks of the reverse proxies whose X-Forwarded-For and X-Real-IP
+	// headers are trusted to carry the address of the client. Without any, the address of the
+	// client is the address of the connection.
+	TrustedProxies []string `split_words:"true"`
+}
+
+// ConfigureProxiesFromEnv configures the trusted proxies of a Gin engine from the
+// "HTTP_***" environment variables.
+//
+// The address of the client, which rate limits and logs rely on, is only taken from the
+// forwarding headers of requests sent by trusted proxies, so that clients can not pick it.
+//
+// router: The Gin engine to configure.
+// Returns an error if the variables or the proxy addresses are invalid.
+func ConfigureProxiesFromEnv(router *gin.Engine) error {
+	var params ProxyParameters
+
+	err := envconfig.Process("http", &params)
+	if err != nil {
+		return err
+	}
+
+	return router.SetTrustedProxies(params.TrustedProxies)
+}
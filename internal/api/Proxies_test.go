@@ -0,0 +1,44 @@
+package api_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"todo-api-go/api"
+)
+
+func TestConfigureProxies(t *testing.T) {
+	assert := assert.New(t)
+
+	var clientIP string
+	router := gin.New()
+	router.GET("/ip", func(c *gin.Context) {
+		clientIP = c.ClientIP()
+	})
+
+	request := func(remoteAddr string) string {
+		req, _ := http.NewRequest("GET", "/ip", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-For", "203.0.113.7")
+		router.ServeHTTP(httptest.NewRecorder(), req)
+		return clientIP
+	}
+
+	err := api.ConfigureProxiesFromEnv(router)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf("192.0.2.1", request("192.0.2.1:4711"), "forwarded addresses should not be trusted by default")
+
+	t.Setenv("HTTP_TRUSTED_PROXIES", "10.0.0.0/8")
+	err = api.ConfigureProxiesFromEnv(router)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf("203.0.113.7", request("10.1.2.3:4711"), "addresses forwarded by trusted proxies should be used")
+	assert.Equalf("192.0.2.1", request("192.0.2.1:4711"), "addresses forwarded by other clients should not be used")
+
+	t.Setenv("HTTP_TRUSTED_PROXIES", "proxy")
+	err = api.ConfigureProxiesFromEnv(router)
+	assert.NotNilf(err, "invalid proxies should be rejected")
+}
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"todo-api-go/entities"
+	"todo-api-go/persistence"
+)
+
+// registerRecurrenceRoutes registers the routes for updating occurrences of recurring ToDo items.
+//
+// Updating an occurrence through /api/todo/:id/occurrence is the same as through /api/todo/:id,
+// and leaves the other occurrences of its series unchanged. Updating it through /api/todo/:id/future
+// applies the update to all future occurrences as well.
+//
+// gin: The Gin engine to register the routes with.
+// mgr: The ToDo entity manager.
+// authFactory: The factory for the authorization middleware.
+// middleware: Handlers to run on every route once the caller has been authorized.
+func registerRecurrenceRoutes(gin *gin.Engine, mgr *persistence.ToDoEntityManager, authFactory AuthorizerFactory, middleware []gin.HandlerFunc) {
+	gin.PUT("/api/todo/:id/occurrence", secured(authFactory, "update", middleware, updateToDoItemHandler(mgr))...)
+	gin.PUT("/api/todo/:id/future", secured(authFactory, "update", middleware, updateFutureHandler(mgr))...)
+}
+
+// updateFutureHandler creates a HandlerFunc function for updating an occurrence of a recurring
+// ToDoItemEntity together with all future occurrences of its series.
+//
+// It takes a manager of type *persistence.ToDoEntityManager as a parameter.
+// The function returns a gin.HandlerFunc.
+func updateFutureHandler(manager *persistence.ToDoEntityManager) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var item entities.ToDoItemEntity
+		err = c.BindJSON(&item)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		item.ID = uint(id)
+		err = manager.WithContext(c.Request.Context()).UpdateFuture(&item)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		writeJSON(c, http.StatusOK, item)
+	})
+}
@@ -0,0 +1,42 @@
+package api_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"todo-api-go/entities"
+	"todo-api-go/testsupport"
+)
+
+func TestUpdateFuture(t *testing.T) {
+	assert := assert.New(t)
+
+	mgr := testsupport.CreateTestManager(t)
+
+	item := &entities.ToDoItemEntity{Description: "Report", DueDate: testsupport.ParseTestDate("2025-01-06"), Recurrence: "FREQ=WEEKLY"}
+	err := mgr.Create(item)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	item.Description = "Weekly report"
+	item.Recurrence = "freq=weekly;interval=2"
+	marshalled, _ := json.Marshal(item)
+	req, _ := http.NewRequest("PUT", "/api/todo/"+strconv.Itoa(int(item.ID))+"/future", bytes.NewBuffer(marshalled))
+	recorder := makeRequest(mgr, req)
+	assert.Equalf(200, recorder.Code, "Expected successful response")
+
+	var updated entities.ToDoItemEntity
+	err = json.Unmarshal(recorder.Body.Bytes(), &updated)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf("FREQ=WEEKLY;INTERVAL=2", updated.Recurrence, "the rule of the series should be updated")
+	assert.Equalf("Weekly report", updated.Description, "the occurrence should be updated")
+
+	marshalled, _ = json.Marshal(entities.ToDoItemEntity{Description: "Not recurring"})
+	req, _ = http.NewRequest("PUT", "/api/todo/1/future", bytes.NewBuffer(marshalled))
+	recorder = makeRequest(mgr, req)
+	assert.Equalf(400, recorder.Code, "Expected items without series to be rejected")
+}
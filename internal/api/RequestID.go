@@ -0,0 +1,43 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/gin-gonic/gin"
+
+	"todo-api-go/reqctx"
+)
+
+// Header carrying the request ID
+const RequestIDHeader = "X-Request-ID"
+
+// Longest client supplied request ID that is accepted
+const maxRequestIDLength = 128
+
+// RequestID returns a gin.HandlerFunc that assigns an ID to every request.
+//
+// A request ID supplied by the client in the X-Request-ID header is kept, otherwise
+// a random one is generated. The ID is added to the request context and echoed in
+// the response headers.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(RequestIDHeader)
+		if requestID == "" || len(requestID) > maxRequestIDLength {
+			requestID = newRequestID()
+		}
+
+		c.Header(RequestIDHeader, requestID)
+		c.Request = c.Request.WithContext(reqctx.WithRequestID(c.Request.Context(), requestID))
+
+		c.Next()
+	}
+}
+
+// newRequestID generates a random request ID.
+func newRequestID() string {
+	random := make([]byte, 16)
+	_, _ = rand.Read(random)
+
+	return hex.EncodeToString(random)
+}
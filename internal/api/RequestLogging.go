@@ -0,0 +1,77 @@
+package api
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+
+	"todo-api-go/reqctx"
+)
+
+// Key of the request-scoped *slog.Logger in the gin context
+const LoggerKey = "logger"
+
+// Component of the loggers used by the handlers of this package
+const logComponent = "api"
+
+// Component of the access log
+const accessLogComponent = "access"
+
+// RequestLogger returns a gin.HandlerFunc that attaches a request-scoped logger to every
+// request and writes an access log entry once the request has been handled.
+//
+// The logger carries the request ID, the trace and span IDs and the route of the request,
+// so it has to run after the RequestID and tracing middleware. It is stored in the gin
+// context and in the request context, where reqctx.LoggerFrom finds it and adds the subject
+// of the principal once the caller has been authorized.
+//
+// Access log entries are logged at error level for server errors, at warning level for
+// client errors and at info level otherwise.
+func RequestLogger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		ctx := c.Request.Context()
+
+		attributes := []any{
+			"request_id", reqctx.RequestIDFrom(ctx),
+			"method", c.Request.Method,
+			"route", c.FullPath(),
+		}
+		if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+			attributes = append(attributes,
+				"trace_id", spanContext.TraceID().String(),
+				"span_id", spanContext.SpanID().String())
+		}
+
+		logger := slog.Default().With(attributes...)
+		c.Set(LoggerKey, logger)
+		c.Request = c.Request.WithContext(reqctx.WithLogger(ctx, logger))
+
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= 500:
+			level = slog.LevelError
+		case status >= 400:
+			level = slog.LevelWarn
+		}
+
+		accessAttributes := []slog.Attr{
+			slog.Int("status", status),
+			slog.String("path", c.Request.URL.Path),
+			slog.Duration("latency", time.Since(start)),
+			slog.String("client_ip", c.ClientIP()),
+			slog.Int("bytes", c.Writer.Size()),
+		}
+		if len(c.Errors) > 0 {
+			accessAttributes = append(accessAttributes, slog.String("errors", c.Errors.String()))
+		}
+
+		reqctx.LoggerFrom(c.Request.Context(), accessLogComponent).
+			LogAttrs(c.Request.Context(), level, "request handled", accessAttributes...)
+	}
+}
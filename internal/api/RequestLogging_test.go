@@ -0,0 +1,74 @@
+package api_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+
+	"todo-api-go/api"
+	"todo-api-go/persistence"
+	"todo-api-go/reqctx"
+	"todo-api-go/testsupport"
+)
+
+func TestRequestLogger(t *testing.T) {
+	assert := assert.New(t)
+
+	var output bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&output, nil)))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	router := gin.New()
+	router.Use(api.RequestID())
+	router.Use(api.RequestLogger())
+	api.RegisterRoutes(router, testsupport.CreateTestManager(t), &MockAuthorizer{Principal: &reqctx.Principal{Subject: "alice"}})
+
+	req, _ := http.NewRequest("GET", "/api/todo/999", nil)
+	req.Header.Set(api.RequestIDHeader, "logged-request")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	assert.Equalf(404, recorder.Code, "Expected not found response")
+
+	var entry map[string]any
+	err := json.Unmarshal(output.Bytes(), &entry)
+	assert.Nilf(err, "access log should be a single JSON entry, not %s", output.String())
+	assert.Equalf("WARN", entry["level"], "client errors should be logged as warnings")
+	assert.Equalf("access", entry[reqctx.ComponentKey], "component should match")
+	assert.Equalf("logged-request", entry["request_id"], "request ID should match")
+	assert.Equalf("/api/todo/:id", entry["route"], "route should match")
+	assert.Equalf("alice", entry[reqctx.SubjectKey], "subject should match")
+	assert.Equalf(float64(404), entry["status"], "status should match")
+}
+
+func TestRequestTelemetry(t *testing.T) {
+	assert := assert.New(t)
+
+	telemetry := testsupport.InstallTestTelemetry(t)
+
+	router := gin.New()
+	router.Use(api.RequestID())
+	router.Use(api.RequestLogger())
+	api.RegisterRoutes(router, testsupport.CreateTestManager(t), &MockAuthorizer{Principal: &reqctx.Principal{Subject: "alice", Tenant: "acme"}})
+
+	req, _ := http.NewRequest("GET", "/api/todo?limit=3", nil)
+	req.Header.Set(api.RequestIDHeader, "traced-request")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	assert.Equalf(200, recorder.Code, "Expected successful response")
+
+	telemetry.AssertSpan(persistence.SpanFindAll,
+		persistence.AttributePageSize.Int(3),
+		persistence.AttributeTenant.String("acme"))
+	telemetry.AssertLog("request handled",
+		attribute.String(reqctx.ComponentKey, "access"),
+		attribute.String("request_id", "traced-request"),
+		attribute.Int("status", 200))
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"todo-api-go/entities"
+	"todo-api-go/persistence"
+)
+
+type ShareRequest struct {
+	GranteeType string `binding:"required"`
+	GranteeID   string `binding:"required"`
+	Permission  string `binding:"required"`
+}
+
+// registerShareRoutes registers the routes for managing the collaborators of a ToDo item.
+//
+// gin: The Gin engine to register the routes with.
+// mgr: The ToDo entity manager.
+// authFactory: The factory for the authorization middleware.
+// middleware: Handlers to run on every route once the caller has been authorized.
+func registerShareRoutes(gin *gin.Engine, mgr *persistence.ToDoEntityManager, authFactory AuthorizerFactory, middleware []gin.HandlerFunc) {
+	gin.GET("/api/todo/:id/shares", secured(authFactory, "retrieve", middleware, getSharesHandler(mgr))...)
+	gin.POST("/api/todo/:id/shares", secured(authFactory, "update", middleware, createShareHandler(mgr))...)
+	gin.DELETE("/api/todo/:id/shares/:shareId", secured(authFactory, "update", middleware, deleteShareHandler(mgr))...)
+}
+
+// createShareHandler creates a HandlerFunc function for sharing a ToDoItemEntity with
+// a user or group.
+//
+// It takes a manager of type *persistence.ToDoEntityManager as a parameter.
+// The function returns a gin.HandlerFunc.
+func createShareHandler(manager *persistence.ToDoEntityManager) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var request ShareRequest
+		err = c.BindJSON(&request)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		share := entities.ToDoShareEntity{
+			ItemID:      uint(id),
+			GranteeType: request.GranteeType,
+			GranteeID:   request.GranteeID,
+			Permission:  request.Permission,
+		}
+
+		err = manager.WithContext(c.Request.Context()).Share(&share)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		writeJSON(c, http.StatusCreated, share)
+	})
+}
+
+// deleteShareHandler creates a HandlerFunc function for revoking a share of a ToDoItemEntity.
+//
+// It takes a manager of type *persistence.ToDoEntityManager as a parameter.
+// The function returns a gin.HandlerFunc.
+func deleteShareHandler(manager *persistence.ToDoEntityManager) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		shareId, err := strconv.Atoi(c.Param("shareId"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		err = manager.WithContext(c.Request.Context()).Unshare(uint(id), uint(shareId))
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.Status(http.StatusOK)
+	})
+}
+
+// getSharesHandler creates a HandlerFunc function for listing the shares of a ToDoItemEntity.
+//
+// It takes a manager of type *persistence.ToDoEntityManager as a parameter.
+// The function returns a gin.HandlerFunc.
+func getSharesHandler(manager *persistence.ToDoEntityManager) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		shares, err := manager.WithContext(c.Request.Context()).FindShares(uint(id))
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		writeJSON(c, http.StatusOK, shares)
+	})
+}
@@ -0,0 +1,83 @@
+package api_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"todo-api-go/api"
+	"todo-api-go/entities"
+	"todo-api-go/reqctx"
+	"todo-api-go/testsupport"
+)
+
+func TestShares(t *testing.T) {
+	assert := assert.New(t)
+
+	mgr := testsupport.CreateTestManager(t)
+	assert.NotNilf(mgr, "manager should not be nil")
+
+	alice := &reqctx.Principal{Subject: "alice"}
+	bob := &reqctx.Principal{Subject: "bob"}
+
+	marshalled, _ := json.Marshal(&entities.ToDoItemEntity{Description: "Private Todo Item"})
+	req, _ := http.NewRequest("POST", "/api/todo", bytes.NewBuffer(marshalled))
+	recorder := makeRequestAs(mgr, req, alice)
+	assert.Equalf(201, recorder.Code, "Expected successful response")
+
+	var item entities.ToDoItemEntity
+	err := json.Unmarshal(recorder.Body.Bytes(), &item)
+	assert.Nilf(err, "error should be nil")
+
+	itemPath := fmt.Sprintf("/api/todo/%d", item.ID)
+	req, _ = http.NewRequest("GET", itemPath, nil)
+	recorder = makeRequestAs(mgr, req, bob)
+	assert.Equalf(404, recorder.Code, "Expected not found response")
+
+	marshalled, _ = json.Marshal(&api.ShareRequest{
+		GranteeType: entities.GranteeUser,
+		GranteeID:   "bob",
+		Permission:  entities.PermissionViewer,
+	})
+	req, _ = http.NewRequest("POST", itemPath+"/shares", bytes.NewBuffer(marshalled))
+	recorder = makeRequestAs(mgr, req, bob)
+	assert.Equalf(404, recorder.Code, "Expected not found response")
+
+	req, _ = http.NewRequest("POST", itemPath+"/shares", bytes.NewBuffer(marshalled))
+	recorder = makeRequestAs(mgr, req, alice)
+	assert.Equalf(201, recorder.Code, "Expected successful response")
+
+	var share entities.ToDoShareEntity
+	err = json.Unmarshal(recorder.Body.Bytes(), &share)
+	assert.Nilf(err, "error should be nil")
+
+	req, _ = http.NewRequest("GET", itemPath, nil)
+	recorder = makeRequestAs(mgr, req, bob)
+	assert.Equalf(200, recorder.Code, "Expected successful response")
+
+	req, _ = http.NewRequest("GET", itemPath+"/shares", nil)
+	recorder = makeRequestAs(mgr, req, bob)
+	assert.Equalf(200, recorder.Code, "Expected successful response")
+
+	var shares []entities.ToDoShareEntity
+	err = json.Unmarshal(recorder.Body.Bytes(), &shares)
+	assert.Nilf(err, "error should be nil")
+	assert.Equalf(1, len(shares), "length should be 1")
+	assert.Equalf("bob", shares[0].GranteeID, "grantee should match")
+
+	req, _ = http.NewRequest("DELETE", itemPath, nil)
+	recorder = makeRequestAs(mgr, req, bob)
+	assert.Equalf(403, recorder.Code, "Expected forbidden response")
+
+	req, _ = http.NewRequest("DELETE", fmt.Sprintf("%s/shares/%d", itemPath, share.ID), nil)
+	recorder = makeRequestAs(mgr, req, alice)
+	assert.Equalf(200, recorder.Code, "Expected successful response")
+
+	req, _ = http.NewRequest("GET", itemPath, nil)
+	recorder = makeRequestAs(mgr, req, bob)
+	assert.Equalf(404, recorder.Code, "Expected not found response")
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"todo-api-go/entities"
+	"todo-api-go/persistence"
+)
+
+type ChildrenResponse struct {
+	Meta ListMetadata
+	// Completion of the direct subtasks of the item
+	Progress persistence.ItemProgress
+	Data     []entities.ToDoItemEntity
+}
+
+type MoveRequest struct {
+	// The new parent of the item; zero for the top level
+	ParentID uint
+}
+
+// registerSubtaskRoutes registers the routes for listing and moving the subtasks of ToDo items.
+//
+// gin: The Gin engine to register the routes with.
+// mgr: The ToDo entity manager.
+// authFactory: The factory for the authorization middleware.
+// middleware: Handlers to run on every route once the caller has been authorized.
+func registerSubtaskRoutes(gin *gin.Engine, mgr *persistence.ToDoEntityManager, authFactory AuthorizerFactory, middleware []gin.HandlerFunc) {
+	gin.GET("/api/todo/:id/children", secured(authFactory, "retrieve", middleware, getChildrenHandler(mgr))...)
+	gin.PUT("/api/todo/:id/parent", secured(authFactory, "update", middleware, moveToDoItemHandler(mgr))...)
+}
+
+// getChildrenHandler creates a HandlerFunc function for listing the direct subtasks of a
+// ToDoItemEntity with pagination, together with the progress of the item.
+//
+// It takes a manager of type *persistence.ToDoEntityManager as a parameter.
+// The function returns a gin.HandlerFunc.
+func getChildrenHandler(manager *persistence.ToDoEntityManager) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		mgr := manager.WithContext(c.Request.Context())
+
+		children, total, err := mgr.FindChildren(uint(id), getPagingConfigurator(c))
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		progress, err := mgr.Progress(uint(id))
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		response := ChildrenResponse{
+			Meta:     ListMetadata{Total: total},
+			Progress: *progress,
+			Data:     children,
+		}
+		writeJSON(c, http.StatusOK, response)
+	})
+}
+
+// moveToDoItemHandler creates a HandlerFunc function for moving a ToDoItemEntity below another
+// item, or to the top level.
+//
+// It takes a manager of type *persistence.ToDoEntityManager as a parameter.
+// The function returns a gin.HandlerFunc.
+func moveToDoItemHandler(manager *persistence.ToDoEntityManager) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var request MoveRequest
+		err = c.BindJSON(&request)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		item, err := manager.WithContext(c.Request.Context()).Move(uint(id), request.ParentID)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		writeJSON(c, http.StatusOK, item)
+	})
+}
@@ -0,0 +1,73 @@
+package api_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"todo-api-go/api"
+	"todo-api-go/entities"
+	"todo-api-go/persistence"
+	"todo-api-go/testsupport"
+)
+
+func TestSubtasks(t *testing.T) {
+	assert := assert.New(t)
+
+	mgr := testsupport.CreateTestManager(t)
+
+	parent := &entities.ToDoItemEntity{Description: "Move house"}
+	err := mgr.Create(parent)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	marshalled, _ := json.Marshal(&entities.ToDoItemEntity{Description: "Pack the boxes", ParentID: parent.ID, Completed: true})
+	req, _ := http.NewRequest("POST", "/api/todo", bytes.NewBuffer(marshalled))
+	recorder := makeRequest(mgr, req)
+	assert.Equalf(201, recorder.Code, "Expected successful response")
+
+	var child entities.ToDoItemEntity
+	err = json.Unmarshal(recorder.Body.Bytes(), &child)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	err = mgr.Create(&entities.ToDoItemEntity{Description: "Hire movers", ParentID: parent.ID})
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	req, _ = http.NewRequest("GET", fmt.Sprintf("/api/todo/%d/children", parent.ID), nil)
+	recorder = makeRequest(mgr, req)
+	assert.Equalf(200, recorder.Code, "Expected successful response")
+
+	var children api.ChildrenResponse
+	err = json.Unmarshal(recorder.Body.Bytes(), &children)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf(int64(2), children.Meta.Total, "subtasks should be counted")
+	assert.Equalf(persistence.ItemProgress{Total: 2, Completed: 1, Percent: 50}, children.Progress, "progress should be returned")
+
+	marshalled, _ = json.Marshal(&api.MoveRequest{ParentID: child.ID})
+	req, _ = http.NewRequest("PUT", fmt.Sprintf("/api/todo/%d/parent", parent.ID), bytes.NewBuffer(marshalled))
+	recorder = makeRequest(mgr, req)
+	assert.Equalf(400, recorder.Code, "Expected cycles to be rejected")
+
+	marshalled, _ = json.Marshal(&api.MoveRequest{})
+	req, _ = http.NewRequest("PUT", fmt.Sprintf("/api/todo/%d/parent", child.ID), bytes.NewBuffer(marshalled))
+	recorder = makeRequest(mgr, req)
+	assert.Equalf(200, recorder.Code, "Expected successful response")
+
+	req, _ = http.NewRequest("DELETE", fmt.Sprintf("/api/todo/%d", parent.ID), nil)
+	recorder = makeRequest(mgr, req)
+	assert.Equalf(409, recorder.Code, "Expected items with subtasks not to be deleted by default")
+
+	req, _ = http.NewRequest("DELETE", fmt.Sprintf("/api/todo/%d?subtasks=shred", parent.ID), nil)
+	recorder = makeRequest(mgr, req)
+	assert.Equalf(400, recorder.Code, "Expected unknown rules to be rejected")
+
+	req, _ = http.NewRequest("DELETE", fmt.Sprintf("/api/todo/%d?subtasks=cascade", parent.ID), nil)
+	recorder = makeRequest(mgr, req)
+	assert.Equalf(200, recorder.Code, "Expected successful response")
+
+	_, err = mgr.FineOne(int(child.ID))
+	assert.Nilf(err, "moved items should not be deleted along with their former parent")
+}
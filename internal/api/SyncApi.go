@@ -0,0 +1,145 @@
+package api
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"todo-api-go/entities"
+	"todo-api-go/persistence"
+)
+
+// Header carrying the sync token an update of an item is based on
+const SyncTokenHeader = "X-Sync-Token"
+
+// Prefix of the decoded sync tokens, versioning their format
+const syncTokenPrefix = "v1:"
+
+type ChangesResponse struct {
+	// Items created or changed since the token, in their current state
+	Changed []entities.ToDoItemEntity
+
+	// Tombstones of the items deleted since the token
+	Deleted []persistence.ItemTombstone
+
+	// Token to retrieve subsequent changes with
+	Token string
+}
+
+type ConflictResponse struct {
+	Error string
+
+	// Fields changed differently since the token the update was based on
+	Fields []string
+
+	// Current state of the item
+	Current entities.ToDoItemEntity
+
+	// Token to base an update resolving the conflict on
+	Token string
+}
+
+// registerSyncRoutes registers the routes for the delta synchronization of offline clients.
+//
+// gin: The Gin engine to register the routes with.
+// mgr: The ToDo entity manager.
+// authFactory: The factory for the authorization middleware.
+// middleware: Handlers to run on every route once the caller has been authorized.
+func registerSyncRoutes(gin *gin.Engine, mgr *persistence.ToDoEntityManager, authFactory AuthorizerFactory, middleware []gin.HandlerFunc) {
+	gin.GET("/api/todo/changes", secured(authFactory, "retrieve", middleware, getChangesHandler(mgr))...)
+}
+
+// getChangesHandler creates a HandlerFunc function for retrieving the changes of the items visible
+// to the caller since the sync token of the since query parameter. Without a token, all visible
+// items are returned as changed.
+//
+// It takes a manager of type *persistence.ToDoEntityManager as a parameter.
+// The function returns a gin.HandlerFunc.
+func getChangesHandler(manager *persistence.ToDoEntityManager) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		var since uint
+		if value := c.Query("since"); value != "" {
+			var ok bool
+			since, ok = parseItemSyncToken(value)
+			if !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid sync token"})
+				return
+			}
+		}
+
+		changes, err := manager.WithContext(c.Request.Context()).FindChanges(since)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		response := ChangesResponse{
+			Changed: changes.Changed,
+			Deleted: changes.Deleted,
+			Token:   formatItemSyncToken(changes.Token),
+		}
+		writeJSON(c, http.StatusOK, response)
+	})
+}
+
+// updateSince updates an item with the state a client derived from the state identified by
+// the sync token of the X-Sync-Token header, merging the changes made since.
+//
+// Conflicting changes are rejected with the conflicting fields and the current state of the item.
+// It returns false if a response has been written.
+func updateSince(c *gin.Context, manager *persistence.ToDoEntityManager, item *entities.ToDoItemEntity) bool {
+	since, ok := parseItemSyncToken(c.GetHeader(SyncTokenHeader))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid sync token"})
+		return false
+	}
+
+	err := manager.WithContext(c.Request.Context()).UpdateSince(item, since)
+
+	var conflict *persistence.ConflictError
+	if errors.As(err, &conflict) {
+		writeJSON(c, http.StatusConflict, ConflictResponse{
+			Error:   conflict.Error(),
+			Fields:  conflict.Fields,
+			Current: conflict.Current,
+			Token:   formatItemSyncToken(conflict.Token),
+		})
+		return false
+	}
+	if err != nil {
+		writeError(c, err)
+		return false
+	}
+
+	return true
+}
+
+// formatItemSyncToken formats a sync token of the persistence layer as an opaque token.
+func formatItemSyncToken(token uint) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(syncTokenPrefix + strconv.FormatUint(uint64(token), 10)))
+}
+
+// parseItemSyncToken parses a token formatted by formatItemSyncToken. It returns false if the
+// token was not issued by formatItemSyncToken.
+func parseItemSyncToken(value string) (uint, bool) {
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimSpace(value))
+	if err != nil {
+		return 0, false
+	}
+
+	digits, found := strings.CutPrefix(string(decoded), syncTokenPrefix)
+	if !found {
+		return 0, false
+	}
+
+	token, err := strconv.ParseUint(digits, 10, 0)
+	if err != nil || token == 0 {
+		return 0, false
+	}
+
+	return uint(token), true
+}
@@ -0,0 +1,114 @@
+package api_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"todo-api-go/api"
+	"todo-api-go/entities"
+	"todo-api-go/persistence"
+	"todo-api-go/testsupport"
+)
+
+func TestChanges(t *testing.T) {
+	assert := assert.New(t)
+
+	mgr := testsupport.CreateTestManager(t)
+
+	req, _ := http.NewRequest("GET", "/api/todo/changes", nil)
+	recorder := makeRequest(mgr, req)
+	assert.Equalf(200, recorder.Code, "Expected successful response")
+
+	var response api.ChangesResponse
+	err := json.Unmarshal(recorder.Body.Bytes(), &response)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Lenf(response.Changed, 10, "the initial changes should cover all items")
+	assert.NotEmptyf(response.Token, "a token should be returned")
+	token := response.Token
+
+	err = mgr.Update(&entities.ToDoItemEntity{ID: 2, Description: "Changed"})
+	assert.Nilf(err, "error should be nil, not %s", err)
+	err = mgr.Delete(3)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	req, _ = http.NewRequest("GET", "/api/todo/changes?since="+url.QueryEscape(token), nil)
+	recorder = makeRequest(mgr, req)
+	assert.Equalf(200, recorder.Code, "Expected successful response")
+
+	err = json.Unmarshal(recorder.Body.Bytes(), &response)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf([]uint{2}, testsupport.CollectIds(response.Changed), "changed items should be returned")
+	if assert.Lenf(response.Deleted, 1, "tombstones should be returned") {
+		assert.Equalf(uint(3), response.Deleted[0].ID, "deleted item should be identified")
+	}
+	assert.NotEqualf(token, response.Token, "the token should advance")
+
+	req, _ = http.NewRequest("GET", "/api/todo/changes?since=garbage", nil)
+	recorder = makeRequest(mgr, req)
+	assert.Equalf(400, recorder.Code, "invalid tokens should be rejected")
+}
+
+func TestUpdateSince(t *testing.T) {
+	assert := assert.New(t)
+
+	mgr := testsupport.CreateTestManager(t)
+
+	item := &entities.ToDoItemEntity{Description: "Original"}
+	err := mgr.Create(item)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	req, _ := http.NewRequest("GET", "/api/todo/changes", nil)
+	var changes api.ChangesResponse
+	err = json.Unmarshal(makeRequest(mgr, req).Body.Bytes(), &changes)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	err = mgr.Update(&entities.ToDoItemEntity{ID: item.ID, Description: "Server"})
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	// Completing the item offline merges with the change of the description
+	completed := *item
+	completed.Completed = true
+	recorder := putSince(mgr, &completed, changes.Token)
+	assert.Equalf(200, recorder.Code, "Expected successful response")
+
+	var updated entities.ToDoItemEntity
+	err = json.Unmarshal(recorder.Body.Bytes(), &updated)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Truef(updated.Completed, "the change of the client should be applied")
+	assert.Equalf("Server", updated.Description, "the change of the server should be kept")
+
+	// Changing the description offline conflicts with the change of the server
+	renamed := *item
+	renamed.Description = "Client"
+	recorder = putSince(mgr, &renamed, changes.Token)
+	assert.Equalf(409, recorder.Code, "conflicting changes should be rejected")
+
+	var conflict api.ConflictResponse
+	err = json.Unmarshal(recorder.Body.Bytes(), &conflict)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf([]string{"Description"}, conflict.Fields, "conflicting fields should be returned")
+	assert.Equalf("Server", conflict.Current.Description, "the current state should be returned")
+
+	resolved := conflict.Current
+	resolved.Description = "Client"
+	recorder = putSince(mgr, &resolved, conflict.Token)
+	assert.Equalf(200, recorder.Code, "Expected successful response")
+
+	recorder = putSince(mgr, &resolved, "garbage")
+	assert.Equalf(400, recorder.Code, "invalid tokens should be rejected")
+}
+
+func putSince(mgr *persistence.ToDoEntityManager, item *entities.ToDoItemEntity, token string) *httptest.ResponseRecorder {
+	marshalled, _ := json.Marshal(item)
+	req, _ := http.NewRequest("PUT", "/api/todo/"+strconv.Itoa(int(item.ID)), bytes.NewBuffer(marshalled))
+	req.Header.Set(api.SyncTokenHeader, token)
+
+	return makeRequest(mgr, req)
+}
@@ -1,13 +1,16 @@
 package api
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
 	"todo-api-go/entities"
 	"todo-api-go/persistence"
+	"todo-api-go/reqctx"
 )
 
 type ListMetadata struct {
@@ -27,12 +30,22 @@ type AuthorizerFactory interface {
 //
 // gin: The Gin engine to register the routes with.
 // mgr: The ToDo entity manager.
+// authFactory: The factory for the authorization middleware.
+// middleware: Handlers to run on every route once the caller has been authorized.
 // Returns the registered Gin engine.
-func RegisterRoutes(gin *gin.Engine, mgr *persistence.ToDoEntityManager, authFactory AuthorizerFactory) *gin.Engine {
-	gin.DELETE("/api/todo/:id", authFactory.RequiresRole("delete"), deleteToDoItemHandler(mgr))
-	gin.GET("/api/todo", authFactory.RequiresRole("retrieve"), getAllToDoItemsHandler(mgr))
-	gin.GET("/api/todo/:id", authFactory.RequiresRole("retreive"), getToDoByIdHandler(mgr))
-	gin.POST("/api/todo", authFactory.RequiresRole("create"), createToDoItemHandler(mgr))
+func RegisterRoutes(gin *gin.Engine, mgr *persistence.ToDoEntityManager, authFactory AuthorizerFactory, middleware ...gin.HandlerFunc) *gin.Engine {
+	gin.DELETE("/api/todo/:id", secured(authFactory, "delete", middleware, deleteToDoItemHandler(mgr))...)
+	gin.GET("/api/todo", secured(authFactory, "retrieve", middleware, getAllToDoItemsHandler(mgr))...)
+	gin.GET("/api/todo/:id", secured(authFactory, "retrieve", middleware, getToDoByIdHandler(mgr))...)
+	gin.POST("/api/todo", secured(authFactory, "create", middleware, createToDoItemHandler(mgr))...)
+	gin.PUT("/api/todo/:id", secured(authFactory, "update", middleware, updateToDoItemHandler(mgr))...)
+
+	registerShareRoutes(gin, mgr, authFactory, middleware)
+	registerHistoryRoutes(gin, mgr, authFactory, middleware)
+	registerTransferRoutes(gin, mgr, authFactory, middleware)
+	registerSyncRoutes(gin, mgr, authFactory, middleware)
+	registerRecurrenceRoutes(gin, mgr, authFactory, middleware)
+	registerSubtaskRoutes(gin, mgr, authFactory, middleware)
 
 	return gin
 }
@@ -52,17 +65,21 @@ func createToDoItemHandler(manager *persistence.ToDoEntityManager) gin.HandlerFu
 
 		err = manager.WithContext(c.Request.Context()).Create(&item)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			writeError(c, err)
 			return
 		}
 
-		c.IndentedJSON(http.StatusCreated, item)
+		writeJSON(c, http.StatusCreated, item)
 	})
 }
 
 // deleteToDoItemHandler creates a HandlerFunc function for deleting a ToDoItemEntity
 // by identifier
 //
+// The "subtasks" query parameter determines what happens to the subtasks of the item: "orphan"
+// turns them into top-level items, "cascade" deletes them, and "block", the default, refuses
+// to delete items with subtasks.
+//
 // It takes a manager of type *persistence.ToDoEntityManager as a parameter.
 // The function returns a gin.HandlerFunc.
 func deleteToDoItemHandler(manager *persistence.ToDoEntityManager) gin.HandlerFunc {
@@ -75,9 +92,15 @@ func deleteToDoItemHandler(manager *persistence.ToDoEntityManager) gin.HandlerFu
 			return
 		}
 
-		err = manager.WithContext(c.Request.Context()).Delete(uint(id))
+		rule, err := persistence.ParseDeleteRule(c.Query("subtasks"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		err = manager.WithContext(c.Request.Context()).DeleteWith(uint(id), rule)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			writeError(c, err)
 			return
 		}
 
@@ -88,21 +111,26 @@ func deleteToDoItemHandler(manager *persistence.ToDoEntityManager) gin.HandlerFu
 // getAllToDoItemsHandler creates a HandlerFunc function for getting all ToDoItemEntity's with
 // pagination.
 //
+// The items can be filtered by the "completed", "due_before", "due_after" and "q" query parameters.
+// The page is returned as JSON, CSV or newline delimited JSON depending on the Accept header.
+//
 // It takes a manager of type *persistence.ToDoEntityManager as a parameter.
 // The function returns a gin.HandlerFunc.
 func getAllToDoItemsHandler(manager *persistence.ToDoEntityManager) gin.HandlerFunc {
 	return gin.HandlerFunc(func(c *gin.Context) {
-		items, total, err := manager.WithContext(c.Request.Context()).FindAll(getPagingConfigurator(c))
+		filter, err := getItemFilter(c)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
-		response := FindResponse{
-			Meta: ListMetadata{Total: total},
-			Data: items,
+		items, total, err := manager.WithContext(c.Request.Context()).FindMatching(filter, getPagingConfigurator(c))
+		if err != nil {
+			writeError(c, err)
+			return
 		}
-		c.IndentedJSON(http.StatusOK, response)
+
+		writeItems(c, items, total)
 	})
 }
 
@@ -130,6 +158,8 @@ func getPagingConfigurator(c *gin.Context) func(*persistence.PagingOptions) {
 // It expects a Gin context object `c`, which contains the ID of the to-do item as a URL parameter.
 // The function first parses the ID from the URL parameter and handles any parsing errors.
 // It then calls the `FineOne` method of the `manager` to retrieve the to-do item with the given ID.
+// If the "as_of" query parameter holds an RFC 3339 timestamp, the item is instead retrieved as it was at that time
+// using the `FindAsOf` method.
 // If any error occurs during the retrieval process, it returns a JSON response with the corresponding error message.
 // Otherwise, it returns a JSON response with the retrieved to-do item.
 func getToDoByIdHandler(manager *persistence.ToDoEntityManager) gin.HandlerFunc {
@@ -142,12 +172,108 @@ func getToDoByIdHandler(manager *persistence.ToDoEntityManager) gin.HandlerFunc
 			return
 		}
 
-		todo, err := manager.WithContext(c.Request.Context()).FineOne(id)
+		var todo *entities.ToDoItemEntity
+		if asOf := c.Query("as_of"); asOf != "" {
+			at, parseErr := time.Parse(time.RFC3339, asOf)
+			if parseErr != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": parseErr.Error()})
+				return
+			}
+
+			todo, err = manager.WithContext(c.Request.Context()).FindAsOf(id, at)
+		} else {
+			todo, err = manager.WithContext(c.Request.Context()).FineOne(id)
+		}
+
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			writeError(c, err)
 			return
 		}
 
-		c.IndentedJSON(http.StatusOK, todo)
+		writeJSON(c, http.StatusOK, todo)
 	})
 }
+
+// updateToDoItemHandler creates a HandlerFunc function for updating a ToDoItemEntity
+// by identifier. Updates carrying the X-Sync-Token header are merged with the changes
+// made since the token.
+//
+// It takes a manager of type *persistence.ToDoEntityManager as a parameter.
+// The function returns a gin.HandlerFunc.
+func updateToDoItemHandler(manager *persistence.ToDoEntityManager) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		id_value := c.Param("id")
+		id, err := strconv.Atoi(id_value)
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var item entities.ToDoItemEntity
+		err = c.BindJSON(&item)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		item.ID = uint(id)
+		if c.GetHeader(SyncTokenHeader) != "" {
+			if !updateSince(c, manager, &item) {
+				return
+			}
+		} else {
+			err = manager.WithContext(c.Request.Context()).Update(&item)
+			if err != nil {
+				writeError(c, err)
+				return
+			}
+		}
+
+		writeJSON(c, http.StatusOK, item)
+	})
+}
+
+// secured assembles the handler chain of a route: the authorization check for the role,
+// followed by the route middleware and finally the route handler.
+//
+// Middleware such as rate limiting runs after authorization, so that it can rely on the
+// principal of the request. Limits that have to apply to unauthorized requests as well belong
+// in front of the routes instead.
+func secured(authFactory AuthorizerFactory, role string, middleware []gin.HandlerFunc, handler gin.HandlerFunc) []gin.HandlerFunc {
+	handlers := []gin.HandlerFunc{authFactory.RequiresRole(role)}
+	handlers = append(handlers, middleware...)
+
+	return append(handlers, handler)
+}
+
+// writeError writes a JSON error response with a status code matching the error.
+//
+// Errors reported by the persistence layer are mapped to the corresponding client error
+// status codes. Any other error results in an internal server error, which is logged.
+func writeError(c *gin.Context, err error) {
+	status := errorStatus(err)
+	if status == http.StatusInternalServerError {
+		reqctx.LoggerFrom(c.Request.Context(), logComponent).
+			ErrorContext(c.Request.Context(), "request failed", "error", err)
+	}
+
+	c.JSON(status, gin.H{"error": err.Error()})
+}
+
+// errorStatus maps errors reported by the persistence layer onto the corresponding client error
+// status codes, and any other error onto an internal server error.
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, persistence.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, persistence.ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, persistence.ErrInvalid):
+		return http.StatusBadRequest
+	case errors.Is(err, persistence.ErrConflict):
+		return http.StatusConflict
+	}
+
+	return http.StatusInternalServerError
+}
@@ -2,7 +2,9 @@ package api_test
 
 import (
 	"bytes"
+	"encoding/csv"
 	"encoding/json"
+	"strings"
 	"testing"
 
 	"net/http"
@@ -14,14 +16,20 @@ import (
 	"todo-api-go/api"
 	"todo-api-go/entities"
 	"todo-api-go/persistence"
+	"todo-api-go/reqctx"
 	"todo-api-go/testsupport"
 )
 
 type MockAuthorizer struct {
+	Principal *reqctx.Principal
 }
 
 func (mock *MockAuthorizer) RequiresRole(role string) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if mock.Principal != nil {
+			c.Request = c.Request.WithContext(reqctx.WithPrincipal(c.Request.Context(), mock.Principal))
+		}
+
 		c.Next()
 	}
 }
@@ -96,6 +104,53 @@ func TestGetAll(t *testing.T) {
 	assert.ElementsMatchf([]uint{2, 3, 4, 5, 6}, testsupport.CollectIds(response.Data), "IDs should match")
 }
 
+func TestGetAllFormats(t *testing.T) {
+	assert := assert.New(t)
+
+	mgr := testsupport.CreateTestManager(t)
+
+	req, _ := http.NewRequest("GET", "/api/todo?limit=2", nil)
+	recorder := makeRequest(mgr, req)
+	assert.Equalf(200, recorder.Code, "Expected successful response")
+	assert.NotContainsf(recorder.Body.String(), "\n", "JSON should be compact by default")
+
+	req, _ = http.NewRequest("GET", "/api/todo?limit=2&pretty=true", nil)
+	recorder = makeRequest(mgr, req)
+	assert.Equalf(200, recorder.Code, "Expected successful response")
+	assert.Containsf(recorder.Body.String(), "\n    ", "JSON should be indented when pretty")
+
+	req, _ = http.NewRequest("GET", "/api/todo?limit=2", nil)
+	req.Header.Set("Accept", api.MIMECSV)
+	recorder = makeRequest(mgr, req)
+	assert.Equalf(200, recorder.Code, "Expected successful response")
+	assert.Equalf("10", recorder.Header().Get(api.TotalCountHeader), "total should be passed in a header")
+
+	records, err := csv.NewReader(recorder.Body).ReadAll()
+	assert.Nilf(err, "error should be nil, not %s", err)
+	if assert.Lenf(records, 3, "CSV should have a header and two rows") {
+		assert.Equalf("id", records[0][0], "header should name the columns")
+		assert.Equalf([]string{"1", "Todo Item 0", "false", "2025-01-01T00:00:00Z"}, records[1][:4], "first row should match")
+	}
+
+	req, _ = http.NewRequest("GET", "/api/todo?limit=2", nil)
+	req.Header.Set("Accept", api.MIMENDJSON)
+	recorder = makeRequest(mgr, req)
+	assert.Equalf(200, recorder.Code, "Expected successful response")
+
+	lines := strings.Split(strings.TrimSpace(recorder.Body.String()), "\n")
+	if assert.Lenf(lines, 2, "NDJSON should have one line per item") {
+		var item entities.ToDoItemEntity
+		err = json.Unmarshal([]byte(lines[1]), &item)
+		assert.Nilf(err, "error should be nil, not %s", err)
+		assert.Equalf(2, int(item.ID), "IDs should match")
+	}
+
+	req, _ = http.NewRequest("GET", "/api/todo", nil)
+	req.Header.Set("Accept", "application/xml")
+	recorder = makeRequest(mgr, req)
+	assert.Equalf(406, recorder.Code, "Expected not acceptable response")
+}
+
 func TestGetByID(t *testing.T) {
 	assert := assert.New(t)
 
@@ -113,8 +168,43 @@ func TestGetByID(t *testing.T) {
 	assert.Equalf("Todo Item 0", item.Description, "descriptions should match")
 }
 
+func TestUpdate(t *testing.T) {
+	assert := assert.New(t)
+
+	mgr := testsupport.CreateTestManager(t)
+	assert.NotNilf(mgr, "manager should not be nil")
+
+	item := &entities.ToDoItemEntity{
+		Description: "Updated Todo Item",
+		Completed:   true,
+		DueDate:     testsupport.ParseTestDate("2024-01-01"),
+	}
+	marshalled, err := json.Marshal(item)
+	assert.Nilf(err, "error should be nil")
+
+	req, _ := http.NewRequest("PUT", "/api/todo/2", bytes.NewBuffer(marshalled))
+	recorder := makeRequest(mgr, req)
+	assert.Equalf(200, recorder.Code, "Expected successful response")
+
+	var updated entities.ToDoItemEntity
+	err = json.Unmarshal(recorder.Body.Bytes(), &updated)
+	assert.Nilf(err, "error should be nil")
+	assert.Equalf(2, int(updated.ID), "IDs should match")
+	assert.Equalf("Updated Todo Item", updated.Description, "descriptions should match")
+	assert.Truef(updated.Completed, "item should be completed")
+	assert.Falsef(updated.CompletedAt.IsZero(), "completion time should be set")
+
+	req, _ = http.NewRequest("PUT", "/api/todo/100", bytes.NewBuffer(marshalled))
+	recorder = makeRequest(mgr, req)
+	assert.Equalf(404, recorder.Code, "Expected not found response")
+}
+
 func makeRequest(mgr *persistence.ToDoEntityManager, request *http.Request) *httptest.ResponseRecorder {
-	var mock MockAuthorizer
+	return makeRequestAs(mgr, request, nil)
+}
+
+func makeRequestAs(mgr *persistence.ToDoEntityManager, request *http.Request, principal *reqctx.Principal) *httptest.ResponseRecorder {
+	mock := MockAuthorizer{Principal: principal}
 
 	router := gin.Default()
 	api.RegisterRoutes(router, mgr, &mock)
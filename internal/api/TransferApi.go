@@ -0,0 +1,396 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"todo-api-go/entities"
+	"todo-api-go/persistence"
+)
+
+// Formats of exported and imported items
+const (
+	FormatJSON     = "json"
+	FormatCSV      = "csv"
+	FormatCalendar = "ics"
+)
+
+// Largest request body accepted by imports
+const maxImportSize = 10 << 20
+
+// ImportRow reports the outcome of importing a row of the imported document.
+type ImportRow struct {
+	// Number of the row, counting from 1: the array element of JSON, the record following the
+	// header row of CSV or the VTODO component of iCalendar documents
+	Row int
+
+	persistence.ImportOutcome
+}
+
+type ImportResponse struct {
+	DryRun     bool
+	Created    int
+	Duplicates int
+	Failed     int
+	Rows       []ImportRow
+}
+
+// importRow is a row of an imported document, holding either an item or the reason why the
+// row could not be read.
+type importRow struct {
+	Row  int
+	Item entities.ToDoItemEntity
+	Err  error
+
+	// UID of the calendar component the row was read from, if any
+	UID string
+}
+
+// registerTransferRoutes registers the routes for exporting and importing ToDo items.
+//
+// gin: The Gin engine to register the routes with.
+// mgr: The ToDo entity manager.
+// authFactory: The factory for the authorization middleware.
+// middleware: Handlers to run on every route once the caller has been authorized.
+func registerTransferRoutes(gin *gin.Engine, mgr *persistence.ToDoEntityManager, authFactory AuthorizerFactory, middleware []gin.HandlerFunc) {
+	gin.GET("/api/todo/export", secured(authFactory, "retrieve", middleware, exportToDoItemsHandler(mgr))...)
+	gin.POST("/api/todo/import", secured(authFactory, "create", middleware, importToDoItemsHandler(mgr))...)
+}
+
+// exportToDoItemsHandler creates a HandlerFunc function for exporting the ToDoItemEntity's matching
+// the filter of the request.
+//
+// The "format" query parameter selects JSON, the default, CSV or iCalendar. Items are streamed
+// as they are loaded, so exports are not limited by the page size.
+//
+// It takes a manager of type *persistence.ToDoEntityManager as a parameter.
+// The function returns a gin.HandlerFunc.
+func exportToDoItemsHandler(manager *persistence.ToDoEntityManager) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		filter, err := getItemFilter(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var encoder itemEncoder
+		var contentType string
+
+		format := c.DefaultQuery("format", FormatJSON)
+		switch format {
+		case FormatJSON:
+			encoder, contentType = &jsonArrayEncoder{w: c.Writer}, gin.MIMEJSON
+		case FormatCSV:
+			encoder, contentType = newCSVEncoder(c.Writer), MIMECSV+"; charset=utf-8"
+		case FormatCalendar:
+			encoder, contentType = newCalendarEncoder(c.Writer), MIMECalendar+"; charset=utf-8"
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unsupported format %q", format)})
+			return
+		}
+
+		// Nothing is written until the first item has been loaded, so that failing queries
+		// still result in an error response
+		begun := false
+		begin := func() error {
+			begun = true
+			c.Header("Content-Type", contentType)
+			c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": "todo." + format}))
+			c.Status(http.StatusOK)
+
+			return encoder.Begin()
+		}
+
+		err = manager.WithContext(c.Request.Context()).Export(filter, func(item *entities.ToDoItemEntity) error {
+			if !begun {
+				if err := begin(); err != nil {
+					return err
+				}
+			}
+
+			return encoder.Encode(item)
+		})
+
+		if err == nil && !begun {
+			err = begin()
+		}
+		if err == nil {
+			err = encoder.End()
+		}
+
+		if err != nil {
+			if !begun {
+				writeError(c, err)
+				return
+			}
+
+			// The response has already started, so the error can only be logged
+			_ = c.Error(err)
+		}
+	})
+}
+
+// importToDoItemsHandler creates a HandlerFunc function for importing ToDoItemEntity's.
+//
+// The format of the request body is selected by the "format" query parameter, or derived from
+// its content type otherwise. With the "dry_run" query parameter, the import is validated
+// without creating any items. The response reports the outcome of every row.
+//
+// It takes a manager of type *persistence.ToDoEntityManager as a parameter.
+// The function returns a gin.HandlerFunc.
+func importToDoItemsHandler(manager *persistence.ToDoEntityManager) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		dryRun, _ := strconv.ParseBool(c.Query("dry_run"))
+
+		format := c.Query("format")
+		if format == "" {
+			format = formatOfContentType(c.ContentType())
+		}
+
+		body := http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize)
+
+		var rows []importRow
+		var err error
+		switch format {
+		case FormatJSON:
+			rows, err = parseJSONItems(body)
+		case FormatCSV:
+			rows, err = parseCSVItems(body)
+		case FormatCalendar:
+			rows, err = parseCalendar(body)
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "the format must be one of json, csv or ics"})
+			return
+		}
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var items []entities.ToDoItemEntity
+		for i := range rows {
+			if rows[i].Err == nil {
+				items = append(items, rows[i].Item)
+			}
+		}
+
+		outcomes, err := manager.WithContext(c.Request.Context()).Import(items, dryRun)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		response := ImportResponse{DryRun: dryRun, Rows: make([]ImportRow, 0, len(rows))}
+		for i := range rows {
+			row := ImportRow{Row: rows[i].Row}
+			if rows[i].Err != nil {
+				row.ImportOutcome = persistence.ImportOutcome{Status: persistence.ImportInvalid, Error: rows[i].Err.Error()}
+			} else {
+				row.ImportOutcome, outcomes = outcomes[0], outcomes[1:]
+			}
+
+			switch row.Status {
+			case persistence.ImportCreated, persistence.ImportAccepted:
+				response.Created++
+			case persistence.ImportDuplicate:
+				response.Duplicates++
+			default:
+				response.Failed++
+			}
+
+			response.Rows = append(response.Rows, row)
+		}
+
+		writeJSON(c, http.StatusOK, response)
+	})
+}
+
+// getItemFilter reads the filter of items from the query parameters of the request:
+// "completed", "due_before", "due_after" and "q", searching the description.
+//
+// Points in time are accepted as RFC 3339 timestamps or dates. It returns an error if a
+// parameter is malformed.
+func getItemFilter(c *gin.Context) (persistence.ItemFilter, error) {
+	var filter persistence.ItemFilter
+	var err error
+
+	if value := c.Query("completed"); value != "" {
+		completed, parseErr := strconv.ParseBool(value)
+		if parseErr != nil {
+			return filter, fmt.Errorf("invalid completed: %w", parseErr)
+		}
+		filter.Completed = &completed
+	}
+
+	filter.DueBefore, err = parseTime(c.Query("due_before"))
+	if err != nil {
+		return filter, fmt.Errorf("invalid due_before: %w", err)
+	}
+
+	filter.DueAfter, err = parseTime(c.Query("due_after"))
+	if err != nil {
+		return filter, fmt.Errorf("invalid due_after: %w", err)
+	}
+
+	filter.Search = c.Query("q")
+
+	return filter, nil
+}
+
+// formatOfContentType maps the content type of a request onto an import format.
+func formatOfContentType(contentType string) string {
+	switch contentType {
+	case gin.MIMEJSON:
+		return FormatJSON
+	case MIMECSV:
+		return FormatCSV
+	case MIMECalendar:
+		return FormatCalendar
+	}
+
+	return ""
+}
+
+// parseTime parses an RFC 3339 timestamp or a date, leaving empty values unset.
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if parsed, err := time.Parse(time.DateOnly, value); err == nil {
+		return parsed, nil
+	}
+
+	return time.Parse(time.RFC3339, value)
+}
+
+// parseJSONItems reads items from a JSON array, or from the Data of a list response.
+//
+// Every array element is read separately, so that a malformed item only fails its own row.
+// It returns an error if the document is neither an array nor a list response.
+func parseJSONItems(r io.Reader) ([]importRow, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var elements []json.RawMessage
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		var list struct{ Data []json.RawMessage }
+		err = json.Unmarshal(trimmed, &list)
+		elements = list.Data
+	} else {
+		err = json.Unmarshal(trimmed, &elements)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON document: %w", err)
+	}
+
+	rows := make([]importRow, 0, len(elements))
+	for i, element := range elements {
+		row := importRow{Row: i + 1}
+		row.Err = json.Unmarshal(element, &row.Item)
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// parseCSVItems reads items from CSV with a header row naming the columns.
+//
+// Columns are matched by name, ignoring case, so that they may appear in any order. The
+// description column is required, while columns of system maintained fields such as the ID
+// are ignored. It returns an error if the header row is missing or lacks a description column.
+func parseCSVItems(r io.Reader) ([]importRow, error) {
+	reader := csv.NewReader(bufio.NewReader(r))
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("invalid CSV document: missing header row")
+		}
+		return nil, fmt.Errorf("invalid CSV document: %w", err)
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+
+	if _, ok := columns["description"]; !ok {
+		return nil, errors.New("invalid CSV document: missing description column")
+	}
+
+	var rows []importRow
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		row := importRow{Row: len(rows) + 1}
+
+		var parseErr *csv.ParseError
+		switch {
+		case errors.As(err, &parseErr):
+			row.Err = parseErr.Err
+		case err != nil:
+			return nil, err
+		default:
+			row.Item, row.Err = csvItem(record, columns)
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// csvItem maps a CSV record onto an item, using the column indexes keyed by column name.
+func csvItem(record []string, columns map[string]int) (entities.ToDoItemEntity, error) {
+	field := func(name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var item entities.ToDoItemEntity
+	var err error
+
+	item.Description = field("description")
+
+	if value := field("completed"); value != "" {
+		item.Completed, err = strconv.ParseBool(value)
+		if err != nil {
+			return item, fmt.Errorf("invalid completed: %w", err)
+		}
+	}
+
+	item.DueDate, err = parseTime(field("due_date"))
+	if err != nil {
+		return item, fmt.Errorf("invalid due_date: %w", err)
+	}
+
+	item.CompletedAt, err = parseTime(field("completed_at"))
+	if err != nil {
+		return item, fmt.Errorf("invalid completed_at: %w", err)
+	}
+
+	return item, nil
+}
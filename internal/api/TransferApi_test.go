@@ -0,0 +1,192 @@
+package api_test
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"todo-api-go/api"
+	"todo-api-go/entities"
+	"todo-api-go/persistence"
+	"todo-api-go/testsupport"
+)
+
+func TestExport(t *testing.T) {
+	assert := assert.New(t)
+
+	mgr := testsupport.CreateTestManager(t)
+	item := &entities.ToDoItemEntity{ID: 2, Description: "Done, finally; with a\nsecond line", Completed: true, DueDate: testsupport.ParseTestDate("2025-01-01")}
+	err := mgr.Update(item)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	req, _ := http.NewRequest("GET", "/api/todo/export", nil)
+	recorder := makeRequest(mgr, req)
+	assert.Equalf(200, recorder.Code, "Expected successful response")
+	assert.Equalf(`attachment; filename=todo.json`, recorder.Header().Get("Content-Disposition"), "export should be an attachment")
+
+	var items []entities.ToDoItemEntity
+	err = json.Unmarshal(recorder.Body.Bytes(), &items)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Lenf(items, 10, "all items should be exported")
+
+	req, _ = http.NewRequest("GET", "/api/todo/export?format=csv&completed=false&q=item", nil)
+	recorder = makeRequest(mgr, req)
+	assert.Equalf(200, recorder.Code, "Expected successful response")
+
+	records, err := csv.NewReader(recorder.Body).ReadAll()
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Lenf(records, 10, "only matching items should be exported after the header")
+
+	req, _ = http.NewRequest("GET", "/api/todo/export?format=ics&completed=true", nil)
+	recorder = makeRequest(mgr, req)
+	assert.Equalf(200, recorder.Code, "Expected successful response")
+
+	body := recorder.Body.String()
+	assert.Truef(strings.HasPrefix(body, "BEGIN:VCALENDAR\r\n"), "export should be a calendar")
+	assert.Containsf(body, "UID:2@todo-api-go\r\n", "UID should identify the item")
+	assert.Containsf(body, "SUMMARY:Done\\, finally\\; with a\\nsecond line\r\n", "summary should be escaped")
+	assert.Containsf(body, "DUE:20250101T000000Z\r\n", "due date should be mapped onto DUE")
+	assert.Containsf(body, "STATUS:COMPLETED\r\n", "completion should be mapped onto STATUS")
+	assert.Containsf(body, "\r\nCOMPLETED:", "completion time should be mapped onto COMPLETED")
+	assert.Equalf(1, strings.Count(body, "BEGIN:VTODO"), "only completed items should be exported")
+
+	req, _ = http.NewRequest("GET", "/api/todo/export?format=xml", nil)
+	recorder = makeRequest(mgr, req)
+	assert.Equalf(400, recorder.Code, "Expected bad request response")
+
+	req, _ = http.NewRequest("GET", "/api/todo/export?due_before=tomorrow", nil)
+	recorder = makeRequest(mgr, req)
+	assert.Equalf(400, recorder.Code, "Expected bad request response")
+}
+
+func TestImportCSV(t *testing.T) {
+	assert := assert.New(t)
+
+	mgr := testsupport.CreateTestManager(t)
+	document := "Due_Date,Description,Completed\n" +
+		"2025-03-01,Imported,false\n" +
+		"2025-01-01,Todo Item 3,false\n" +
+		"someday,Broken,false\n" +
+		",,true\n" +
+		"2025-03-01,imported,false\n"
+
+	req, _ := http.NewRequest("POST", "/api/todo/import?dry_run=true", strings.NewReader(document))
+	req.Header.Set("Content-Type", api.MIMECSV)
+	recorder := makeRequest(mgr, req)
+	assert.Equalf(200, recorder.Code, "Expected successful response")
+
+	var response api.ImportResponse
+	err := json.Unmarshal(recorder.Body.Bytes(), &response)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Truef(response.DryRun, "import should be a dry run")
+	assert.Equalf(1, response.Created, "one item should be accepted")
+	assert.Equalf(2, response.Duplicates, "two items should be duplicates")
+	assert.Equalf(2, response.Failed, "two items should fail")
+
+	if assert.Lenf(response.Rows, 5, "every row should be reported") {
+		assert.Equalf(persistence.ImportAccepted, response.Rows[0].Status, "row 1 should be accepted")
+		assert.Equalf(uint(4), response.Rows[1].DuplicateOf, "row 2 should duplicate item 4")
+		assert.Equalf(3, response.Rows[2].Row, "rows should be numbered")
+		assert.Containsf(response.Rows[2].Error, "due_date", "row 3 should report the invalid column")
+		assert.Equalf("description is required", response.Rows[3].Error, "row 4 should lack a description")
+		assert.Equalf(persistence.ImportDuplicate, response.Rows[4].Status, "row 5 should duplicate row 1")
+	}
+
+	_, total, _ := mgr.FindAll()
+	assert.Equalf(int64(10), total, "dry runs should not create items")
+
+	req, _ = http.NewRequest("POST", "/api/todo/import?format=csv", strings.NewReader(document))
+	recorder = makeRequest(mgr, req)
+	assert.Equalf(200, recorder.Code, "Expected successful response")
+
+	_, total, _ = mgr.FindAll()
+	assert.Equalf(int64(11), total, "valid rows should be created")
+
+	req, _ = http.NewRequest("POST", "/api/todo/import?format=csv", strings.NewReader("id,completed\n1,true\n"))
+	recorder = makeRequest(mgr, req)
+	assert.Equalf(400, recorder.Code, "Expected bad request response")
+}
+
+func TestImportJSON(t *testing.T) {
+	assert := assert.New(t)
+
+	mgr := testsupport.CreateTestManager(t)
+	document := `{"Meta": {"Total": 2}, "Data": [{"Description": "From JSON", "Completed": true}, {"Description": 42}]}`
+
+	req, _ := http.NewRequest("POST", "/api/todo/import", strings.NewReader(document))
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	recorder := makeRequest(mgr, req)
+	assert.Equalf(200, recorder.Code, "Expected successful response")
+
+	var response api.ImportResponse
+	err := json.Unmarshal(recorder.Body.Bytes(), &response)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf(1, response.Created, "one item should be created")
+	assert.Equalf(1, response.Failed, "one item should fail")
+
+	created, err := mgr.FineOne(int(response.Rows[0].ID))
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Truef(created.Completed, "completion should be imported")
+
+	req, _ = http.NewRequest("POST", "/api/todo/import?format=json", strings.NewReader("not json"))
+	recorder = makeRequest(mgr, req)
+	assert.Equalf(400, recorder.Code, "Expected bad request response")
+}
+
+func TestImportCalendar(t *testing.T) {
+	assert := assert.New(t)
+
+	mgr := testsupport.CreateTestManager(t)
+	document := "BEGIN:VCALENDAR\r\n" +
+		"VERSION:2.0\r\n" +
+		"BEGIN:VTODO\r\n" +
+		"UID:abc\r\n" +
+		"SUMMARY:Call the plumber\\, urgently and with a summary long enough to be f\r\n" +
+		" olded\r\n" +
+		"DUE;VALUE=DATE:20250301\r\n" +
+		"STATUS:COMPLETED\r\n" +
+		"COMPLETED:20250228T120000Z\r\n" +
+		"BEGIN:VALARM\r\n" +
+		"DESCRIPTION:Alarm\r\n" +
+		"END:VALARM\r\n" +
+		"END:VTODO\r\n" +
+		"BEGIN:VTODO\r\n" +
+		"SUMMARY:Local time\r\n" +
+		"DUE;TZID=Europe/Berlin:20250301T100000\r\n" +
+		"END:VTODO\r\n" +
+		"BEGIN:VTODO\r\n" +
+		"SUMMARY:Broken\r\n" +
+		"DUE:tomorrow\r\n" +
+		"END:VTODO\r\n" +
+		"END:VCALENDAR\r\n"
+
+	req, _ := http.NewRequest("POST", "/api/todo/import", strings.NewReader(document))
+	req.Header.Set("Content-Type", api.MIMECalendar)
+	recorder := makeRequest(mgr, req)
+	assert.Equalf(200, recorder.Code, "Expected successful response")
+
+	var response api.ImportResponse
+	err := json.Unmarshal(recorder.Body.Bytes(), &response)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf(2, response.Created, "two items should be created")
+	assert.Equalf(1, response.Failed, "one item should fail")
+
+	created, err := mgr.FineOne(int(response.Rows[0].ID))
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf("Call the plumber, urgently and with a summary long enough to be folded", created.Description, "summary should be unfolded and unescaped")
+	assert.Truef(created.Completed, "status should be mapped onto completion")
+	assert.Equalf("2025-02-28T12:00:00Z", created.CompletedAt.UTC().Format("2006-01-02T15:04:05Z"), "completion time should match")
+	assert.Equalf("2025-03-01", created.DueDate.UTC().Format("2006-01-02"), "due date should match")
+
+	local, err := mgr.FineOne(int(response.Rows[1].ID))
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf("2025-03-01T09:00:00Z", local.DueDate.UTC().Format("2006-01-02T15:04:05Z"), "time zone should be applied")
+
+	req, _ = http.NewRequest("POST", "/api/todo/import?format=ics", strings.NewReader("BEGIN:VCARD\r\n"))
+	recorder = makeRequest(mgr, req)
+	assert.Equalf(400, recorder.Code, "Expected bad request response")
+}
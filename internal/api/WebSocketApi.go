@@ -0,0 +1,492 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+
+	"todo-api-go/entities"
+	"todo-api-go/events"
+	"todo-api-go/persistence"
+	"todo-api-go/reqctx"
+)
+
+// Types of the messages exchanged over the WebSocket channel. Changes of items are sent with
+// the types of the events published by the hub, such as events.ItemCreated.
+const (
+	// Requests sent by clients
+	WebSocketSubscribe   = "subscribe"
+	WebSocketUnsubscribe = "unsubscribe"
+	WebSocketCreate      = "create"
+	WebSocketUpdate      = "update"
+	WebSocketDelete      = "delete"
+
+	// Messages sent by the server
+	WebSocketAck      = "ack"
+	WebSocketError    = "error"
+	WebSocketPresence = "presence"
+	WebSocketReset    = "reset"
+)
+
+// Largest request accepted from a client, in bytes
+const webSocketReadLimit = 64 << 10
+
+// Number of replies and presence updates queued for a client before it is disconnected as too slow
+const webSocketQueueSize = 64
+
+// Time allowed for writing a message to a client
+const webSocketWriteTimeout = 10 * time.Second
+
+// WebSocketRequest is a request sent by a client over the WebSocket channel.
+type WebSocketRequest struct {
+	// One of WebSocketSubscribe, WebSocketUnsubscribe, WebSocketCreate, WebSocketUpdate or WebSocketDelete
+	Type string
+
+	// Chosen by the client to correlate the reply with the request
+	ID string
+
+	// The item to subscribe to, unsubscribe from, update or delete. Subscriptions without an
+	// item apply to the list of all items visible to the caller.
+	ItemID uint
+
+	// The item to create, or the new state of the item to update
+	Data *entities.ToDoItemEntity
+}
+
+// WebSocketMessage is a message sent by the server over the WebSocket channel: the reply to a
+// request, a change of an item, or the viewers of an item.
+type WebSocketMessage struct {
+	Type string
+
+	// ID of the request replied to
+	ID string `json:",omitempty"`
+
+	// ID of the change, as used by the event stream
+	EventID uint64 `json:",omitempty"`
+
+	ItemID uint `json:",omitempty"`
+
+	// The item created, updated or changed
+	Data *entities.ToDoItemEntity `json:",omitempty"`
+
+	// Status code and description of a failed request, as returned by the REST handlers
+	Status int    `json:",omitempty"`
+	Error  string `json:",omitempty"`
+
+	// The principals viewing the item
+	Viewers []Viewer `json:",omitempty"`
+}
+
+// Viewer is a principal viewing an item over the WebSocket channel.
+type Viewer struct {
+	Subject string
+	Name    string `json:",omitempty"`
+}
+
+// RegisterWebSocketRoutes registers the WebSocket channel for real-time collaboration for the Gin engine.
+//
+// gin: The Gin engine to register the routes with.
+// mgr: The ToDo entity manager.
+// hub: The hub publishing the changes of items.
+// authFactory: The factory for the authorization middleware.
+// middleware: Handlers to run on every route once the caller has been authorized.
+// Returns the registered Gin engine.
+func RegisterWebSocketRoutes(gin *gin.Engine, mgr *persistence.ToDoEntityManager, hub *events.Hub, authFactory AuthorizerFactory, middleware ...gin.HandlerFunc) *gin.Engine {
+	gin.GET("/api/ws", secured(authFactory, "retrieve", middleware, webSocketHandler(mgr, hub, newPresence()))...)
+
+	return gin
+}
+
+// webSocketHandler creates a HandlerFunc function upgrading the request to a WebSocket
+// connection, over which the caller subscribes to changes and submits mutations.
+//
+// Subscribing to an item makes the caller a viewer of the item, and the viewers are sent to
+// the subscribers of the item whenever they change. Mutations are performed with the
+// permissions of the caller and require the same roles as the corresponding REST routes.
+//
+// Clients that do not keep up with their messages are disconnected with the "try again later"
+// close code. Clients falling behind on changes are sent a "reset" message instead, telling
+// them to reload their items.
+//
+// It takes a manager of type *persistence.ToDoEntityManager, a hub of type *events.Hub and
+// the registry of viewers as parameters.
+// The function returns a gin.HandlerFunc.
+func webSocketHandler(manager *persistence.ToDoEntityManager, hub *events.Hub, viewers *presence) gin.HandlerFunc {
+	upgrader := websocket.Upgrader{}
+
+	return gin.HandlerFunc(func(c *gin.Context) {
+		conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+		if err != nil {
+			// The upgrader has responded with an error
+			return
+		}
+
+		ctx := c.Request.Context()
+		session := &webSocketSession{
+			conn:      conn,
+			mgr:       manager.WithContext(ctx),
+			hub:       hub,
+			presence:  viewers,
+			principal: reqctx.PrincipalFrom(ctx),
+			items:     map[uint]bool{},
+			queue:     make(chan WebSocketMessage, webSocketQueueSize),
+			done:      make(chan struct{}),
+		}
+		session.run(ctx)
+	})
+}
+
+// webSocketSession is the state of a WebSocket connection.
+type webSocketSession struct {
+	conn      *websocket.Conn
+	mgr       *persistence.ToDoEntityManager
+	hub       *events.Hub
+	presence  *presence
+	principal *reqctx.Principal
+
+	// Subscriptions of the client, guarded by the mutex
+	mutex sync.Mutex
+	list  bool
+	items map[uint]bool
+
+	// Replies and presence updates waiting to be written
+	queue chan WebSocketMessage
+
+	// Closed when the session ends, with the close code sent to the client
+	done      chan struct{}
+	closeOnce sync.Once
+	closeCode int
+}
+
+// run serves the session until the connection is closed, reading requests while a separate
+// goroutine writes messages.
+func (session *webSocketSession) run(ctx context.Context) {
+	logger := reqctx.LoggerFrom(ctx, logComponent)
+
+	// Changes are subscribed to before any request is read, so that no change of an item the
+	// client creates or subscribes to is missed
+	subscription, _, _ := session.hub.Subscribe(session.principal, 0)
+
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		session.write(subscription)
+	}()
+
+	heartbeat := session.hub.Heartbeat()
+	session.conn.SetReadLimit(webSocketReadLimit)
+	_ = session.conn.SetReadDeadline(time.Now().Add(2 * heartbeat))
+	session.conn.SetPongHandler(func(string) error {
+		return session.conn.SetReadDeadline(time.Now().Add(2 * heartbeat))
+	})
+
+	for {
+		var request WebSocketRequest
+		err := session.conn.ReadJSON(&request)
+		if err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				logger.DebugContext(ctx, "websocket closed", "error", err)
+			}
+			break
+		}
+
+		session.handle(&request)
+	}
+
+	session.close(websocket.CloseNormalClosure)
+	<-written
+
+	session.mutex.Lock()
+	viewed := make([]uint, 0, len(session.items))
+	for id := range session.items {
+		viewed = append(viewed, id)
+	}
+	session.mutex.Unlock()
+	for _, id := range viewed {
+		session.presence.leave(id, session)
+	}
+
+	session.conn.Close()
+}
+
+// write writes the queued messages and the changes the client subscribed to, and pings the
+// client, until the session is closed.
+func (session *webSocketSession) write(subscription *events.Subscription) {
+	defer func() { subscription.Close() }()
+
+	ping := time.NewTicker(session.hub.Heartbeat())
+	defer ping.Stop()
+
+	for {
+		var err error
+
+		select {
+		case <-session.done:
+			message := websocket.FormatCloseMessage(session.closeCode, "")
+			_ = session.conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(webSocketWriteTimeout))
+
+			// Give the client a moment to acknowledge the close before reading fails
+			_ = session.conn.SetReadDeadline(time.Now().Add(time.Second))
+			return
+
+		case message := <-session.queue:
+			err = session.send(&message)
+
+		case event, ok := <-subscription.Events():
+			if !ok {
+				// The hub dropped the subscription, as the client fell behind
+				subscription, _, _ = session.hub.Subscribe(session.principal, 0)
+				err = session.send(&WebSocketMessage{Type: WebSocketReset})
+				break
+			}
+			if session.follows(event.Item.ID) {
+				err = session.send(&WebSocketMessage{Type: event.Type, EventID: event.ID, ItemID: event.Item.ID, Data: &event.Item})
+			}
+
+		case <-ping.C:
+			err = session.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(webSocketWriteTimeout))
+		}
+
+		if err != nil {
+			// Reading fails as well once the connection is closed, ending the session
+			session.conn.Close()
+			return
+		}
+	}
+}
+
+// send writes a message to the client.
+func (session *webSocketSession) send(message *WebSocketMessage) error {
+	_ = session.conn.SetWriteDeadline(time.Now().Add(webSocketWriteTimeout))
+	return session.conn.WriteJSON(message)
+}
+
+// enqueue queues a message for the client, closing the session if the client does not keep up.
+func (session *webSocketSession) enqueue(message WebSocketMessage) {
+	select {
+	case session.queue <- message:
+	case <-session.done:
+	default:
+		session.close(websocket.CloseTryAgainLater)
+	}
+}
+
+// close ends the session, telling the client why. Only the first close code is sent.
+func (session *webSocketSession) close(code int) {
+	session.closeOnce.Do(func() {
+		session.closeCode = code
+		close(session.done)
+	})
+}
+
+// follows reports whether the client subscribed to the changes of an item.
+func (session *webSocketSession) follows(id uint) bool {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+
+	return session.list || session.items[id]
+}
+
+// handle performs a request of the client and queues the reply.
+func (session *webSocketSession) handle(request *WebSocketRequest) {
+	reply := WebSocketMessage{Type: WebSocketAck, ID: request.ID, ItemID: request.ItemID}
+
+	var err error
+	switch request.Type {
+	case WebSocketSubscribe:
+		err = session.subscribe(request.ItemID)
+
+	case WebSocketUnsubscribe:
+		session.unsubscribe(request.ItemID)
+
+	case WebSocketCreate:
+		reply.Data, err = session.create(request.Data)
+
+	case WebSocketUpdate:
+		reply.Data, err = session.update(request.ItemID, request.Data)
+
+	case WebSocketDelete:
+		err = session.delete(request.ItemID)
+
+	default:
+		reply = WebSocketMessage{Type: WebSocketError, ID: request.ID, Status: http.StatusBadRequest, Error: "unknown request type"}
+	}
+
+	if err != nil {
+		reply = WebSocketMessage{Type: WebSocketError, ID: request.ID, ItemID: request.ItemID, Status: errorStatus(err), Error: err.Error()}
+	}
+	if reply.Data != nil {
+		reply.ItemID = reply.Data.ID
+	}
+
+	session.enqueue(reply)
+}
+
+// subscribe subscribes the client to the changes of a visible item, making it a viewer of the
+// item, or to the changes of all visible items.
+func (session *webSocketSession) subscribe(id uint) error {
+	if id == 0 {
+		session.mutex.Lock()
+		session.list = true
+		session.mutex.Unlock()
+		return nil
+	}
+
+	_, err := session.mgr.FineOne(int(id))
+	if err != nil {
+		return err
+	}
+
+	session.mutex.Lock()
+	viewing := session.items[id]
+	session.items[id] = true
+	session.mutex.Unlock()
+
+	if !viewing {
+		session.presence.join(id, session, session.viewer())
+	}
+	return nil
+}
+
+// unsubscribe ends a subscription of the client, as made by subscribe.
+func (session *webSocketSession) unsubscribe(id uint) {
+	session.mutex.Lock()
+	viewing := session.items[id]
+	if id == 0 {
+		session.list = false
+	} else {
+		delete(session.items, id)
+	}
+	session.mutex.Unlock()
+
+	if viewing {
+		session.presence.leave(id, session)
+	}
+}
+
+// create creates an item like the REST route does.
+func (session *webSocketSession) create(item *entities.ToDoItemEntity) (*entities.ToDoItemEntity, error) {
+	err := session.authorize("create")
+	if err != nil {
+		return nil, err
+	}
+	if item == nil {
+		return nil, persistence.ErrInvalid
+	}
+
+	created := *item
+	err = session.mgr.Create(&created)
+	if err != nil {
+		return nil, err
+	}
+
+	return &created, nil
+}
+
+// update updates an item like the REST route does.
+func (session *webSocketSession) update(id uint, item *entities.ToDoItemEntity) (*entities.ToDoItemEntity, error) {
+	err := session.authorize("update")
+	if err != nil {
+		return nil, err
+	}
+	if item == nil {
+		return nil, persistence.ErrInvalid
+	}
+
+	updated := *item
+	updated.ID = id
+	err = session.mgr.Update(&updated)
+	if err != nil {
+		return nil, err
+	}
+
+	return &updated, nil
+}
+
+// delete deletes an item like the REST route does.
+func (session *webSocketSession) delete(id uint) error {
+	err := session.authorize("delete")
+	if err != nil {
+		return err
+	}
+
+	return session.mgr.Delete(id)
+}
+
+// authorize checks that the client has been granted the role required by the REST route of a
+// mutation. Without a principal, authorization is not enforced.
+func (session *webSocketSession) authorize(role string) error {
+	if session.principal == nil || session.principal.HasRole(role) {
+		return nil
+	}
+
+	return persistence.ErrForbidden
+}
+
+// viewer describes the client as a viewer of items.
+func (session *webSocketSession) viewer() Viewer {
+	if session.principal == nil {
+		return Viewer{}
+	}
+
+	return Viewer{Subject: session.principal.Subject, Name: session.principal.Name}
+}
+
+// presence tracks the sessions viewing items, telling the viewers of an item when they change.
+type presence struct {
+	mutex sync.Mutex
+	items map[uint]map[*webSocketSession]Viewer
+}
+
+func newPresence() *presence {
+	return &presence{items: map[uint]map[*webSocketSession]Viewer{}}
+}
+
+// join adds a session to the viewers of an item.
+func (presence *presence) join(id uint, session *webSocketSession, viewer Viewer) {
+	presence.mutex.Lock()
+	defer presence.mutex.Unlock()
+
+	if presence.items[id] == nil {
+		presence.items[id] = map[*webSocketSession]Viewer{}
+	}
+	presence.items[id][session] = viewer
+
+	presence.broadcast(id)
+}
+
+// leave removes a session from the viewers of an item.
+func (presence *presence) leave(id uint, session *webSocketSession) {
+	presence.mutex.Lock()
+	defer presence.mutex.Unlock()
+
+	delete(presence.items[id], session)
+	if len(presence.items[id]) == 0 {
+		delete(presence.items, id)
+		return
+	}
+
+	presence.broadcast(id)
+}
+
+// broadcast queues the viewers of an item for its viewing sessions. Principals viewing the
+// item in several sessions are listed once. The caller must hold the mutex.
+func (presence *presence) broadcast(id uint) {
+	var viewers []Viewer
+	for _, viewer := range presence.items[id] {
+		if !slices.Contains(viewers, viewer) {
+			viewers = append(viewers, viewer)
+		}
+	}
+	sort.Slice(viewers, func(i, j int) bool { return viewers[i].Subject < viewers[j].Subject })
+
+	for session := range presence.items[id] {
+		session.enqueue(WebSocketMessage{Type: WebSocketPresence, ItemID: id, Viewers: viewers})
+	}
+}
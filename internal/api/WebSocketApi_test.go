@@ -0,0 +1,189 @@
+package api_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+
+	"todo-api-go/api"
+	"todo-api-go/entities"
+	"todo-api-go/events"
+	"todo-api-go/persistence"
+	"todo-api-go/reqctx"
+	"todo-api-go/testsupport"
+)
+
+// Header naming the subject of the caller for the subjectAuthorizer
+const testSubjectHeader = "X-Test-Subject"
+
+// subjectAuthorizer authorizes callers as the subject named by a header, granting the roles
+// listed in another header, so that a single router serves several principals.
+type subjectAuthorizer struct{}
+
+func (authorizer *subjectAuthorizer) RequiresRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal := &reqctx.Principal{Subject: c.GetHeader(testSubjectHeader)}
+		if roles := c.GetHeader("X-Test-Roles"); roles != "" {
+			principal.Roles = strings.Split(roles, ",")
+		}
+
+		c.Request = c.Request.WithContext(reqctx.WithPrincipal(c.Request.Context(), principal))
+		c.Next()
+	}
+}
+
+func TestWebSocketMutations(t *testing.T) {
+	assert := assert.New(t)
+
+	server, _ := startWebSocketServer(t)
+	conn := dialWebSocket(t, server, "alice", "retrieve,create,update,delete")
+
+	reply := request(t, conn, api.WebSocketRequest{Type: api.WebSocketSubscribe, ID: "1"})
+	assert.Equalf(api.WebSocketAck, reply.Type, "subscription should be acknowledged")
+	assert.Equalf("1", reply.ID, "reply should be correlated")
+
+	messages := requestAll(t, conn, api.WebSocketRequest{Type: api.WebSocketCreate, ID: "2", Data: &entities.ToDoItemEntity{Description: "Collaborative Todo Item"}})
+	created := messages[api.WebSocketAck]
+	if !assert.NotNilf(created.Data, "created item should be returned") {
+		return
+	}
+	assert.Equalf("alice", created.Data.OwnerID, "item should be owned by the caller")
+	assert.Equalf(created.Data.ID, messages[events.ItemCreated].ItemID, "creation should be published")
+
+	messages = requestAll(t, conn, api.WebSocketRequest{Type: api.WebSocketUpdate, ID: "3", ItemID: created.Data.ID, Data: &entities.ToDoItemEntity{Description: "Updated", Completed: true}})
+	assert.Truef(messages[api.WebSocketAck].Data.Completed, "updated item should be returned")
+	assert.Equalf("Updated", messages[events.ItemUpdated].Data.Description, "update should be published")
+
+	messages = requestAll(t, conn, api.WebSocketRequest{Type: api.WebSocketDelete, ID: "4", ItemID: created.Data.ID})
+	assert.Equalf(created.Data.ID, messages[events.ItemDeleted].ItemID, "deletion should be published")
+
+	reply = request(t, conn, api.WebSocketRequest{Type: api.WebSocketUpdate, ID: "5", ItemID: created.Data.ID, Data: &entities.ToDoItemEntity{}})
+	assert.Equalf(api.WebSocketError, reply.Type, "update of a deleted item should fail")
+	assert.Equalf(http.StatusNotFound, reply.Status, "status should match the REST route")
+
+	reply = request(t, conn, api.WebSocketRequest{Type: "rename", ID: "6"})
+	assert.Equalf(http.StatusBadRequest, reply.Status, "unknown requests should be rejected")
+}
+
+func TestWebSocketAuthorization(t *testing.T) {
+	assert := assert.New(t)
+
+	server, mgr := startWebSocketServer(t)
+	conn := dialWebSocket(t, server, "bob", "retrieve")
+
+	reply := request(t, conn, api.WebSocketRequest{Type: api.WebSocketCreate, ID: "1", Data: &entities.ToDoItemEntity{Description: "Forbidden"}})
+	assert.Equalf(api.WebSocketError, reply.Type, "creation should require the create role")
+	assert.Equalf(http.StatusForbidden, reply.Status, "status should match")
+
+	alice := mgr.WithContext(reqctx.WithPrincipal(context.Background(), &reqctx.Principal{Subject: "alice"}))
+	private := &entities.ToDoItemEntity{Description: "Private"}
+	err := alice.Create(private)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	reply = request(t, conn, api.WebSocketRequest{Type: api.WebSocketSubscribe, ID: "2", ItemID: private.ID})
+	assert.Equalf(http.StatusNotFound, reply.Status, "invisible items should not be subscribed to")
+}
+
+func TestWebSocketPresence(t *testing.T) {
+	assert := assert.New(t)
+
+	server, _ := startWebSocketServer(t)
+	alice := dialWebSocket(t, server, "alice", "retrieve,admin")
+	bob := dialWebSocket(t, server, "bob", "retrieve,admin")
+
+	messages := requestAll(t, alice, api.WebSocketRequest{Type: api.WebSocketSubscribe, ID: "1", ItemID: 1})
+	assert.Equalf([]api.Viewer{{Subject: "alice"}}, messages[api.WebSocketPresence].Viewers, "viewer should be present")
+
+	messages = requestAll(t, bob, api.WebSocketRequest{Type: api.WebSocketSubscribe, ID: "1", ItemID: 1})
+	assert.Equalf([]api.Viewer{{Subject: "alice"}, {Subject: "bob"}}, messages[api.WebSocketPresence].Viewers, "viewers should be present")
+	assert.Equalf([]api.Viewer{{Subject: "alice"}, {Subject: "bob"}}, receiveMessage(t, alice).Viewers, "viewers should be told about new viewers")
+
+	bob.Close()
+	assert.Equalf([]api.Viewer{{Subject: "alice"}}, receiveMessage(t, alice).Viewers, "viewers should be told about leaving viewers")
+}
+
+func startWebSocketServer(t *testing.T) (*httptest.Server, *persistence.ToDoEntityManager) {
+	hub := events.NewHub(events.HubParameters{LogSize: 100, BufferSize: 10, Heartbeat: time.Second})
+	mgr := testsupport.CreateTestManager(t)
+	mgr.AddAudienceObserver(hub)
+
+	router := gin.Default()
+	api.RegisterWebSocketRoutes(router, mgr, hub, &subjectAuthorizer{})
+
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	return server, mgr
+}
+
+func dialWebSocket(t *testing.T, server *httptest.Server, subject string, roles string) *websocket.Conn {
+	header := http.Header{}
+	header.Set(testSubjectHeader, subject)
+	header.Set("X-Test-Roles", roles)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/api/ws", header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+// request sends a request and returns the reply, skipping any other messages
+func request(t *testing.T, conn *websocket.Conn, request api.WebSocketRequest) api.WebSocketMessage {
+	err := conn.WriteJSON(&request)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for {
+		message := receiveMessage(t, conn)
+		if message.ID == request.ID {
+			return message
+		}
+	}
+}
+
+// requestAll sends a request and returns the reply together with the messages received until
+// the reply and one message of every other expected kind have arrived, keyed by their type
+func requestAll(t *testing.T, conn *websocket.Conn, request api.WebSocketRequest) map[string]api.WebSocketMessage {
+	err := conn.WriteJSON(&request)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		api.WebSocketCreate:    events.ItemCreated,
+		api.WebSocketUpdate:    events.ItemUpdated,
+		api.WebSocketDelete:    events.ItemDeleted,
+		api.WebSocketSubscribe: api.WebSocketPresence,
+	}[request.Type]
+
+	messages := map[string]api.WebSocketMessage{}
+	for messages[api.WebSocketAck].ID != request.ID || messages[expected].Type == "" {
+		message := receiveMessage(t, conn)
+		messages[message.Type] = message
+	}
+
+	return messages
+}
+
+func receiveMessage(t *testing.T, conn *websocket.Conn) api.WebSocketMessage {
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+	var message api.WebSocketMessage
+	err := conn.ReadJSON(&message)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return message
+}
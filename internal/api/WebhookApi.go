@@ -0,0 +1,289 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"todo-api-go/entities"
+	"todo-api-go/persistence"
+)
+
+type WebhookRequest struct {
+	URL         string   `binding:"required"`
+	Events      []string `binding:"required"`
+	Description string
+
+	// Whether the subscription is active, defaulting to true
+	Active *bool
+}
+
+type WebhookResponse struct {
+	// The signing secret. It is only returned when the subscription is created.
+	Secret string
+	Data   entities.WebhookSubscriptionEntity
+}
+
+type WebhookDeliveriesResponse struct {
+	Meta ListMetadata
+	Data []entities.WebhookDeliveryEntity
+}
+
+// RegisterWebhookRoutes registers the webhook subscription and delivery routes for the Gin engine.
+//
+// gin: The Gin engine to register the routes with.
+// mgr: The webhook manager.
+// authFactory: The factory for the authorization middleware.
+// middleware: Handlers to run on every route once the caller has been authorized.
+// Returns the registered Gin engine.
+func RegisterWebhookRoutes(gin *gin.Engine, mgr *persistence.WebhookManager, authFactory AuthorizerFactory, middleware ...gin.HandlerFunc) *gin.Engine {
+	gin.GET("/api/webhooks", secured(authFactory, "webhooks", middleware, getAllWebhooksHandler(mgr))...)
+	gin.POST("/api/webhooks", secured(authFactory, "webhooks", middleware, createWebhookHandler(mgr))...)
+	gin.GET("/api/webhooks/:id", secured(authFactory, "webhooks", middleware, getWebhookHandler(mgr))...)
+	gin.PUT("/api/webhooks/:id", secured(authFactory, "webhooks", middleware, updateWebhookHandler(mgr))...)
+	gin.DELETE("/api/webhooks/:id", secured(authFactory, "webhooks", middleware, deleteWebhookHandler(mgr))...)
+
+	gin.GET("/api/webhook-deliveries", secured(authFactory, "webhooks", middleware, getWebhookDeliveriesHandler(mgr))...)
+	gin.GET("/api/webhook-deliveries/:id", secured(authFactory, "webhooks", middleware, getWebhookDeliveryHandler(mgr))...)
+	gin.POST("/api/webhook-deliveries/:id/retry", secured(authFactory, "webhooks", middleware, retryWebhookDeliveryHandler(mgr))...)
+
+	return gin
+}
+
+// createWebhookHandler creates a HandlerFunc function for subscribing the caller to events.
+//
+// It takes a manager of type *persistence.WebhookManager as a parameter.
+// The function returns a gin.HandlerFunc.
+func createWebhookHandler(manager *persistence.WebhookManager) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		var request WebhookRequest
+		err := c.BindJSON(&request)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		mgr := manager.WithContext(c.Request.Context())
+
+		subscription := entities.WebhookSubscriptionEntity{
+			URL:         request.URL,
+			Events:      request.Events,
+			Description: request.Description,
+		}
+		err = mgr.Create(&subscription)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		// Subscriptions are created active, and deactivated on request
+		if request.Active != nil && !*request.Active {
+			subscription.Active = false
+			err = mgr.Update(&subscription)
+			if err != nil {
+				writeError(c, err)
+				return
+			}
+		}
+
+		writeJSON(c, http.StatusCreated, WebhookResponse{Secret: subscription.Secret, Data: subscription})
+	})
+}
+
+// getAllWebhooksHandler creates a HandlerFunc function for listing the subscriptions of the caller.
+//
+// It takes a manager of type *persistence.WebhookManager as a parameter.
+// The function returns a gin.HandlerFunc.
+func getAllWebhooksHandler(manager *persistence.WebhookManager) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		subscriptions, err := manager.WithContext(c.Request.Context()).FindAll()
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		writeJSON(c, http.StatusOK, subscriptions)
+	})
+}
+
+// getWebhookHandler creates a HandlerFunc function for retrieving a subscription of the caller.
+//
+// It takes a manager of type *persistence.WebhookManager as a parameter.
+// The function returns a gin.HandlerFunc.
+func getWebhookHandler(manager *persistence.WebhookManager) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		subscription, err := manager.WithContext(c.Request.Context()).FindOne(uint(id))
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		writeJSON(c, http.StatusOK, subscription)
+	})
+}
+
+// updateWebhookHandler creates a HandlerFunc function for changing a subscription of the caller.
+//
+// It takes a manager of type *persistence.WebhookManager as a parameter.
+// The function returns a gin.HandlerFunc.
+func updateWebhookHandler(manager *persistence.WebhookManager) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var request WebhookRequest
+		err = c.BindJSON(&request)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		subscription := entities.WebhookSubscriptionEntity{
+			ID:          uint(id),
+			URL:         request.URL,
+			Events:      request.Events,
+			Description: request.Description,
+			Active:      request.Active == nil || *request.Active,
+		}
+		err = manager.WithContext(c.Request.Context()).Update(&subscription)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		writeJSON(c, http.StatusOK, subscription)
+	})
+}
+
+// deleteWebhookHandler creates a HandlerFunc function for removing a subscription of the caller
+// together with its deliveries.
+//
+// It takes a manager of type *persistence.WebhookManager as a parameter.
+// The function returns a gin.HandlerFunc.
+func deleteWebhookHandler(manager *persistence.WebhookManager) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		err = manager.WithContext(c.Request.Context()).Delete(uint(id))
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	})
+}
+
+// getWebhookDeliveriesHandler creates a HandlerFunc function for listing the deliveries of the
+// subscriptions of the caller with filtering and pagination.
+//
+// The deliveries are filtered by the "subscription" and "status" query parameters. Filtering
+// by the "dead" status lists the deliveries that have been given up.
+//
+// It takes a manager of type *persistence.WebhookManager as a parameter.
+// The function returns a gin.HandlerFunc.
+func getWebhookDeliveriesHandler(manager *persistence.WebhookManager) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		filter, err := getDeliveryFilter(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		deliveries, total, err := manager.WithContext(c.Request.Context()).FindDeliveries(filter, getPagingConfigurator(c))
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		response := WebhookDeliveriesResponse{
+			Meta: ListMetadata{Total: total},
+			Data: deliveries,
+		}
+		writeJSON(c, http.StatusOK, response)
+	})
+}
+
+// getWebhookDeliveryHandler creates a HandlerFunc function for retrieving a delivery of a
+// subscription of the caller together with the log of its attempts.
+//
+// It takes a manager of type *persistence.WebhookManager as a parameter.
+// The function returns a gin.HandlerFunc.
+func getWebhookDeliveryHandler(manager *persistence.WebhookManager) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		delivery, err := manager.WithContext(c.Request.Context()).FindDelivery(uint(id))
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		writeJSON(c, http.StatusOK, delivery)
+	})
+}
+
+// retryWebhookDeliveryHandler creates a HandlerFunc function for queuing a dead delivery of a
+// subscription of the caller for another round of attempts.
+//
+// It takes a manager of type *persistence.WebhookManager as a parameter.
+// The function returns a gin.HandlerFunc.
+func retryWebhookDeliveryHandler(manager *persistence.WebhookManager) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		delivery, err := manager.WithContext(c.Request.Context()).Retry(uint(id))
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		writeJSON(c, http.StatusAccepted, delivery)
+	})
+}
+
+// getDeliveryFilter configures the delivery filter from the "subscription" and "status" query
+// parameters of a Gin request context.
+// It returns an error if a query parameter can not be parsed.
+func getDeliveryFilter(c *gin.Context) (persistence.DeliveryFilter, error) {
+	filter := persistence.DeliveryFilter{Status: c.Query("status")}
+
+	switch filter.Status {
+	case "", entities.DeliveryPending, entities.DeliveryDelivered, entities.DeliveryDead:
+	default:
+		return filter, fmt.Errorf("unknown status %q", filter.Status)
+	}
+
+	if subscription := c.Query("subscription"); subscription != "" {
+		id, err := strconv.ParseUint(subscription, 10, 0)
+		if err != nil {
+			return filter, err
+		}
+		filter.SubscriptionID = uint(id)
+	}
+
+	return filter, nil
+}
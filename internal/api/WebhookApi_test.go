@@ -0,0 +1,157 @@
+package api_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"todo-api-go/api"
+	"todo-api-go/entities"
+	"todo-api-go/persistence"
+	"todo-api-go/reqctx"
+	"todo-api-go/testsupport"
+)
+
+func TestWebhookSubscriptions(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testsupport.CreateTestDatabase(t)
+	router := gin.Default()
+	alice := &MockAuthorizer{Principal: &reqctx.Principal{Subject: "alice"}}
+	api.RegisterWebhookRoutes(router, persistence.NewWebhookManager(db), alice)
+
+	marshalled, _ := json.Marshal(&api.WebhookRequest{URL: "https://example.com/hook", Events: []string{entities.WebhookItemCreated}})
+	req, _ := http.NewRequest("POST", "/api/webhooks", bytes.NewBuffer(marshalled))
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	assert.Equalf(201, recorder.Code, "Expected successful response")
+
+	var created api.WebhookResponse
+	err := json.Unmarshal(recorder.Body.Bytes(), &created)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Containsf(created.Secret, persistence.WebhookSecretPrefix, "secret should be returned on creation")
+	assert.Truef(created.Data.Active, "subscription should be active")
+
+	req, _ = http.NewRequest("GET", fmt.Sprintf("/api/webhooks/%d", created.Data.ID), nil)
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	assert.Equalf(200, recorder.Code, "Expected successful response")
+	assert.NotContainsf(recorder.Body.String(), created.Secret, "secret should not be returned afterwards")
+
+	inactive := false
+	marshalled, _ = json.Marshal(&api.WebhookRequest{URL: "https://example.com/hook", Events: []string{entities.WebhookItemDeleted}, Active: &inactive})
+	req, _ = http.NewRequest("PUT", fmt.Sprintf("/api/webhooks/%d", created.Data.ID), bytes.NewBuffer(marshalled))
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	assert.Equalf(200, recorder.Code, "Expected successful response")
+
+	var updated entities.WebhookSubscriptionEntity
+	err = json.Unmarshal(recorder.Body.Bytes(), &updated)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Falsef(updated.Active, "subscription should be deactivated")
+	assert.Equalf([]string{entities.WebhookItemDeleted}, updated.Events, "events should be updated")
+
+	marshalled, _ = json.Marshal(&api.WebhookRequest{URL: "https://example.com/hook", Events: []string{"todo.renamed"}})
+	req, _ = http.NewRequest("POST", "/api/webhooks", bytes.NewBuffer(marshalled))
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	assert.Equalf(400, recorder.Code, "Expected bad request response")
+
+	req, _ = http.NewRequest("DELETE", fmt.Sprintf("/api/webhooks/%d", created.Data.ID), nil)
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	assert.Equalf(204, recorder.Code, "Expected successful response")
+
+	req, _ = http.NewRequest("GET", "/api/webhooks", nil)
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	assert.Equalf(200, recorder.Code, "Expected successful response")
+	assert.Equalf("[]", recorder.Body.String(), "subscription should be deleted")
+}
+
+func TestWebhookDeliveries(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testsupport.CreateTestDatabase(t)
+	principal := &reqctx.Principal{Subject: "alice"}
+	webhooks := persistence.NewWebhookManager(db)
+	router := gin.Default()
+	api.RegisterRoutes(router, persistence.New(db), &MockAuthorizer{Principal: principal})
+	api.RegisterWebhookRoutes(router, webhooks, &MockAuthorizer{Principal: principal})
+
+	marshalled, _ := json.Marshal(&api.WebhookRequest{URL: "https://example.com/hook", Events: []string{entities.WebhookItemCreated}})
+	req, _ := http.NewRequest("POST", "/api/webhooks", bytes.NewBuffer(marshalled))
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	assert.Equalf(201, recorder.Code, "Expected successful response")
+
+	marshalled, _ = json.Marshal(&entities.ToDoItemEntity{Description: "Hooked Todo Item"})
+	req, _ = http.NewRequest("POST", "/api/todo", bytes.NewBuffer(marshalled))
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	assert.Equalf(201, recorder.Code, "Expected successful response")
+
+	req, _ = http.NewRequest("GET", "/api/webhook-deliveries?status=pending", nil)
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	assert.Equalf(200, recorder.Code, "Expected successful response")
+
+	var response api.WebhookDeliveriesResponse
+	err := json.Unmarshal(recorder.Body.Bytes(), &response)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	if !assert.Equalf(1, int(response.Meta.Total), "total length should be 1") {
+		return
+	}
+	delivery := response.Data[0]
+	assert.Equalf(entities.WebhookItemCreated, delivery.Event, "event should match")
+
+	req, _ = http.NewRequest("GET", "/api/webhook-deliveries?status=lost", nil)
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	assert.Equalf(400, recorder.Code, "Expected bad request response")
+
+	// Give the delivery up, as the dispatcher does once its attempts are exhausted
+	pending, err := webhooks.ClaimDue(delivery.NextAttemptAt, 10, 0)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	if assert.Equalf(1, len(pending), "delivery should be due") {
+		pending[0].Delivery.Status = entities.DeliveryDead
+		err = webhooks.RecordAttempt(&pending[0].Delivery, &entities.WebhookAttemptEntity{StatusCode: 410, Error: "unexpected status 410 Gone"})
+		assert.Nilf(err, "error should be nil, not %s", err)
+	}
+
+	req, _ = http.NewRequest("GET", "/api/webhook-deliveries?status=dead", nil)
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	assert.Equalf(200, recorder.Code, "Expected successful response")
+	err = json.Unmarshal(recorder.Body.Bytes(), &response)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf(1, int(response.Meta.Total), "dead delivery should be listed")
+
+	req, _ = http.NewRequest("GET", fmt.Sprintf("/api/webhook-deliveries/%d", delivery.ID), nil)
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	assert.Equalf(200, recorder.Code, "Expected successful response")
+
+	var log persistence.WebhookDeliveryLog
+	err = json.Unmarshal(recorder.Body.Bytes(), &log)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	if assert.Equalf(1, len(log.Log), "attempt should be logged") {
+		assert.Equalf(410, log.Log[0].StatusCode, "status code should match")
+	}
+
+	req, _ = http.NewRequest("POST", fmt.Sprintf("/api/webhook-deliveries/%d/retry", delivery.ID), nil)
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	assert.Equalf(202, recorder.Code, "Expected accepted response")
+
+	var retried entities.WebhookDeliveryEntity
+	err = json.Unmarshal(recorder.Body.Bytes(), &retried)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf(entities.DeliveryPending, retried.Status, "delivery should be pending")
+}
@@ -3,8 +3,14 @@ module todo-api-go/api
 go 1.21.4
 
 require (
+	github.com/andybalholm/brotli v1.1.0
 	github.com/gin-gonic/gin v1.9.1
+	github.com/gorilla/websocket v1.5.3
+	github.com/kelseyhightower/envconfig v1.4.0
+	github.com/klauspost/compress v1.17.4
 	github.com/stretchr/testify v1.8.4
+	go.opentelemetry.io/otel v1.23.1
+	go.opentelemetry.io/otel/trace v1.23.1
 )
 
 require (
@@ -0,0 +1,114 @@
+package apikeys
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"todo-api-go/persistence"
+	"todo-api-go/reqctx"
+)
+
+// Header that may carry an API key instead of the Authorization header
+const apiKeyHeader = "X-API-Key"
+
+type AuthorizerFactory interface {
+	RequiresRole(role string) gin.HandlerFunc
+}
+
+type Authorizer struct {
+	keys     *persistence.ApiKeyManager
+	fallback AuthorizerFactory
+}
+
+// New creates an Authorizer accepting API keys issued by the service.
+//
+// Requests that do not present an API key are delegated to the fallback factory,
+// typically the OIDC authorizer. A nil fallback rejects such requests.
+//
+// Returns a pointer to Authorizer.
+func New(keys *persistence.ApiKeyManager, fallback AuthorizerFactory) *Authorizer {
+	return &Authorizer{
+		keys:     keys,
+		fallback: fallback,
+	}
+}
+
+// RequiresRole returns a gin.HandlerFunc that checks if the caller has the specified role.
+//
+// Callers presenting an API key are granted the roles mapped from the scopes of the key.
+// It takes a role string as a parameter and returns a gin.HandlerFunc.
+func (authz *Authorizer) RequiresRole(role string) gin.HandlerFunc {
+	var fallback gin.HandlerFunc
+	if authz.fallback != nil {
+		fallback = authz.fallback.RequiresRole(role)
+	}
+
+	return func(c *gin.Context) {
+		presented, ok := apiKeyFrom(c.Request)
+		if !ok {
+			if fallback == nil {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+					"error": "api key required",
+				})
+				return
+			}
+
+			fallback(c)
+			return
+		}
+
+		key, err := authz.keys.WithContext(c.Request.Context()).Authenticate(presented)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		roles := persistence.RolesForScopes(key.Scopes)
+		if !slices.Contains(roles, role) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "api key scopes do not grant role " + role,
+			})
+			return
+		}
+
+		principal := &reqctx.Principal{
+			Subject: key.OwnerID,
+			Name:    key.Name,
+			Tenant:  key.Tenant,
+			Roles:   roles,
+		}
+
+		c.Set("apikey", key)
+		c.Request = c.Request.WithContext(reqctx.WithPrincipal(c.Request.Context(), principal))
+
+		c.Next()
+	}
+}
+
+// apiKeyFrom extracts an API key from a request.
+//
+// The key may be presented in the X-API-Key header, as a bearer token or as the password of
+// basic authentication, for clients such as calendar applications that only support the latter.
+// It returns the key and whether the request carried one.
+func apiKeyFrom(request *http.Request) (string, bool) {
+	if key := request.Header.Get(apiKeyHeader); key != "" {
+		return key, true
+	}
+
+	if _, password, ok := request.BasicAuth(); ok && strings.HasPrefix(password, persistence.ApiKeyPrefix) {
+		return password, true
+	}
+
+	token, ok := strings.CutPrefix(request.Header.Get("Authorization"), "Bearer ")
+	token = strings.TrimSpace(token)
+	if ok && strings.HasPrefix(token, persistence.ApiKeyPrefix) {
+		return token, true
+	}
+
+	return "", false
+}
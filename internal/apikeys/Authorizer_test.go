@@ -0,0 +1,113 @@
+package apikeys_test
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"todo-api-go/api"
+	"todo-api-go/apikeys"
+	"todo-api-go/entities"
+	"todo-api-go/persistence"
+	"todo-api-go/reqctx"
+	"todo-api-go/testsupport"
+)
+
+type FallbackAuthorizer struct {
+}
+
+func (fallback *FallbackAuthorizer) RequiresRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.AbortWithStatus(http.StatusTeapot)
+	}
+}
+
+func TestRequiresRole(t *testing.T) {
+	assert := assert.New(t)
+
+	keys := persistence.NewApiKeyManager(testsupport.CreateTestDatabase(t))
+	owner := reqctx.WithPrincipal(context.Background(), &reqctx.Principal{
+		Subject: "alice",
+		Roles:   []string{"retrieve"},
+	})
+
+	plain, err := keys.WithContext(owner).Create(&entities.ApiKeyEntity{Name: "ci", Scopes: []string{"todo:read"}})
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	var subject string
+	router := gin.Default()
+	authz := apikeys.New(keys, &FallbackAuthorizer{})
+	handler := func(c *gin.Context) {
+		subject = reqctx.PrincipalFrom(c.Request.Context()).Subject
+		c.Status(http.StatusOK)
+	}
+	router.GET("/retrieve", authz.RequiresRole("retrieve"), handler)
+	router.GET("/delete", authz.RequiresRole("delete"), handler)
+
+	recorder := makeRequest(router, "/retrieve", "Bearer "+plain)
+	assert.Equalf(200, recorder.Code, "Expected successful response")
+	assert.Equalf("alice", subject, "principal should be the key owner")
+
+	recorder = makeRequest(router, "/retrieve", "Basic "+base64.StdEncoding.EncodeToString([]byte("alice:"+plain)))
+	assert.Equalf(200, recorder.Code, "Expected successful response for basic authentication")
+
+	recorder = makeRequest(router, "/delete", "Bearer "+plain)
+	assert.Equalf(403, recorder.Code, "Expected forbidden response")
+
+	recorder = makeRequest(router, "/retrieve", "Bearer "+persistence.ApiKeyPrefix+"0000_unknown")
+	assert.Equalf(401, recorder.Code, "Expected unauthorized response")
+
+	recorder = makeRequest(router, "/retrieve", "Bearer some.jwt.token")
+	assert.Equalf(418, recorder.Code, "Expected fallback response")
+}
+
+func TestApiKeyScopes(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testsupport.CreateTestDatabase(t)
+	keys := persistence.NewApiKeyManager(db)
+	items := persistence.New(db)
+	owner := reqctx.WithPrincipal(context.Background(), &reqctx.Principal{
+		Subject: "alice",
+		Roles:   []string{"retrieve"},
+	})
+
+	item := &entities.ToDoItemEntity{Description: "read by key"}
+	err := items.WithContext(owner).Create(item)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	plain, err := keys.WithContext(owner).Create(&entities.ApiKeyEntity{Name: "ci", Scopes: []string{"todo:read"}})
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	router := gin.Default()
+	api.RegisterRoutes(router, items, apikeys.New(keys, nil))
+	api.RegisterInboxRoutes(router, persistence.NewReminderManager(db), apikeys.New(keys, nil))
+
+	recorder := makeRequest(router, "/api/todo", "Bearer "+plain)
+	assert.Equalf(200, recorder.Code, "read keys should list items")
+
+	recorder = makeRequest(router, fmt.Sprintf("/api/todo/%d", item.ID), "Bearer "+plain)
+	assert.Equalf(200, recorder.Code, "read keys should retrieve single items")
+
+	recorder = makeRequest(router, fmt.Sprintf("/api/todo/%d/children", item.ID), "Bearer "+plain)
+	assert.Equalf(200, recorder.Code, "read keys should list subtasks")
+
+	recorder = makeRequest(router, "/api/inbox", "Bearer "+plain)
+	assert.Equalf(200, recorder.Code, "read keys should list the inbox")
+}
+
+func makeRequest(router *gin.Engine, path string, authorization string) *httptest.ResponseRecorder {
+	request, _ := http.NewRequest("GET", path, nil)
+	request.Header.Set("Authorization", authorization)
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+
+	return recorder
+}
@@ -0,0 +1,18 @@
+package entities
+
+import "time"
+
+type ApiKeyEntity struct {
+	ID         uint
+	OwnerID    string `gorm:"index"`
+	Tenant     string
+	Name       string
+	Prefix     string   `gorm:"uniqueIndex"`
+	Hash       string   `json:"-"`
+	Scopes     []string `gorm:"serializer:json"`
+	ExpiresAt  time.Time
+	LastUsedAt time.Time
+	RevokedAt  time.Time
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
@@ -0,0 +1,29 @@
+package entities
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Actions recorded in the audit log
+const (
+	AuditItemCreate  = "todo.create"
+	AuditItemUpdate  = "todo.update"
+	AuditItemDelete  = "todo.delete"
+	AuditItemRevert  = "todo.revert"
+	AuditShareCreate = "share.create"
+	AuditShareDelete = "share.delete"
+)
+
+type AuditEntryEntity struct {
+	ID        uint
+	Actor     string `gorm:"index"`
+	Tenant    string
+	Action    string          `gorm:"index"`
+	ItemID    uint            `gorm:"index"`
+	Before    json.RawMessage `gorm:"serializer:json"`
+	After     json.RawMessage `gorm:"serializer:json"`
+	RequestID string          `gorm:"index"`
+	TraceID   string          `gorm:"index"`
+	CreatedAt time.Time       `gorm:"index"`
+}
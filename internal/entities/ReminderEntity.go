@@ -0,0 +1,61 @@
+package entities
+
+import "time"
+
+// States of a reminder
+const (
+	// The reminder is waiting to be sent, or for its next attempt
+	ReminderPending = "pending"
+
+	// The notifier of the reminder has delivered it
+	ReminderSent = "sent"
+
+	// The item has been completed, deleted or rescheduled before the reminder was due
+	ReminderCanceled = "canceled"
+
+	// Every attempt has failed, and the reminder has been given up
+	ReminderDead = "dead"
+)
+
+// ReminderEntity is a reminder of the due date of a ToDoItemEntity, sent through one notifier
+// channel at an offset from the due date.
+//
+// Reminders are leased by the scheduler instance sending them, so that every reminder is sent
+// by one instance at a time.
+type ReminderEntity struct {
+	ID     uint
+	ItemID uint `gorm:"index"`
+	// Owner of the item, to whom the reminder is addressed
+	Recipient string
+	// Name of the notifier channel sending the reminder
+	Channel string
+	// Due date of the item the reminder was scheduled for
+	DueDate time.Time
+	// Offset from the due date, negative before the due date
+	Offset time.Duration
+	// When the reminder is sent, the due date plus the offset, or the next attempt after a failure
+	SendAt    time.Time `gorm:"index:idx_reminder_due"`
+	Status    string    `gorm:"index:idx_reminder_due"`
+	Attempts  int
+	LastError string
+	SentAt    time.Time
+	// Scheduler instance holding the lease of the reminder, and when the lease expires
+	LeaseHolder  string    `json:"-"`
+	LeaseExpires time.Time `json:"-"`
+	// Key preventing the same reminder from being scheduled twice
+	DedupKey  string `gorm:"uniqueIndex" json:"-"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// InboxMessageEntity is a notification in the in-app inbox of a user.
+type InboxMessageEntity struct {
+	ID         uint
+	OwnerID    string `gorm:"index"`
+	ItemID     uint
+	ReminderID uint `gorm:"uniqueIndex"`
+	Subject    string
+	Body       string
+	Read       bool `gorm:"column:is_read"`
+	CreatedAt  time.Time
+}
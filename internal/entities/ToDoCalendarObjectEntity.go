@@ -0,0 +1,16 @@
+package entities
+
+import "time"
+
+// ToDoCalendarObjectEntity records the resource name and UID a CalDAV client chose for a
+// ToDoItemEntity it created. Other items are exposed under names derived from their ID.
+//
+// The record outlives the item, so that the deletion can be reported to syncing clients
+// under the name they know.
+type ToDoCalendarObjectEntity struct {
+	ID        uint
+	ItemID    uint   `gorm:"uniqueIndex"`
+	Name      string `gorm:"uniqueIndex"`
+	UID       string
+	CreatedAt time.Time
+}
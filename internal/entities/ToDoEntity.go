@@ -4,10 +4,25 @@ import "time"
 
 type ToDoItemEntity struct {
 	ID          uint
+	OwnerID     string `gorm:"index"`
 	Description string
 	Completed   bool
 	DueDate     time.Time
 	CompletedAt time.Time
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
+	// Item the item is a subtask of; zero for top-level items
+	ParentID uint `gorm:"index"`
+	// Recurrence rule of the series the item is an occurrence of, as the value of an RFC 5545
+	// RRULE property; empty for items that do not recur
+	Recurrence string
+	// IANA time zone the due dates of the series are computed in; empty for UTC
+	TimeZone string
+	// Series the item is an occurrence of, if any
+	SeriesID uint `gorm:"index"`
+	// Due date the occurrence was scheduled for by its series, which the due date differs from
+	// once the occurrence has been rescheduled
+	ScheduledDue time.Time
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	// Email address of the owner as of creating the item, if known, to which reminders are mailed
+	OwnerEmail string `json:"-"`
 }
@@ -0,0 +1,35 @@
+package entities
+
+import "time"
+
+// Changes recorded in the revision history of a ToDoItemEntity
+const (
+	RevisionCreate = "create"
+	RevisionUpdate = "update"
+	RevisionRevert = "revert"
+	RevisionDelete = "delete"
+)
+
+type ToDoRevisionEntity struct {
+	ID        uint
+	ItemID    uint `gorm:"uniqueIndex:idx_revision_item"`
+	Revision  uint `gorm:"uniqueIndex:idx_revision_item"`
+	Action    string
+	Actor     string
+	Snapshot  ToDoItemEntity `gorm:"serializer:json"`
+	CreatedAt time.Time      `gorm:"index"`
+
+	// Position of the revision in the order the changes of all items were committed in
+	Sequence uint `gorm:"index"`
+
+	// Shares of the item when it was deleted, recorded with deletions only, as the shares are
+	// removed along with the item
+	SharedWith []ToDoShareEntity `gorm:"serializer:json" json:"-"`
+}
+
+// ToDoSequenceEntity is the counter numbering the revisions of all items in the order they are
+// committed. It is stored in a single row, which is locked by the transactions recording revisions.
+type ToDoSequenceEntity struct {
+	ID    uint
+	Value uint
+}
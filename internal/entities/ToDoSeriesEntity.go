@@ -0,0 +1,22 @@
+package entities
+
+import "time"
+
+// ToDoSeriesEntity describes a series of recurring ToDo items.
+//
+// Only the open occurrence of a series is stored as an item. The next occurrence is created
+// from the series when the open occurrence is completed.
+type ToDoSeriesEntity struct {
+	ID      uint
+	OwnerID string `gorm:"index"`
+	// Description of the occurrences
+	Description string
+	// Recurrence rule, as the value of an RFC 5545 RRULE property; empty once the series has ended
+	Recurrence string
+	// IANA time zone the due dates are computed in; empty for UTC
+	TimeZone string
+	// Due date of the first occurrence, which the recurrence rule is applied to
+	Start     time.Time
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
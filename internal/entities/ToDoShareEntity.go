@@ -0,0 +1,27 @@
+package entities
+
+import "time"
+
+// Kinds of grantee a ToDoItemEntity may be shared with
+const (
+	GranteeUser  = "user"
+	GranteeGroup = "group"
+)
+
+// Permissions that may be held on a ToDoItemEntity. PermissionOwner is implied
+// by owning the item and can not be granted through a share.
+const (
+	PermissionViewer = "viewer"
+	PermissionEditor = "editor"
+	PermissionOwner  = "owner"
+)
+
+type ToDoShareEntity struct {
+	ID          uint
+	ItemID      uint   `gorm:"uniqueIndex:idx_share_grantee"`
+	GranteeType string `gorm:"uniqueIndex:idx_share_grantee"`
+	GranteeID   string `gorm:"uniqueIndex:idx_share_grantee"`
+	Permission  string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
@@ -0,0 +1,77 @@
+package entities
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Events a webhook subscription may subscribe to
+const (
+	WebhookItemCreated   = "todo.created"
+	WebhookItemCompleted = "todo.completed"
+	WebhookItemDeleted   = "todo.deleted"
+	WebhookItemOverdue   = "todo.overdue"
+	WebhookItemReminder  = "todo.reminder"
+)
+
+// WebhookEvents lists the events a webhook subscription may subscribe to
+var WebhookEvents = []string{WebhookItemCreated, WebhookItemCompleted, WebhookItemDeleted, WebhookItemOverdue, WebhookItemReminder}
+
+// States of a webhook delivery
+const (
+	// The delivery is waiting for its next attempt
+	DeliveryPending = "pending"
+
+	// The receiver has accepted the delivery
+	DeliveryDelivered = "delivered"
+
+	// Every attempt has failed, and the delivery has been given up
+	DeliveryDead = "dead"
+)
+
+type WebhookSubscriptionEntity struct {
+	ID      uint
+	OwnerID string `gorm:"index"`
+	Tenant  string
+	URL     string
+	Events  []string `gorm:"serializer:json"`
+	Secret  string   `json:"-"`
+	Active  bool
+	// Description of the subscription, for its owner
+	Description string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// WebhookDeliveryEntity is an event waiting in the outbox for delivery to a subscription, or
+// the record of its delivery.
+type WebhookDeliveryEntity struct {
+	ID             uint
+	SubscriptionID uint   `gorm:"index"`
+	Event          string `gorm:"index"`
+	ItemID         uint
+	Payload        json.RawMessage `gorm:"serializer:json"`
+	Status         string          `gorm:"index:idx_delivery_due"`
+	NextAttemptAt  time.Time       `gorm:"index:idx_delivery_due"`
+	Attempts       int
+	LastError      string
+	DeliveredAt    time.Time
+	// Key preventing the same event from being queued twice, if the event may be detected repeatedly
+	DedupKey  *string `gorm:"uniqueIndex" json:"-"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// WebhookAttemptEntity logs an attempt to deliver a WebhookDeliveryEntity.
+type WebhookAttemptEntity struct {
+	ID         uint
+	DeliveryID uint `gorm:"index"`
+	Attempt    int
+	StatusCode int
+	// Beginning of the response body
+	Response string
+	// Reason why the attempt failed, if it did
+	Error      string
+	DurationMs int64
+	CreatedAt  time.Time
+}
@@ -0,0 +1,101 @@
+package events
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+
+	"todo-api-go/entities"
+	"todo-api-go/persistence"
+	"todo-api-go/reqctx"
+)
+
+// Component of the loggers used by this package
+const logComponent = "events"
+
+// Feed propagates the changes of items between the instances of the API sharing a database,
+// so that clients see the changes made through any instance.
+type Feed interface {
+	// Publish sends an event to the hubs of all instances, this one included. The ID of the
+	// event is assigned by the receiving hubs.
+	Publish(ctx context.Context, event Event) error
+
+	// Run passes the events published by any instance on to the hub of this instance, until
+	// the context is canceled.
+	Run(ctx context.Context, hub *Hub) error
+}
+
+// ItemLoader retrieves the current state of an item, for events whose item could not be
+// propagated in full.
+type ItemLoader func(ctx context.Context, id uint) (*entities.ToDoItemEntity, error)
+
+// AudienceLoader retrieves the audience of an item, or of a deleted item as of its deletion,
+// for events whose audience could not be propagated in full.
+type AudienceLoader func(ctx context.Context, id uint) (*persistence.ItemAudience, error)
+
+// NewFeed creates the feed suiting a database: a PostgresFeed for Postgres databases, and a
+// MemoryFeed reaching this instance only for any other database, such as sqlite databases
+// that can not be shared between instances anyway.
+//
+// db: The database shared by the instances.
+// load: The loader of items whose state could not be propagated in full.
+// loadAudience: The loader of the audiences of such items.
+// Returns the Feed and an error.
+func NewFeed(db *gorm.DB, load ItemLoader, loadAudience AudienceLoader) (Feed, error) {
+	if db.Dialector.Name() != "postgres" {
+		return NewMemoryFeed(), nil
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewPostgresFeed(sqlDB, PostgresChannel, load, loadAudience), nil
+}
+
+// NewEvent describes a committed change of an item, as reported to a persistence.AudienceObserver,
+// as an event. The ID of the event is assigned once it is published by a hub.
+func NewEvent(audience persistence.ItemAudience, action string, before *entities.ToDoItemEntity, after *entities.ToDoItemEntity) Event {
+	event := Event{Type: ItemUpdated, OccurredAt: time.Now(), Audience: audience}
+
+	switch action {
+	case entities.RevisionCreate:
+		event.Type = ItemCreated
+	case entities.RevisionDelete:
+		event.Type = ItemDeleted
+	}
+
+	if after != nil {
+		event.Item = *after
+	} else {
+		event.Item = *before
+	}
+
+	return event
+}
+
+// Relay publishes the changes of items on a feed, as a persistence.AudienceObserver.
+type Relay struct {
+	feed Feed
+}
+
+// NewRelay creates a Relay publishing on the specified feed.
+//
+// feed: The feed to publish the changes on.
+// Returns a pointer to Relay.
+func NewRelay(feed Feed) *Relay {
+	return &Relay{feed: feed}
+}
+
+// ItemChangedFor implements persistence.AudienceObserver by publishing the change on the feed.
+// Failures are logged, as the change has been committed already.
+func (relay *Relay) ItemChangedFor(ctx context.Context, audience persistence.ItemAudience, action string, before *entities.ToDoItemEntity, after *entities.ToDoItemEntity) {
+	event := NewEvent(audience, action, before, after)
+
+	err := relay.feed.Publish(ctx, event)
+	if err != nil {
+		reqctx.LoggerFrom(ctx, logComponent).ErrorContext(ctx, "change could not be published", "item_id", event.Item.ID, "error", err)
+	}
+}
@@ -0,0 +1,240 @@
+package events_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"todo-api-go/entities"
+	"todo-api-go/events"
+	"todo-api-go/persistence"
+	"todo-api-go/reqctx"
+	"todo-api-go/testsupport"
+)
+
+func TestMemoryFeed(t *testing.T) {
+	assert := assert.New(t)
+
+	feed := events.NewMemoryFeed()
+	hub := events.NewHub(testParameters())
+	runFeed(t, feed, hub)
+
+	mgr := testsupport.CreateTestManager(t)
+	mgr.AddAudienceObserver(events.NewRelay(feed))
+
+	subscription, _, _ := hub.Subscribe(&reqctx.Principal{Subject: "alice"}, 0)
+	defer subscription.Close()
+
+	item := &entities.ToDoItemEntity{Description: "relayed"}
+	err := mgr.WithContext(reqctx.WithPrincipal(context.Background(), &reqctx.Principal{Subject: "alice"})).Create(item)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	event := receive(t, subscription)
+	assert.Equalf(events.ItemCreated, event.Type, "creation should be relayed")
+	assert.Equalf(item.ID, event.Item.ID, "item should match")
+}
+
+func TestPostgresFeed(t *testing.T) {
+	assert := assert.New(t)
+
+	standIn := startPostgresStandIn(t)
+	mgr := testsupport.CreateTestManager(t)
+	load := func(ctx context.Context, id uint) (*entities.ToDoItemEntity, error) {
+		return mgr.WithContext(ctx).FineOne(int(id))
+	}
+	loadAudience := func(ctx context.Context, id uint) (*persistence.ItemAudience, error) {
+		return mgr.WithContext(ctx).FindAudience(id)
+	}
+
+	// Two instances sharing the database, the first one making the changes
+	feed := events.NewPostgresFeed(openStandIn(t, standIn), events.PostgresChannel, load, loadAudience)
+	hub := events.NewHub(testParameters())
+	runFeed(t, feed, hub)
+	mgr.AddAudienceObserver(events.NewRelay(feed))
+
+	otherHub := events.NewHub(testParameters())
+	runFeed(t, events.NewPostgresFeed(openStandIn(t, standIn), events.PostgresChannel, load, loadAudience), otherHub)
+
+	alice := &reqctx.Principal{Subject: "alice"}
+	subscription, _, _ := hub.Subscribe(alice, 0)
+	defer subscription.Close()
+	otherSubscription, _, _ := otherHub.Subscribe(alice, 0)
+	defer otherSubscription.Close()
+	bobSubscription, _, _ := otherHub.Subscribe(&reqctx.Principal{Subject: "bob"}, 0)
+	defer bobSubscription.Close()
+
+	items := mgr.WithContext(reqctx.WithPrincipal(context.Background(), alice))
+	item := &entities.ToDoItemEntity{Description: "It's a \\ shared item"}
+	err := items.Create(item)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	for _, subscription := range []*events.Subscription{subscription, otherSubscription} {
+		event := receive(t, subscription)
+		assert.Equalf(events.ItemCreated, event.Type, "creation should be propagated")
+		assert.Equalf(item.ID, event.Item.ID, "item should be propagated")
+		assert.Equalf(item.Description, event.Item.Description, "item should be propagated")
+		assert.Truef(item.DueDate.Equal(event.Item.DueDate), "item should be propagated")
+	}
+	assert.Emptyf(bobSubscription.Events(), "the audience of the item should be propagated")
+
+	// Items exceeding the payload limit are loaded by the receiving instances
+	item.Description = strings.Repeat("long ", 2000)
+	err = items.Update(item)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	for _, subscription := range []*events.Subscription{subscription, otherSubscription} {
+		event := receive(t, subscription)
+		assert.Equalf(events.ItemUpdated, event.Type, "update should be propagated")
+		assert.Equalf(item.Description, event.Item.Description, "oversized item should be loaded")
+	}
+
+	err = items.Delete(item.ID)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	for _, subscription := range []*events.Subscription{subscription, otherSubscription} {
+		event := receive(t, subscription)
+		assert.Equalf(events.ItemDeleted, event.Type, "deletion should be propagated")
+		assert.Equalf(item.ID, event.Item.ID, "deleted item should be identified")
+	}
+}
+
+func TestPostgresFeedLargeAudience(t *testing.T) {
+	assert := assert.New(t)
+
+	standIn := startPostgresStandIn(t)
+	mgr := testsupport.CreateTestManager(t)
+	load := func(ctx context.Context, id uint) (*entities.ToDoItemEntity, error) {
+		return mgr.WithContext(ctx).FineOne(int(id))
+	}
+	loadAudience := func(ctx context.Context, id uint) (*persistence.ItemAudience, error) {
+		return mgr.WithContext(ctx).FindAudience(id)
+	}
+
+	feed := events.NewPostgresFeed(openStandIn(t, standIn), events.PostgresChannel, load, loadAudience)
+	hub := events.NewHub(testParameters())
+	runFeed(t, feed, hub)
+	mgr.AddAudienceObserver(events.NewRelay(feed))
+
+	otherHub := events.NewHub(testParameters())
+	runFeed(t, events.NewPostgresFeed(openStandIn(t, standIn), events.PostgresChannel, load, loadAudience), otherHub)
+
+	items := mgr.WithContext(reqctx.WithPrincipal(context.Background(), &reqctx.Principal{Subject: "alice"}))
+	item := &entities.ToDoItemEntity{Description: "widely shared"}
+	err := items.Create(item)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	// The grantees alone exceed the payload limit
+	var grantee string
+	for i := 0; i < 100; i++ {
+		grantee = fmt.Sprintf("%s-%03d", strings.Repeat("grantee", 15), i)
+		err = items.Share(&entities.ToDoShareEntity{ItemID: item.ID, GranteeType: entities.GranteeUser, GranteeID: grantee, Permission: entities.PermissionViewer})
+		assert.Nilf(err, "error should be nil, not %s", err)
+	}
+
+	subscription, _, _ := hub.Subscribe(&reqctx.Principal{Subject: grantee}, 0)
+	defer subscription.Close()
+	otherSubscription, _, _ := otherHub.Subscribe(&reqctx.Principal{Subject: grantee}, 0)
+	defer otherSubscription.Close()
+	bobSubscription, _, _ := otherHub.Subscribe(&reqctx.Principal{Subject: "bob"}, 0)
+	defer bobSubscription.Close()
+
+	item.Description = "still widely shared"
+	err = items.Update(item)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	// Both instances load the item, so the deletion waits for both to receive the update
+	for _, subscription := range []*events.Subscription{subscription, otherSubscription} {
+		event := receive(t, subscription)
+		assert.Equalf(events.ItemUpdated, event.Type, "update should be propagated")
+		assert.Equalf(item.Description, event.Item.Description, "item should be loaded")
+		assert.Truef(event.Audience.Includes(&reqctx.Principal{Subject: grantee}), "audience should be loaded")
+	}
+
+	err = items.Delete(item.ID)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	for _, subscription := range []*events.Subscription{subscription, otherSubscription} {
+		event := receive(t, subscription)
+		assert.Equalf(events.ItemDeleted, event.Type, "deletion should be propagated to the grantees")
+		assert.Equalf(item.ID, event.Item.ID, "deleted item should be identified")
+	}
+	assert.Emptyf(bobSubscription.Events(), "the audience of the item should be loaded")
+}
+
+func TestPostgresFeedReconnect(t *testing.T) {
+	assert := assert.New(t)
+
+	standIn := startPostgresStandIn(t)
+	feed := events.NewPostgresFeed(openStandIn(t, standIn), events.PostgresChannel, nil, nil)
+	hub := events.NewHub(testParameters())
+	runFeed(t, feed, hub)
+
+	standIn.dropConnections()
+	standIn.waitForListeners(t, 1)
+
+	subscription, _, _ := hub.Subscribe(&reqctx.Principal{Subject: "alice"}, 0)
+	defer subscription.Close()
+
+	err := feed.Publish(context.Background(), events.Event{Type: events.ItemCreated, Item: entities.ToDoItemEntity{ID: 42, OwnerID: "alice"}, Audience: persistence.ItemAudience{OwnerID: "alice"}})
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf(uint(42), receive(t, subscription).Item.ID, "events should be received after reconnecting")
+}
+
+func TestNewFeed(t *testing.T) {
+	assert := assert.New(t)
+
+	feed, err := events.NewFeed(testsupport.CreateTestDatabase(t), nil, nil)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.IsTypef(&events.MemoryFeed{}, feed, "sqlite databases should use an in-memory feed")
+}
+
+func openStandIn(t *testing.T, standIn *postgresStandIn) *sql.DB {
+	db, err := sql.Open("pgx", standIn.dsn())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+// runFeed runs a feed for a hub until the end of the test, returning once the feed passes
+// events on to the hub
+func runFeed(t *testing.T, feed events.Feed, hub *events.Hub) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	go func() {
+		defer close(done)
+		_ = feed.Run(ctx, hub)
+	}()
+
+	probe := &reqctx.Principal{Subject: "probe"}
+	subscription, _, _ := hub.Subscribe(probe, 0)
+	defer subscription.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		err := feed.Publish(context.Background(), events.Event{Type: events.ItemUpdated, Audience: persistence.ItemAudience{OwnerID: probe.Subject}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case <-subscription.Events():
+			return
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+
+	t.Fatal("feed not running")
+}
@@ -0,0 +1,204 @@
+package events
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+
+	"todo-api-go/entities"
+	"todo-api-go/persistence"
+	"todo-api-go/reqctx"
+)
+
+// Types of the events published by the Hub
+const (
+	ItemCreated = "todo.created"
+	ItemUpdated = "todo.updated"
+	ItemDeleted = "todo.deleted"
+)
+
+// Event is a committed change of a ToDoItemEntity, as published to the subscribers of a Hub.
+type Event struct {
+	// Sequence number of the event, increasing with every event published by the hub
+	ID uint64
+
+	// One of ItemCreated, ItemUpdated or ItemDeleted
+	Type string
+
+	// The item after the change; for deleted items, before the deletion
+	Item entities.ToDoItemEntity
+
+	OccurredAt time.Time
+
+	// The principals the event is published to
+	Audience persistence.ItemAudience `json:"-"`
+}
+
+type HubParameters struct {
+	// Number of recent events kept for subscribers resuming after an interruption
+	LogSize int `split_words:"true" default:"1000"`
+
+	// Number of events buffered for a subscriber, which is disconnected if it falls further behind
+	BufferSize int `split_words:"true" default:"64"`
+
+	// Interval between heartbeats on idle streams, keeping proxies from closing them
+	Heartbeat time.Duration `default:"15s"`
+}
+
+// Hub publishes the changes of items to the subscribers within the process that are allowed
+// to see them, keeping a bounded log of recent events for subscribers to resume from.
+//
+// The hub is fed by a ToDoEntityManager as an AudienceObserver.
+type Hub struct {
+	params HubParameters
+
+	mutex       sync.Mutex
+	log         []Event
+	nextID      uint64
+	subscribers map[*Subscription]struct{}
+}
+
+// Subscription receives the events published by a Hub that are visible to its principal.
+type Subscription struct {
+	hub       *Hub
+	principal *reqctx.Principal
+	events    chan Event
+}
+
+// NewHubFromEnv creates a Hub configured from the "EVENTS_***" environment variables.
+//
+// Returns a pointer to Hub and an error.
+func NewHubFromEnv() (*Hub, error) {
+	var params HubParameters
+
+	err := envconfig.Process("events", &params)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewHub(params), nil
+}
+
+// NewHub creates a Hub with the specified parameters.
+//
+// params: The configuration of the hub.
+// Returns a pointer to Hub.
+func NewHub(params HubParameters) *Hub {
+	return &Hub{
+		params: params,
+		// Event IDs start from the time the hub was created, so that IDs issued by an earlier
+		// process are not mistaken for IDs of this one
+		nextID:      uint64(time.Now().UnixMicro()),
+		subscribers: map[*Subscription]struct{}{},
+	}
+}
+
+// Heartbeat returns the interval between heartbeats on idle streams.
+func (hub *Hub) Heartbeat() time.Duration {
+	return hub.params.Heartbeat
+}
+
+// ItemChangedFor implements persistence.AudienceObserver by publishing the change.
+func (hub *Hub) ItemChangedFor(ctx context.Context, audience persistence.ItemAudience, action string, before *entities.ToDoItemEntity, after *entities.ToDoItemEntity) {
+	hub.Publish(NewEvent(audience, action, before, after))
+}
+
+// Publish assigns the next ID to an event, logs it and passes it on to the subscribers allowed
+// to see it.
+//
+// Subscribers are never waited for. A subscriber whose buffer is full is disconnected by
+// closing its channel, and expected to subscribe again from the last event it received.
+func (hub *Hub) Publish(event Event) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	event.ID = hub.nextID
+	hub.nextID++
+
+	hub.log = append(hub.log, event)
+	if excess := len(hub.log) - hub.params.LogSize; excess > 0 {
+		hub.log = append([]Event(nil), hub.log[excess:]...)
+	}
+
+	for subscription := range hub.subscribers {
+		if !event.Audience.Includes(subscription.principal) {
+			continue
+		}
+
+		select {
+		case subscription.events <- event:
+		default:
+			hub.unsubscribe(subscription)
+		}
+	}
+}
+
+// Subscribe subscribes a principal to the events it is allowed to see.
+//
+// Subscribers resuming after an interruption pass the ID of the last event they received,
+// and any other subscribers zero. The logged events following that event are returned along
+// with the subscription, unless some of them are no longer logged, in which case the
+// subscriber has missed events and should reload the items instead.
+//
+// It takes the principal, nil for internal subscribers, and the ID of the last event received.
+// It returns the subscription, the missed events and whether all missed events are included.
+func (hub *Hub) Subscribe(principal *reqctx.Principal, lastEventID uint64) (*Subscription, []Event, bool) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	subscription := &Subscription{
+		hub:       hub,
+		principal: principal,
+		events:    make(chan Event, hub.params.BufferSize),
+	}
+	hub.subscribers[subscription] = struct{}{}
+
+	if lastEventID == 0 {
+		return subscription, nil, true
+	}
+
+	// The event following the last one received must still be logged, or not have occurred yet
+	oldest := hub.nextID
+	if len(hub.log) > 0 {
+		oldest = hub.log[0].ID
+	}
+	if lastEventID+1 < oldest || lastEventID >= hub.nextID {
+		return subscription, nil, false
+	}
+
+	var missed []Event
+	for i := range hub.log {
+		if hub.log[i].ID > lastEventID && hub.log[i].Audience.Includes(principal) {
+			missed = append(missed, hub.log[i])
+		}
+	}
+
+	return subscription, missed, true
+}
+
+// Events returns the channel delivering the events of the subscription. It is closed once the
+// subscription has been closed, or disconnected for falling behind.
+func (subscription *Subscription) Events() <-chan Event {
+	return subscription.events
+}
+
+// Close ends the subscription. It may be called more than once.
+func (subscription *Subscription) Close() {
+	subscription.hub.mutex.Lock()
+	defer subscription.hub.mutex.Unlock()
+
+	subscription.hub.unsubscribe(subscription)
+}
+
+// unsubscribe removes a subscription and closes its channel, if it has not been removed yet.
+// The caller must hold the mutex of the hub.
+func (hub *Hub) unsubscribe(subscription *Subscription) {
+	if _, ok := hub.subscribers[subscription]; !ok {
+		return
+	}
+
+	delete(hub.subscribers, subscription)
+	close(subscription.events)
+}
@@ -0,0 +1,145 @@
+package events_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"todo-api-go/entities"
+	"todo-api-go/events"
+	"todo-api-go/persistence"
+	"todo-api-go/reqctx"
+	"todo-api-go/testsupport"
+)
+
+func TestHubVisibility(t *testing.T) {
+	assert := assert.New(t)
+
+	hub := events.NewHub(testParameters())
+	mgr := testsupport.CreateTestManager(t)
+	mgr.AddAudienceObserver(hub)
+
+	alice := &reqctx.Principal{Subject: "alice"}
+	bob := &reqctx.Principal{Subject: "bob", Groups: []string{"team"}}
+
+	aliceEvents, _, _ := hub.Subscribe(alice, 0)
+	defer aliceEvents.Close()
+	bobEvents, _, _ := hub.Subscribe(bob, 0)
+	defer bobEvents.Close()
+
+	items := mgr.WithContext(reqctx.WithPrincipal(context.Background(), alice))
+	item := &entities.ToDoItemEntity{Description: "private"}
+	err := items.Create(item)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	event := receive(t, aliceEvents)
+	assert.Equalf(events.ItemCreated, event.Type, "creation should be published")
+	assert.Equalf(item.ID, event.Item.ID, "item should match")
+	assert.Emptyf(bobEvents.Events(), "private items should not be published to other principals")
+
+	err = items.Share(&entities.ToDoShareEntity{ItemID: item.ID, GranteeType: entities.GranteeGroup, GranteeID: "team", Permission: entities.PermissionViewer})
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	item.Completed = true
+	err = items.Update(item)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf(events.ItemUpdated, receive(t, aliceEvents).Type, "update should be published")
+	assert.Equalf(events.ItemUpdated, receive(t, bobEvents).Type, "update should be published to the grantees")
+
+	err = items.Delete(item.ID)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf(events.ItemDeleted, receive(t, aliceEvents).Type, "deletion should be published")
+	assert.Equalf(events.ItemDeleted, receive(t, bobEvents).Type, "deletion should be published to the former grantees")
+}
+
+func TestHubResume(t *testing.T) {
+	assert := assert.New(t)
+
+	params := testParameters()
+	params.LogSize = 2
+	hub := events.NewHub(params)
+
+	subscription, _, _ := hub.Subscribe(nil, 0)
+	defer subscription.Close()
+
+	for i := 0; i < 4; i++ {
+		hub.Publish(events.Event{Type: events.ItemCreated, Item: entities.ToDoItemEntity{ID: uint(i + 1)}})
+	}
+
+	var received []events.Event
+	for i := 0; i < 4; i++ {
+		received = append(received, receive(t, subscription))
+	}
+
+	resumed, missed, complete := hub.Subscribe(nil, received[1].ID)
+	resumed.Close()
+	assert.Truef(complete, "logged events should be resumed")
+	assert.Equalf(received[2:], missed, "events after the last received event should be returned")
+
+	resumed, missed, complete = hub.Subscribe(nil, received[3].ID)
+	resumed.Close()
+	assert.Truef(complete, "up to date subscribers should be resumed")
+	assert.Emptyf(missed, "no events should be missed")
+
+	resumed, _, complete = hub.Subscribe(nil, received[0].ID)
+	resumed.Close()
+	assert.Falsef(complete, "events dropped from the log should be reported as missed")
+
+	resumed, _, complete = hub.Subscribe(nil, received[3].ID+100)
+	resumed.Close()
+	assert.Falsef(complete, "unknown events should be reported as missed")
+}
+
+func TestHubSlowSubscriber(t *testing.T) {
+	assert := assert.New(t)
+
+	params := testParameters()
+	params.BufferSize = 1
+	hub := events.NewHub(params)
+
+	subscription, _, _ := hub.Subscribe(nil, 0)
+	hub.Publish(events.Event{Type: events.ItemCreated})
+	hub.Publish(events.Event{Type: events.ItemCreated})
+
+	_, ok := <-subscription.Events()
+	assert.Truef(ok, "buffered event should be delivered")
+	_, ok = <-subscription.Events()
+	assert.Falsef(ok, "subscribers falling behind should be disconnected")
+
+	subscription.Close()
+}
+
+func TestAudience(t *testing.T) {
+	assert := assert.New(t)
+
+	audience := persistence.ItemAudience{OwnerID: "alice", Users: []string{"bob"}, Groups: []string{"team"}}
+	assert.Truef(audience.Includes(nil), "internal subscribers should see every item")
+	assert.Truef(audience.Includes(&reqctx.Principal{Subject: "alice"}), "owners should see their items")
+	assert.Truef(audience.Includes(&reqctx.Principal{Subject: "bob"}), "grantees should see shared items")
+	assert.Truef(audience.Includes(&reqctx.Principal{Subject: "carol", Groups: []string{"team"}}), "group members should see shared items")
+	assert.Falsef(audience.Includes(&reqctx.Principal{Subject: "carol"}), "other principals should not see the item")
+
+	unowned := persistence.ItemAudience{}
+	assert.Truef(unowned.Includes(nil), "internal subscribers should see items without owner")
+	assert.Truef(unowned.Includes(&reqctx.Principal{Subject: "carol", Roles: []string{persistence.RoleAdmin}}), "admins should see items without owner")
+	assert.Falsef(unowned.Includes(&reqctx.Principal{Subject: "carol"}), "items without owner should not be visible to everyone")
+}
+
+func receive(t *testing.T, subscription *events.Subscription) events.Event {
+	select {
+	case event, ok := <-subscription.Events():
+		if !ok {
+			t.Fatal("subscription closed")
+		}
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("no event received")
+	}
+	return events.Event{}
+}
+
+func testParameters() events.HubParameters {
+	return events.HubParameters{LogSize: 100, BufferSize: 10, Heartbeat: time.Second}
+}
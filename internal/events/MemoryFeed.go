@@ -0,0 +1,49 @@
+package events
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryFeed is a Feed reaching the hubs of this instance only.
+type MemoryFeed struct {
+	mutex sync.Mutex
+	hubs  map[*Hub]int
+}
+
+// NewMemoryFeed creates a MemoryFeed.
+//
+// Returns a pointer to MemoryFeed.
+func NewMemoryFeed() *MemoryFeed {
+	return &MemoryFeed{hubs: map[*Hub]int{}}
+}
+
+// Publish implements Feed by publishing the event on the hubs the feed is running for.
+// Events published while the feed is not running are dropped.
+func (feed *MemoryFeed) Publish(ctx context.Context, event Event) error {
+	feed.mutex.Lock()
+	defer feed.mutex.Unlock()
+
+	for hub := range feed.hubs {
+		hub.Publish(event)
+	}
+
+	return nil
+}
+
+// Run implements Feed by passing the published events on to the hub until the context is canceled.
+func (feed *MemoryFeed) Run(ctx context.Context, hub *Hub) error {
+	feed.mutex.Lock()
+	feed.hubs[hub]++
+	feed.mutex.Unlock()
+
+	<-ctx.Done()
+
+	feed.mutex.Lock()
+	if feed.hubs[hub]--; feed.hubs[hub] == 0 {
+		delete(feed.hubs, hub)
+	}
+	feed.mutex.Unlock()
+
+	return ctx.Err()
+}
@@ -0,0 +1,197 @@
+package events
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+
+	"todo-api-go/entities"
+	"todo-api-go/persistence"
+	"todo-api-go/reqctx"
+)
+
+// Channel of the Postgres notifications carrying the changes of items
+const PostgresChannel = "todo_changes"
+
+// Largest payload of a Postgres notification, in bytes
+const maxNotificationPayload = 7999
+
+// Delay before listening again after the listening connection failed
+const listenRetryDelay = time.Second
+
+// feedMessage is an event as sent through the notifications of a PostgresFeed.
+type feedMessage struct {
+	Type       string
+	Item       entities.ToDoItemEntity
+	OccurredAt time.Time
+	Audience   persistence.ItemAudience
+
+	// Whether only the ID and owner of the item and its audience were sent, as they exceeded
+	// the payload limit
+	Partial bool `json:",omitempty"`
+}
+
+// PostgresFeed is a Feed propagating events between instances through the LISTEN and NOTIFY
+// commands of Postgres.
+//
+// Every instance, the publishing one included, receives the events through the notifications
+// of its listening connection, so that all instances see the events in the same order.
+// Events published while the listening connection of an instance is interrupted are missed
+// by that instance.
+type PostgresFeed struct {
+	db           *sql.DB
+	channel      string
+	load         ItemLoader
+	loadAudience AudienceLoader
+}
+
+// NewPostgresFeed creates a PostgresFeed.
+//
+// db: The Postgres database shared by the instances, opened with the pgx driver.
+// channel: The channel of the notifications.
+// load: The loader of items that exceed the payload limit of notifications.
+// loadAudience: The loader of the audiences of such items.
+// Returns a pointer to PostgresFeed.
+func NewPostgresFeed(db *sql.DB, channel string, load ItemLoader, loadAudience AudienceLoader) *PostgresFeed {
+	return &PostgresFeed{db: db, channel: channel, load: load, loadAudience: loadAudience}
+}
+
+// Publish implements Feed by notifying the listening instances of the event.
+//
+// Notification payloads are limited to 8000 bytes, so events whose item and audience exceed
+// the limit, such as items with long descriptions or many shares, are sent with the ID and
+// owner of the item only. Receiving instances load the audience and the current state of such
+// items, except for the state of deleted items, which are published with their ID and owner only.
+func (feed *PostgresFeed) Publish(ctx context.Context, event Event) error {
+	message := feedMessage{Type: event.Type, Item: event.Item, OccurredAt: event.OccurredAt, Audience: event.Audience}
+
+	payload, err := json.Marshal(&message)
+	if err != nil {
+		return err
+	}
+
+	if len(payload) > maxNotificationPayload {
+		message.Item = entities.ToDoItemEntity{ID: event.Item.ID, OwnerID: event.Item.OwnerID}
+		message.Audience = persistence.ItemAudience{OwnerID: event.Audience.OwnerID}
+		message.Partial = true
+
+		payload, err = json.Marshal(&message)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Statements without arguments use the simple query protocol, which is cheapest for a
+	// statement that is not repeated with the same payload
+	_, err = feed.db.ExecContext(ctx, "NOTIFY "+pgx.Identifier{feed.channel}.Sanitize()+", "+quoteLiteral(string(payload)))
+	return err
+}
+
+// Run implements Feed by listening for notifications on a dedicated connection, passing the
+// events on to the hub until the context is canceled. The connection is opened again if it fails.
+func (feed *PostgresFeed) Run(ctx context.Context, hub *Hub) error {
+	logger := reqctx.LoggerFrom(ctx, logComponent)
+
+	for {
+		err := feed.listen(ctx, hub)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		logger.WarnContext(ctx, "listening for changes failed", "channel", feed.channel, "error", err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(listenRetryDelay):
+		}
+	}
+}
+
+// listen listens for notifications on a connection taken from the pool until it fails or the
+// context is canceled. The connection is discarded afterwards, as it may still be listening.
+func (feed *PostgresFeed) listen(ctx context.Context, hub *Hub) error {
+	conn, err := feed.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(driverConn any) error {
+		stdlibConn, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return fmt.Errorf("unsupported driver connection %T", driverConn)
+		}
+		pgxConn := stdlibConn.Conn()
+
+		_, err := pgxConn.Exec(ctx, "LISTEN "+pgx.Identifier{feed.channel}.Sanitize())
+		if err != nil {
+			return fmt.Errorf("%w: %w", driver.ErrBadConn, err)
+		}
+
+		for {
+			notification, err := pgxConn.WaitForNotification(ctx)
+			if err != nil {
+				return fmt.Errorf("%w: %w", driver.ErrBadConn, err)
+			}
+
+			feed.receive(ctx, hub, notification.Payload)
+		}
+	})
+}
+
+// receive publishes the event carried by the payload of a notification on the hub.
+func (feed *PostgresFeed) receive(ctx context.Context, hub *Hub, payload string) {
+	logger := reqctx.LoggerFrom(ctx, logComponent)
+
+	var message feedMessage
+	err := json.Unmarshal([]byte(payload), &message)
+	if err != nil {
+		logger.ErrorContext(ctx, "change notification could not be decoded", "error", err)
+		return
+	}
+
+	if message.Partial {
+		audience, err := feed.loadAudience(ctx, message.Item.ID)
+		switch {
+		case errors.Is(err, persistence.ErrNotFound):
+			// The item was deleted without a revision, so the deletion can not be relayed
+			return
+		case err != nil:
+			logger.ErrorContext(ctx, "audience of changed item could not be loaded", "item_id", message.Item.ID, "error", err)
+			return
+		}
+		message.Audience = *audience
+	}
+
+	if message.Partial && message.Type != ItemDeleted {
+		item, err := feed.load(ctx, message.Item.ID)
+		switch {
+		case errors.Is(err, persistence.ErrNotFound):
+			// The item was deleted since, which is published separately
+			return
+		case err != nil:
+			logger.ErrorContext(ctx, "changed item could not be loaded", "item_id", message.Item.ID, "error", err)
+			return
+		}
+		message.Item = *item
+	}
+
+	hub.Publish(Event{Type: message.Type, Item: message.Item, OccurredAt: message.OccurredAt, Audience: message.Audience})
+}
+
+// quoteLiteral quotes a string as an escape string constant, which is interpreted the same
+// regardless of the standard_conforming_strings setting.
+func quoteLiteral(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `'`, `''`)
+
+	return "E'" + value + "'"
+}
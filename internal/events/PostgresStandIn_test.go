@@ -0,0 +1,220 @@
+package events_test
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgproto3"
+)
+
+// postgresStandIn is a local server speaking enough of the Postgres protocol to test
+// LISTEN and NOTIFY: it accepts any user without authentication, registers listeners,
+// delivers notifications to them up to the payload limit of Postgres, and answers any other simple query with an empty response.
+type postgresStandIn struct {
+	listener net.Listener
+
+	mutex     sync.Mutex
+	conns     map[*standInConn]bool
+	listeners map[*standInConn]string
+}
+
+// standInConn is a client connection to a postgresStandIn.
+type standInConn struct {
+	conn    net.Conn
+	backend *pgproto3.Backend
+
+	// Serializes the messages sent to the client, as notifications are sent by the connections
+	// of the notifying clients
+	mutex sync.Mutex
+}
+
+func startPostgresStandIn(t *testing.T) *postgresStandIn {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	standIn := &postgresStandIn{listener: listener, conns: map[*standInConn]bool{}, listeners: map[*standInConn]string{}}
+	t.Cleanup(func() {
+		listener.Close()
+		standIn.dropConnections()
+	})
+
+	go standIn.accept()
+
+	return standIn
+}
+
+// dsn returns the data source name for connecting to the stand-in with the pgx driver
+func (standIn *postgresStandIn) dsn() string {
+	return fmt.Sprintf("postgres://test@%s/test?sslmode=disable", standIn.listener.Addr())
+}
+
+// waitForListeners waits until the specified number of connections are listening
+func (standIn *postgresStandIn) waitForListeners(t *testing.T, count int) {
+	deadline := time.Now().Add(5 * time.Second)
+
+	for time.Now().Before(deadline) {
+		standIn.mutex.Lock()
+		listening := len(standIn.listeners)
+		standIn.mutex.Unlock()
+
+		if listening >= count {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("fewer than %d connections listening", count)
+}
+
+// dropConnections closes all client connections, as a restarting server would
+func (standIn *postgresStandIn) dropConnections() {
+	standIn.mutex.Lock()
+	defer standIn.mutex.Unlock()
+
+	for conn := range standIn.conns {
+		conn.conn.Close()
+		delete(standIn.listeners, conn)
+	}
+}
+
+func (standIn *postgresStandIn) accept() {
+	for {
+		conn, err := standIn.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		client := &standInConn{conn: conn, backend: pgproto3.NewBackend(conn, conn)}
+
+		standIn.mutex.Lock()
+		standIn.conns[client] = true
+		standIn.mutex.Unlock()
+
+		go standIn.serve(client)
+	}
+}
+
+func (standIn *postgresStandIn) serve(client *standInConn) {
+	defer func() {
+		standIn.mutex.Lock()
+		delete(standIn.conns, client)
+		delete(standIn.listeners, client)
+		standIn.mutex.Unlock()
+
+		client.conn.Close()
+	}()
+
+	if !standIn.startup(client) {
+		return
+	}
+
+	for {
+		message, err := client.backend.Receive()
+		if err != nil {
+			return
+		}
+
+		switch message := message.(type) {
+		case *pgproto3.Query:
+			standIn.query(client, message.String)
+		case *pgproto3.Sync:
+			_ = client.send(&pgproto3.ErrorResponse{Severity: "ERROR", Code: "0A000", Message: "only simple queries are supported"}, &pgproto3.ReadyForQuery{TxStatus: 'I'})
+		case *pgproto3.Terminate:
+			return
+		}
+	}
+}
+
+// startup accepts the startup message of a client, declining encryption
+func (standIn *postgresStandIn) startup(client *standInConn) bool {
+	for {
+		message, err := client.backend.ReceiveStartupMessage()
+		if err != nil {
+			return false
+		}
+
+		switch message.(type) {
+		case *pgproto3.SSLRequest, *pgproto3.GSSEncRequest:
+			_, err = client.conn.Write([]byte("N"))
+			if err != nil {
+				return false
+			}
+		case *pgproto3.StartupMessage:
+			return client.send(
+				&pgproto3.AuthenticationOk{},
+				&pgproto3.ParameterStatus{Name: "server_version", Value: "16.0"},
+				&pgproto3.ParameterStatus{Name: "standard_conforming_strings", Value: "on"},
+				&pgproto3.ParameterStatus{Name: "client_encoding", Value: "UTF8"},
+				&pgproto3.BackendKeyData{ProcessID: 1, SecretKey: 1},
+				&pgproto3.ReadyForQuery{TxStatus: 'I'},
+			) == nil
+		default:
+			return false
+		}
+	}
+}
+
+func (standIn *postgresStandIn) query(client *standInConn, query string) {
+	query = strings.TrimSpace(query)
+
+	switch {
+	case strings.HasPrefix(query, "LISTEN "):
+		standIn.mutex.Lock()
+		standIn.listeners[client] = strings.TrimPrefix(query, "LISTEN ")
+		standIn.mutex.Unlock()
+
+		_ = client.send(&pgproto3.CommandComplete{CommandTag: []byte("LISTEN")}, &pgproto3.ReadyForQuery{TxStatus: 'I'})
+	case strings.HasPrefix(query, "NOTIFY "):
+		channel, payload, _ := strings.Cut(strings.TrimPrefix(query, "NOTIFY "), ", E'")
+		notification := &pgproto3.NotificationResponse{PID: 1, Channel: strings.Trim(channel, `"`), Payload: unescapeLiteral(strings.TrimSuffix(payload, "'"))}
+
+		// Postgres rejects payloads of 8000 bytes or more
+		if len(notification.Payload) >= 8000 {
+			_ = client.send(&pgproto3.ErrorResponse{Severity: "ERROR", Code: "22023", Message: "payload string too long"}, &pgproto3.ReadyForQuery{TxStatus: 'I'})
+			return
+		}
+
+		standIn.mutex.Lock()
+		for listener, listening := range standIn.listeners {
+			if listening == channel {
+				_ = listener.send(notification)
+			}
+		}
+		standIn.mutex.Unlock()
+
+		_ = client.send(&pgproto3.CommandComplete{CommandTag: []byte("NOTIFY")}, &pgproto3.ReadyForQuery{TxStatus: 'I'})
+	default:
+		_ = client.send(&pgproto3.EmptyQueryResponse{}, &pgproto3.ReadyForQuery{TxStatus: 'I'})
+	}
+}
+
+func (client *standInConn) send(messages ...pgproto3.BackendMessage) error {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	for _, message := range messages {
+		client.backend.Send(message)
+	}
+
+	return client.backend.Flush()
+}
+
+// unescapeLiteral reverses the escaping of backslashes and quotes in an escape string constant
+func unescapeLiteral(value string) string {
+	var builder strings.Builder
+
+	for i := 0; i < len(value); i++ {
+		if (value[i] == '\\' || value[i] == '\'') && i+1 < len(value) && value[i+1] == value[i] {
+			i++
+		}
+		builder.WriteByte(value[i])
+	}
+
+	return builder.String()
+}
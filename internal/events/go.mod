@@ -0,0 +1,18 @@
+module todo-api-go/events
+
+go 1.21.5
+
+require (
+	github.com/jackc/pgx/v5 v5.4.3
+	github.com/kelseyhightower/envconfig v1.4.0
+	github.com/stretchr/testify v1.8.4
+	gorm.io/gorm v1.25.5
+)
+
+require (
+	github.com/jackc/pgpassfile v1.0.0 // indirect
+	github.com/jackc/pgservicefile v0.0.0-20221227161230-091c0ba34f0a // indirect
+	github.com/jinzhu/inflection v1.0.0 // indirect
+	github.com/jinzhu/now v1.1.5 // indirect
+	golang.org/x/crypto v0.9.0 // indirect
+)
@@ -2,6 +2,7 @@ package oidc
 
 import (
 	"context"
+	"sort"
 
 	"github.com/gin-gonic/gin"
 	"github.com/kelseyhightower/envconfig"
@@ -9,6 +10,14 @@ import (
 	"github.com/zitadel/zitadel-go/v3/pkg/authorization"
 	"github.com/zitadel/zitadel-go/v3/pkg/authorization/oauth"
 	"github.com/zitadel/zitadel-go/v3/pkg/zitadel"
+
+	"todo-api-go/reqctx"
+)
+
+const (
+	rolesClaim         = "urn:zitadel:iam:org:project:roles"
+	resourceOwnerClaim = "urn:zitadel:iam:user:resourceowner:id"
+	groupsClaim        = "groups"
 )
 
 type ZitadelParameters struct {
@@ -77,7 +86,48 @@ func (authz *Authorizer) RequiresRole(role string) gin.HandlerFunc {
 		}
 
 		c.Set("introspection", inspectCtx)
+		c.Request = c.Request.WithContext(reqctx.WithPrincipal(c.Request.Context(), newPrincipal(inspectCtx)))
 
 		c.Next()
 	}
 }
+
+// newPrincipal creates the principal describing the caller of an introspected token.
+//
+// The roles are taken from the Zitadel project roles claim, the tenant from the resource owner
+// claim and the groups from the optional "groups" claim. The email address is only taken if
+// it has been verified.
+//
+// It takes a pointer to the oauth.IntrospectionContext as a parameter.
+// It returns a pointer to reqctx.Principal.
+func newPrincipal(inspectCtx *oauth.IntrospectionContext) *reqctx.Principal {
+	principal := &reqctx.Principal{
+		Subject: inspectCtx.Subject,
+		Name:    inspectCtx.Username,
+	}
+
+	if inspectCtx.EmailVerified {
+		principal.Email = inspectCtx.Email
+	}
+
+	if tenant, ok := inspectCtx.Claims[resourceOwnerClaim].(string); ok {
+		principal.Tenant = tenant
+	}
+
+	if roles, ok := inspectCtx.Claims[rolesClaim].(map[string]interface{}); ok {
+		for role := range roles {
+			principal.Roles = append(principal.Roles, role)
+		}
+		sort.Strings(principal.Roles)
+	}
+
+	if groups, ok := inspectCtx.Claims[groupsClaim].([]interface{}); ok {
+		for _, group := range groups {
+			if name, ok := group.(string); ok {
+				principal.Groups = append(principal.Groups, name)
+			}
+		}
+	}
+
+	return principal
+}
@@ -0,0 +1,299 @@
+package persistence
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"todo-api-go/entities"
+	"todo-api-go/reqctx"
+)
+
+const (
+	// Prefix identifying API keys issued by this service
+	ApiKeyPrefix = "tdk_"
+
+	// Lifetime of API keys created without an explicit expiration
+	DefaultApiKeyLifetime = 90 * 24 * time.Hour
+
+	// Longest lifetime an API key may be created with
+	MaxApiKeyLifetime = 365 * 24 * time.Hour
+
+	// Minimum time between two updates of the last used timestamp of a key
+	lastUsedResolution = time.Minute
+)
+
+// ErrInvalidApiKey is returned when an API key is unknown, malformed, expired or revoked
+var ErrInvalidApiKey = errors.New("invalid api key")
+
+// ApiKeyScopes maps the scopes an API key may be created with onto the roles they grant.
+var ApiKeyScopes = map[string][]string{
+	"todo:read":   {"retrieve"},
+	"todo:create": {"create"},
+	"todo:update": {"update"},
+	"todo:delete": {"delete"},
+	"todo:write":  {"create", "update", "delete"},
+}
+
+type ApiKeyManager struct {
+	orm *gorm.DB
+	ctx context.Context
+}
+
+// NewApiKeyManager creates a new instance of ApiKeyManager.
+//
+// Parameters:
+// - orm: A pointer to a gorm.DB object representing the underlying GORM ORM instance.
+//
+// Returns:
+// - A pointer to an ApiKeyManager object.
+func NewApiKeyManager(orm *gorm.DB) *ApiKeyManager {
+	return &ApiKeyManager{orm: orm, ctx: context.Background()}
+}
+
+// Authenticate resolves an API key presented by a client.
+//
+// The key must exist, must not be expired or revoked and must match the stored hash.
+// The last used timestamp of the key is updated as a side effect.
+//
+// It takes the presented key as a parameter.
+// It returns the matching ApiKeyEntity, or ErrInvalidApiKey if the key is not acceptable.
+func (mgr *ApiKeyManager) Authenticate(presented string) (*entities.ApiKeyEntity, error) {
+	prefix, ok := parseApiKey(presented)
+	if !ok {
+		return nil, ErrInvalidApiKey
+	}
+
+	var key entities.ApiKeyEntity
+	err := mgr.orm.Where("prefix = ?", prefix).First(&key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvalidApiKey
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(key.Hash), []byte(hashApiKey(presented))) != 1 {
+		return nil, ErrInvalidApiKey
+	}
+
+	now := time.Now()
+	if !key.RevokedAt.IsZero() || !now.Before(key.ExpiresAt) {
+		return nil, ErrInvalidApiKey
+	}
+
+	if now.Sub(key.LastUsedAt) >= lastUsedResolution {
+		key.LastUsedAt = now
+		err = mgr.orm.Model(&key).UpdateColumn("last_used_at", now).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &key, nil
+}
+
+// Create issues a new API key.
+//
+// The principal of the manager's context becomes the owner of the key and may only grant
+// scopes mapping onto roles it holds itself. Keys without an expiration expire after
+// DefaultApiKeyLifetime.
+//
+// It takes a pointer to an ApiKeyEntity holding the name, scopes and expiration of the key.
+// The passed key is refreshed with the stored state on success.
+// It returns the plain text key, which is not stored and can not be recovered later, and an error if any occurred.
+func (mgr *ApiKeyManager) Create(key *entities.ApiKeyEntity) (string, error) {
+	principal := reqctx.PrincipalFrom(mgr.ctx)
+	if principal != nil {
+		key.OwnerID = principal.Subject
+		key.Tenant = principal.Tenant
+	}
+
+	err := validateApiKey(key, principal)
+	if err != nil {
+		return "", err
+	}
+
+	plain, prefix, err := generateApiKey()
+	if err != nil {
+		return "", err
+	}
+
+	key.ID = 0
+	key.Prefix = prefix
+	key.Hash = hashApiKey(plain)
+	key.LastUsedAt = time.Time{}
+	key.RevokedAt = time.Time{}
+
+	err = mgr.orm.Create(key).Error
+	if err != nil {
+		return "", err
+	}
+
+	return plain, nil
+}
+
+// FindAll retrieves the API keys owned by the principal of the manager's context.
+//
+// Revoked and expired keys are included. Internal callers without a principal retrieve all keys.
+// It returns a slice of ApiKeyEntity objects and an error if any occurred.
+func (mgr *ApiKeyManager) FindAll() ([]entities.ApiKeyEntity, error) {
+	var keys []entities.ApiKeyEntity
+	err := mgr.orm.Scopes(mgr.ownedKeys).Order("id asc").Find(&keys).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// Revoke revokes an API key owned by the principal of the manager's context.
+//
+// Revoking a key that has already been revoked has no effect.
+// It takes the ID of the key as a parameter.
+// It returns the revoked ApiKeyEntity and an error if the key does not exist or the operation fails.
+func (mgr *ApiKeyManager) Revoke(id uint) (*entities.ApiKeyEntity, error) {
+	var key entities.ApiKeyEntity
+	err := mgr.orm.Scopes(mgr.ownedKeys).First(&key, id).Error
+	if err != nil {
+		return nil, err
+	}
+
+	if key.RevokedAt.IsZero() {
+		key.RevokedAt = time.Now()
+		err = mgr.orm.Model(&key).Update("revoked_at", key.RevokedAt).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &key, nil
+}
+
+// WithContext returns a new ApiKeyManager with the provided context.
+//
+// ctx context.Context
+// *ApiKeyManager
+func (mgr *ApiKeyManager) WithContext(ctx context.Context) *ApiKeyManager {
+	return &ApiKeyManager{orm: mgr.orm.WithContext(ctx), ctx: ctx}
+}
+
+// ownedKeys is a scope restricting an ApiKeyEntity query to the keys owned by the principal
+// of the manager's context.
+func (mgr *ApiKeyManager) ownedKeys(db *gorm.DB) *gorm.DB {
+	principal := reqctx.PrincipalFrom(mgr.ctx)
+	if principal == nil {
+		return db
+	}
+
+	return db.Where("owner_id = ?", principal.Subject)
+}
+
+// RolesForScopes returns the roles granted by a set of API key scopes.
+//
+// Unknown scopes are ignored.
+// It takes a slice of scopes as a parameter and returns a sorted slice of roles.
+func RolesForScopes(scopes []string) []string {
+	var roles []string
+	for _, scope := range scopes {
+		for _, role := range ApiKeyScopes[scope] {
+			if !slices.Contains(roles, role) {
+				roles = append(roles, role)
+			}
+		}
+	}
+
+	slices.Sort(roles)
+	return roles
+}
+
+// validateApiKey checks the name, scopes and expiration of a key about to be created.
+//
+// When a principal is given, every role granted by the scopes must be held by the principal.
+// A missing expiration is defaulted to DefaultApiKeyLifetime.
+func validateApiKey(key *entities.ApiKeyEntity, principal *reqctx.Principal) error {
+	if strings.TrimSpace(key.Name) == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalid)
+	}
+
+	if len(key.Scopes) == 0 {
+		return fmt.Errorf("%w: at least one scope is required", ErrInvalid)
+	}
+
+	for _, scope := range key.Scopes {
+		if _, ok := ApiKeyScopes[scope]; !ok {
+			return fmt.Errorf("%w: unknown scope %q", ErrInvalid, scope)
+		}
+	}
+
+	if principal != nil {
+		for _, role := range RolesForScopes(key.Scopes) {
+			if !principal.HasRole(role) {
+				return fmt.Errorf("%w: role %q is required to grant the requested scopes", ErrForbidden, role)
+			}
+		}
+	}
+
+	now := time.Now()
+	switch {
+	case key.ExpiresAt.IsZero():
+		key.ExpiresAt = now.Add(DefaultApiKeyLifetime)
+	case !key.ExpiresAt.After(now):
+		return fmt.Errorf("%w: expiration must be in the future", ErrInvalid)
+	case key.ExpiresAt.After(now.Add(MaxApiKeyLifetime)):
+		return fmt.Errorf("%w: expiration must be within %s", ErrInvalid, MaxApiKeyLifetime)
+	}
+
+	return nil
+}
+
+// generateApiKey generates a new random API key.
+//
+// A key has the form "tdk_<prefix>_<secret>", where the prefix is used to look the key up
+// and the secret provides 256 bits of entropy.
+// It returns the plain text key and its prefix.
+func generateApiKey() (string, string, error) {
+	random := make([]byte, 38)
+	_, err := rand.Read(random)
+	if err != nil {
+		return "", "", err
+	}
+
+	prefix := hex.EncodeToString(random[:6])
+	secret := base64.RawURLEncoding.EncodeToString(random[6:])
+
+	return ApiKeyPrefix + prefix + "_" + secret, prefix, nil
+}
+
+// parseApiKey extracts the lookup prefix from a presented key.
+func parseApiKey(presented string) (string, bool) {
+	rest, ok := strings.CutPrefix(presented, ApiKeyPrefix)
+	if !ok {
+		return "", false
+	}
+
+	prefix, secret, ok := strings.Cut(rest, "_")
+	if !ok || prefix == "" || secret == "" {
+		return "", false
+	}
+
+	return prefix, true
+}
+
+// hashApiKey returns the hex encoded SHA-256 hash of a key.
+//
+// Keys are long random values, so a fast hash is sufficient to protect them at rest.
+func hashApiKey(plain string) string {
+	sum := sha256.Sum256([]byte(plain))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,87 @@
+package persistence_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"todo-api-go/entities"
+	"todo-api-go/persistence"
+	"todo-api-go/reqctx"
+	"todo-api-go/testsupport"
+)
+
+func TestApiKeyLifecycle(t *testing.T) {
+	assert := assert.New(t)
+
+	keys := persistence.NewApiKeyManager(testsupport.CreateTestDatabase(t)).WithContext(keyOwnerContext("alice", "retrieve", "create"))
+
+	key := &entities.ApiKeyEntity{Name: "ci", Scopes: []string{"todo:read"}}
+	plain, err := keys.Create(key)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Truef(len(plain) > len(persistence.ApiKeyPrefix), "plain key should be returned")
+	assert.Equalf("alice", key.OwnerID, "owner should be the creating principal")
+	assert.NotEqualf(plain, key.Hash, "key should be stored hashed")
+	assert.Falsef(key.ExpiresAt.IsZero(), "expiration should be defaulted")
+
+	authenticated, err := keys.Authenticate(plain)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf(key.ID, authenticated.ID, "IDs should match")
+	assert.Falsef(authenticated.LastUsedAt.IsZero(), "last used time should be tracked")
+
+	_, err = keys.Authenticate(plain + "x")
+	assert.ErrorIsf(err, persistence.ErrInvalidApiKey, "tampered keys should be rejected")
+
+	found, err := keys.FindAll()
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf(1, len(found), "length should be 1")
+
+	others, err := keys.WithContext(keyOwnerContext("bob")).FindAll()
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf(0, len(others), "keys of other principals should not be listed")
+
+	_, err = keys.WithContext(keyOwnerContext("bob")).Revoke(key.ID)
+	assert.ErrorIsf(err, persistence.ErrNotFound, "keys of other principals should not be revocable")
+
+	revoked, err := keys.Revoke(key.ID)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Falsef(revoked.RevokedAt.IsZero(), "revocation time should be set")
+
+	_, err = keys.Authenticate(plain)
+	assert.ErrorIsf(err, persistence.ErrInvalidApiKey, "revoked keys should be rejected")
+}
+
+func TestApiKeyValidation(t *testing.T) {
+	assert := assert.New(t)
+
+	keys := persistence.NewApiKeyManager(testsupport.CreateTestDatabase(t)).WithContext(keyOwnerContext("alice", "retrieve"))
+
+	_, err := keys.Create(&entities.ApiKeyEntity{Name: "ci", Scopes: []string{"todo:admin"}})
+	assert.ErrorIsf(err, persistence.ErrInvalid, "unknown scopes should be rejected")
+
+	_, err = keys.Create(&entities.ApiKeyEntity{Name: "ci", Scopes: []string{"todo:write"}})
+	assert.ErrorIsf(err, persistence.ErrForbidden, "scopes beyond the roles of the owner should be rejected")
+
+	_, err = keys.Create(&entities.ApiKeyEntity{
+		Name:      "ci",
+		Scopes:    []string{"todo:read"},
+		ExpiresAt: time.Now().Add(2 * persistence.MaxApiKeyLifetime),
+	})
+	assert.ErrorIsf(err, persistence.ErrInvalid, "excessive lifetimes should be rejected")
+}
+
+func TestRolesForScopes(t *testing.T) {
+	assert := assert.New(t)
+
+	roles := persistence.RolesForScopes([]string{"todo:read", "todo:write", "todo:update"})
+	assert.Equalf([]string{"create", "delete", "retrieve", "update"}, roles, "roles should match")
+}
+
+func keyOwnerContext(subject string, roles ...string) context.Context {
+	return reqctx.WithPrincipal(context.Background(), &reqctx.Principal{
+		Subject: subject,
+		Roles:   roles,
+	})
+}
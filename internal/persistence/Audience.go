@@ -0,0 +1,141 @@
+package persistence
+
+import (
+	"context"
+	"slices"
+
+	"gorm.io/gorm"
+
+	"todo-api-go/entities"
+	"todo-api-go/reqctx"
+)
+
+// ItemAudience describes the principals a ToDoItemEntity is visible to: its owner, and the
+// users and groups it is shared with. Items without an owner are only visible to admins.
+type ItemAudience struct {
+	OwnerID string
+	Users   []string
+	Groups  []string
+}
+
+// Includes reports whether the item is visible to a principal, following the same rules as
+// the queries of the ToDoEntityManager. Internal callers without a principal see every item.
+func (audience *ItemAudience) Includes(principal *reqctx.Principal) bool {
+	if audience.OwnerID == "" {
+		return managesUnownedItems(principal)
+	}
+
+	if principal == nil || audience.OwnerID == principal.Subject {
+		return true
+	}
+
+	if slices.Contains(audience.Users, principal.Subject) {
+		return true
+	}
+
+	for _, group := range principal.Groups {
+		if slices.Contains(audience.Groups, group) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AudienceObserver is notified of changes to ToDoItemEntity objects once they have been
+// committed, like an ItemObserver, together with the audience of the changed item. The
+// audience of a deleted item is the audience it had before the deletion.
+//
+// It suits observers forwarding changes to the principals allowed to see them.
+type AudienceObserver interface {
+	ItemChangedFor(ctx context.Context, audience ItemAudience, action string, before *entities.ToDoItemEntity, after *entities.ToDoItemEntity)
+}
+
+// AddAudienceObserver registers an observer that is notified of every committed change made
+// through the manager and the managers derived from it with WithContext afterwards, along
+// with the audience of the changed item.
+//
+// Observers are meant to be registered during startup, before the manager is used.
+func (mgr *ToDoEntityManager) AddAudienceObserver(observer AudienceObserver) {
+	mgr.audienceObservers = append(mgr.audienceObservers, observer)
+}
+
+// FindAudience looks up the audience of a ToDoItemEntity, or the audience a deleted item had
+// when it was deleted.
+//
+// It suits internal callers relaying the changes of items, such as feeds between instances.
+// Callers with a principal only find the audiences of items visible to them.
+// It takes the ID of the item as a parameter.
+// It returns the ItemAudience and ErrNotFound if the item neither exists nor has been deleted.
+func (mgr *ToDoEntityManager) FindAudience(id uint) (_ *ItemAudience, err error) {
+	mgr, span := mgr.startSpan(SpanFindAudience, AttributeItemID.Int(int(id)))
+	defer func() { endSpan(span, err) }()
+
+	var audience *ItemAudience
+	var items []entities.ToDoItemEntity
+	err = mgr.orm.Limit(1).Find(&items, id).Error
+	if err != nil {
+		return nil, err
+	}
+
+	if len(items) > 0 {
+		var shares []entities.ToDoShareEntity
+		err = mgr.orm.Where("item_id = ?", id).Order("id asc").Find(&shares).Error
+		if err != nil {
+			return nil, err
+		}
+		audience = newAudience(&items[0], shares)
+	} else {
+		var deletion entities.ToDoRevisionEntity
+		err = mgr.orm.Where("item_id = ? AND action = ?", id, entities.RevisionDelete).Order("id desc").First(&deletion).Error
+		if err != nil {
+			return nil, err
+		}
+		audience = newAudience(&deletion.Snapshot, deletion.SharedWith)
+	}
+
+	if !audience.Includes(reqctx.PrincipalFrom(mgr.ctx)) {
+		return nil, ErrNotFound
+	}
+
+	return audience, nil
+}
+
+// audienceOf looks up the audience of an item. It is only looked up if audience observers
+// are registered, as it is not needed otherwise.
+func (mgr *ToDoEntityManager) audienceOf(db *gorm.DB, item *entities.ToDoItemEntity) (*ItemAudience, error) {
+	if len(mgr.audienceObservers) == 0 {
+		return nil, nil
+	}
+
+	if item.OwnerID == "" {
+		return newAudience(item, nil), nil
+	}
+
+	var shares []entities.ToDoShareEntity
+	err := db.Where("item_id = ?", item.ID).Order("id asc").Find(&shares).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return newAudience(item, shares), nil
+}
+
+// newAudience describes the audience of an item shared through the specified shares.
+func newAudience(item *entities.ToDoItemEntity, shares []entities.ToDoShareEntity) *ItemAudience {
+	audience := &ItemAudience{OwnerID: item.OwnerID}
+	if item.OwnerID == "" {
+		return audience
+	}
+
+	for _, share := range shares {
+		switch share.GranteeType {
+		case entities.GranteeUser:
+			audience.Users = append(audience.Users, share.GranteeID)
+		case entities.GranteeGroup:
+			audience.Groups = append(audience.Groups, share.GranteeID)
+		}
+	}
+
+	return audience
+}
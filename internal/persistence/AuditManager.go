@@ -0,0 +1,169 @@
+package persistence
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+
+	"todo-api-go/entities"
+	"todo-api-go/reqctx"
+)
+
+// Actor recorded for operations performed without a principal
+const SystemActor = "system"
+
+type AuditFilter struct {
+	Actor     string
+	Action    string
+	ItemID    uint
+	RequestID string
+	TraceID   string
+	Since     time.Time
+	Until     time.Time
+}
+
+type AuditFilterConfigurator func(filter *AuditFilter)
+
+type AuditManager struct {
+	orm *gorm.DB
+}
+
+// NewAuditManager creates a new instance of AuditManager.
+//
+// The audit log is append-only: entries are written by the other managers of this package
+// as part of their mutating operations and can only be queried through the AuditManager.
+//
+// Parameters:
+// - orm: A pointer to a gorm.DB object representing the underlying GORM ORM instance.
+//
+// Returns:
+// - A pointer to an AuditManager object.
+func NewAuditManager(orm *gorm.DB) *AuditManager {
+	return &AuditManager{orm: orm}
+}
+
+// FindAll retrieves audit entries, newest first, matching the configured filter and paging options.
+//
+// It takes an AuditFilterConfigurator and optional PagingConfigurator arguments.
+// It returns a slice of AuditEntryEntity objects, the total number of matching entries and an error if any occurred.
+func (mgr *AuditManager) FindAll(configureFilter AuditFilterConfigurator, configurators ...PagingConfigurator) ([]entities.AuditEntryEntity, int64, error) {
+	var filter AuditFilter
+	if configureFilter != nil {
+		configureFilter(&filter)
+	}
+
+	var count int64
+	err := mgr.orm.Model(&entities.AuditEntryEntity{}).Scopes(filterAudit(&filter)).Count(&count).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var entries []entities.AuditEntryEntity
+	err = mgr.orm.Scopes(filterAudit(&filter), Paginate(configurators...)).Order("id desc").Find(&entries).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return entries, count, nil
+}
+
+// WithContext returns a new AuditManager with the provided context.
+//
+// ctx context.Context
+// *AuditManager
+func (mgr *AuditManager) WithContext(ctx context.Context) *AuditManager {
+	return &AuditManager{orm: mgr.orm.WithContext(ctx)}
+}
+
+// filterAudit returns a scope restricting an AuditEntryEntity query to the entries matching the filter.
+func filterAudit(filter *AuditFilter) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if filter.Actor != "" {
+			db = db.Where("actor = ?", filter.Actor)
+		}
+
+		if filter.Action != "" {
+			db = db.Where("action = ?", filter.Action)
+		}
+
+		if filter.ItemID != 0 {
+			db = db.Where("item_id = ?", filter.ItemID)
+		}
+
+		if filter.RequestID != "" {
+			db = db.Where("request_id = ?", filter.RequestID)
+		}
+
+		if filter.TraceID != "" {
+			db = db.Where("trace_id = ?", filter.TraceID)
+		}
+
+		if !filter.Since.IsZero() {
+			db = db.Where("created_at >= ?", filter.Since)
+		}
+
+		if !filter.Until.IsZero() {
+			db = db.Where("created_at < ?", filter.Until)
+		}
+
+		return db
+	}
+}
+
+// recordAudit appends an entry to the audit log.
+//
+// It is meant to be called within the transaction of the audited operation, so that the
+// entry is only recorded if the operation succeeds. The actor, request ID and trace ID
+// are taken from the context.
+//
+// Parameters:
+// - ctx: The context of the audited operation.
+// - tx: The transaction of the audited operation.
+// - action: The audited action.
+// - itemID: The ID of the affected ToDoItemEntity.
+// - before: The state before the operation, or nil.
+// - after: The state after the operation, or nil.
+func recordAudit(ctx context.Context, tx *gorm.DB, action string, itemID uint, before any, after any) error {
+	entry := entities.AuditEntryEntity{
+		Actor:     SystemActor,
+		Action:    action,
+		ItemID:    itemID,
+		RequestID: reqctx.RequestIDFrom(ctx),
+	}
+
+	if principal := reqctx.PrincipalFrom(ctx); principal != nil {
+		entry.Actor = principal.Subject
+		entry.Tenant = principal.Tenant
+	}
+
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.HasTraceID() {
+		entry.TraceID = spanContext.TraceID().String()
+	}
+
+	var err error
+	entry.Before, err = snapshot(before)
+	if err != nil {
+		return err
+	}
+
+	entry.After, err = snapshot(after)
+	if err != nil {
+		return err
+	}
+
+	return tx.Create(&entry).Error
+}
+
+// snapshot captures the state of an entity as JSON.
+//
+// It returns nil for a nil entity.
+func snapshot(entity any) (json.RawMessage, error) {
+	if entity == nil {
+		return nil, nil
+	}
+
+	return json.Marshal(entity)
+}
@@ -0,0 +1,92 @@
+package persistence_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"todo-api-go/entities"
+	"todo-api-go/persistence"
+	"todo-api-go/reqctx"
+	"todo-api-go/testsupport"
+)
+
+func TestAuditMutations(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testsupport.CreateTestDatabase(t)
+	audit := persistence.NewAuditManager(db)
+
+	ctx := reqctx.WithRequestID(principalContext("alice"), "request-1")
+	mgr := persistence.New(db).WithContext(ctx)
+
+	item := &entities.ToDoItemEntity{Description: "audited"}
+	err := mgr.Create(item)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	item.Description = "changed"
+	err = mgr.Update(item)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	err = mgr.Delete(item.ID)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	entries, total, err := audit.FindAll(func(filter *persistence.AuditFilter) {
+		filter.ItemID = item.ID
+	})
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf(int64(3), total, "total length should be 3")
+	assert.Equalf(
+		[]string{entities.AuditItemDelete, entities.AuditItemUpdate, entities.AuditItemCreate},
+		collectActions(entries),
+		"actions should be listed newest first")
+
+	for _, entry := range entries {
+		assert.Equalf("alice", entry.Actor, "actor should be the principal")
+		assert.Equalf("request-1", entry.RequestID, "request IDs should match")
+	}
+
+	var before, after entities.ToDoItemEntity
+	assert.Nilf(json.Unmarshal(entries[1].Before, &before), "before snapshot should be recorded")
+	assert.Nilf(json.Unmarshal(entries[1].After, &after), "after snapshot should be recorded")
+	assert.Equalf("audited", before.Description, "before snapshot should hold the previous state")
+	assert.Equalf("changed", after.Description, "after snapshot should hold the new state")
+	assert.Emptyf(entries[0].After, "deletions should not have an after snapshot")
+}
+
+func TestAuditFailedMutation(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testsupport.CreateTestDatabase(t)
+	audit := persistence.NewAuditManager(db)
+	alice := persistence.New(db).WithContext(principalContext("alice"))
+	bob := persistence.New(db).WithContext(principalContext("bob"))
+
+	item := &entities.ToDoItemEntity{Description: "audited"}
+	err := alice.Create(item)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	err = bob.Delete(item.ID)
+	assert.NotNilf(err, "error should not be nil")
+
+	_, total, err := audit.FindAll(func(filter *persistence.AuditFilter) {
+		filter.Actor = "bob"
+	})
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf(int64(0), total, "failed operations should not be audited")
+
+	_, total, err = audit.WithContext(context.Background()).FindAll(nil)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf(int64(1), total, "total length should be 1")
+}
+
+func collectActions(entries []entities.AuditEntryEntity) []string {
+	var actions []string
+	for _, entry := range entries {
+		actions = append(actions, entry.Action)
+	}
+
+	return actions
+}
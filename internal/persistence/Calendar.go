@@ -0,0 +1,206 @@
+package persistence
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"todo-api-go/entities"
+)
+
+// Extension of the names of calendar objects
+const calendarObjectExtension = ".ics"
+
+// CalendarObject is a ToDoItemEntity exposed as a resource of a calendar, such as the VTODO
+// resources served over CalDAV.
+type CalendarObject struct {
+	// Name of the resource within the calendar
+	Name string
+
+	// UID of the calendar component chosen by the client that created the item, if any
+	UID string
+
+	Item entities.ToDoItemEntity
+}
+
+// CalendarObjectName returns the name of the calendar object of an item that was not created
+// as a calendar object.
+func CalendarObjectName(id uint) string {
+	return strconv.FormatUint(uint64(id), 10) + calendarObjectExtension
+}
+
+// parseCalendarObjectName returns the ID of the item whose default calendar object name is name.
+func parseCalendarObjectName(name string) (uint, bool) {
+	digits, found := strings.CutSuffix(name, calendarObjectExtension)
+	if !found {
+		return 0, false
+	}
+
+	id, err := strconv.ParseUint(digits, 10, 0)
+	if err != nil || CalendarObjectName(uint(id)) != name {
+		return 0, false
+	}
+
+	return uint(id), true
+}
+
+// FindCalendarObject retrieves a calendar object by its name.
+//
+// Items created as calendar objects are found by the name chosen by their client, and any other
+// item by the name derived from its ID. The item must be visible to the principal of the
+// manager's context.
+//
+// It takes the name of the calendar object.
+// It returns the calendar object and an error if it does not exist or is not visible.
+func (mgr *ToDoEntityManager) FindCalendarObject(name string) (object *CalendarObject, err error) {
+	mgr, span := mgr.startSpan(SpanFindCalendarObject, AttributeObjectName.String(name))
+	defer func() { endSpan(span, err) }()
+
+	var mapping entities.ToDoCalendarObjectEntity
+	err = mgr.orm.Where("name = ?", name).First(&mapping).Error
+	switch {
+	case errors.Is(err, ErrNotFound):
+		id, ok := parseCalendarObjectName(name)
+		if !ok {
+			return nil, ErrNotFound
+		}
+
+		// Items created with a chosen name are not available under their default name
+		var count int64
+		err = mgr.orm.Model(&entities.ToDoCalendarObjectEntity{}).Where("item_id = ?", id).Count(&count).Error
+		if err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			return nil, ErrNotFound
+		}
+
+		mapping = entities.ToDoCalendarObjectEntity{ItemID: id, Name: name}
+
+	case err != nil:
+		return nil, err
+	}
+
+	item, err := mgr.FineOne(int(mapping.ItemID))
+	if err != nil {
+		return nil, err
+	}
+
+	span.SetAttributes(AttributeItemID.Int(int(item.ID)))
+	return &CalendarObject{Name: mapping.Name, UID: mapping.UID, Item: *item}, nil
+}
+
+// CalendarObjects exposes items as calendar objects, in the order of the items.
+//
+// It takes the items, which the caller is expected to have retrieved through the manager.
+// It returns the calendar objects and an error if the names of the objects could not be looked up.
+func (mgr *ToDoEntityManager) CalendarObjects(items []entities.ToDoItemEntity) ([]CalendarObject, error) {
+	ids := make([]uint, 0, len(items))
+	for i := range items {
+		ids = append(ids, items[i].ID)
+	}
+
+	mappings, err := mgr.calendarMappings(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	objects := make([]CalendarObject, 0, len(items))
+	for i := range items {
+		object := CalendarObject{Name: CalendarObjectName(items[i].ID), Item: items[i]}
+		if mapping, ok := mappings[items[i].ID]; ok {
+			object.Name, object.UID = mapping.Name, mapping.UID
+		}
+		objects = append(objects, object)
+	}
+
+	return objects, nil
+}
+
+// CalendarObjectNames returns the names of the calendar objects of items, in the order of the
+// IDs. Items need not exist anymore, so that the names of deleted items can be reported.
+func (mgr *ToDoEntityManager) CalendarObjectNames(ids []uint) ([]string, error) {
+	mappings, err := mgr.calendarMappings(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(ids))
+	for _, id := range ids {
+		name := CalendarObjectName(id)
+		if mapping, ok := mappings[id]; ok {
+			name = mapping.Name
+		}
+		names = append(names, name)
+	}
+
+	return names, nil
+}
+
+// calendarMappings looks up the names and UIDs chosen for items, keyed by the ID of the item.
+func (mgr *ToDoEntityManager) calendarMappings(ids []uint) (map[uint]entities.ToDoCalendarObjectEntity, error) {
+	mappings := map[uint]entities.ToDoCalendarObjectEntity{}
+
+	for start := 0; start < len(ids); start += duplicateLookupSize {
+		end := min(start+duplicateLookupSize, len(ids))
+
+		var found []entities.ToDoCalendarObjectEntity
+		err := mgr.orm.Where("item_id IN ?", ids[start:end]).Find(&found).Error
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range found {
+			mappings[found[i].ItemID] = found[i]
+		}
+	}
+
+	return mappings, nil
+}
+
+// CreateCalendarObject creates a ToDoItemEntity as a calendar object with a name and UID chosen
+// by the client, like Create does.
+//
+// The names derived from item IDs are reserved for items not created as calendar objects. The
+// name of a deleted calendar object may be reused.
+//
+// It takes a pointer to the calendar object, whose item is refreshed with the stored state on success.
+// It returns ErrInvalid if the name is reserved or taken, and an error if the creation failed.
+func (mgr *ToDoEntityManager) CreateCalendarObject(object *CalendarObject) (err error) {
+	mgr, span := mgr.startSpan(SpanCreateCalendarObject, AttributeObjectName.String(object.Name))
+	defer func() { endSpan(span, err) }()
+
+	if _, reserved := parseCalendarObjectName(object.Name); reserved || object.Name == "" {
+		return ErrInvalid
+	}
+
+	// Names of deleted items are released, while names of existing items stay taken even if
+	// the items are not visible to the principal
+	items := mgr.orm.Model(&entities.ToDoItemEntity{}).Select("id")
+
+	var taken int64
+	err = mgr.orm.Model(&entities.ToDoCalendarObjectEntity{}).Where("name = ? AND item_id IN (?)", object.Name, items).Count(&taken).Error
+	if err != nil {
+		return err
+	}
+	if taken > 0 {
+		return ErrInvalid
+	}
+
+	err = mgr.create(&object.Item, func(tx *gorm.DB) error {
+		err := tx.Where("name = ?", object.Name).Delete(&entities.ToDoCalendarObjectEntity{}).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Create(&entities.ToDoCalendarObjectEntity{ItemID: object.Item.ID, Name: object.Name, UID: object.UID}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	span.SetAttributes(AttributeItemID.Int(int(object.Item.ID)))
+	return nil
+}
@@ -0,0 +1,67 @@
+package persistence_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"todo-api-go/entities"
+	"todo-api-go/persistence"
+	"todo-api-go/testsupport"
+)
+
+func TestFindCalendarObject(t *testing.T) {
+	assert := assert.New(t)
+
+	mgr := testsupport.CreateTestManager(t)
+
+	object, err := mgr.FindCalendarObject("4.ics")
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf(uint(4), object.Item.ID, "the default name should identify the item")
+	assert.Equalf("", object.UID, "the UID should default")
+
+	for _, name := range []string{"11.ics", "04.ics", "4", "other.ics"} {
+		_, err = mgr.FindCalendarObject(name)
+		assert.ErrorIsf(err, persistence.ErrNotFound, "%s should not be found", name)
+	}
+}
+
+func TestCreateCalendarObject(t *testing.T) {
+	assert := assert.New(t)
+
+	mgr := testsupport.CreateTestManager(t)
+
+	object := persistence.CalendarObject{Name: "abc.ics", UID: "abc@example.com", Item: entities.ToDoItemEntity{Description: "Chosen"}}
+	err := mgr.CreateCalendarObject(&object)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf(uint(11), object.Item.ID, "the item should be created")
+
+	found, err := mgr.FindCalendarObject("abc.ics")
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf("abc@example.com", found.UID, "the UID should be stored")
+	assert.Equalf("Chosen", found.Item.Description, "the item should be found by its name")
+
+	_, err = mgr.FindCalendarObject("11.ics")
+	assert.ErrorIsf(err, persistence.ErrNotFound, "the default name should not identify the item")
+
+	items, _, err := mgr.FindAll()
+	assert.Nilf(err, "error should be nil, not %s", err)
+	objects, err := mgr.CalendarObjects(items)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf("1.ics", objects[0].Name, "items should have default names")
+	assert.Equalf("abc.ics", objects[10].Name, "items should have their chosen names")
+
+	err = mgr.CreateCalendarObject(&persistence.CalendarObject{Name: "abc.ics", Item: entities.ToDoItemEntity{Description: "Again"}})
+	assert.ErrorIsf(err, persistence.ErrInvalid, "names should be unique")
+	err = mgr.CreateCalendarObject(&persistence.CalendarObject{Name: "12.ics", Item: entities.ToDoItemEntity{Description: "Reserved"}})
+	assert.ErrorIsf(err, persistence.ErrInvalid, "default names should be reserved")
+
+	err = mgr.Delete(11)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	names, err := mgr.CalendarObjectNames([]uint{11, 3})
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf([]string{"abc.ics", "3.ics"}, names, "names of deleted items should be kept")
+
+	err = mgr.CreateCalendarObject(&persistence.CalendarObject{Name: "abc.ics", Item: entities.ToDoItemEntity{Description: "Again"}})
+	assert.Nilf(err, "names of deleted items should be reusable, not %s", err)
+}
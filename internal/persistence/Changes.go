@@ -0,0 +1,228 @@
+package persistence
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"todo-api-go/entities"
+	"todo-api-go/reqctx"
+)
+
+// ID of the row of the revision sequence counter
+const sequenceID = 1
+
+// ItemChanges describes the changes of the items visible to a principal since a sync token.
+type ItemChanges struct {
+	// Items created or changed since the token, in their current state
+	Changed []entities.ToDoItemEntity
+
+	// Items deleted since the token
+	Deleted []ItemTombstone
+
+	// Token identifying the state the changes lead up to, to find subsequent changes with
+	Token uint
+}
+
+// ItemTombstone records the deletion of an item.
+type ItemTombstone struct {
+	ID        uint
+	DeletedAt time.Time
+}
+
+// ConflictError is returned by UpdateSince when the fields changed by an update were changed
+// differently since the state the update is based on. It wraps ErrConflict.
+type ConflictError struct {
+	// Names of the conflicting fields
+	Fields []string
+
+	// Current state of the item
+	Current entities.ToDoItemEntity
+
+	// Token identifying the current state, to base a resolved update on
+	Token uint
+}
+
+func (conflict *ConflictError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrConflict, strings.Join(conflict.Fields, ", "))
+}
+
+func (conflict *ConflictError) Unwrap() error {
+	return ErrConflict
+}
+
+// SyncToken returns a token identifying the current state of the items, to find subsequent
+// changes with FindChanges.
+//
+// Tokens follow the sequence number of the latest committed revision, so that every change of
+// any item yields a new token. As revisions are sequenced in the order they are committed, changes
+// committed after a token was issued always follow the token. They are never 0, which stands for
+// the absence of a token.
+func (mgr *ToDoEntityManager) SyncToken() (token uint, err error) {
+	err = mgr.orm.Model(&entities.ToDoSequenceEntity{}).Select("COALESCE(MAX(value), 0) + 1").Scan(&token).Error
+	return token, err
+}
+
+// FindChanges retrieves the changes of the items since a sync token.
+//
+// Changed items are restricted to the items visible to the principal of the manager's context.
+// Deleted items are reported if they were visible to the principal when they were deleted, as
+// their owner or a grantee of one of their shares; items that stop being visible without being
+// deleted are not reported. With the token 0, all visible items are reported as changed and no
+// deletions are reported.
+//
+// It takes the token of a previous call, or 0.
+// It returns the changes and an error if the token is not a token issued before, or the query failed.
+func (mgr *ToDoEntityManager) FindChanges(since uint) (changes *ItemChanges, err error) {
+	mgr, span := mgr.startSpan(SpanFindChanges, AttributeSyncToken.Int(int(since)))
+	defer func() { endSpan(span, err) }()
+
+	token, err := mgr.SyncToken()
+	if err != nil {
+		return nil, err
+	}
+
+	if since > token {
+		return nil, ErrInvalid
+	}
+
+	changes = &ItemChanges{Changed: []entities.ToDoItemEntity{}, Deleted: []ItemTombstone{}, Token: token}
+
+	// Items predating the revision history have no revisions, so the initial changes cover
+	// all visible items
+	query := mgr.orm.Scopes(mgr.visibleItems)
+	if since > 0 {
+		revised := mgr.orm.Model(&entities.ToDoRevisionEntity{}).
+			Select("item_id").
+			Where("sequence >= ? AND sequence < ?", since, token)
+		query = query.Where("id IN (?)", revised)
+	}
+
+	err = query.Order("id asc").Find(&changes.Changed).Error
+	if err != nil {
+		return nil, err
+	}
+
+	if since > 0 {
+		var deletions []entities.ToDoRevisionEntity
+		err = mgr.orm.Where("action = ? AND sequence >= ? AND sequence < ?", entities.RevisionDelete, since, token).
+			Order("item_id asc").
+			Find(&deletions).Error
+		if err != nil {
+			return nil, err
+		}
+
+		principal := reqctx.PrincipalFrom(mgr.ctx)
+		for i := range deletions {
+			audience := newAudience(&deletions[i].Snapshot, deletions[i].SharedWith)
+			if audience.Includes(principal) {
+				changes.Deleted = append(changes.Deleted, ItemTombstone{ID: deletions[i].ItemID, DeletedAt: deletions[i].CreatedAt})
+			}
+		}
+	}
+
+	span.SetAttributes(
+		AttributeChanged.Int(len(changes.Changed)),
+		AttributeDeleted.Int(len(changes.Deleted)))
+	return changes, nil
+}
+
+// UpdateSince updates an item with the state a client derived from the state identified by a
+// sync token, such as an offline client replaying its edits.
+//
+// Changes made to the item since the token are merged field by field: fields left unchanged by
+// the client keep their current state, and fields changed by the client are updated unless they
+// were changed differently since the token, in which case nothing is updated and a ConflictError
+// listing the conflicting fields is returned. Without a revision preceding the token, such as
+// for items predating the revision history, all fields differing from the current state conflict
+// once the item has been changed since the token.
+//
+// It takes a pointer to a ToDoItemEntity, refreshed with the stored state on success, and the
+// token of the state the update is based on.
+// It returns ErrInvalid if the token was not issued before, a ConflictError, or any error of Update.
+func (mgr *ToDoEntityManager) UpdateSince(item *entities.ToDoItemEntity, since uint) (err error) {
+	mgr, span := mgr.startSpan(SpanUpdateSince, AttributeItemID.Int(int(item.ID)), AttributeSyncToken.Int(int(since)))
+	defer func() { endSpan(span, err) }()
+
+	token, err := mgr.SyncToken()
+	if err != nil {
+		return err
+	}
+
+	if since == 0 || since > token {
+		return fmt.Errorf("%w: unknown sync token %d", ErrInvalid, since)
+	}
+
+	existing, err := mgr.findEditable(item.ID)
+	if err != nil {
+		return err
+	}
+
+	var changes int64
+	err = mgr.orm.Model(&entities.ToDoRevisionEntity{}).Where("item_id = ? AND sequence >= ?", item.ID, since).Count(&changes).Error
+	if err != nil {
+		return err
+	}
+
+	if changes > 0 {
+		var base *entities.ToDoItemEntity
+
+		var revision entities.ToDoRevisionEntity
+		err = mgr.orm.Where("item_id = ? AND sequence < ?", item.ID, since).Order("sequence desc").First(&revision).Error
+		switch {
+		case err == nil:
+			base = &revision.Snapshot
+		case !errors.Is(err, ErrNotFound):
+			return err
+		}
+
+		conflicts := mergeChanges(item, existing, base)
+		span.SetAttributes(AttributeConflicts.Int(len(conflicts)))
+		if len(conflicts) > 0 {
+			return &ConflictError{Fields: conflicts, Current: *existing, Token: token}
+		}
+	}
+
+	return mgr.Update(item)
+}
+
+// mergeChanges merges the current state of an item into the state derived by a client from a
+// base state, returning the names of the fields changed differently by both. Without a base
+// state, all fields differing from the current state are considered changed by both.
+func mergeChanges(item *entities.ToDoItemEntity, current *entities.ToDoItemEntity, base *entities.ToDoItemEntity) []string {
+	known := base != nil
+	if !known {
+		base = &entities.ToDoItemEntity{}
+	}
+
+	conflicts := []string{}
+	if !mergeField(&item.Description, current.Description, base.Description, known, func(a string, b string) bool { return a == b }) {
+		conflicts = append(conflicts, "Description")
+	}
+	if !mergeField(&item.Completed, current.Completed, base.Completed, known, func(a bool, b bool) bool { return a == b }) {
+		conflicts = append(conflicts, "Completed")
+	}
+	if !mergeField(&item.DueDate, current.DueDate, base.DueDate, known, time.Time.Equal) {
+		conflicts = append(conflicts, "DueDate")
+	}
+
+	return conflicts
+}
+
+// mergeField merges the current value of a field into the value derived by a client from a base
+// value, taking the current value if the client left the field unchanged. It returns false if
+// both changed the field differently, or the base value is not known and the values differ.
+func mergeField[T any](value *T, current T, base T, known bool, equal func(a T, b T) bool) bool {
+	switch {
+	case equal(*value, current):
+		return true
+	case !known:
+		return false
+	case equal(*value, base):
+		*value = current
+		return true
+	}
+
+	return equal(current, base)
+}
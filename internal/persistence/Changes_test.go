@@ -0,0 +1,211 @@
+package persistence_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+
+	"todo-api-go/entities"
+	"todo-api-go/persistence"
+	"todo-api-go/testsupport"
+)
+
+func TestFindChanges(t *testing.T) {
+	assert := assert.New(t)
+
+	mgr := testsupport.CreateTestManager(t)
+
+	changes, err := mgr.FindChanges(0)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Lenf(changes.Changed, 10, "the initial changes should cover all items")
+	assert.Emptyf(changes.Deleted, "the initial changes should not report deletions")
+	initial := changes.Token
+
+	err = mgr.Update(&entities.ToDoItemEntity{ID: 2, Description: "Changed"})
+	assert.Nilf(err, "error should be nil, not %s", err)
+	err = mgr.Delete(3)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	changes, err = mgr.FindChanges(initial)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf([]uint{2}, testsupport.CollectIds(changes.Changed), "changed items should be reported")
+	if assert.Lenf(changes.Deleted, 1, "deleted items should be reported") {
+		assert.Equalf(uint(3), changes.Deleted[0].ID, "deleted items should be reported")
+		assert.Falsef(changes.Deleted[0].DeletedAt.IsZero(), "the time of the deletion should be reported")
+	}
+	assert.Greaterf(changes.Token, initial, "the token should advance")
+
+	changes, err = mgr.FindChanges(changes.Token)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Emptyf(changes.Changed, "there should be no further changes")
+	assert.Emptyf(changes.Deleted, "there should be no further deletions")
+
+	_, err = mgr.FindChanges(changes.Token + 1)
+	assert.ErrorIsf(err, persistence.ErrInvalid, "unknown tokens should be rejected")
+}
+
+func TestFindChangesVisibility(t *testing.T) {
+	assert := assert.New(t)
+
+	mgr := testsupport.CreateTestManager(t)
+	alice := mgr.WithContext(principalContext("alice"))
+	bob := mgr.WithContext(adminContext("bob"))
+
+	err := mgr.Update(&entities.ToDoItemEntity{ID: 5, Description: "Earlier"})
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	token, err := bob.SyncToken()
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	item := entities.ToDoItemEntity{Description: "Private"}
+	err = alice.Create(&item)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	err = alice.Delete(item.ID)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	err = mgr.Update(&entities.ToDoItemEntity{ID: 1, Description: "Public"})
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	changes, err := bob.FindChanges(token)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf([]uint{1}, testsupport.CollectIds(changes.Changed), "only visible items should be reported")
+	assert.Emptyf(changes.Deleted, "deletions of items of others should not be reported")
+
+	// Deletions of shared items are reported to the grantees, although the shares are gone
+	token = changes.Token
+	shared := entities.ToDoItemEntity{Description: "Shared"}
+	err = alice.Create(&shared)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	err = alice.Share(&entities.ToDoShareEntity{ItemID: shared.ID, GranteeType: entities.GranteeGroup, GranteeID: "team", Permission: entities.PermissionViewer})
+	assert.Nilf(err, "error should be nil, not %s", err)
+	err = alice.Delete(shared.ID)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	changes, err = mgr.WithContext(principalContext("carol", "team")).FindChanges(token)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	if assert.Lenf(changes.Deleted, 1, "deletions of shared items should be reported to the grantees") {
+		assert.Equalf(shared.ID, changes.Deleted[0].ID, "the shared item should be reported")
+	}
+
+	changes, err = bob.FindChanges(token)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Emptyf(changes.Deleted, "deletions of items of others should not be reported")
+}
+
+func TestMigrateSequence(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testsupport.CreateTestDatabase(t)
+	mgr := persistence.New(db)
+
+	for _, description := range []string{"First", "Second"} {
+		err := mgr.Update(&entities.ToDoItemEntity{ID: 1, Description: description})
+		assert.Nilf(err, "error should be nil, not %s", err)
+	}
+
+	// Revisions recorded before revisions were sequenced
+	err := db.Session(&gorm.Session{AllowGlobalUpdate: true}).Model(&entities.ToDoRevisionEntity{}).Update("sequence", 0).Error
+	assert.Nilf(err, "error should be nil, not %s", err)
+	err = db.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&entities.ToDoSequenceEntity{}).Error
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	for i := 0; i < 2; i++ {
+		err = persistence.Migrate(db)
+		assert.Nilf(err, "error should be nil, not %s", err)
+
+		token, err := mgr.SyncToken()
+		assert.Nilf(err, "error should be nil, not %s", err)
+		assert.Equalf(uint(3), token, "the sequence should continue from the existing revisions")
+	}
+
+	var revisions []entities.ToDoRevisionEntity
+	err = db.Order("id asc").Find(&revisions).Error
+	assert.Nilf(err, "error should be nil, not %s", err)
+	for _, revision := range revisions {
+		assert.Equalf(revision.ID, revision.Sequence, "existing revisions should be sequenced by their IDs")
+	}
+
+	err = mgr.Update(&entities.ToDoItemEntity{ID: 1, Description: "Third"})
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	changes, err := mgr.FindChanges(3)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf([]uint{1}, testsupport.CollectIds(changes.Changed), "new revisions should follow the existing revisions")
+	assert.Equalf(uint(4), changes.Token, "the token should advance")
+}
+
+func TestUpdateSince(t *testing.T) {
+	assert := assert.New(t)
+
+	mgr := testsupport.CreateTestManager(t)
+
+	item := &entities.ToDoItemEntity{Description: "Original", DueDate: testsupport.ParseTestDate("2025-01-01")}
+	err := mgr.Create(item)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	token, err := mgr.SyncToken()
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	// The server changes the due date while the client completes the item
+	err = mgr.Update(&entities.ToDoItemEntity{ID: item.ID, Description: "Original", DueDate: testsupport.ParseTestDate("2025-02-01")})
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	edit := *item
+	edit.Completed = true
+	err = mgr.UpdateSince(&edit, token)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Truef(edit.Completed, "the change of the client should be applied")
+	assert.Equalf(testsupport.ParseTestDate("2025-02-01"), edit.DueDate.UTC(), "the change of the server should be kept")
+
+	// The server and the client change the description differently
+	err = mgr.Update(&entities.ToDoItemEntity{ID: item.ID, Description: "Server", Completed: true, DueDate: edit.DueDate})
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	stale := *item
+	stale.Description = "Client"
+	err = mgr.UpdateSince(&stale, token)
+	assert.ErrorIsf(err, persistence.ErrConflict, "overlapping changes should conflict")
+
+	var conflict *persistence.ConflictError
+	if assert.ErrorAsf(err, &conflict, "the conflict should be described") {
+		assert.Equalf([]string{"Description"}, conflict.Fields, "conflicting fields should be reported")
+		assert.Equalf("Server", conflict.Current.Description, "the current state should be reported")
+		assert.Greaterf(conflict.Token, token, "a new token should be reported")
+
+		// Resolving the conflict on top of the reported state succeeds
+		resolved := conflict.Current
+		resolved.Description = "Client"
+		err = mgr.UpdateSince(&resolved, conflict.Token)
+		assert.Nilf(err, "error should be nil, not %s", err)
+		assert.Equalf("Client", resolved.Description, "the resolution should be applied")
+	}
+
+	err = mgr.UpdateSince(&stale, 0)
+	assert.ErrorIsf(err, persistence.ErrInvalid, "updates should be based on a token")
+}
+
+func TestUpdateSinceWithoutHistory(t *testing.T) {
+	assert := assert.New(t)
+
+	mgr := testsupport.CreateTestManager(t)
+
+	token, err := mgr.SyncToken()
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	// Fixture items predate the revision history, so their state at the token is unknown
+	item, err := mgr.FineOne(1)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	edit := *item
+	edit.Completed = true
+	err = mgr.UpdateSince(&edit, token)
+	assert.Nilf(err, "items unchanged since the token should be updated, not %s", err)
+
+	edit = *item
+	edit.Description = "Client"
+	err = mgr.UpdateSince(&edit, token)
+	var conflict *persistence.ConflictError
+	if assert.ErrorAsf(err, &conflict, "changes of items with unknown base state should conflict") {
+		assert.Equalf([]string{"Description", "Completed"}, conflict.Fields, "fields differing from the current state should conflict")
+	}
+}
@@ -0,0 +1,76 @@
+package persistence
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ItemFilter restricts the items returned by a query. The zero value matches all items.
+type ItemFilter struct {
+	// Whether matching items are completed, if set
+	Completed *bool
+
+	// Matching items are due before this point in time, if set
+	DueBefore time.Time
+
+	// Matching items are due at or after this point in time, if set
+	DueAfter time.Time
+
+	// Matching items contain this text in their description, ignoring case, if set
+	Search string
+}
+
+// IsZero reports whether the filter matches all items.
+func (filter ItemFilter) IsZero() bool {
+	return filter.Completed == nil && filter.DueBefore.IsZero() && filter.DueAfter.IsZero() && filter.Search == ""
+}
+
+// String describes the filter in the form of query parameters, for example in span attributes.
+func (filter ItemFilter) String() string {
+	var conditions []string
+
+	if filter.Completed != nil {
+		conditions = append(conditions, "completed="+strconv.FormatBool(*filter.Completed))
+	}
+	if !filter.DueBefore.IsZero() {
+		conditions = append(conditions, "due_before="+filter.DueBefore.Format(time.RFC3339))
+	}
+	if !filter.DueAfter.IsZero() {
+		conditions = append(conditions, "due_after="+filter.DueAfter.Format(time.RFC3339))
+	}
+	if filter.Search != "" {
+		conditions = append(conditions, "q="+filter.Search)
+	}
+
+	return strings.Join(conditions, "&")
+}
+
+// scope is a scope restricting a ToDoItemEntity query to the items matching the filter.
+func (filter ItemFilter) scope(db *gorm.DB) *gorm.DB {
+	if filter.Completed != nil {
+		db = db.Where("completed = ?", *filter.Completed)
+	}
+
+	// Items without due date are stored with the zero time, which must not count as due
+	if !filter.DueBefore.IsZero() {
+		db = db.Where("due_date > ? AND due_date < ?", time.Time{}, filter.DueBefore)
+	}
+	if !filter.DueAfter.IsZero() {
+		db = db.Where("due_date >= ?", filter.DueAfter)
+	}
+
+	if filter.Search != "" {
+		db = db.Where("LOWER(description) LIKE ? ESCAPE '!'", "%"+escapeLike(strings.ToLower(filter.Search))+"%")
+	}
+
+	return db
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern using "!", which unlike a backslash
+// needs no escaping in the string literals of any supported database.
+func escapeLike(value string) string {
+	return strings.NewReplacer(`!`, `!!`, `%`, `!%`, `_`, `!_`).Replace(value)
+}
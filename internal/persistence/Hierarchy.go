@@ -0,0 +1,302 @@
+package persistence
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"todo-api-go/entities"
+)
+
+// DeleteRule determines what happens to the subtasks of a deleted item.
+type DeleteRule string
+
+const (
+	// Subtasks become top-level items
+	DeleteOrphan DeleteRule = "orphan"
+
+	// Subtasks are deleted along with the item, at any depth
+	DeleteCascade DeleteRule = "cascade"
+
+	// Items with subtasks are not deleted
+	DeleteBlock DeleteRule = "block"
+)
+
+// ParseDeleteRule parses the name of a DeleteRule, defaulting to DeleteBlock if it is empty.
+//
+// It returns ErrInvalid if the name is unknown.
+func ParseDeleteRule(value string) (DeleteRule, error) {
+	switch rule := DeleteRule(value); rule {
+	case "":
+		return DeleteBlock, nil
+	case DeleteOrphan, DeleteCascade, DeleteBlock:
+		return rule, nil
+	}
+
+	return "", fmt.Errorf("%w: unknown delete rule %q, expected one of %s, %s, %s", ErrInvalid, value, DeleteOrphan, DeleteCascade, DeleteBlock)
+}
+
+// ItemProgress summarizes the completion of the subtasks of an item.
+type ItemProgress struct {
+	// Number of direct subtasks of the item
+	Total int64
+
+	// Number of completed direct subtasks
+	Completed int64
+
+	// Share of completed subtasks in percent, rounded down; zero for items without subtasks
+	Percent int
+}
+
+// itemChange is a change of an item made within a transaction, whose observers are notified
+// once the transaction has been committed.
+type itemChange struct {
+	action   string
+	before   *entities.ToDoItemEntity
+	after    *entities.ToDoItemEntity
+	audience *ItemAudience
+}
+
+// FindChildren retrieves the direct subtasks of a ToDoItemEntity based on the provided paging configuration.
+//
+// The item and its subtasks are only returned if they are visible to the principal of the manager's context.
+// It takes the ID of the item and optional PagingConfigurator arguments.
+// It returns a slice of ToDoItemEntity objects, the total number of visible subtasks and an error if any occurred.
+func (mgr *ToDoEntityManager) FindChildren(id uint, configurators ...PagingConfigurator) (items []entities.ToDoItemEntity, count int64, err error) {
+	mgr, span := mgr.startSpan(SpanFindChildren, append(pageAttributes(configurators), AttributeItemID.Int(int(id)))...)
+	defer func() { endSpan(span, err) }()
+
+	_, err = mgr.FineOne(int(id))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	children := func(db *gorm.DB) *gorm.DB {
+		return db.Scopes(mgr.visibleItems).Where("parent_id = ?", id)
+	}
+
+	err = mgr.orm.Model(&entities.ToDoItemEntity{}).Scopes(children).Count(&count).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	err = mgr.orm.Scopes(children, Paginate(configurators...)).Order("id asc").Find(&items).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	span.SetAttributes(AttributeResultCount.Int(len(items)), AttributeTotalCount.Int64(count))
+	return items, count, nil
+}
+
+// Progress computes the progress of a ToDoItemEntity from the completion of its direct subtasks.
+//
+// The item must be visible to the principal of the manager's context. Its subtasks are counted
+// whether they are visible or not, so that every principal sees the same progress.
+// It takes the ID of the item as a parameter.
+// It returns the ItemProgress and an error if any occurred.
+func (mgr *ToDoEntityManager) Progress(id uint) (_ *ItemProgress, err error) {
+	mgr, span := mgr.startSpan(SpanProgress, AttributeItemID.Int(int(id)))
+	defer func() { endSpan(span, err) }()
+
+	_, err = mgr.FineOne(int(id))
+	if err != nil {
+		return nil, err
+	}
+
+	var progress ItemProgress
+	err = mgr.orm.Model(&entities.ToDoItemEntity{}).Where("parent_id = ?", id).Count(&progress.Total).Error
+	if err != nil {
+		return nil, err
+	}
+
+	err = mgr.orm.Model(&entities.ToDoItemEntity{}).Where("parent_id = ? AND completed = ?", id, true).Count(&progress.Completed).Error
+	if err != nil {
+		return nil, err
+	}
+
+	if progress.Total > 0 {
+		progress.Percent = int(progress.Completed * 100 / progress.Total)
+	}
+
+	return &progress, nil
+}
+
+// Move makes a ToDoItemEntity a subtask of another item, or a top-level item if the parent ID is zero.
+//
+// The principal of the manager's context must be allowed to update both the item and its new
+// parent. The move is recorded in the revision history and the audit log.
+//
+// It takes the ID of the item and the ID of its new parent.
+// It returns the moved item, ErrInvalid if the parent does not exist or is the item itself or
+// one of its subtasks, or an error if the caller lacks permission or the update fails.
+func (mgr *ToDoEntityManager) Move(id uint, parentID uint) (_ *entities.ToDoItemEntity, err error) {
+	mgr, span := mgr.startSpan(SpanMove, AttributeItemID.Int(int(id)), AttributeParentID.Int(int(parentID)))
+	defer func() { endSpan(span, err) }()
+
+	existing, err := mgr.findEditable(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if existing.ParentID == parentID {
+		return existing, nil
+	}
+
+	// The parent is checked within the transaction, which locks the ancestors it is checked
+	// against, so that concurrent moves can not create a cycle
+	return mgr.save(id, []string{"parent_id"}, entities.RevisionUpdate, entities.AuditItemUpdate, func(tx *gorm.DB, updated *entities.ToDoItemEntity) error {
+		updated.ParentID = parentID
+		return mgr.inTransaction(tx).checkParent(id, parentID)
+	})
+}
+
+// inTransaction returns a new ToDoEntityManager running its queries within a transaction.
+func (mgr *ToDoEntityManager) inTransaction(tx *gorm.DB) *ToDoEntityManager {
+	copied := *mgr
+	copied.orm = tx
+	return &copied
+}
+
+// checkParent checks that an item may become a subtask of a parent: the principal of the
+// manager's context must be allowed to update the parent, and the parent must be neither
+// the item itself nor one of its subtasks. Items without ID are new items without subtasks,
+// and items without parent are top-level items.
+//
+// Within a transaction, the item and the ancestors of the parent are locked until the
+// transaction ends, so that concurrent moves see each other's changes rather than creating a
+// cycle, such as two items moved beneath each other. One of two moves locking the same items in
+// opposite order is aborted by the database.
+func (mgr *ToDoEntityManager) checkParent(id uint, parentID uint) error {
+	if parentID == 0 {
+		return nil
+	}
+
+	if parentID == id {
+		return fmt.Errorf("%w: item %d can not be a subtask of itself", ErrInvalid, id)
+	}
+
+	_, err := mgr.findEditable(parentID)
+	if errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("%w: parent item %d does not exist", ErrInvalid, parentID)
+	}
+	if err != nil || id == 0 {
+		return err
+	}
+
+	err = mgr.orm.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").Limit(1).Find(&entities.ToDoItemEntity{}, id).Error
+	if err != nil {
+		return err
+	}
+
+	visited := map[uint]bool{}
+	for ancestor := parentID; ancestor != 0 && !visited[ancestor]; {
+		if ancestor == id {
+			return fmt.Errorf("%w: item %d can not be a subtask of its own subtask %d", ErrInvalid, id, parentID)
+		}
+		visited[ancestor] = true
+
+		var item entities.ToDoItemEntity
+		err = mgr.orm.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "parent_id").Limit(1).Find(&item, ancestor).Error
+		if err != nil {
+			return err
+		}
+		ancestor = item.ParentID
+	}
+
+	return nil
+}
+
+// detachSubtasks applies a DeleteRule to the subtasks of an item that is being deleted within
+// a transaction, before the item itself is deleted.
+//
+// Orphaning requires ownership of every direct subtask, and cascading deletions require
+// ownership of every subtask, at any depth, which is checked before any subtask is changed.
+// It returns the changes of the subtasks, ErrForbidden if a subtask may not be changed, and
+// ErrConflict if the rule blocks the deletion.
+func (mgr *ToDoEntityManager) detachSubtasks(tx *gorm.DB, item *entities.ToDoItemEntity, rule DeleteRule) ([]itemChange, error) {
+	var children []entities.ToDoItemEntity
+	err := tx.Where("parent_id = ?", item.ID).Order("id asc").Find(&children).Error
+	if err != nil || len(children) == 0 {
+		return nil, err
+	}
+
+	var changes []itemChange
+	switch rule {
+	case DeleteOrphan:
+		for i := range children {
+			if !mgr.inTransaction(tx).canManage(&children[i]) {
+				return nil, ErrForbidden
+			}
+		}
+
+		for i := range children {
+			before := children[i]
+			after := children[i]
+			after.ParentID = 0
+
+			err = tx.Save(&after).Error
+			if err != nil {
+				return nil, err
+			}
+
+			err = recordRevision(mgr.ctx, tx, entities.RevisionUpdate, &after)
+			if err != nil {
+				return nil, err
+			}
+
+			err = recordAudit(mgr.ctx, tx, entities.AuditItemUpdate, after.ID, &before, &after)
+			if err != nil {
+				return nil, err
+			}
+
+			changes = append(changes, itemChange{action: entities.RevisionUpdate, before: &before, after: &after})
+		}
+
+	case DeleteCascade:
+		// Subtasks are collected level by level, and deleted deepest first
+		descendants := children
+		seen := map[uint]bool{item.ID: true}
+		for level := children; len(level) > 0; {
+			var ids []uint
+			for i := range level {
+				if !seen[level[i].ID] {
+					seen[level[i].ID] = true
+					ids = append(ids, level[i].ID)
+				}
+			}
+
+			level = nil
+			if len(ids) > 0 {
+				err = tx.Where("parent_id IN ? AND id NOT IN ?", ids, ids).Order("id asc").Find(&level).Error
+				if err != nil {
+					return nil, err
+				}
+			}
+			descendants = append(descendants, level...)
+		}
+
+		for i := range descendants {
+			if !mgr.inTransaction(tx).canManage(&descendants[i]) {
+				return nil, ErrForbidden
+			}
+		}
+
+		for i := len(descendants) - 1; i >= 0; i-- {
+			descendant := &descendants[i]
+			audience, err := mgr.remove(tx, descendant)
+			if err != nil {
+				return nil, err
+			}
+
+			changes = append(changes, itemChange{action: entities.RevisionDelete, before: descendant, audience: audience})
+		}
+
+	default:
+		return nil, fmt.Errorf("%w: item %d has %d subtasks", ErrConflict, item.ID, len(children))
+	}
+
+	return changes, nil
+}
@@ -0,0 +1,215 @@
+package persistence_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+
+	"todo-api-go/entities"
+	"todo-api-go/persistence"
+	"todo-api-go/testsupport"
+)
+
+func TestSubtasks(t *testing.T) {
+	assert := assert.New(t)
+
+	mgr := testsupport.CreateTestManager(t)
+	alice := mgr.WithContext(principalContext("alice"))
+	bob := mgr.WithContext(principalContext("bob"))
+
+	trip := createItem(t, alice, "Plan the trip", 0)
+	flights := createItem(t, alice, "Book the flights", trip.ID)
+	seat := createItem(t, alice, "Pick a seat", flights.ID)
+	createItem(t, alice, "Book the hotel", trip.ID)
+
+	err := bob.Create(&entities.ToDoItemEntity{Description: "Sneak in", ParentID: trip.ID})
+	assert.ErrorIsf(err, persistence.ErrInvalid, "subtasks of invisible items should be rejected")
+
+	children, total, err := alice.FindChildren(trip.ID)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf(int64(2), total, "direct subtasks should be counted")
+	assert.Lenf(children, 2, "direct subtasks should be listed")
+
+	_, _, err = bob.FindChildren(trip.ID)
+	assert.ErrorIsf(err, persistence.ErrNotFound, "subtasks of invisible items should not be listed")
+
+	flights.Completed = true
+	err = alice.Update(flights)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf(trip.ID, flights.ParentID, "updates should keep the parent")
+
+	progress, err := alice.Progress(trip.ID)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf(persistence.ItemProgress{Total: 2, Completed: 1, Percent: 50}, *progress, "progress should be computed from the subtasks")
+
+	progress, err = alice.Progress(seat.ID)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf(persistence.ItemProgress{}, *progress, "items without subtasks should have no progress")
+}
+
+func TestMove(t *testing.T) {
+	assert := assert.New(t)
+
+	mgr := testsupport.CreateTestManager(t)
+	alice := mgr.WithContext(principalContext("alice"))
+	bob := mgr.WithContext(principalContext("bob"))
+
+	root := createItem(t, alice, "Root", 0)
+	child := createItem(t, alice, "Child", root.ID)
+	grandchild := createItem(t, alice, "Grandchild", child.ID)
+	other := createItem(t, bob, "Other", 0)
+
+	_, err := alice.Move(root.ID, grandchild.ID)
+	assert.ErrorIsf(err, persistence.ErrInvalid, "items should not become subtasks of their subtasks")
+
+	_, err = alice.Move(root.ID, root.ID)
+	assert.ErrorIsf(err, persistence.ErrInvalid, "items should not become subtasks of themselves")
+
+	_, err = alice.Move(root.ID, 4711)
+	assert.ErrorIsf(err, persistence.ErrInvalid, "missing parents should be rejected")
+
+	_, err = alice.Move(root.ID, other.ID)
+	assert.ErrorIsf(err, persistence.ErrInvalid, "invisible parents should be rejected")
+
+	moved, err := alice.Move(grandchild.ID, root.ID)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf(root.ID, moved.ParentID, "the item should be moved")
+
+	moved, err = alice.Move(child.ID, 0)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Zerof(moved.ParentID, "the item should become a top-level item")
+
+	_, err = alice.Move(root.ID, child.ID)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	history, _, err := alice.FindHistory(root.ID)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Lenf(history, 2, "the move should be recorded in the history")
+}
+
+func TestConcurrentMoves(t *testing.T) {
+	assert := assert.New(t)
+
+	mgr := testsupport.CreateTestManager(t)
+	alice := mgr.WithContext(principalContext("alice"))
+
+	for i := 0; i < 10; i++ {
+		first := createItem(t, alice, "First", 0)
+		second := createItem(t, alice, "Second", 0)
+
+		// Moving the items beneath each other at the same time must not create a cycle
+		var wait sync.WaitGroup
+		errs := make([]error, 2)
+		for j, move := range [][2]uint{{first.ID, second.ID}, {second.ID, first.ID}} {
+			wait.Add(1)
+			go func(j int, move [2]uint) {
+				defer wait.Done()
+				_, errs[j] = alice.Move(move[0], move[1])
+			}(j, move)
+		}
+		wait.Wait()
+		assert.Falsef(errs[0] == nil && errs[1] == nil, "only one of the moves should succeed")
+
+		first, err := alice.FineOne(int(first.ID))
+		assert.Nilf(err, "error should be nil, not %s", err)
+		second, err = alice.FineOne(int(second.ID))
+		assert.Nilf(err, "error should be nil, not %s", err)
+		assert.Falsef(first.ParentID == second.ID && second.ParentID == first.ID, "the items should not be subtasks of each other")
+	}
+}
+
+func TestUpdateAfterConcurrentMove(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testsupport.CreateTestDatabase(t)
+	alice := persistence.New(db).WithContext(principalContext("alice"))
+
+	parent := createItem(t, alice, "Parent", 0)
+	item := createItem(t, alice, "Item", 0)
+
+	// Move the item right after the update has read it, before the update is stored
+	moved := false
+	err := db.Callback().Query().After("gorm:query").Register("test:move", func(tx *gorm.DB) {
+		if !moved && tx.Statement.Table == "to_do_item_entities" {
+			moved = true
+			_, err := alice.Move(item.ID, parent.ID)
+			assert.Nilf(err, "error should be nil, not %s", err)
+		}
+	})
+	assert.Nilf(err, "error should be nil, not %s", err)
+	defer db.Callback().Query().Remove("test:move")
+
+	err = alice.Update(&entities.ToDoItemEntity{ID: item.ID, Description: "Updated", Completed: true})
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Truef(moved, "the item should have been moved during the update")
+
+	updated, err := alice.FineOne(int(item.ID))
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf("Updated", updated.Description, "the update should be stored")
+	assert.Truef(updated.Completed, "the update should be stored")
+	assert.Equalf(parent.ID, updated.ParentID, "the update should keep the concurrent move")
+}
+
+func TestDeleteWithSubtasks(t *testing.T) {
+	assert := assert.New(t)
+
+	mgr := testsupport.CreateTestManager(t)
+	alice := mgr.WithContext(principalContext("alice"))
+	bob := mgr.WithContext(principalContext("bob"))
+
+	root := createItem(t, alice, "Root", 0)
+	child := createItem(t, alice, "Child", root.ID)
+	grandchild := createItem(t, alice, "Grandchild", child.ID)
+
+	err := alice.Delete(root.ID)
+	assert.ErrorIsf(err, persistence.ErrConflict, "items with subtasks should not be deleted by default")
+
+	// Subtasks of other owners block cascading deletions
+	err = alice.Share(&entities.ToDoShareEntity{ItemID: grandchild.ID, GranteeType: entities.GranteeUser, GranteeID: "bob", Permission: entities.PermissionEditor})
+	assert.Nilf(err, "error should be nil, not %s", err)
+	bobs := createItem(t, bob, "Bob's subtask", grandchild.ID)
+
+	err = alice.DeleteWith(root.ID, persistence.DeleteCascade)
+	assert.ErrorIsf(err, persistence.ErrForbidden, "subtasks of other owners should not be deleted")
+
+	err = alice.DeleteWith(child.ID, persistence.DeleteOrphan)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	orphan, err := alice.FineOne(int(grandchild.ID))
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Zerof(orphan.ParentID, "subtasks should become top-level items")
+
+	err = alice.DeleteWith(grandchild.ID, persistence.DeleteOrphan)
+	assert.ErrorIsf(err, persistence.ErrForbidden, "subtasks of other owners should not be orphaned")
+
+	subtask, err := bob.FineOne(int(bobs.ID))
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf(grandchild.ID, subtask.ParentID, "subtasks of other owners should be kept")
+
+	err = bob.Delete(bobs.ID)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	_, err = alice.Move(grandchild.ID, root.ID)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	err = alice.DeleteWith(root.ID, persistence.DeleteCascade)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	_, err = alice.FineOne(int(grandchild.ID))
+	assert.ErrorIsf(err, persistence.ErrNotFound, "subtasks should be deleted along with the item")
+
+	_, err = persistence.ParseDeleteRule("shred")
+	assert.ErrorIsf(err, persistence.ErrInvalid, "unknown rules should be rejected")
+}
+
+func createItem(t *testing.T, mgr *persistence.ToDoEntityManager, description string, parentID uint) *entities.ToDoItemEntity {
+	item := &entities.ToDoItemEntity{Description: description, ParentID: parentID}
+	err := mgr.Create(item)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return item
+}
@@ -0,0 +1,254 @@
+package persistence
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"todo-api-go/entities"
+	"todo-api-go/reqctx"
+)
+
+// Fields of a ToDoItemEntity that are not reported as changes between revisions
+var unrevisionedFields = map[string]bool{
+	"UpdatedAt": true,
+}
+
+type FieldChange struct {
+	Field string
+	From  any
+	To    any
+}
+
+type ItemRevision struct {
+	entities.ToDoRevisionEntity
+
+	// Changes relative to the preceding revision
+	Changes []FieldChange
+}
+
+// FindHistory retrieves the revisions of a ToDoItemEntity in chronological order.
+//
+// The item must be visible to the principal of the manager's context. Each revision is
+// accompanied by the field changes relative to the preceding revision.
+//
+// It takes the ID of the item and optional PagingConfigurator arguments.
+// It returns a slice of ItemRevision objects, the total number of revisions and an error if any occurred.
+func (mgr *ToDoEntityManager) FindHistory(itemID uint, configurators ...PagingConfigurator) (_ []ItemRevision, _ int64, err error) {
+	mgr, span := mgr.startSpan(SpanFindHistory, append(pageAttributes(configurators), AttributeItemID.Int(int(itemID)))...)
+	defer func() { endSpan(span, err) }()
+
+	_, err = mgr.FineOne(int(itemID))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var count int64
+	err = mgr.orm.Model(&entities.ToDoRevisionEntity{}).Where("item_id = ?", itemID).Count(&count).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var revisions []entities.ToDoRevisionEntity
+	err = mgr.orm.Where("item_id = ?", itemID).Scopes(Paginate(configurators...)).Order("revision asc").Find(&revisions).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if len(revisions) == 0 {
+		return []ItemRevision{}, count, nil
+	}
+
+	// The predecessor of the first revision on the page is needed to compute its changes
+	var previous *entities.ToDoItemEntity
+	if revisions[0].Revision > 1 {
+		var predecessor entities.ToDoRevisionEntity
+		err = mgr.orm.Where("item_id = ? AND revision = ?", itemID, revisions[0].Revision-1).First(&predecessor).Error
+		if err != nil {
+			return nil, 0, err
+		}
+		previous = &predecessor.Snapshot
+	}
+
+	history := make([]ItemRevision, 0, len(revisions))
+	for i := range revisions {
+		history = append(history, ItemRevision{
+			ToDoRevisionEntity: revisions[i],
+			Changes:            diffItems(previous, &revisions[i].Snapshot),
+		})
+		previous = &revisions[i].Snapshot
+	}
+
+	span.SetAttributes(AttributeResultCount.Int(len(history)), AttributeTotalCount.Int64(count))
+	return history, count, nil
+}
+
+// FindAsOf returns a ToDoItemEntity as it was at the specified point in time.
+//
+// The item must currently be visible to the principal of the manager's context.
+// It takes the ID of the item and the point in time as parameters.
+// It returns ErrNotFound if the item did not exist at that time.
+func (mgr *ToDoEntityManager) FindAsOf(id int, at time.Time) (_ *entities.ToDoItemEntity, err error) {
+	mgr, span := mgr.startSpan(SpanFindAsOf, AttributeItemID.Int(id))
+	defer func() { endSpan(span, err) }()
+
+	_, err = mgr.FineOne(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var revision entities.ToDoRevisionEntity
+	err = mgr.orm.Where("item_id = ? AND created_at <= ?", id, at).Order("revision desc").First(&revision).Error
+	if err != nil {
+		return nil, err
+	}
+
+	if revision.Action == entities.RevisionDelete {
+		return nil, ErrNotFound
+	}
+
+	return &revision.Snapshot, nil
+}
+
+// Revert restores the modifiable fields of a ToDoItemEntity to the state of an earlier revision.
+//
+// The owner of the item and principals holding an editor share may revert it. The revert
+// is recorded as a new revision, so it can be reverted itself.
+//
+// It takes the ID of the item and the revision to restore as parameters.
+// It returns the restored item and an error if any occurred.
+func (mgr *ToDoEntityManager) Revert(itemID uint, revision uint) (_ *entities.ToDoItemEntity, err error) {
+	mgr, span := mgr.startSpan(SpanRevert, AttributeItemID.Int(int(itemID)), AttributeRevision.Int(int(revision)))
+	defer func() { endSpan(span, err) }()
+
+	_, err = mgr.findEditable(itemID)
+	if err != nil {
+		return nil, err
+	}
+
+	var target entities.ToDoRevisionEntity
+	err = mgr.orm.Where("item_id = ? AND revision = ?", itemID, revision).First(&target).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return mgr.save(itemID, updateColumns, entities.RevisionRevert, entities.AuditItemRevert, func(tx *gorm.DB, updated *entities.ToDoItemEntity) error {
+		updated.Description = target.Snapshot.Description
+		updated.Completed = target.Snapshot.Completed
+		updated.DueDate = target.Snapshot.DueDate
+		updated.CompletedAt = target.Snapshot.CompletedAt
+		return nil
+	})
+}
+
+// recordRevision appends the state of a ToDoItemEntity to its revision history.
+//
+// It is meant to be called within the transaction of the change, so that the revision
+// is only recorded if the change succeeds.
+//
+// Parameters:
+// - ctx: The context of the change.
+// - tx: The transaction of the change.
+// - action: The kind of change.
+// - item: The state of the item after the change.
+func recordRevision(ctx context.Context, tx *gorm.DB, action string, item *entities.ToDoItemEntity) error {
+	return createRevision(ctx, tx, entities.ToDoRevisionEntity{Action: action, Snapshot: *item})
+}
+
+// recordDeletion appends the deletion of a ToDoItemEntity to its revision history, along with
+// the shares of the item, so that the deletion can be reported to its grantees once the shares
+// have been removed. Like recordRevision, it is meant to be called within the transaction of the deletion.
+func recordDeletion(ctx context.Context, tx *gorm.DB, item *entities.ToDoItemEntity, shares []entities.ToDoShareEntity) error {
+	return createRevision(ctx, tx, entities.ToDoRevisionEntity{Action: entities.RevisionDelete, Snapshot: *item, SharedWith: shares})
+}
+
+// createRevision numbers a revision as the latest revision of its item, attributes it to the
+// principal of the context and stores it.
+//
+// The revision is also numbered by the revision sequence, whose counter stays locked until the
+// transaction ends, so that revisions are sequenced in the order their transactions are committed.
+func createRevision(ctx context.Context, tx *gorm.DB, revision entities.ToDoRevisionEntity) error {
+	sequence, err := nextSequence(tx)
+	if err != nil {
+		return err
+	}
+
+	var latest uint
+	err = tx.Model(&entities.ToDoRevisionEntity{}).
+		Where("item_id = ?", revision.Snapshot.ID).
+		Select("COALESCE(MAX(revision), 0)").
+		Scan(&latest).Error
+	if err != nil {
+		return err
+	}
+
+	revision.ItemID = revision.Snapshot.ID
+	revision.Revision = latest + 1
+	revision.Sequence = sequence
+	revision.Actor = SystemActor
+	if principal := reqctx.PrincipalFrom(ctx); principal != nil {
+		revision.Actor = principal.Subject
+	}
+
+	return tx.Create(&revision).Error
+}
+
+// nextSequence increments the counter of the revision sequence, locking it until the end of the
+// transaction, and returns the incremented value.
+func nextSequence(tx *gorm.DB) (uint, error) {
+	err := tx.Model(&entities.ToDoSequenceEntity{}).
+		Where("id = ?", sequenceID).
+		Update("value", gorm.Expr("value + 1")).Error
+	if err != nil {
+		return 0, err
+	}
+
+	var sequence entities.ToDoSequenceEntity
+	err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&sequence, sequenceID).Error
+	return sequence.Value, err
+}
+
+// diffItems lists the fields that differ between two states of a ToDoItemEntity.
+//
+// A nil previous state is treated as the zero value, so that every populated field
+// of the initial revision is reported.
+func diffItems(previous *entities.ToDoItemEntity, current *entities.ToDoItemEntity) []FieldChange {
+	if previous == nil {
+		previous = &entities.ToDoItemEntity{}
+	}
+
+	before := reflect.ValueOf(*previous)
+	after := reflect.ValueOf(*current)
+	fields := before.Type()
+
+	changes := []FieldChange{}
+	for i := 0; i < fields.NumField(); i++ {
+		name := fields.Field(i).Name
+		if unrevisionedFields[name] {
+			continue
+		}
+
+		from := before.Field(i).Interface()
+		to := after.Field(i).Interface()
+		if fieldEqual(from, to) {
+			continue
+		}
+
+		changes = append(changes, FieldChange{Field: name, From: from, To: to})
+	}
+
+	return changes
+}
+
+// fieldEqual compares two field values, treating time values representing the same instant as equal.
+func fieldEqual(a any, b any) bool {
+	if at, ok := a.(time.Time); ok {
+		bt, ok := b.(time.Time)
+		return ok && at.Equal(bt)
+	}
+
+	return reflect.DeepEqual(a, b)
+}
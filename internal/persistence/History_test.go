@@ -0,0 +1,97 @@
+package persistence_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"todo-api-go/entities"
+	"todo-api-go/persistence"
+	"todo-api-go/testsupport"
+)
+
+func TestHistory(t *testing.T) {
+	assert := assert.New(t)
+
+	mgr := testsupport.CreateTestManager(t).WithContext(principalContext("alice"))
+
+	item := &entities.ToDoItemEntity{Description: "first"}
+	err := mgr.Create(item)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	item.Description = "second"
+	err = mgr.Update(item)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	item.Completed = true
+	err = mgr.Update(item)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	history, total, err := mgr.FindHistory(item.ID)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf(int64(3), total, "total length should be 3")
+	assert.Equalf(uint(1), history[0].Revision, "revisions should be numbered from 1")
+	assert.Equalf(entities.RevisionCreate, history[0].Action, "first revision should be the creation")
+	assert.Equalf("alice", history[1].Actor, "actor should be the principal")
+	assert.Equalf([]persistence.FieldChange{{Field: "Description", From: "first", To: "second"}}, history[1].Changes, "changes should match")
+	assert.Equalf([]string{"Completed", "CompletedAt"}, collectFields(history[2].Changes), "changed fields should match")
+
+	page, _, err := mgr.FindHistory(item.ID, func(options *persistence.PagingOptions) {
+		options.Offset = 1
+		options.Limit = 1
+	})
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf(history[1].Changes, page[0].Changes, "changes should be computed across pages")
+
+	reverted, err := mgr.Revert(item.ID, 1)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf("first", reverted.Description, "description should be restored")
+	assert.Falsef(reverted.Completed, "completion should be restored")
+
+	history, total, err = mgr.FindHistory(item.ID)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf(int64(4), total, "reverts should be recorded as revisions")
+	assert.Equalf(entities.RevisionRevert, history[3].Action, "last revision should be the revert")
+}
+
+func TestFindAsOf(t *testing.T) {
+	assert := assert.New(t)
+
+	mgr := testsupport.CreateTestManager(t)
+
+	beforeCreation := time.Now()
+	time.Sleep(10 * time.Millisecond)
+
+	item := &entities.ToDoItemEntity{Description: "first"}
+	err := mgr.Create(item)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	time.Sleep(10 * time.Millisecond)
+	afterCreation := time.Now()
+	time.Sleep(10 * time.Millisecond)
+
+	item.Description = "second"
+	err = mgr.Update(item)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	found, err := mgr.FindAsOf(int(item.ID), afterCreation)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf("first", found.Description, "earlier state should be returned")
+
+	found, err = mgr.FindAsOf(int(item.ID), time.Now())
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf("second", found.Description, "current state should be returned")
+
+	_, err = mgr.FindAsOf(int(item.ID), beforeCreation)
+	assert.ErrorIsf(err, persistence.ErrNotFound, "item should not exist before its creation")
+}
+
+func collectFields(changes []persistence.FieldChange) []string {
+	var fields []string
+	for _, change := range changes {
+		fields = append(fields, change.Field)
+	}
+
+	return fields
+}
@@ -0,0 +1,108 @@
+package persistence
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/uptrace/opentelemetry-go-extra/otelgorm"
+	"github.com/uptrace/opentelemetry-go-extra/otelsql"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"gorm.io/gorm"
+
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+)
+
+// Name of the meter recording the metrics of the database queries
+const meterName = "todo-api-go/persistence"
+
+// Key of the start time of a query in the instance settings of its statement
+const queryStartedKey = "todo:query_started"
+
+// callbackRegistration registers a gorm callback at the position it has been obtained for.
+type callbackRegistration interface {
+	Register(name string, fn func(*gorm.DB)) error
+}
+
+// Instrument registers the OpenTelemetry instrumentation of a database connection: otelgorm
+// records a span per query, the statistics of the connection pool are reported as go.sql.*
+// metrics, and the db.client.operation.duration histogram records the duration of the queries.
+//
+// The statistics are reported for the *sql.DB returned by db.DB(), as otelgorm only reports
+// them if the connection pool is a *sql.DB, which is not the case with prepared statements.
+// Instruments are created with the global meter provider, so the OpenTelemetry SDK has to be
+// set up before.
+//
+// It takes the connection and the name of the database.
+// It returns an error if the instrumentation cannot be registered.
+func Instrument(db *gorm.DB, dbName string) error {
+	err := db.Use(otelgorm.NewPlugin(otelgorm.WithDBName(dbName), otelgorm.WithoutMetrics()))
+	if err != nil {
+		return err
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	otelsql.ReportDBStatsMetrics(sqlDB, otelsql.WithAttributes(semconv.DBName(dbName)))
+
+	duration, err := otel.Meter(meterName).Float64Histogram("db.client.operation.duration",
+		metric.WithUnit("s"),
+		metric.WithDescription("Duration of database client operations."),
+		metric.WithExplicitBucketBoundaries(0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 10))
+	if err != nil {
+		return err
+	}
+
+	callbacks := db.Callback()
+	operations := []struct {
+		name   string
+		before callbackRegistration
+		after  callbackRegistration
+	}{
+		{"create", callbacks.Create().Before("gorm:create"), callbacks.Create().After("gorm:create")},
+		{"query", callbacks.Query().Before("gorm:query"), callbacks.Query().After("gorm:query")},
+		{"update", callbacks.Update().Before("gorm:update"), callbacks.Update().After("gorm:update")},
+		{"delete", callbacks.Delete().Before("gorm:delete"), callbacks.Delete().After("gorm:delete")},
+		{"row", callbacks.Row().Before("gorm:row"), callbacks.Row().After("gorm:row")},
+		{"raw", callbacks.Raw().Before("gorm:raw"), callbacks.Raw().After("gorm:raw")},
+	}
+
+	for _, operation := range operations {
+		err = errors.Join(
+			operation.before.Register("metrics:before_"+operation.name, startQuery),
+			operation.after.Register("metrics:after_"+operation.name, recordQuery(duration, operation.name, dbName)))
+		if err != nil {
+			return fmt.Errorf("registering the metrics of %s operations failed: %w", operation.name, err)
+		}
+	}
+
+	return nil
+}
+
+// startQuery is a gorm callback recording the start time of a query.
+func startQuery(tx *gorm.DB) {
+	tx.InstanceSet(queryStartedKey, time.Now())
+}
+
+// recordQuery returns a gorm callback recording the duration of a query started by startQuery.
+// Queries without results are not considered failed.
+func recordQuery(duration metric.Float64Histogram, operation string, dbName string) func(tx *gorm.DB) {
+	return func(tx *gorm.DB) {
+		value, ok := tx.InstanceGet(queryStartedKey)
+		started, isTime := value.(time.Time)
+		if !ok || !isTime || tx.DryRun {
+			return
+		}
+
+		attributes := []attribute.KeyValue{semconv.DBOperation(operation), semconv.DBName(dbName)}
+		if tx.Error != nil && !errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+			attributes = append(attributes, semconv.ErrorTypeKey.String(fmt.Sprintf("%T", tx.Error)))
+		}
+
+		duration.Record(tx.Statement.Context, time.Since(started).Seconds(), metric.WithAttributes(attributes...))
+	}
+}
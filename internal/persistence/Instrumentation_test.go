@@ -0,0 +1,34 @@
+package persistence_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"gorm.io/gorm"
+
+	"todo-api-go/persistence"
+	"todo-api-go/testsupport"
+)
+
+func TestInstrument(t *testing.T) {
+	assert := assert.New(t)
+
+	telemetry := testsupport.InstallTestTelemetry(t)
+
+	// Prepared statements hide the *sql.DB from otelgorm
+	db := testsupport.CreateTestDatabase(t).Session(&gorm.Session{PrepareStmt: true})
+	err := persistence.Instrument(db, "todo-api-go")
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	_, _, err = persistence.New(db).FindAll()
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	_, ok := telemetry.MetricValue("db.client.operation.duration",
+		attribute.String("db.operation", "query"),
+		attribute.String("db.name", "todo-api-go"))
+	assert.Truef(ok, "query durations should be recorded")
+
+	_, ok = telemetry.MetricValue("go.sql.connections_open", attribute.String("db.name", "todo-api-go"))
+	assert.Truef(ok, "connection pool statistics should be reported")
+}
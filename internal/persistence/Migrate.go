@@ -0,0 +1,79 @@
+package persistence
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"todo-api-go/entities"
+)
+
+// Migrate creates or updates the database schema for all entities managed by this package.
+//
+// It takes a pointer to a gorm.DB object as a parameter.
+// It returns an error if the migration fails.
+func Migrate(db *gorm.DB) error {
+	err := db.AutoMigrate(
+		&entities.ToDoItemEntity{},
+		&entities.ToDoShareEntity{},
+		&entities.ApiKeyEntity{},
+		&entities.AuditEntryEntity{},
+		&entities.ToDoRevisionEntity{},
+		&entities.ToDoSeriesEntity{},
+		&entities.ToDoCalendarObjectEntity{},
+		&entities.WebhookSubscriptionEntity{},
+		&entities.WebhookDeliveryEntity{},
+		&entities.WebhookAttemptEntity{},
+		&entities.ReminderEntity{},
+		&entities.InboxMessageEntity{},
+		&entities.ToDoSequenceEntity{},
+	)
+	if err != nil {
+		return err
+	}
+
+	return migrateSequence(db)
+}
+
+// migrateSequence creates the counter of the revision sequence, continuing from the revisions
+// recorded before revisions were sequenced, which are sequenced by their IDs.
+func migrateSequence(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&entities.ToDoRevisionEntity{}).Where("sequence = 0").Update("sequence", gorm.Expr("id")).Error
+		if err != nil {
+			return err
+		}
+
+		var latest uint
+		err = tx.Model(&entities.ToDoRevisionEntity{}).Select("COALESCE(MAX(sequence), 0)").Scan(&latest).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&entities.ToDoSequenceEntity{ID: sequenceID, Value: latest}).Error
+	})
+}
+
+// AssignUnownedItems makes a principal the owner of the items without owner, along with their
+// series.
+//
+// Items created before items were owned have no owner, and items without owner are only visible
+// to admins and internal callers. Assigning them to a principal, who may share them with others,
+// keeps them available to regular users after upgrading.
+//
+// It takes the database and the subject of the new owner.
+// It returns the number of assigned items and an error if the assignment fails.
+func AssignUnownedItems(db *gorm.DB, ownerID string) (int64, error) {
+	var assigned int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&entities.ToDoItemEntity{}).Where("owner_id = '' OR owner_id IS NULL").Update("owner_id", ownerID)
+		if result.Error != nil {
+			return result.Error
+		}
+		assigned = result.RowsAffected
+
+		return tx.Model(&entities.ToDoSeriesEntity{}).Where("owner_id = '' OR owner_id IS NULL").Update("owner_id", ownerID).Error
+	})
+
+	return assigned, err
+}
@@ -0,0 +1,85 @@
+package persistence
+
+import (
+	"context"
+	"time"
+
+	"todo-api-go/entities"
+	"todo-api-go/reqctx"
+)
+
+// Component of the loggers used by this package
+const logComponent = "persistence"
+
+// ItemObserver is notified of changes to ToDoItemEntity objects once they have been committed.
+//
+// The action is one of the revision actions, such as entities.RevisionCreate. The state before
+// the change is nil for created items, and the state after the change is nil for deleted items.
+// Observers are called synchronously, so they should return quickly.
+type ItemObserver interface {
+	ItemChanged(ctx context.Context, action string, before *entities.ToDoItemEntity, after *entities.ToDoItemEntity)
+}
+
+// AddObserver registers an observer that is notified of every committed change made through
+// the manager and the managers derived from it with WithContext afterwards.
+//
+// Observers are meant to be registered during startup, before the manager is used.
+func (mgr *ToDoEntityManager) AddObserver(observer ItemObserver) {
+	mgr.observers = append(mgr.observers, observer)
+}
+
+// CountOpen counts the items that have not been completed, and those among them that are
+// past their due date, across all owners.
+//
+// It takes the point in time determining whether an item is overdue as a parameter.
+// It returns the number of open items, the number of overdue items and an error if any occurred.
+func (mgr *ToDoEntityManager) CountOpen(now time.Time) (_ int64, _ int64, err error) {
+	mgr, span := mgr.startSpan(SpanCountOpen)
+	defer func() { endSpan(span, err) }()
+
+	var open int64
+	err = mgr.orm.Model(&entities.ToDoItemEntity{}).Where("completed = ?", false).Count(&open).Error
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var overdue int64
+	err = mgr.orm.Model(&entities.ToDoItemEntity{}).
+		Where("completed = ? AND due_date > ? AND due_date < ?", false, time.Time{}, now).
+		Count(&overdue).Error
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return open, overdue, nil
+}
+
+// notify logs a committed change and passes it on to the registered observers.
+//
+// The audience of the item is looked up for the audience observers unless it is given, as it
+// must be for deleted items.
+func (mgr *ToDoEntityManager) notify(action string, before *entities.ToDoItemEntity, after *entities.ToDoItemEntity, audience *ItemAudience) {
+	item := after
+	if item == nil {
+		item = before
+	}
+	logger := reqctx.LoggerFrom(mgr.ctx, logComponent)
+	logger.DebugContext(mgr.ctx, "item changed", "action", action, "item_id", item.ID)
+
+	for _, observer := range mgr.observers {
+		observer.ItemChanged(mgr.ctx, action, before, after)
+	}
+
+	if audience == nil {
+		var err error
+		audience, err = mgr.audienceOf(mgr.orm, item)
+		if err != nil {
+			logger.ErrorContext(mgr.ctx, "audience of changed item could not be looked up", "item_id", item.ID, "error", err)
+			return
+		}
+	}
+
+	for _, observer := range mgr.audienceObservers {
+		observer.ItemChangedFor(mgr.ctx, *audience, action, before, after)
+	}
+}
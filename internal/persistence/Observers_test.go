@@ -0,0 +1,74 @@
+package persistence_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"todo-api-go/entities"
+	"todo-api-go/testsupport"
+)
+
+type recordingObserver struct {
+	actions []string
+	before  []*entities.ToDoItemEntity
+	after   []*entities.ToDoItemEntity
+}
+
+func (observer *recordingObserver) ItemChanged(ctx context.Context, action string, before *entities.ToDoItemEntity, after *entities.ToDoItemEntity) {
+	observer.actions = append(observer.actions, action)
+	observer.before = append(observer.before, before)
+	observer.after = append(observer.after, after)
+}
+
+func TestObservers(t *testing.T) {
+	assert := assert.New(t)
+
+	mgr := testsupport.CreateTestManager(t)
+	observer := &recordingObserver{}
+	mgr.AddObserver(observer)
+
+	ctx := principalContext("alice")
+	item := &entities.ToDoItemEntity{Description: "Observed"}
+	err := mgr.WithContext(ctx).Create(item)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	item.Completed = true
+	err = mgr.WithContext(ctx).Update(item)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	err = mgr.WithContext(principalContext("bob")).Delete(item.ID)
+	assert.NotNilf(err, "deletion by another principal should fail")
+
+	err = mgr.WithContext(ctx).Delete(item.ID)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	assert.Equalf([]string{entities.RevisionCreate, entities.RevisionUpdate, entities.RevisionDelete}, observer.actions,
+		"only committed changes should be observed")
+	assert.Nilf(observer.before[0], "created item should have no previous state")
+	assert.Falsef(observer.before[1].Completed, "previous state should not be completed")
+	assert.Truef(observer.after[1].Completed, "updated state should be completed")
+	assert.Nilf(observer.after[2], "deleted item should have no subsequent state")
+}
+
+func TestCountOpen(t *testing.T) {
+	assert := assert.New(t)
+
+	mgr := testsupport.CreateTestManager(t)
+
+	open, overdue, err := mgr.CountOpen(testsupport.ParseTestDate("2024-12-01"))
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf(int64(10), open, "all test items should be open")
+	assert.Equalf(int64(0), overdue, "no test item should be overdue")
+
+	err = mgr.Create(&entities.ToDoItemEntity{Description: "No due date"})
+	assert.Nilf(err, "error should be nil, not %s", err)
+	err = mgr.Create(&entities.ToDoItemEntity{Description: "Done", Completed: true})
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	open, overdue, err = mgr.CountOpen(testsupport.ParseTestDate("2025-06-01"))
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf(int64(11), open, "completed items should not be counted")
+	assert.Equalf(int64(10), overdue, "items without due date should not be overdue")
+}
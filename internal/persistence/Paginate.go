@@ -27,25 +27,33 @@ type PagingConfigurator func(options *PagingOptions)
 // The function returns the modified *gorm.DB object with the applied pagination options.
 func Paginate(configurators ...PagingConfigurator) func(db *gorm.DB) *gorm.DB {
 	return func(db *gorm.DB) *gorm.DB {
-		config := &PagingOptions{
-			Offset: 0,
-			Limit:  50,
-		}
+		config := pagingOptions(configurators...)
 
-		// Apply the configurators
-		for _, configurator := range configurators {
-			configurator(config)
-		}
+		return db.Offset(config.Offset).Limit(config.Limit)
+	}
+}
+
+// pagingOptions applies the PagingConfigurator functions to the default pagination options
+// and forces sane limits on the result.
+func pagingOptions(configurators ...PagingConfigurator) PagingOptions {
+	config := PagingOptions{
+		Offset: 0,
+		Limit:  50,
+	}
 
-		// Force sane limits
-		switch {
-		case config.Limit > 50:
-			config.Limit = 50
+	// Apply the configurators
+	for _, configurator := range configurators {
+		configurator(&config)
+	}
 
-		case config.Offset < 0:
-			config.Offset = 0
-		}
+	// Force sane limits
+	switch {
+	case config.Limit > 50:
+		config.Limit = 50
 
-		return db.Offset(config.Offset).Limit(config.Limit)
+	case config.Offset < 0:
+		config.Offset = 0
 	}
+
+	return config
 }
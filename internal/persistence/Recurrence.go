@@ -0,0 +1,210 @@
+package persistence
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"todo-api-go/entities"
+	"todo-api-go/recurrence"
+)
+
+// UpdateFuture updates an occurrence of a recurring ToDoItemEntity together with all future
+// occurrences of its series, as opposed to Update, which updates the occurrence only.
+//
+// The description, due date, recurrence rule and time zone of the item apply to the series from
+// this occurrence on: the series is continued from the due date of the occurrence, and the
+// occurrences it creates later on take the description of the item. If the recurrence rule is
+// unchanged, a COUNT part keeps counting the earlier occurrences; a changed rule applies from
+// this occurrence on. An empty recurrence rule ends the series with this occurrence.
+// The completion state of the occurrence is left unchanged.
+// The passed item is refreshed with the stored state on success.
+//
+// It takes a pointer to a ToDoItemEntity as a parameter.
+// It returns ErrInvalid if the item does not recur or the recurrence is invalid, or any error of Update.
+func (mgr *ToDoEntityManager) UpdateFuture(item *entities.ToDoItemEntity) (err error) {
+	mgr, span := mgr.startSpan(SpanUpdateFuture, AttributeItemID.Int(int(item.ID)))
+	defer func() { endSpan(span, err) }()
+
+	existing, err := mgr.findEditable(item.ID)
+	if err != nil {
+		return err
+	}
+
+	if existing.SeriesID == 0 {
+		return fmt.Errorf("%w: item %d does not recur", ErrInvalid, item.ID)
+	}
+
+	// The series is read and locked along with the item, so that the rule and start of the series
+	// are updated from their current state
+	updated, err := mgr.save(item.ID, futureColumns, entities.RevisionUpdate, entities.AuditItemUpdate, func(tx *gorm.DB, updated *entities.ToDoItemEntity) error {
+		var series entities.ToDoSeriesEntity
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&series, updated.SeriesID).Error
+		if err != nil {
+			return err
+		}
+
+		scheduled := updated.ScheduledDue
+		updated.Description = item.Description
+		updated.DueDate = item.DueDate
+		updated.ScheduledDue = item.DueDate.UTC()
+		updated.Recurrence = ""
+
+		if item.Recurrence != "" {
+			rule, _, err := parseRecurrence(item.Recurrence, item.TimeZone, item.DueDate)
+			if err != nil {
+				return err
+			}
+
+			if rule.Count > 0 && rule.String() == series.Recurrence {
+				previous, previousLocation, err := parseRecurrence(series.Recurrence, series.TimeZone, series.Start)
+				if err != nil {
+					return err
+				}
+
+				rule.Count = max(rule.Count-previous.CountBefore(series.Start.In(previousLocation), scheduled), 1)
+			}
+
+			updated.Recurrence = rule.String()
+			updated.TimeZone = item.TimeZone
+		}
+
+		series.Description = updated.Description
+		series.Recurrence = updated.Recurrence
+		series.TimeZone = updated.TimeZone
+		series.Start = updated.ScheduledDue
+		return tx.Model(&series).Select("description", "recurrence", "time_zone", "start").Updates(&series).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	*item = *updated
+	return nil
+}
+
+// Columns of a ToDoItemEntity written by UpdateFuture
+var futureColumns = []string{"description", "due_date", "scheduled_due", "recurrence", "time_zone"}
+
+// startSeries starts a series for a new ToDoItemEntity with a recurrence rule, as its first
+// occurrence. The recurrence fields of items without a recurrence rule are cleared.
+func startSeries(tx *gorm.DB, item *entities.ToDoItemEntity) error {
+	item.SeriesID = 0
+	item.ScheduledDue = time.Time{}
+
+	if item.Recurrence == "" {
+		item.TimeZone = ""
+		return nil
+	}
+
+	rule, _, err := parseRecurrence(item.Recurrence, item.TimeZone, item.DueDate)
+	if err != nil {
+		return err
+	}
+
+	// Due dates are stored in UTC, so that they are compared correctly regardless of the
+	// offsets they were specified with
+	series := entities.ToDoSeriesEntity{
+		OwnerID:     item.OwnerID,
+		Description: item.Description,
+		Recurrence:  rule.String(),
+		TimeZone:    item.TimeZone,
+		Start:       item.DueDate.UTC(),
+	}
+	err = tx.Create(&series).Error
+	if err != nil {
+		return err
+	}
+
+	item.Recurrence = series.Recurrence
+	item.SeriesID = series.ID
+	item.ScheduledDue = series.Start
+	return nil
+}
+
+// continueSeries creates the occurrence following a completed occurrence of a series within a
+// transaction, owned by the owner of the completed occurrence and shared like it.
+//
+// No occurrence is created if the series has ended, or the completed occurrence has been
+// followed by another one already, such as when it is completed again.
+// It returns the created occurrence, if any.
+func (mgr *ToDoEntityManager) continueSeries(tx *gorm.DB, completed *entities.ToDoItemEntity) (*entities.ToDoItemEntity, error) {
+	var series entities.ToDoSeriesEntity
+	err := tx.First(&series, completed.SeriesID).Error
+	if err != nil || series.Recurrence == "" {
+		return nil, err
+	}
+
+	var later int64
+	err = tx.Model(&entities.ToDoItemEntity{}).
+		Where("series_id = ? AND scheduled_due > ?", series.ID, completed.ScheduledDue.UTC()).
+		Count(&later).Error
+	if err != nil || later > 0 {
+		return nil, err
+	}
+
+	rule, location, err := parseRecurrence(series.Recurrence, series.TimeZone, series.Start)
+	if err != nil {
+		return nil, err
+	}
+
+	due, found := rule.Next(series.Start.In(location), completed.ScheduledDue)
+	if !found {
+		return nil, nil
+	}
+
+	next := &entities.ToDoItemEntity{
+		OwnerID:      completed.OwnerID,
+		OwnerEmail:   completed.OwnerEmail,
+		Description:  series.Description,
+		DueDate:      due.UTC(),
+		Recurrence:   series.Recurrence,
+		TimeZone:     series.TimeZone,
+		SeriesID:     series.ID,
+		ScheduledDue: due.UTC(),
+		ParentID:     completed.ParentID,
+	}
+	err = mgr.insert(tx, next)
+	if err != nil {
+		return nil, err
+	}
+
+	var shares []entities.ToDoShareEntity
+	err = tx.Where("item_id = ?", completed.ID).Find(&shares).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range shares {
+		shares[i].ID = 0
+		shares[i].ItemID = next.ID
+	}
+	if len(shares) > 0 {
+		err = tx.Create(&shares).Error
+	}
+
+	return next, err
+}
+
+// parseRecurrence parses the recurrence rule and time zone of a series, which requires a due date.
+//
+// It returns ErrInvalid if the rule or time zone is invalid, or the due date is missing.
+func parseRecurrence(value string, timeZone string, due time.Time) (*recurrence.Rule, *time.Location, error) {
+	rule, err := recurrence.Parse(value)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", ErrInvalid, err)
+	}
+
+	location, err := time.LoadLocation(timeZone)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: unknown time zone %s", ErrInvalid, timeZone)
+	}
+
+	if due.IsZero() {
+		return nil, nil, fmt.Errorf("%w: recurring items require a due date", ErrInvalid)
+	}
+
+	return rule, location, nil
+}
@@ -0,0 +1,189 @@
+package persistence_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"todo-api-go/entities"
+	"todo-api-go/persistence"
+	"todo-api-go/testsupport"
+)
+
+func TestRecurringItem(t *testing.T) {
+	assert := assert.New(t)
+
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("time zone database not available")
+	}
+
+	mgr := testsupport.CreateTestManager(t)
+	alice := mgr.WithContext(principalContext("alice"))
+	bob := mgr.WithContext(principalContext("bob"))
+
+	// Daylight saving time starts on March 30th 2025 in Berlin
+	item := &entities.ToDoItemEntity{
+		Description: "Water the plants",
+		DueDate:     time.Date(2025, time.March, 24, 9, 0, 0, 0, berlin),
+		Recurrence:  "freq=weekly",
+		TimeZone:    "Europe/Berlin",
+	}
+	err = alice.Create(item)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.NotZerof(item.SeriesID, "a series should be started")
+	assert.Equalf("FREQ=WEEKLY", item.Recurrence, "the rule should be normalized")
+
+	err = alice.Share(&entities.ToDoShareEntity{ItemID: item.ID, GranteeType: entities.GranteeUser, GranteeID: "bob", Permission: entities.PermissionEditor})
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	completed := *item
+	completed.Completed = true
+	err = bob.Update(&completed)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	next := findOpenOccurrence(t, alice, item.SeriesID)
+	if !assert.NotNilf(next, "the next occurrence should be created") {
+		return
+	}
+	assert.Equalf(time.Date(2025, time.March, 31, 9, 0, 0, 0, berlin), next.DueDate.In(berlin), "the local time of day should be kept across daylight saving time")
+	assert.Equalf("alice", next.OwnerID, "the next occurrence should keep the owner")
+	assert.Equalf("Water the plants", next.Description, "the next occurrence should take the description of the series")
+
+	shares, err := alice.FindShares(next.ID)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Lenf(shares, 1, "the next occurrence should be shared like the completed one")
+
+	// Completing the occurrence again does not create another occurrence
+	completed.Completed = false
+	err = alice.Update(&completed)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	completed.Completed = true
+	err = alice.Update(&completed)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Lenf(findOccurrences(t, alice, item.SeriesID), 2, "occurrences should not be duplicated")
+}
+
+func TestRecurringItemCount(t *testing.T) {
+	assert := assert.New(t)
+
+	mgr := testsupport.CreateTestManager(t)
+
+	item := &entities.ToDoItemEntity{Description: "Twice", DueDate: testsupport.ParseTestDate("2025-01-01"), Recurrence: "FREQ=DAILY;COUNT=2"}
+	err := mgr.Create(item)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	next := completeOccurrence(t, mgr, item)
+	if !assert.NotNilf(next, "the second occurrence should be created") {
+		return
+	}
+	assert.Equalf(testsupport.ParseTestDate("2025-01-02"), next.DueDate.UTC(), "the due date should follow the rule")
+
+	assert.Nilf(completeOccurrence(t, mgr, next), "the series should end after COUNT occurrences")
+}
+
+func TestUpdateFuture(t *testing.T) {
+	assert := assert.New(t)
+
+	mgr := testsupport.CreateTestManager(t)
+
+	item := &entities.ToDoItemEntity{Description: "Report", DueDate: testsupport.ParseTestDate("2025-01-06"), Recurrence: "FREQ=WEEKLY"}
+	err := mgr.Create(item)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	// Changing this occurrence only leaves the series unchanged
+	occurrence := *item
+	occurrence.Description = "Report, including the holidays"
+	occurrence.DueDate = testsupport.ParseTestDate("2025-01-08")
+	err = mgr.Update(&occurrence)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	next := completeOccurrence(t, mgr, &occurrence)
+	if !assert.NotNilf(next, "the next occurrence should be created") {
+		return
+	}
+	assert.Equalf("Report", next.Description, "the description of the series should be kept")
+	assert.Equalf(testsupport.ParseTestDate("2025-01-13"), next.DueDate.UTC(), "the schedule of the series should be kept")
+
+	// Changing all future occurrences continues the series from this occurrence
+	future := *next
+	future.Description = "Weekly report"
+	future.DueDate = testsupport.ParseTestDate("2025-01-14")
+	future.Recurrence = "FREQ=WEEKLY;INTERVAL=2"
+	err = mgr.UpdateFuture(&future)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf("FREQ=WEEKLY;INTERVAL=2", future.Recurrence, "the rule should be updated")
+
+	next = completeOccurrence(t, mgr, &future)
+	if !assert.NotNilf(next, "the next occurrence should be created") {
+		return
+	}
+	assert.Equalf("Weekly report", next.Description, "the description of the series should be updated")
+	assert.Equalf(testsupport.ParseTestDate("2025-01-28"), next.DueDate.UTC(), "the series should continue from the updated occurrence")
+
+	// Clearing the rule ends the series
+	future = *next
+	future.Recurrence = ""
+	err = mgr.UpdateFuture(&future)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Nilf(completeOccurrence(t, mgr, &future), "the series should end")
+
+	err = mgr.UpdateFuture(&entities.ToDoItemEntity{ID: 1, Description: "Not recurring"})
+	assert.ErrorIsf(err, persistence.ErrInvalid, "items without series should be rejected")
+}
+
+func TestInvalidRecurrence(t *testing.T) {
+	assert := assert.New(t)
+
+	mgr := testsupport.CreateTestManager(t)
+	due := testsupport.ParseTestDate("2025-01-01")
+
+	for _, item := range []entities.ToDoItemEntity{
+		{Description: "Unknown frequency", DueDate: due, Recurrence: "FREQ=SOMETIMES"},
+		{Description: "Unknown time zone", DueDate: due, Recurrence: "FREQ=DAILY", TimeZone: "Mars/Olympus_Mons"},
+		{Description: "No due date", Recurrence: "FREQ=DAILY"},
+	} {
+		err := mgr.Create(&item)
+		assert.ErrorIsf(err, persistence.ErrInvalid, "%s should be rejected", item.Description)
+	}
+}
+
+// completeOccurrence completes an occurrence of a series, returning the next occurrence, if any
+func completeOccurrence(t *testing.T, mgr *persistence.ToDoEntityManager, item *entities.ToDoItemEntity) *entities.ToDoItemEntity {
+	completed := *item
+	completed.Completed = true
+
+	err := mgr.Update(&completed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return findOpenOccurrence(t, mgr, item.SeriesID)
+}
+
+func findOpenOccurrence(t *testing.T, mgr *persistence.ToDoEntityManager, seriesID uint) *entities.ToDoItemEntity {
+	for _, occurrence := range findOccurrences(t, mgr, seriesID) {
+		if !occurrence.Completed {
+			return &occurrence
+		}
+	}
+
+	return nil
+}
+
+func findOccurrences(t *testing.T, mgr *persistence.ToDoEntityManager, seriesID uint) []entities.ToDoItemEntity {
+	items, _, err := mgr.FindAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	occurrences := []entities.ToDoItemEntity{}
+	for _, item := range items {
+		if item.SeriesID == seriesID {
+			occurrences = append(occurrences, item)
+		}
+	}
+
+	return occurrences
+}
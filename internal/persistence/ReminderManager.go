@@ -0,0 +1,350 @@
+package persistence
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"todo-api-go/entities"
+	"todo-api-go/reqctx"
+)
+
+// PendingReminder is a reminder leased for sending, together with its item as of sending.
+type PendingReminder struct {
+	Reminder entities.ReminderEntity
+	Item     entities.ToDoItemEntity
+}
+
+// ReminderOutbox records the notifications of a reminder within the transaction that marks
+// the reminder as sent, so that they are recorded exactly once.
+type ReminderOutbox struct {
+	tx      *gorm.DB
+	pending *PendingReminder
+}
+
+// AddToInbox adds a message about the reminder to the in-app inbox of its recipient.
+func (outbox *ReminderOutbox) AddToInbox(subject string, body string) error {
+	return outbox.tx.Create(&entities.InboxMessageEntity{
+		OwnerID:    outbox.pending.Reminder.Recipient,
+		ItemID:     outbox.pending.Item.ID,
+		ReminderID: outbox.pending.Reminder.ID,
+		Subject:    subject,
+		Body:       body,
+	}).Error
+}
+
+// EnqueueWebhooks queues the todo.reminder event of the reminder in the webhook outbox, for
+// the subscriptions that would be notified of changes of its item.
+//
+// It returns the number of queued deliveries.
+func (outbox *ReminderOutbox) EnqueueWebhooks() (int, error) {
+	reminder := &outbox.pending.Reminder
+	return enqueueWebhooks(outbox.tx, entities.WebhookItemReminder, &outbox.pending.Item, reminder.SendAt, func(subscription *entities.WebhookSubscriptionEntity) string {
+		return fmt.Sprintf("%s:%d:%d", entities.WebhookItemReminder, subscription.ID, reminder.ID)
+	})
+}
+
+// InboxFilter restricts the messages returned by FindInbox. Zero fields match all messages.
+type InboxFilter struct {
+	Unread bool
+}
+
+type ReminderManager struct {
+	orm *gorm.DB
+	ctx context.Context
+}
+
+// NewReminderManager creates a new instance of ReminderManager.
+//
+// Reminders are scheduled for the due dates of open items and sent by the scheduler instances
+// of the service through the ReminderManager, which leases every reminder to one instance at
+// a time. Reminders sent to the in-app inbox can be read through the ReminderManager as well.
+//
+// Parameters:
+// - orm: A pointer to a gorm.DB object representing the underlying GORM ORM instance.
+//
+// Returns:
+// - A pointer to a ReminderManager object.
+func NewReminderManager(orm *gorm.DB) *ReminderManager {
+	return &ReminderManager{orm: orm, ctx: context.Background()}
+}
+
+// Schedule schedules reminders for the open items whose due date, plus an offset, falls within
+// a period of time, across all owners. A reminder is scheduled for every offset and channel,
+// addressed to the owner of the item.
+//
+// Every reminder is scheduled once per due date, so that the period may overlap with the
+// periods of earlier calls, and with those of other scheduler instances.
+//
+// It takes the offsets from the due dates, the channels, the start of the period, exclusive, and its end.
+// It returns the number of scheduled reminders and an error if any occurred.
+func (mgr *ReminderManager) Schedule(offsets []time.Duration, channels []string, since time.Time, until time.Time) (int, error) {
+	scheduled := 0
+
+	for _, offset := range offsets {
+		var batch []entities.ToDoItemEntity
+		err := mgr.orm.Where("completed = ? AND due_date > ? AND due_date <= ?", false, since.Add(-offset), until.Add(-offset)).
+			FindInBatches(&batch, exportBatchSize, func(tx *gorm.DB, _ int) error {
+				for i := range batch {
+					item := &batch[i]
+					for _, channel := range channels {
+						reminder := entities.ReminderEntity{
+							ItemID:    item.ID,
+							Recipient: item.OwnerID,
+							Channel:   channel,
+							DueDate:   item.DueDate,
+							Offset:    offset,
+							SendAt:    item.DueDate.Add(offset),
+							Status:    entities.ReminderPending,
+							DedupKey:  fmt.Sprintf("%d:%d:%d:%s", item.ID, item.DueDate.Unix(), int64(offset.Seconds()), channel),
+						}
+
+						result := mgr.orm.Clauses(clause.OnConflict{DoNothing: true}).Create(&reminder)
+						if result.Error != nil {
+							return result.Error
+						}
+						scheduled += int(result.RowsAffected)
+					}
+				}
+
+				return nil
+			}).Error
+		if err != nil {
+			return scheduled, err
+		}
+	}
+
+	return scheduled, nil
+}
+
+// Claim leases pending reminders that are due for sending to a scheduler instance, oldest first.
+//
+// Leasing counts the attempt, so that concurrent instances skip the reminder until the lease
+// expires, and the reminder is sent again if the instance fails to complete it in time.
+//
+// It takes the name of the instance, the current time, the maximum number of reminders to lease and the lease.
+// It returns the leased reminders and an error if any occurred.
+func (mgr *ReminderManager) Claim(holder string, now time.Time, limit int, lease time.Duration) ([]PendingReminder, error) {
+	var due []entities.ReminderEntity
+	err := mgr.orm.Where("status = ? AND send_at <= ? AND lease_expires <= ?", entities.ReminderPending, now, now).
+		Order("send_at asc").
+		Limit(limit).
+		Find(&due).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []PendingReminder
+	for i := range due {
+		result := mgr.orm.Model(&entities.ReminderEntity{}).
+			Where("id = ? AND status = ? AND attempts = ?", due[i].ID, entities.ReminderPending, due[i].Attempts).
+			Updates(map[string]any{"attempts": due[i].Attempts + 1, "lease_holder": holder, "lease_expires": now.Add(lease)})
+		if result.Error != nil {
+			return nil, result.Error
+		}
+
+		// Another instance leased the reminder first
+		if result.RowsAffected == 0 {
+			continue
+		}
+
+		due[i].Attempts++
+		due[i].LeaseHolder = holder
+		due[i].LeaseExpires = now.Add(lease)
+		pending = append(pending, PendingReminder{Reminder: due[i]})
+	}
+
+	return pending, nil
+}
+
+// Prepare loads the item of a leased reminder as of sending, so that the reminder can be sent
+// before it is completed, outside of the transaction of Complete.
+//
+// It takes the reminder as leased by the instance.
+// It reports whether the reminder is to be sent, as reminders whose item has been completed,
+// deleted or rescheduled since they were scheduled are canceled by Complete, and returns an error if any occurred.
+func (mgr *ReminderManager) Prepare(pending *PendingReminder) (bool, error) {
+	var item entities.ToDoItemEntity
+	err := mgr.orm.Limit(1).Find(&item, pending.Reminder.ItemID).Error
+	if err != nil {
+		return false, err
+	}
+
+	pending.Item = item
+	return isDue(&pending.Reminder, &item), nil
+}
+
+// Complete sends a leased reminder through a notify function, and marks it as sent, within
+// a transaction.
+//
+// Reminders whose item has been completed, deleted or rescheduled since they were scheduled
+// are canceled instead, without calling the notify function. The notifications recorded
+// through the outbox passed to the notify function are committed together with the state of
+// the reminder; the transaction is rolled back if the notify function fails.
+//
+// It takes the reminder as leased by the instance, and the notify function.
+// The passed reminder is updated with its new state on success.
+// It returns ErrLeaseLost if the lease has expired and the reminder has been leased again,
+// the error of the notify function, or any other error.
+func (mgr *ReminderManager) Complete(pending *PendingReminder, notify func(outbox *ReminderOutbox) error) error {
+	reminder := pending.Reminder
+
+	return mgr.orm.Transaction(func(tx *gorm.DB) error {
+		var item entities.ToDoItemEntity
+		err := tx.Limit(1).Find(&item, reminder.ItemID).Error
+		if err != nil {
+			return err
+		}
+
+		reminder.Status = entities.ReminderSent
+		reminder.SentAt = time.Now()
+		if !isDue(&reminder, &item) {
+			reminder.Status = entities.ReminderCanceled
+			reminder.SentAt = time.Time{}
+		}
+
+		// The reminder is updated first, so that instances that lost the lease notify nobody
+		result := tx.Model(&entities.ReminderEntity{}).
+			Where("id = ? AND status = ? AND lease_holder = ? AND attempts = ?", reminder.ID, entities.ReminderPending, reminder.LeaseHolder, reminder.Attempts).
+			Updates(map[string]any{"status": reminder.Status, "sent_at": reminder.SentAt, "last_error": ""})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrLeaseLost
+		}
+
+		if reminder.Status == entities.ReminderSent {
+			pending.Item = item
+			err = notify(&ReminderOutbox{tx: tx, pending: pending})
+			if err != nil {
+				return err
+			}
+		}
+
+		reminder.LastError = ""
+		pending.Reminder = reminder
+		return nil
+	})
+}
+
+// Fail records a failed attempt to send a leased reminder, and releases its lease. The reminder
+// is retried at the specified time, or given up if the time is zero.
+//
+// It takes the reminder as leased by the instance, the cause of the failure and the time of the retry.
+// The passed reminder is updated with its new state on success.
+// It returns ErrLeaseLost if the lease has expired and the reminder has been leased again, or any other error.
+func (mgr *ReminderManager) Fail(pending *PendingReminder, cause error, retryAt time.Time) error {
+	reminder := pending.Reminder
+	reminder.LastError = cause.Error()
+	reminder.LeaseExpires = time.Time{}
+	if retryAt.IsZero() {
+		reminder.Status = entities.ReminderDead
+	} else {
+		reminder.SendAt = retryAt
+	}
+
+	result := mgr.orm.Model(&entities.ReminderEntity{}).
+		Where("id = ? AND status = ? AND lease_holder = ? AND attempts = ?", reminder.ID, entities.ReminderPending, reminder.LeaseHolder, reminder.Attempts).
+		Updates(map[string]any{"status": reminder.Status, "send_at": reminder.SendAt, "last_error": reminder.LastError, "lease_expires": reminder.LeaseExpires})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrLeaseLost
+	}
+
+	pending.Reminder = reminder
+	return nil
+}
+
+// isDue reports whether a reminder is still to be sent for the current state of its item, which
+// is the zero value if the item has been deleted.
+func isDue(reminder *entities.ReminderEntity, item *entities.ToDoItemEntity) bool {
+	return item.ID != 0 && !item.Completed && item.DueDate.Equal(reminder.DueDate)
+}
+
+// FindReminders retrieves the reminders of an item, across all channels, in the order they are sent.
+//
+// It takes the ID of the item as a parameter.
+// It returns a slice of ReminderEntity objects and an error if any occurred.
+func (mgr *ReminderManager) FindReminders(itemID uint) ([]entities.ReminderEntity, error) {
+	var reminders []entities.ReminderEntity
+	err := mgr.orm.Where("item_id = ?", itemID).Order("send_at asc, id asc").Find(&reminders).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return reminders, nil
+}
+
+// FindInbox retrieves the messages in the in-app inbox of the principal of the manager's
+// context, newest first. Internal callers without a principal retrieve the messages of all users.
+//
+// It takes the filter and optional PagingConfigurator arguments.
+// It returns a slice of InboxMessageEntity objects, the total number of matching messages and an error if any occurred.
+func (mgr *ReminderManager) FindInbox(filter InboxFilter, configurators ...PagingConfigurator) ([]entities.InboxMessageEntity, int64, error) {
+	scope := func(db *gorm.DB) *gorm.DB {
+		db = db.Scopes(mgr.ownedMessages)
+		if filter.Unread {
+			db = db.Where("is_read = ?", false)
+		}
+		return db
+	}
+
+	var count int64
+	err := mgr.orm.Model(&entities.InboxMessageEntity{}).Scopes(scope).Count(&count).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var messages []entities.InboxMessageEntity
+	err = mgr.orm.Scopes(scope, Paginate(configurators...)).Order("id desc").Find(&messages).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return messages, count, nil
+}
+
+// MarkRead marks a message in the in-app inbox of the principal of the manager's context as read.
+//
+// It takes the ID of the message as a parameter.
+// It returns the InboxMessageEntity and an error if it does not exist or is not owned by the principal.
+func (mgr *ReminderManager) MarkRead(id uint) (*entities.InboxMessageEntity, error) {
+	var message entities.InboxMessageEntity
+	err := mgr.orm.Scopes(mgr.ownedMessages).First(&message, id).Error
+	if err != nil {
+		return nil, err
+	}
+
+	message.Read = true
+	err = mgr.orm.Model(&message).Update("is_read", true).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &message, nil
+}
+
+// WithContext returns a new ReminderManager with the provided context.
+//
+// ctx context.Context
+// *ReminderManager
+func (mgr *ReminderManager) WithContext(ctx context.Context) *ReminderManager {
+	return &ReminderManager{orm: mgr.orm.WithContext(ctx), ctx: ctx}
+}
+
+// ownedMessages is a scope restricting an InboxMessageEntity query to the messages owned by
+// the principal of the manager's context.
+func (mgr *ReminderManager) ownedMessages(db *gorm.DB) *gorm.DB {
+	principal := reqctx.PrincipalFrom(mgr.ctx)
+	if principal == nil {
+		return db
+	}
+
+	return db.Where("owner_id = ?", principal.Subject)
+}
@@ -0,0 +1,162 @@
+package persistence_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"todo-api-go/entities"
+	"todo-api-go/persistence"
+	"todo-api-go/testsupport"
+)
+
+func TestReminderLeases(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testsupport.CreateTestDatabase(t)
+	reminders := persistence.NewReminderManager(db)
+
+	due := time.Date(2030, time.January, 1, 10, 0, 0, 0, time.UTC)
+	item := &entities.ToDoItemEntity{Description: "Submit the report", DueDate: due}
+	err := persistence.New(db).WithContext(principalContext("alice")).Create(item)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	offsets := []time.Duration{-time.Hour, 0}
+	scheduled, err := reminders.Schedule(offsets, []string{"inbox"}, due.Add(-2*time.Hour), due.Add(-30*time.Minute))
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf(1, scheduled, "the reminder an hour before the due date should be scheduled")
+
+	scheduled, err = reminders.Schedule(offsets, []string{"inbox"}, due.Add(-2*time.Hour), due.Add(-30*time.Minute))
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf(0, scheduled, "reminders should be scheduled once")
+
+	now := due.Add(-30 * time.Minute)
+	pending, err := reminders.Claim("a", now, 10, time.Minute)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	if !assert.Lenf(pending, 1, "the due reminder should be leased") {
+		return
+	}
+	assert.Equalf("alice", pending[0].Reminder.Recipient, "the reminder should be addressed to the owner")
+
+	other, err := reminders.Claim("b", now, 10, time.Minute)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Emptyf(other, "leased reminders should not be leased again")
+
+	sending, err := reminders.Prepare(&pending[0])
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Truef(sending, "the reminder should be sent")
+	assert.Equalf(item.ID, pending[0].Item.ID, "the item should be loaded")
+
+	err = reminders.Complete(&pending[0], func(outbox *persistence.ReminderOutbox) error {
+		return outbox.AddToInbox("Reminder", pending[0].Item.Description)
+	})
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf(entities.ReminderSent, pending[0].Reminder.Status, "the reminder should be sent")
+
+	// The lease of the reminder at the due date expires before the instance completes it
+	_, err = reminders.Schedule(offsets, []string{"inbox"}, now, due)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	expired, err := reminders.Claim("a", due, 10, time.Minute)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	taken, err := reminders.Claim("b", due.Add(2*time.Minute), 10, time.Minute)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	if !assert.Lenf(expired, 1, "the due reminder should be leased") || !assert.Lenf(taken, 1, "expired leases should be taken over") {
+		return
+	}
+
+	notify := func(outbox *persistence.ReminderOutbox) error {
+		return outbox.AddToInbox("Reminder", "Submit the report")
+	}
+	err = reminders.Complete(&expired[0], notify)
+	assert.ErrorIsf(err, persistence.ErrLeaseLost, "expired leases should not complete reminders")
+	err = reminders.Complete(&taken[0], notify)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	messages, total, err := reminders.WithContext(principalContext("alice")).FindInbox(persistence.InboxFilter{Unread: true})
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf(int64(2), total, "every reminder should be delivered once")
+	assert.Lenf(messages, 2, "every reminder should be delivered once")
+
+	_, total, err = reminders.WithContext(principalContext("bob")).FindInbox(persistence.InboxFilter{})
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf(int64(0), total, "messages of other principals should not be found")
+
+	_, err = reminders.WithContext(principalContext("bob")).MarkRead(messages[0].ID)
+	assert.ErrorIsf(err, persistence.ErrNotFound, "messages of other principals should not be marked")
+
+	read, err := reminders.WithContext(principalContext("alice")).MarkRead(messages[0].ID)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Truef(read.Read, "the message should be read")
+
+	_, total, err = reminders.WithContext(principalContext("alice")).FindInbox(persistence.InboxFilter{Unread: true})
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf(int64(1), total, "read messages should be filtered")
+}
+
+func TestReminderCancellationAndFailure(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testsupport.CreateTestDatabase(t)
+	reminders := persistence.NewReminderManager(db)
+	items := persistence.New(db)
+
+	due := time.Date(2030, time.January, 1, 10, 0, 0, 0, time.UTC)
+	item := &entities.ToDoItemEntity{Description: "Call back", DueDate: due}
+	err := items.Create(item)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	_, err = reminders.Schedule([]time.Duration{-time.Hour, 0}, []string{"smtp"}, due.Add(-2*time.Hour), due)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	pending, err := reminders.Claim("a", due.Add(-time.Hour), 10, time.Minute)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	if !assert.Lenf(pending, 1, "the due reminder should be leased") {
+		return
+	}
+
+	failure := errors.New("connection refused")
+	err = reminders.Fail(&pending[0], failure, due.Add(-50*time.Minute))
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	retried, err := reminders.Claim("a", due.Add(-55*time.Minute), 10, time.Minute)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Emptyf(retried, "failed reminders should wait for their retry")
+
+	retried, err = reminders.Claim("a", due.Add(-50*time.Minute), 10, time.Minute)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	if assert.Lenf(retried, 1, "failed reminders should be retried") {
+		assert.Equalf(2, retried[0].Reminder.Attempts, "attempts should be counted")
+
+		err = reminders.Fail(&retried[0], failure, time.Time{})
+		assert.Nilf(err, "error should be nil, not %s", err)
+		assert.Equalf(entities.ReminderDead, retried[0].Reminder.Status, "the reminder should be given up")
+	}
+
+	// Completing the item cancels the reminder at the due date
+	item.Completed = true
+	err = items.Update(item)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	pending, err = reminders.Claim("a", due, 10, time.Minute)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	if assert.Lenf(pending, 1, "the due reminder should be leased") {
+		sending, err := reminders.Prepare(&pending[0])
+		assert.Nilf(err, "error should be nil, not %s", err)
+		assert.Falsef(sending, "reminders of completed items should not be sent")
+
+		err = reminders.Complete(&pending[0], func(*persistence.ReminderOutbox) error {
+			t.Error("reminders of completed items should not be sent")
+			return nil
+		})
+		assert.Nilf(err, "error should be nil, not %s", err)
+		assert.Equalf(entities.ReminderCanceled, pending[0].Reminder.Status, "the reminder should be canceled")
+	}
+
+	found, err := reminders.FindReminders(item.ID)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Lenf(found, 2, "reminders should be kept")
+	assert.Equalf(failure.Error(), found[0].LastError, "the error should be kept")
+}
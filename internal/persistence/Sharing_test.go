@@ -0,0 +1,253 @@
+package persistence_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"todo-api-go/entities"
+	"todo-api-go/persistence"
+	"todo-api-go/reqctx"
+	"todo-api-go/testsupport"
+)
+
+func TestOwnedItemsAreHidden(t *testing.T) {
+	assert := assert.New(t)
+
+	mgr := testsupport.CreateTestManager(t)
+	alice := mgr.WithContext(principalContext("alice"))
+	bob := mgr.WithContext(principalContext("bob"))
+
+	item := &entities.ToDoItemEntity{Description: "private"}
+	err := alice.Create(item)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf("alice", item.OwnerID, "owner should be the creating principal")
+
+	_, total, err := alice.FindAll()
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf(int64(1), total, "owner should only see owned items")
+
+	_, total, err = bob.FindAll()
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf(int64(0), total, "other principals should not see the item")
+
+	_, err = bob.FineOne(int(item.ID))
+	assert.ErrorIsf(err, persistence.ErrNotFound, "item should not be visible")
+
+	err = bob.Delete(item.ID)
+	assert.ErrorIsf(err, persistence.ErrNotFound, "item should not be deletable")
+}
+
+func TestShareWithUser(t *testing.T) {
+	assert := assert.New(t)
+
+	mgr := testsupport.CreateTestManager(t)
+	alice := mgr.WithContext(principalContext("alice"))
+	bob := mgr.WithContext(principalContext("bob"))
+
+	item := &entities.ToDoItemEntity{Description: "shared"}
+	err := alice.Create(item)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	share := &entities.ToDoShareEntity{
+		ItemID:      item.ID,
+		GranteeType: entities.GranteeUser,
+		GranteeID:   "bob",
+		Permission:  entities.PermissionViewer,
+	}
+	err = alice.Share(share)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.NotEqualf(0, int(share.ID), "ID should not be 0")
+
+	found, err := bob.FineOne(int(item.ID))
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf(item.ID, found.ID, "shared item should be visible")
+
+	found.Description = "changed"
+	err = bob.Update(found)
+	assert.ErrorIsf(err, persistence.ErrForbidden, "viewers should not update")
+
+	share.Permission = entities.PermissionEditor
+	err = alice.Share(share)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	shares, err := bob.FindShares(item.ID)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf(1, len(shares), "re-sharing should replace the existing share")
+	assert.Equalf(entities.PermissionEditor, shares[0].Permission, "permission should be replaced")
+
+	found.Description = "changed"
+	err = bob.Update(found)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf("alice", found.OwnerID, "owner should not change")
+
+	err = bob.Delete(item.ID)
+	assert.ErrorIsf(err, persistence.ErrForbidden, "editors should not delete")
+
+	err = bob.Unshare(item.ID, share.ID)
+	assert.ErrorIsf(err, persistence.ErrForbidden, "editors should not manage shares")
+
+	err = alice.Unshare(item.ID, share.ID)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	_, err = bob.FineOne(int(item.ID))
+	assert.ErrorIsf(err, persistence.ErrNotFound, "item should no longer be visible")
+}
+
+func TestShareWithGroup(t *testing.T) {
+	assert := assert.New(t)
+
+	mgr := testsupport.CreateTestManager(t)
+	alice := mgr.WithContext(principalContext("alice"))
+	bob := mgr.WithContext(principalContext("bob", "team"))
+	carol := mgr.WithContext(principalContext("carol", "other"))
+
+	item := &entities.ToDoItemEntity{Description: "team item"}
+	err := alice.Create(item)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	err = alice.Share(&entities.ToDoShareEntity{
+		ItemID:      item.ID,
+		GranteeType: entities.GranteeGroup,
+		GranteeID:   "team",
+		Permission:  entities.PermissionViewer,
+	})
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	_, total, err := bob.FindAll()
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf(int64(1), total, "group members should see the shared item")
+
+	_, total, err = carol.FindAll()
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf(int64(0), total, "non-members should not see the shared item")
+}
+
+func TestFindAudience(t *testing.T) {
+	assert := assert.New(t)
+
+	mgr := testsupport.CreateTestManager(t)
+	alice := mgr.WithContext(principalContext("alice"))
+
+	item := &entities.ToDoItemEntity{Description: "team item"}
+	err := alice.Create(item)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	err = alice.Share(&entities.ToDoShareEntity{
+		ItemID:      item.ID,
+		GranteeType: entities.GranteeGroup,
+		GranteeID:   "team",
+		Permission:  entities.PermissionViewer,
+	})
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	audience, err := mgr.FindAudience(item.ID)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Truef(audience.Includes(&reqctx.Principal{Subject: "bob", Groups: []string{"team"}}), "grantees should be included")
+	assert.Falsef(audience.Includes(&reqctx.Principal{Subject: "carol"}), "other principals should not be included")
+
+	_, err = mgr.WithContext(principalContext("carol")).FindAudience(item.ID)
+	assert.ErrorIsf(err, persistence.ErrNotFound, "audiences of invisible items should not be found")
+
+	err = alice.Delete(item.ID)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	audience, err = mgr.FindAudience(item.ID)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Truef(audience.Includes(&reqctx.Principal{Subject: "bob", Groups: []string{"team"}}), "audiences of deleted items should be found")
+
+	_, err = mgr.FindAudience(item.ID + 100)
+	assert.ErrorIsf(err, persistence.ErrNotFound, "audiences of unknown items should not be found")
+}
+
+func TestUnownedItems(t *testing.T) {
+	assert := assert.New(t)
+
+	mgr := testsupport.CreateTestManager(t)
+	bob := mgr.WithContext(principalContext("bob"))
+	admin := mgr.WithContext(adminContext("root"))
+
+	_, total, err := bob.FindAll()
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf(int64(0), total, "items without owner should not be visible to everyone")
+
+	err = bob.Update(&entities.ToDoItemEntity{ID: 1, Description: "changed"})
+	assert.ErrorIsf(err, persistence.ErrNotFound, "items without owner should not be updated by everyone")
+
+	err = bob.Delete(1)
+	assert.ErrorIsf(err, persistence.ErrNotFound, "items without owner should not be deleted by everyone")
+
+	_, total, err = admin.FindAll()
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf(int64(10), total, "admins should see items without owner")
+
+	err = admin.Share(&entities.ToDoShareEntity{ItemID: 1, GranteeType: entities.GranteeUser, GranteeID: "bob", Permission: entities.PermissionViewer})
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	err = bob.Delete(1)
+	assert.ErrorIsf(err, persistence.ErrForbidden, "viewers should not delete items without owner")
+
+	err = admin.Delete(1)
+	assert.Nilf(err, "error should be nil, not %s", err)
+}
+
+func TestShareValidation(t *testing.T) {
+	assert := assert.New(t)
+
+	mgr := testsupport.CreateTestManager(t)
+
+	err := mgr.Share(&entities.ToDoShareEntity{
+		ItemID:      1,
+		GranteeType: entities.GranteeUser,
+		GranteeID:   "bob",
+		Permission:  entities.PermissionOwner,
+	})
+	assert.ErrorIsf(err, persistence.ErrInvalid, "owner permission should not be grantable")
+
+	err = mgr.Share(&entities.ToDoShareEntity{
+		ItemID:      1,
+		GranteeType: "robot",
+		GranteeID:   "bob",
+		Permission:  entities.PermissionViewer,
+	})
+	assert.ErrorIsf(err, persistence.ErrInvalid, "unknown grantee types should be rejected")
+}
+
+func TestAssignUnownedItems(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testsupport.CreateTestDatabase(t)
+	mgr := persistence.New(db)
+	alice := mgr.WithContext(principalContext("alice"))
+
+	owned := &entities.ToDoItemEntity{Description: "owned"}
+	err := mgr.WithContext(principalContext("bob")).Create(owned)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	assigned, err := persistence.AssignUnownedItems(db, "alice")
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf(int64(10), assigned, "items without owner should be assigned")
+
+	_, total, err := alice.FindAll()
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf(int64(10), total, "assigned items should be visible to their owner")
+
+	found, err := mgr.FineOne(int(owned.ID))
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf("bob", found.OwnerID, "owned items should keep their owner")
+}
+
+func adminContext(subject string) context.Context {
+	return reqctx.WithPrincipal(context.Background(), &reqctx.Principal{
+		Subject: subject,
+		Roles:   []string{persistence.RoleAdmin},
+	})
+}
+
+func principalContext(subject string, groups ...string) context.Context {
+	return reqctx.WithPrincipal(context.Background(), &reqctx.Principal{
+		Subject: subject,
+		Groups:  groups,
+	})
+}
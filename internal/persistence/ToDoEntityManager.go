@@ -2,14 +2,40 @@ package persistence
 
 import (
 	"context"
+	"errors"
+	"time"
 
+	"go.opentelemetry.io/otel/trace"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"todo-api-go/entities"
+	"todo-api-go/reqctx"
+)
+
+var (
+	// ErrNotFound is returned when the requested entity does not exist or is not visible to the caller
+	ErrNotFound = gorm.ErrRecordNotFound
+
+	// ErrForbidden is returned when the caller lacks the permission required for an operation
+	ErrForbidden = errors.New("operation not permitted")
+
+	// ErrInvalid is returned when the supplied data can not be accepted
+	ErrInvalid = errors.New("invalid request")
+
+	// ErrConflict is returned when an update conflicts with changes made since the state it is based on
+	ErrConflict = errors.New("conflicting changes")
+
+	// ErrLeaseLost is returned when a lease has expired and been taken over by another holder
+	ErrLeaseLost = errors.New("lease lost")
 )
 
 type ToDoEntityManager struct {
-	orm *gorm.DB
+	orm               *gorm.DB
+	ctx               context.Context
+	observers         []ItemObserver
+	audienceObservers []AudienceObserver
+	tracer            trace.Tracer
 }
 
 // Close closes the ToDoEntityManager and associated database connection.
@@ -27,41 +53,224 @@ func (mgr *ToDoEntityManager) Close() {
 
 // Create creates a ToDoItemEntity in the database.
 //
+// When the manager's context carries a principal, that principal becomes the owner of the item.
+// Items with a recurrence rule start a new series, with the item as its first occurrence.
+// Items with a parent become subtasks of the parent, which the principal must be allowed to update.
+// The creation is recorded in the revision history and the audit log, and queued for
+// delivery to webhook subscriptions.
 // It takes a pointer to a ToDoItemEntity as a parameter.
 // It returns an error if there was an issue creating the entity.
-func (mgr *ToDoEntityManager) Create(item *entities.ToDoItemEntity) error {
-	return mgr.orm.Create(item).Error
+func (mgr *ToDoEntityManager) Create(item *entities.ToDoItemEntity) (err error) {
+	mgr, span := mgr.startSpan(SpanCreate)
+	defer func() { endSpan(span, err) }()
+
+	err = mgr.create(item, nil)
+	if err != nil {
+		return err
+	}
+
+	span.SetAttributes(AttributeItemID.Int(int(item.ID)))
+	return nil
+}
+
+// create stores a new ToDoItemEntity owned by the principal of the manager's context, recording
+// the creation in the revision history, the audit log and the webhook outbox. The within function, if any, runs in
+// the same transaction once the item has been stored. Observers are notified once the
+// transaction has been committed.
+func (mgr *ToDoEntityManager) create(item *entities.ToDoItemEntity, within func(tx *gorm.DB) error) error {
+	if principal := reqctx.PrincipalFrom(mgr.ctx); principal != nil {
+		item.OwnerID = principal.Subject
+		item.OwnerEmail = principal.Email
+	}
+
+	err := mgr.checkParent(0, item.ParentID)
+	if err != nil {
+		return err
+	}
+
+	err = mgr.orm.Transaction(func(tx *gorm.DB) error {
+		err := startSeries(tx, item)
+		if err != nil {
+			return err
+		}
+
+		err = mgr.insert(tx, item)
+		if err != nil || within == nil {
+			return err
+		}
+
+		return within(tx)
+	})
+	if err != nil {
+		return err
+	}
+
+	mgr.notify(entities.RevisionCreate, nil, item, nil)
+	return nil
+}
+
+// insert stores a new ToDoItemEntity within a transaction, recording the creation in the
+// revision history, the audit log and the webhook outbox.
+func (mgr *ToDoEntityManager) insert(tx *gorm.DB, item *entities.ToDoItemEntity) error {
+	err := tx.Create(item).Error
+	if err != nil {
+		return err
+	}
+
+	err = recordRevision(mgr.ctx, tx, entities.RevisionCreate, item)
+	if err != nil {
+		return err
+	}
+
+	err = recordAudit(mgr.ctx, tx, entities.AuditItemCreate, item.ID, nil, item)
+	if err != nil {
+		return err
+	}
+
+	return recordWebhooks(tx, entities.RevisionCreate, nil, item)
 }
 
 // Delete a ToDoItemEntity from the database by its ID.
 //
+// Items with subtasks are not deleted; see DeleteWith.
+//
 // Parameters:
 // - id: the ID of the ToDoItemEntity to be deleted.
 //
 // Returns:
 // - error: an error if the deletion operation fails.
 func (mgr *ToDoEntityManager) Delete(id uint) error {
-	return mgr.orm.Delete(&entities.ToDoItemEntity{}, id).Error
+	return mgr.DeleteWith(id, DeleteBlock)
+}
+
+// DeleteWith deletes a ToDoItemEntity from the database by its ID, applying a rule to its subtasks.
+//
+// Only the owner of an item may delete it, orphaning requires ownership of every subtask moved
+// to the top level, and cascading deletions require ownership of every deleted subtask. Any
+// shares of the deleted items are removed as well.
+// Every deletion, and every subtask moved to the top level, is recorded in the revision
+// history and the audit log, and deletions are queued for delivery to webhook subscriptions.
+//
+// Parameters:
+// - id: the ID of the ToDoItemEntity to be deleted.
+// - rule: what happens to the subtasks of the item.
+//
+// Returns:
+// - error: ErrConflict if the rule blocks the deletion of an item with subtasks, ErrForbidden if
+// a subtask may not be orphaned or deleted, or an error if the deletion operation fails.
+func (mgr *ToDoEntityManager) DeleteWith(id uint, rule DeleteRule) (err error) {
+	mgr, span := mgr.startSpan(SpanDelete, AttributeItemID.Int(int(id)), AttributeDeleteRule.String(string(rule)))
+	defer func() { endSpan(span, err) }()
+
+	item, err := mgr.FineOne(int(id))
+	if err != nil {
+		return err
+	}
+
+	if !mgr.canManage(item) {
+		return ErrForbidden
+	}
+
+	var changes []itemChange
+	err = mgr.orm.Transaction(func(tx *gorm.DB) error {
+		detached, err := mgr.detachSubtasks(tx, item, rule)
+		if err != nil {
+			return err
+		}
+
+		audience, err := mgr.remove(tx, item)
+		if err != nil {
+			return err
+		}
+
+		changes = append(detached, itemChange{action: entities.RevisionDelete, before: item, audience: audience})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, change := range changes {
+		mgr.notify(change.action, change.before, change.after, change.audience)
+	}
+	return nil
+}
+
+// remove deletes a ToDoItemEntity and its shares within a transaction, recording the deletion
+// in the revision history, the audit log and the webhook outbox.
+//
+// It returns the audience of the item as of its deletion.
+func (mgr *ToDoEntityManager) remove(tx *gorm.DB, item *entities.ToDoItemEntity) (*ItemAudience, error) {
+	// Subscribers and the audience are determined by the shares of the item, which are
+	// removed along with it
+	err := recordWebhooks(tx, entities.RevisionDelete, item, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var shares []entities.ToDoShareEntity
+	err = tx.Where("item_id = ?", item.ID).Order("id asc").Find(&shares).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var audience *ItemAudience
+	if len(mgr.audienceObservers) > 0 {
+		audience = newAudience(item, shares)
+	}
+
+	err = tx.Where("item_id = ?", item.ID).Delete(&entities.ToDoShareEntity{}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Delete(&entities.ToDoItemEntity{}, item.ID).Error
+	if err != nil {
+		return nil, err
+	}
+
+	err = recordDeletion(mgr.ctx, tx, item, shares)
+	if err != nil {
+		return nil, err
+	}
+
+	return audience, recordAudit(mgr.ctx, tx, entities.AuditItemDelete, item.ID, item, nil)
 }
 
 // FindAll retrieves all ToDoItemEntity objects from the database based on the provided paging configuration.
 //
+// Only items visible to the principal of the manager's context are returned.
 // The function accepts optional PagingConfigurator arguments to configure the pagination of the results.
 // It returns a slice of ToDoItemEntity objects and an error if any occurred.
 func (mgr *ToDoEntityManager) FindAll(configurators ...PagingConfigurator) ([]entities.ToDoItemEntity, int64, error) {
-	var count int64
+	return mgr.FindMatching(ItemFilter{}, configurators...)
+}
+
+// FindMatching retrieves the ToDoItemEntity objects matching a filter based on the provided paging configuration.
+//
+// Only items visible to the principal of the manager's context are returned.
+// It takes the filter and optional PagingConfigurator arguments to configure the pagination of the results.
+// It returns a slice of ToDoItemEntity objects, the total number of matching items and an error if any occurred.
+func (mgr *ToDoEntityManager) FindMatching(filter ItemFilter, configurators ...PagingConfigurator) (items []entities.ToDoItemEntity, count int64, err error) {
+	attributes := pageAttributes(configurators)
+	if !filter.IsZero() {
+		attributes = append(attributes, AttributeFilter.String(filter.String()))
+	}
+
+	mgr, span := mgr.startSpan(SpanFindAll, attributes...)
+	defer func() { endSpan(span, err) }()
 
-	err := mgr.orm.Model(&entities.ToDoItemEntity{}).Count(&count).Error
+	err = mgr.orm.Model(&entities.ToDoItemEntity{}).Scopes(mgr.visibleItems, filter.scope).Count(&count).Error
 	if err != nil {
 		return nil, 0, err
 	}
 
-	var items []entities.ToDoItemEntity
-	err = mgr.orm.Scopes(Paginate(configurators...)).Order("id asc").Find(&items).Error
+	err = mgr.orm.Scopes(mgr.visibleItems, filter.scope, Paginate(configurators...)).Order("id asc").Find(&items).Error
 	if err != nil {
 		return nil, 0, err
 	}
 
+	span.SetAttributes(AttributeResultCount.Int(len(items)), AttributeTotalCount.Int64(count))
 	return items, count, nil
 }
 
@@ -70,11 +279,15 @@ func (mgr *ToDoEntityManager) FindAll(configurators ...PagingConfigurator) ([]en
 // It takes an integer `id` as a parameter.
 // The function retrieves a ToDoItemEntity with the given `id` from the database using the `mgr.orm.First` method.
 // If the retrieval is successful, it returns a pointer to the retrieved ToDoItemEntity and a `nil` error.
-// If an error occurs during the retrieval, it returns a `nil` ToDoItemEntity and the error encountered.
-func (mgr *ToDoEntityManager) FineOne(id int) (*entities.ToDoItemEntity, error) {
+// If an error occurs during the retrieval, or the item is not visible to the principal of the manager's context,
+// it returns a `nil` ToDoItemEntity and the error encountered.
+func (mgr *ToDoEntityManager) FineOne(id int) (_ *entities.ToDoItemEntity, err error) {
+	mgr, span := mgr.startSpan(SpanFindOne, AttributeItemID.Int(id))
+	defer func() { endSpan(span, err) }()
+
 	var item entities.ToDoItemEntity
 
-	err := mgr.orm.First(&item, id).Error
+	err = mgr.orm.Scopes(mgr.visibleItems).First(&item, id).Error
 	if err != nil {
 		return nil, err
 	}
@@ -82,12 +295,136 @@ func (mgr *ToDoEntityManager) FineOne(id int) (*entities.ToDoItemEntity, error)
 	return &item, nil
 }
 
+// Update saves the modifiable fields of an existing ToDoItemEntity.
+//
+// The owner of the item and principals holding an editor share may update it.
+// The completion timestamp is maintained automatically when the completion state changes.
+// The update is recorded in the revision history and the audit log. Completing the item is
+// queued for delivery to webhook subscriptions, and creates the next occurrence of its series,
+// if any. The recurrence of the item is left unchanged; see UpdateFuture. So is its parent; see Move.
+// The passed item is refreshed with the stored state on success.
+//
+// It takes a pointer to a ToDoItemEntity as a parameter.
+// It returns an error if the item does not exist, the caller lacks permission or the update fails.
+func (mgr *ToDoEntityManager) Update(item *entities.ToDoItemEntity) (err error) {
+	mgr, span := mgr.startSpan(SpanUpdate, AttributeItemID.Int(int(item.ID)))
+	defer func() { endSpan(span, err) }()
+
+	_, err = mgr.findEditable(item.ID)
+	if err != nil {
+		return err
+	}
+
+	updated, err := mgr.save(item.ID, updateColumns, entities.RevisionUpdate, entities.AuditItemUpdate, func(tx *gorm.DB, updated *entities.ToDoItemEntity) error {
+		switch {
+		case item.Completed && !updated.Completed:
+			updated.CompletedAt = time.Now()
+		case !item.Completed:
+			updated.CompletedAt = time.Time{}
+		}
+
+		updated.Description = item.Description
+		updated.Completed = item.Completed
+		updated.DueDate = item.DueDate
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	*item = *updated
+	return nil
+}
+
+// findEditable retrieves a ToDoItemEntity the principal of the manager's context may update.
+//
+// It returns ErrForbidden if the item is visible but the principal lacks permission to update it.
+func (mgr *ToDoEntityManager) findEditable(id uint) (*entities.ToDoItemEntity, error) {
+	existing, err := mgr.FineOne(int(id))
+	if err != nil {
+		return nil, err
+	}
+
+	switch mgr.permissionOn(existing) {
+	case entities.PermissionOwner, entities.PermissionEditor:
+		return existing, nil
+	}
+
+	return nil, ErrForbidden
+}
+
+// Columns of a ToDoItemEntity written by Update and Revert
+var updateColumns = []string{"description", "completed", "completed_at", "due_date"}
+
+// save stores a change to a ToDoItemEntity, recording it in the revision history, the audit log
+// and the webhook outbox within the same transaction. Completing an occurrence of a series creates
+// the next occurrence in the same transaction. Observers are notified once the transaction has
+// been committed.
+//
+// The item is read and locked within the transaction, so that the change function applies to its
+// current state, and only the listed columns are written, so that concurrent changes to other
+// fields, such as the parent of the item, are kept. The change function may run further queries
+// within the transaction.
+//
+// It returns the stored item, or ErrNotFound if the item has been deleted.
+func (mgr *ToDoEntityManager) save(id uint, columns []string, revisionAction string, auditAction string, change func(tx *gorm.DB, item *entities.ToDoItemEntity) error) (*entities.ToDoItemEntity, error) {
+	var before, updated entities.ToDoItemEntity
+	var next *entities.ToDoItemEntity
+	err := mgr.orm.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&before, id).Error
+		if err != nil {
+			return err
+		}
+
+		updated = before
+		err = change(tx, &updated)
+		if err != nil {
+			return err
+		}
+
+		err = tx.Model(&updated).Select(columns).Updates(&updated).Error
+		if err != nil {
+			return err
+		}
+
+		err = recordRevision(mgr.ctx, tx, revisionAction, &updated)
+		if err != nil {
+			return err
+		}
+
+		err = recordAudit(mgr.ctx, tx, auditAction, updated.ID, &before, &updated)
+		if err != nil {
+			return err
+		}
+
+		err = recordWebhooks(tx, revisionAction, &before, &updated)
+		if err != nil || updated.SeriesID == 0 || !updated.Completed || before.Completed {
+			return err
+		}
+
+		next, err = mgr.continueSeries(tx, &updated)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	mgr.notify(revisionAction, &before, &updated, nil)
+	if next != nil {
+		mgr.notify(entities.RevisionCreate, nil, next, nil)
+	}
+	return &updated, nil
+}
+
 // WithContext returns a new ToDoEntityManager with the provided context.
 //
+// The principal carried by the context, if any, determines which items are visible
+// and which operations are permitted.
+//
 // ctx context.Context
 // *ToDoEntityManager
 func (mgr *ToDoEntityManager) WithContext(ctx context.Context) *ToDoEntityManager {
-	return &ToDoEntityManager{orm: mgr.orm.WithContext(ctx)}
+	return &ToDoEntityManager{orm: mgr.orm.WithContext(ctx), ctx: ctx, observers: mgr.observers, audienceObservers: mgr.audienceObservers, tracer: mgr.tracer}
 }
 
 // New creates a new instance of ToDoEntityManager.
@@ -98,5 +435,5 @@ func (mgr *ToDoEntityManager) WithContext(ctx context.Context) *ToDoEntityManage
 // Returns:
 // - A pointer to a ToDoEntityManager object.
 func New(orm *gorm.DB) *ToDoEntityManager {
-	return &ToDoEntityManager{orm: orm}
+	return &ToDoEntityManager{orm: orm, ctx: context.Background()}
 }
@@ -0,0 +1,126 @@
+package persistence
+
+import (
+	"errors"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"todo-api-go/reqctx"
+)
+
+// Name of the tracer creating the spans of this package
+const tracerName = "todo-api-go/persistence"
+
+// Names of the spans of the ToDoEntityManager operations
+const (
+	SpanCreate      = "todo.create"
+	SpanDelete      = "todo.delete"
+	SpanFindAll     = "todo.find_all"
+	SpanFindOne     = "todo.find_one"
+	SpanUpdate      = "todo.update"
+	SpanFindHistory = "todo.find_history"
+	SpanFindAsOf    = "todo.find_as_of"
+	SpanRevert      = "todo.revert"
+	SpanFindShares  = "todo.find_shares"
+	SpanShare       = "todo.share"
+	SpanUnshare     = "todo.unshare"
+	SpanCountOpen   = "todo.count_open"
+	SpanExport      = "todo.export"
+	SpanImport      = "todo.import"
+
+	SpanFindChanges          = "todo.find_changes"
+	SpanUpdateSince          = "todo.update_since"
+	SpanUpdateFuture         = "todo.update_future"
+	SpanFindCalendarObject   = "todo.find_calendar_object"
+	SpanCreateCalendarObject = "todo.create_calendar_object"
+	SpanFindChildren         = "todo.find_children"
+	SpanProgress             = "todo.progress"
+	SpanMove                 = "todo.move"
+	SpanFindAudience         = "todo.find_audience"
+)
+
+// Attributes of the spans of the ToDoEntityManager operations
+const (
+	AttributeItemID      = attribute.Key("todo.item.id")
+	AttributeRevision    = attribute.Key("todo.revision")
+	AttributePageOffset  = attribute.Key("todo.page.offset")
+	AttributePageSize    = attribute.Key("todo.page.size")
+	AttributeResultCount = attribute.Key("todo.result.count")
+	AttributeTotalCount  = attribute.Key("todo.total.count")
+	AttributeTenant      = attribute.Key("todo.tenant")
+	AttributeFilter      = attribute.Key("todo.filter")
+	AttributeDryRun      = attribute.Key("todo.import.dry_run")
+	AttributeCreated     = attribute.Key("todo.import.created")
+	AttributeDuplicates  = attribute.Key("todo.import.duplicates")
+	AttributeFailed      = attribute.Key("todo.import.failed")
+	AttributeSyncToken   = attribute.Key("todo.sync.token")
+	AttributeChanged     = attribute.Key("todo.sync.changed")
+	AttributeDeleted     = attribute.Key("todo.sync.deleted")
+	AttributeConflicts   = attribute.Key("todo.sync.conflicts")
+	AttributeObjectName  = attribute.Key("todo.calendar.object")
+	AttributeParentID    = attribute.Key("todo.item.parent_id")
+	AttributeDeleteRule  = attribute.Key("todo.delete.rule")
+)
+
+// Tracer returns the tracer creating the spans of the manager's operations.
+//
+// Unless a tracer has been set, it is a tracer of the global tracer provider at the time of the call.
+func (mgr *ToDoEntityManager) Tracer() trace.Tracer {
+	if mgr.tracer != nil {
+		return mgr.tracer
+	}
+
+	return otel.Tracer(tracerName)
+}
+
+// SetTracer replaces the tracer creating the spans of the manager's operations, which defaults
+// to a tracer of the global tracer provider. Setting nil restores the default. It applies to the
+// managers derived from the manager with WithContext afterwards.
+//
+// Like observers, the tracer is meant to be set during startup or in tests, before the manager is used.
+func (mgr *ToDoEntityManager) SetTracer(tracer trace.Tracer) {
+	mgr.tracer = tracer
+}
+
+// startSpan starts a span of an operation as a child of the span in the manager's context.
+//
+// The span carries the tenant of the principal of the manager's context in addition to the
+// specified attributes. It returns a manager whose context carries the span, so that the
+// queries of the operation, and the operations it calls, become its children.
+func (mgr *ToDoEntityManager) startSpan(name string, attributes ...attribute.KeyValue) (*ToDoEntityManager, trace.Span) {
+	if principal := reqctx.PrincipalFrom(mgr.ctx); principal != nil && principal.Tenant != "" {
+		attributes = append(attributes, AttributeTenant.String(principal.Tenant))
+	}
+
+	ctx, span := mgr.Tracer().Start(mgr.ctx, name, trace.WithAttributes(attributes...))
+	return mgr.WithContext(ctx), span
+}
+
+// endSpan ends the span of an operation, recording the error the operation failed with.
+//
+// Errors caused by the caller, such as missing items or permissions, are recorded as events
+// only, while any other error also sets the status of the span to error.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+
+		if !errors.Is(err, ErrNotFound) && !errors.Is(err, ErrForbidden) && !errors.Is(err, ErrInvalid) {
+			span.SetStatus(codes.Error, err.Error())
+		}
+	}
+
+	span.End()
+}
+
+// pageAttributes describes the page requested by the PagingConfigurator functions.
+func pageAttributes(configurators []PagingConfigurator) []attribute.KeyValue {
+	options := pagingOptions(configurators...)
+
+	return []attribute.KeyValue{
+		AttributePageOffset.Int(options.Offset),
+		AttributePageSize.Int(options.Limit),
+	}
+}
@@ -0,0 +1,114 @@
+package persistence_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"todo-api-go/entities"
+	"todo-api-go/persistence"
+	"todo-api-go/reqctx"
+	"todo-api-go/testsupport"
+)
+
+func TestFindAllSpan(t *testing.T) {
+	assert := assert.New(t)
+
+	telemetry := testsupport.InstallTestTelemetry(t)
+	mgr := testsupport.CreateTestManager(t)
+	ctx := reqctx.WithPrincipal(context.Background(), &reqctx.Principal{Tenant: "acme", Roles: []string{persistence.RoleAdmin}})
+
+	_, _, err := mgr.WithContext(ctx).FindAll(func(options *persistence.PagingOptions) {
+		options.Offset = 2
+		options.Limit = 5
+	})
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	span := telemetry.AssertSpan(persistence.SpanFindAll,
+		persistence.AttributePageOffset.Int(2),
+		persistence.AttributePageSize.Int(5),
+		persistence.AttributeResultCount.Int(5),
+		persistence.AttributeTotalCount.Int64(10),
+		persistence.AttributeTenant.String("acme"))
+	if span != nil {
+		assert.Equal(codes.Unset, span.Status.Code)
+	}
+}
+
+func TestCreateSpan(t *testing.T) {
+	assert := assert.New(t)
+
+	telemetry := testsupport.InstallTestTelemetry(t)
+	mgr := testsupport.CreateTestManager(t)
+
+	item := &entities.ToDoItemEntity{Description: "Traced"}
+	err := mgr.Create(item)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	telemetry.AssertSpan(persistence.SpanCreate, persistence.AttributeItemID.Int(int(item.ID)))
+}
+
+func TestSpanErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	telemetry := testsupport.InstallTestTelemetry(t)
+	mgr := testsupport.CreateTestManager(t)
+
+	_, err := mgr.FineOne(100)
+	assert.ErrorIs(err, persistence.ErrNotFound)
+
+	span := telemetry.AssertSpan(persistence.SpanFindOne, persistence.AttributeItemID.Int(100))
+	if span != nil {
+		assert.Equalf(codes.Unset, span.Status.Code, "missing items should not mark the span as failed")
+		assert.Lenf(span.Events, 1, "the error should be recorded")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, _, err = mgr.WithContext(ctx).FindAll()
+	assert.NotNilf(err, "query with a canceled context should fail")
+
+	span = telemetry.AssertSpan(persistence.SpanFindAll)
+	if span != nil {
+		assert.Equalf(codes.Error, span.Status.Code, "unexpected errors should mark the span as failed")
+	}
+}
+
+func TestNestedSpans(t *testing.T) {
+	assert := assert.New(t)
+
+	telemetry := testsupport.InstallTestTelemetry(t)
+	mgr := testsupport.CreateTestManager(t)
+
+	err := mgr.Delete(1)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	deleteSpan := telemetry.AssertSpan(persistence.SpanDelete)
+	findSpan := telemetry.AssertSpan(persistence.SpanFindOne)
+	if deleteSpan != nil && findSpan != nil {
+		assert.Equalf(deleteSpan.SpanContext.SpanID(), findSpan.Parent.SpanID(), "lookup should be a child of the deletion")
+	}
+}
+
+func TestSetTracer(t *testing.T) {
+	assert := assert.New(t)
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	mgr := testsupport.CreateTestManager(t)
+	mgr.SetTracer(provider.Tracer("test"))
+
+	_, err := mgr.WithContext(context.Background()).FineOne(1)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	ended := recorder.Ended()
+	if assert.Lenf(ended, 1, "derived managers should use the tracer") {
+		assert.Equal(persistence.SpanFindOne, ended[0].Name())
+	}
+}
@@ -0,0 +1,213 @@
+package persistence
+
+import (
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"gorm.io/gorm"
+
+	"todo-api-go/entities"
+)
+
+// Outcomes of importing an item
+const (
+	// The item has been created
+	ImportCreated = "created"
+
+	// The item is valid and would be created, but the import is a dry run
+	ImportAccepted = "accepted"
+
+	// The item matches an existing item or an item imported before, and has been skipped
+	ImportDuplicate = "duplicate"
+
+	// The item is invalid and has been skipped
+	ImportInvalid = "invalid"
+)
+
+// Number of items loaded at once while exporting
+const exportBatchSize = 100
+
+// Number of descriptions looked up at once while detecting duplicates
+const duplicateLookupSize = 500
+
+// ImportOutcome describes the outcome of importing an item.
+type ImportOutcome struct {
+	// One of ImportCreated, ImportAccepted, ImportDuplicate or ImportInvalid
+	Status string
+
+	// ID of the created item
+	ID uint `json:",omitempty"`
+
+	// ID of the existing item the item duplicates, if it is a duplicate of an existing item
+	DuplicateOf uint `json:",omitempty"`
+
+	// Reason why the item is invalid
+	Error string `json:",omitempty"`
+}
+
+// itemKey identifies items that are considered duplicates of each other: items with the same
+// description, ignoring case and surrounding whitespace, and the same due date.
+type itemKey struct {
+	description string
+	due         int64
+}
+
+// keyOf returns the duplicate detection key of an item.
+func keyOf(item *entities.ToDoItemEntity) itemKey {
+	return itemKey{
+		description: strings.ToLower(strings.TrimSpace(item.Description)),
+		due:         item.DueDate.Truncate(time.Second).Unix(),
+	}
+}
+
+// Export passes every ToDoItemEntity matching a filter to a visitor function, in the order of their IDs.
+//
+// Only items visible to the principal of the manager's context are exported. Items are loaded in
+// batches, so that exports of any size can be streamed without holding all items in memory.
+//
+// It takes the filter and the visitor function, which stops the export by returning an error.
+// It returns the error of the visitor function or the query, if any occurred.
+func (mgr *ToDoEntityManager) Export(filter ItemFilter, visit func(item *entities.ToDoItemEntity) error) (err error) {
+	var attributes []attribute.KeyValue
+	if !filter.IsZero() {
+		attributes = append(attributes, AttributeFilter.String(filter.String()))
+	}
+
+	mgr, span := mgr.startSpan(SpanExport, attributes...)
+	defer func() { endSpan(span, err) }()
+
+	exported := 0
+	var batch []entities.ToDoItemEntity
+	err = mgr.orm.Scopes(mgr.visibleItems, filter.scope).FindInBatches(&batch, exportBatchSize, func(tx *gorm.DB, _ int) error {
+		for i := range batch {
+			err := visit(&batch[i])
+			if err != nil {
+				return err
+			}
+			exported++
+		}
+
+		return nil
+	}).Error
+
+	span.SetAttributes(AttributeResultCount.Int(exported))
+	return err
+}
+
+// Import creates ToDoItemEntity objects, skipping invalid items and duplicates.
+//
+// An item is a duplicate if an item with the same description, ignoring case, and the same due
+// date is visible to the principal of the manager's context, or appears earlier in the import.
+// Items are created one by one, like Create does, so that every item is owned by the principal
+// and recorded in the revision history and the audit log. The completion timestamp of completed
+// items defaults to the time of the import.
+//
+// In a dry run, items are validated and checked for duplicates, but not created.
+//
+// It takes the items to import and whether the import is a dry run.
+// It returns the outcome of every item, in the order of the items, and an error if the import
+// failed. Items imported before the failure remain created.
+func (mgr *ToDoEntityManager) Import(items []entities.ToDoItemEntity, dryRun bool) (outcomes []ImportOutcome, err error) {
+	mgr, span := mgr.startSpan(SpanImport, AttributeDryRun.Bool(dryRun))
+	defer func() { endSpan(span, err) }()
+
+	existing, err := mgr.existingKeys(items)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := map[string]int{}
+	imported := map[itemKey]bool{}
+	outcomes = make([]ImportOutcome, len(items))
+
+	defer func() {
+		span.SetAttributes(
+			AttributeCreated.Int(counts[ImportCreated]+counts[ImportAccepted]),
+			AttributeDuplicates.Int(counts[ImportDuplicate]),
+			AttributeFailed.Int(counts[ImportInvalid]))
+	}()
+
+	now := time.Now()
+	for i := range items {
+		item := items[i]
+		key := keyOf(&item)
+
+		switch {
+		case key.description == "":
+			outcomes[i] = ImportOutcome{Status: ImportInvalid, Error: "description is required"}
+
+		case existing[key] != 0:
+			outcomes[i] = ImportOutcome{Status: ImportDuplicate, DuplicateOf: existing[key]}
+
+		case imported[key]:
+			outcomes[i] = ImportOutcome{Status: ImportDuplicate}
+
+		case dryRun:
+			outcomes[i] = ImportOutcome{Status: ImportAccepted}
+
+		default:
+			created := entities.ToDoItemEntity{
+				Description: strings.TrimSpace(item.Description),
+				Completed:   item.Completed,
+				DueDate:     item.DueDate,
+			}
+			if created.Completed {
+				created.CompletedAt = item.CompletedAt
+				if created.CompletedAt.IsZero() {
+					created.CompletedAt = now
+				}
+			}
+
+			err = mgr.Create(&created)
+			if err != nil {
+				return outcomes[:i], err
+			}
+			outcomes[i] = ImportOutcome{Status: ImportCreated, ID: created.ID}
+		}
+
+		counts[outcomes[i].Status]++
+		if outcomes[i].Status != ImportInvalid {
+			imported[key] = true
+		}
+	}
+
+	return outcomes, nil
+}
+
+// existingKeys looks up the visible items sharing their description with any of the specified
+// items, and returns their IDs keyed by their duplicate detection key.
+func (mgr *ToDoEntityManager) existingKeys(items []entities.ToDoItemEntity) (map[itemKey]uint, error) {
+	seen := map[string]bool{}
+	var descriptions []string
+	for i := range items {
+		description := keyOf(&items[i]).description
+		if description != "" && !seen[description] {
+			seen[description] = true
+			descriptions = append(descriptions, description)
+		}
+	}
+
+	existing := map[itemKey]uint{}
+	for start := 0; start < len(descriptions); start += duplicateLookupSize {
+		end := min(start+duplicateLookupSize, len(descriptions))
+
+		var candidates []entities.ToDoItemEntity
+		err := mgr.orm.Scopes(mgr.visibleItems).
+			Where("LOWER(TRIM(description)) IN ?", descriptions[start:end]).
+			Order("id asc").
+			Find(&candidates).Error
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range candidates {
+			key := keyOf(&candidates[i])
+			if existing[key] == 0 {
+				existing[key] = candidates[i].ID
+			}
+		}
+	}
+
+	return existing, nil
+}
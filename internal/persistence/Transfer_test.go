@@ -0,0 +1,121 @@
+package persistence_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"todo-api-go/entities"
+	"todo-api-go/persistence"
+	"todo-api-go/testsupport"
+)
+
+func TestFindMatching(t *testing.T) {
+	assert := assert.New(t)
+
+	mgr := testsupport.CreateTestManager(t)
+
+	err := mgr.Update(&entities.ToDoItemEntity{ID: 3, Description: "Done 100%", Completed: true, DueDate: testsupport.ParseTestDate("2024-06-01")})
+	assert.Nilf(err, "error should be nil, not %s", err)
+	err = mgr.Create(&entities.ToDoItemEntity{Description: "Someday"})
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	completed := true
+	items, total, err := mgr.FindMatching(persistence.ItemFilter{Completed: &completed})
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf(int64(1), total, "total should only count matching items")
+	assert.Equalf([]uint{3}, testsupport.CollectIds(items), "IDs should match")
+
+	items, _, err = mgr.FindMatching(persistence.ItemFilter{DueBefore: testsupport.ParseTestDate("2024-12-31")})
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf([]uint{3}, testsupport.CollectIds(items), "items without due date should not be due")
+
+	items, _, err = mgr.FindMatching(persistence.ItemFilter{DueAfter: testsupport.ParseTestDate("2025-01-01")})
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Lenf(items, 9, "items due at the bound should match")
+
+	items, _, err = mgr.FindMatching(persistence.ItemFilter{Search: "ITEM 1"})
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf([]uint{2}, testsupport.CollectIds(items), "search should ignore case")
+
+	items, _, err = mgr.FindMatching(persistence.ItemFilter{Search: "0%"})
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf([]uint{3}, testsupport.CollectIds(items), "wildcards should be matched literally")
+}
+
+func TestExport(t *testing.T) {
+	assert := assert.New(t)
+
+	mgr := testsupport.CreateTestManager(t)
+	for i := 0; i < 150; i++ {
+		err := mgr.Create(&entities.ToDoItemEntity{Description: "Bulk"})
+		assert.Nilf(err, "error should be nil, not %s", err)
+	}
+
+	var ids []uint
+	err := mgr.Export(persistence.ItemFilter{}, func(item *entities.ToDoItemEntity) error {
+		ids = append(ids, item.ID)
+		return nil
+	})
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Lenf(ids, 160, "all items should be exported across batches")
+	assert.Equalf(uint(1), ids[0], "items should be exported in ID order")
+	assert.Equalf(uint(160), ids[159], "items should be exported in ID order")
+
+	ids = nil
+	err = mgr.Export(persistence.ItemFilter{Search: "todo"}, func(item *entities.ToDoItemEntity) error {
+		ids = append(ids, item.ID)
+		return nil
+	})
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Lenf(ids, 10, "only matching items should be exported")
+
+	stop := errors.New("stop")
+	err = mgr.Export(persistence.ItemFilter{}, func(item *entities.ToDoItemEntity) error {
+		return stop
+	})
+	assert.ErrorIsf(err, stop, "errors of the visitor should stop the export")
+}
+
+func TestImport(t *testing.T) {
+	assert := assert.New(t)
+
+	mgr := testsupport.CreateTestManager(t)
+	due := testsupport.ParseTestDate("2025-01-01")
+
+	items := []entities.ToDoItemEntity{
+		{Description: "Imported", DueDate: due, Completed: true},
+		{Description: " "},
+		{Description: "todo item 4", DueDate: due},
+		{Description: "IMPORTED ", DueDate: due},
+		{Description: "Todo Item 4", DueDate: testsupport.ParseTestDate("2025-02-01")},
+	}
+
+	outcomes, err := mgr.Import(items, true)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf([]persistence.ImportOutcome{
+		{Status: persistence.ImportAccepted},
+		{Status: persistence.ImportInvalid, Error: "description is required"},
+		{Status: persistence.ImportDuplicate, DuplicateOf: 5},
+		{Status: persistence.ImportDuplicate},
+		{Status: persistence.ImportAccepted},
+	}, outcomes, "outcomes should match")
+
+	_, total, _ := mgr.FindAll()
+	assert.Equalf(int64(10), total, "dry runs should not create items")
+
+	outcomes, err = mgr.Import(items, false)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf(persistence.ImportCreated, outcomes[0].Status, "item should be created")
+	assert.Equalf(persistence.ImportCreated, outcomes[4].Status, "item should be created")
+
+	created, err := mgr.FineOne(int(outcomes[0].ID))
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf("Imported", created.Description, "description should be trimmed")
+	assert.Falsef(created.CompletedAt.IsZero(), "completion time should default to the import")
+
+	outcomes, err = mgr.Import(items[:1], false)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf(persistence.ImportDuplicate, outcomes[0].Status, "imported items should be duplicates afterwards")
+}
@@ -0,0 +1,556 @@
+package persistence
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"todo-api-go/entities"
+	"todo-api-go/reqctx"
+)
+
+// Prefix identifying the signing secrets of webhook subscriptions
+const WebhookSecretPrefix = "whsec_"
+
+// WebhookPayload is the body of a webhook delivery.
+type WebhookPayload struct {
+	// One of entities.WebhookEvents
+	Event string
+
+	// When the event occurred; for overdue items, when the item became overdue
+	OccurredAt time.Time
+
+	// The item as of the event
+	Data entities.ToDoItemEntity
+}
+
+// DeliveryFilter restricts the deliveries returned by FindDeliveries. Zero fields match all deliveries.
+type DeliveryFilter struct {
+	SubscriptionID uint
+	Status         string
+}
+
+// WebhookDeliveryLog is a delivery together with the log of its attempts.
+type WebhookDeliveryLog struct {
+	entities.WebhookDeliveryEntity
+
+	// Attempts to deliver, oldest first
+	Log []entities.WebhookAttemptEntity
+}
+
+// PendingDelivery is a delivery claimed for an attempt, together with its subscription.
+type PendingDelivery struct {
+	Delivery     entities.WebhookDeliveryEntity
+	Subscription entities.WebhookSubscriptionEntity
+}
+
+type WebhookManager struct {
+	orm *gorm.DB
+	ctx context.Context
+
+	// Networks deliveries may reach despite being internal
+	allowedNetworks Networks
+}
+
+// NewWebhookManager creates a new instance of WebhookManager.
+//
+// Deliveries are queued by the ToDoEntityManager in the transactions of its mutating operations,
+// forming an outbox that is drained by a dispatcher through the WebhookManager.
+//
+// Parameters:
+// - orm: A pointer to a gorm.DB object representing the underlying GORM ORM instance.
+//
+// Returns:
+// - A pointer to a WebhookManager object.
+func NewWebhookManager(orm *gorm.DB) *WebhookManager {
+	return &WebhookManager{orm: orm, ctx: context.Background()}
+}
+
+// Create registers a webhook subscription owned by the principal of the manager's context.
+//
+// A signing secret is generated for the subscription, and the subscription is active.
+//
+// It takes a pointer to a WebhookSubscriptionEntity holding the URL, events and description.
+// The passed subscription is refreshed with the stored state, including its secret, on success.
+// It returns ErrInvalid if the URL or events are not acceptable, and an error if the creation failed.
+func (mgr *WebhookManager) Create(subscription *entities.WebhookSubscriptionEntity) error {
+	if principal := reqctx.PrincipalFrom(mgr.ctx); principal != nil {
+		subscription.OwnerID = principal.Subject
+		subscription.Tenant = principal.Tenant
+	}
+
+	err := mgr.validateSubscription(subscription)
+	if err != nil {
+		return err
+	}
+
+	subscription.Secret, err = generateWebhookSecret()
+	if err != nil {
+		return err
+	}
+
+	subscription.ID = 0
+	subscription.Active = true
+
+	return mgr.orm.Create(subscription).Error
+}
+
+// FindAll retrieves the webhook subscriptions owned by the principal of the manager's context.
+//
+// Internal callers without a principal retrieve all subscriptions.
+// It returns a slice of WebhookSubscriptionEntity objects and an error if any occurred.
+func (mgr *WebhookManager) FindAll() ([]entities.WebhookSubscriptionEntity, error) {
+	var subscriptions []entities.WebhookSubscriptionEntity
+	err := mgr.orm.Scopes(mgr.ownedSubscriptions).Order("id asc").Find(&subscriptions).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return subscriptions, nil
+}
+
+// FindOne retrieves a webhook subscription owned by the principal of the manager's context.
+//
+// It takes the ID of the subscription as a parameter.
+// It returns the WebhookSubscriptionEntity and an error if it does not exist or is not owned by the principal.
+func (mgr *WebhookManager) FindOne(id uint) (*entities.WebhookSubscriptionEntity, error) {
+	var subscription entities.WebhookSubscriptionEntity
+	err := mgr.orm.Scopes(mgr.ownedSubscriptions).First(&subscription, id).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &subscription, nil
+}
+
+// Update saves the URL, events, description and activation of a webhook subscription owned by
+// the principal of the manager's context. Deliveries of inactive subscriptions are held back
+// until the subscription is activated again.
+//
+// It takes a pointer to a WebhookSubscriptionEntity, which is refreshed with the stored state on success.
+// It returns an error if the subscription does not exist, the changes are not acceptable or the update failed.
+func (mgr *WebhookManager) Update(subscription *entities.WebhookSubscriptionEntity) error {
+	existing, err := mgr.FindOne(subscription.ID)
+	if err != nil {
+		return err
+	}
+
+	existing.URL = subscription.URL
+	existing.Events = subscription.Events
+	existing.Description = subscription.Description
+	existing.Active = subscription.Active
+
+	err = mgr.validateSubscription(existing)
+	if err != nil {
+		return err
+	}
+
+	err = mgr.orm.Save(existing).Error
+	if err != nil {
+		return err
+	}
+
+	*subscription = *existing
+	return nil
+}
+
+// Delete removes a webhook subscription owned by the principal of the manager's context,
+// together with its deliveries and their logs.
+//
+// It takes the ID of the subscription as a parameter.
+// It returns an error if the subscription does not exist or the deletion failed.
+func (mgr *WebhookManager) Delete(id uint) error {
+	subscription, err := mgr.FindOne(id)
+	if err != nil {
+		return err
+	}
+
+	return mgr.orm.Transaction(func(tx *gorm.DB) error {
+		deliveries := tx.Model(&entities.WebhookDeliveryEntity{}).Select("id").Where("subscription_id = ?", subscription.ID)
+
+		err := tx.Where("delivery_id IN (?)", deliveries).Delete(&entities.WebhookAttemptEntity{}).Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Where("subscription_id = ?", subscription.ID).Delete(&entities.WebhookDeliveryEntity{}).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Delete(subscription).Error
+	})
+}
+
+// FindDeliveries retrieves the deliveries of the webhook subscriptions owned by the principal
+// of the manager's context, newest first. Filtering by entities.DeliveryDead yields the
+// dead-letter view of the deliveries that have been given up.
+//
+// It takes the filter and optional PagingConfigurator arguments.
+// It returns a slice of WebhookDeliveryEntity objects, the total number of matching deliveries and an error if any occurred.
+func (mgr *WebhookManager) FindDeliveries(filter DeliveryFilter, configurators ...PagingConfigurator) ([]entities.WebhookDeliveryEntity, int64, error) {
+	scope := func(db *gorm.DB) *gorm.DB {
+		db = db.Scopes(mgr.ownedDeliveries)
+		if filter.SubscriptionID != 0 {
+			db = db.Where("subscription_id = ?", filter.SubscriptionID)
+		}
+		if filter.Status != "" {
+			db = db.Where("status = ?", filter.Status)
+		}
+		return db
+	}
+
+	var count int64
+	err := mgr.orm.Model(&entities.WebhookDeliveryEntity{}).Scopes(scope).Count(&count).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var deliveries []entities.WebhookDeliveryEntity
+	err = mgr.orm.Scopes(scope, Paginate(configurators...)).Order("id desc").Find(&deliveries).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return deliveries, count, nil
+}
+
+// FindDelivery retrieves a delivery of a webhook subscription owned by the principal of the
+// manager's context, together with the log of its attempts.
+//
+// It takes the ID of the delivery as a parameter.
+// It returns the WebhookDeliveryLog and an error if the delivery does not exist or is not owned by the principal.
+func (mgr *WebhookManager) FindDelivery(id uint) (*WebhookDeliveryLog, error) {
+	var log WebhookDeliveryLog
+	err := mgr.orm.Scopes(mgr.ownedDeliveries).First(&log.WebhookDeliveryEntity, id).Error
+	if err != nil {
+		return nil, err
+	}
+
+	err = mgr.orm.Where("delivery_id = ?", id).Order("attempt asc").Find(&log.Log).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &log, nil
+}
+
+// Retry queues a dead delivery of a webhook subscription owned by the principal of the
+// manager's context for another round of attempts. Retrying a pending delivery has no effect.
+//
+// It takes the ID of the delivery as a parameter.
+// It returns the WebhookDeliveryEntity and ErrInvalid if it has been delivered already.
+func (mgr *WebhookManager) Retry(id uint) (*entities.WebhookDeliveryEntity, error) {
+	var delivery entities.WebhookDeliveryEntity
+	err := mgr.orm.Scopes(mgr.ownedDeliveries).First(&delivery, id).Error
+	if err != nil {
+		return nil, err
+	}
+
+	switch delivery.Status {
+	case entities.DeliveryDelivered:
+		return nil, fmt.Errorf("%w: the delivery has been delivered already", ErrInvalid)
+	case entities.DeliveryPending:
+		return &delivery, nil
+	}
+
+	delivery.Status = entities.DeliveryPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = time.Now()
+
+	err = mgr.orm.Model(&delivery).Select("status", "attempts", "next_attempt_at").Updates(&delivery).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &delivery, nil
+}
+
+// ClaimDue claims pending deliveries of active subscriptions that are due for an attempt,
+// oldest first.
+//
+// Claiming counts the attempt and postpones the next attempt by the lease, so that concurrent
+// dispatchers skip the delivery, and the delivery is retried if the dispatcher fails to record
+// the outcome of the attempt.
+//
+// It takes the current time, the maximum number of deliveries to claim and the lease.
+// It returns the claimed deliveries with their subscriptions and an error if any occurred.
+func (mgr *WebhookManager) ClaimDue(now time.Time, limit int, lease time.Duration) ([]PendingDelivery, error) {
+	active := mgr.orm.Model(&entities.WebhookSubscriptionEntity{}).Select("id").Where("active = ?", true)
+
+	var due []entities.WebhookDeliveryEntity
+	err := mgr.orm.Where("status = ? AND next_attempt_at <= ? AND subscription_id IN (?)", entities.DeliveryPending, now, active).
+		Order("next_attempt_at asc").
+		Limit(limit).
+		Find(&due).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var claimed []entities.WebhookDeliveryEntity
+	var subscriptionIDs []uint
+	for i := range due {
+		result := mgr.orm.Model(&entities.WebhookDeliveryEntity{}).
+			Where("id = ? AND status = ? AND attempts = ?", due[i].ID, entities.DeliveryPending, due[i].Attempts).
+			Updates(map[string]any{"attempts": due[i].Attempts + 1, "next_attempt_at": now.Add(lease)})
+		if result.Error != nil {
+			return nil, result.Error
+		}
+
+		// Another dispatcher claimed the delivery first
+		if result.RowsAffected == 0 {
+			continue
+		}
+
+		due[i].Attempts++
+		due[i].NextAttemptAt = now.Add(lease)
+		claimed = append(claimed, due[i])
+		if !slices.Contains(subscriptionIDs, due[i].SubscriptionID) {
+			subscriptionIDs = append(subscriptionIDs, due[i].SubscriptionID)
+		}
+	}
+
+	if len(claimed) == 0 {
+		return nil, nil
+	}
+
+	var subscriptions []entities.WebhookSubscriptionEntity
+	err = mgr.orm.Find(&subscriptions, subscriptionIDs).Error
+	if err != nil {
+		return nil, err
+	}
+
+	pending := make([]PendingDelivery, 0, len(claimed))
+	for i := range claimed {
+		for j := range subscriptions {
+			if subscriptions[j].ID == claimed[i].SubscriptionID {
+				pending = append(pending, PendingDelivery{Delivery: claimed[i], Subscription: subscriptions[j]})
+			}
+		}
+	}
+
+	return pending, nil
+}
+
+// RecordAttempt logs an attempt of a claimed delivery and stores the resulting state of the
+// delivery: its status, next attempt, last error and delivery time.
+//
+// The state is not stored if the delivery has been claimed again since, because the lease
+// expired before the attempt completed.
+//
+// It takes the delivery as updated by the dispatcher and the attempt.
+// It returns an error if any occurred.
+func (mgr *WebhookManager) RecordAttempt(delivery *entities.WebhookDeliveryEntity, attempt *entities.WebhookAttemptEntity) error {
+	return mgr.orm.Transaction(func(tx *gorm.DB) error {
+		attempt.DeliveryID = delivery.ID
+		attempt.Attempt = delivery.Attempts
+
+		err := tx.Create(attempt).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Model(&entities.WebhookDeliveryEntity{}).
+			Where("id = ? AND attempts = ?", delivery.ID, delivery.Attempts).
+			Select("status", "next_attempt_at", "last_error", "delivered_at").
+			Updates(delivery).Error
+	})
+}
+
+// EnqueueOverdue queues the todo.overdue event of the open items that became overdue within a
+// period of time, across all owners.
+//
+// Every item is queued once per due date, so that the period may overlap with the periods of
+// earlier calls, and with those of other dispatchers.
+//
+// It takes the start of the period, exclusive, and its end.
+// It returns the number of queued deliveries and an error if any occurred.
+func (mgr *WebhookManager) EnqueueOverdue(since time.Time, now time.Time) (int, error) {
+	queued := 0
+
+	var batch []entities.ToDoItemEntity
+	err := mgr.orm.Where("completed = ? AND due_date > ? AND due_date <= ?", false, since, now).
+		FindInBatches(&batch, exportBatchSize, func(tx *gorm.DB, _ int) error {
+			for i := range batch {
+				item := &batch[i]
+				count, err := enqueueWebhooks(mgr.orm, entities.WebhookItemOverdue, item, item.DueDate, func(subscription *entities.WebhookSubscriptionEntity) string {
+					return fmt.Sprintf("%s:%d:%d:%d", entities.WebhookItemOverdue, subscription.ID, item.ID, item.DueDate.Unix())
+				})
+				if err != nil {
+					return err
+				}
+				queued += count
+			}
+
+			return nil
+		}).Error
+
+	return queued, err
+}
+
+// WithContext returns a new WebhookManager with the provided context.
+//
+// ctx context.Context
+// *WebhookManager
+func (mgr *WebhookManager) WithContext(ctx context.Context) *WebhookManager {
+	return &WebhookManager{orm: mgr.orm.WithContext(ctx), ctx: ctx, allowedNetworks: mgr.allowedNetworks}
+}
+
+// ownedSubscriptions is a scope restricting a WebhookSubscriptionEntity query to the
+// subscriptions owned by the principal of the manager's context.
+func (mgr *WebhookManager) ownedSubscriptions(db *gorm.DB) *gorm.DB {
+	principal := reqctx.PrincipalFrom(mgr.ctx)
+	if principal == nil {
+		return db
+	}
+
+	return db.Where("owner_id = ?", principal.Subject)
+}
+
+// ownedDeliveries is a scope restricting a WebhookDeliveryEntity query to the deliveries of
+// the subscriptions owned by the principal of the manager's context.
+func (mgr *WebhookManager) ownedDeliveries(db *gorm.DB) *gorm.DB {
+	if reqctx.PrincipalFrom(mgr.ctx) == nil {
+		return db
+	}
+
+	owned := mgr.orm.Model(&entities.WebhookSubscriptionEntity{}).Select("id").Scopes(mgr.ownedSubscriptions)
+	return db.Where("subscription_id IN (?)", owned)
+}
+
+// recordWebhooks queues the webhook deliveries of a change of a ToDoItemEntity in the outbox,
+// within the transaction of the change.
+//
+// Items created and deleted yield the todo.created and todo.deleted events, and items whose
+// completion state changes to completed yield the todo.completed event.
+func recordWebhooks(tx *gorm.DB, action string, before *entities.ToDoItemEntity, after *entities.ToDoItemEntity) error {
+	var event string
+	var item *entities.ToDoItemEntity
+
+	switch {
+	case action == entities.RevisionCreate:
+		event, item = entities.WebhookItemCreated, after
+	case action == entities.RevisionDelete:
+		event, item = entities.WebhookItemDeleted, before
+	case after != nil && after.Completed && (before == nil || !before.Completed):
+		event, item = entities.WebhookItemCompleted, after
+	default:
+		return nil
+	}
+
+	_, err := enqueueWebhooks(tx, event, item, time.Now(), nil)
+	return err
+}
+
+// enqueueWebhooks queues a delivery of an event for every active subscription to the event
+// whose owner may see the item: subscriptions of the owner of the item and of users the item
+// is shared with directly. Shares with groups are not considered, as group memberships are only
+// known during requests. Items without owner are only delivered to the subscriptions created by
+// internal callers, as the roles of the owners of subscriptions are not known either.
+//
+// If a deduplication key function is given, deliveries whose key has been queued before are skipped.
+// It returns the number of queued deliveries.
+func enqueueWebhooks(tx *gorm.DB, event string, item *entities.ToDoItemEntity, occurred time.Time, dedupKey func(subscription *entities.WebhookSubscriptionEntity) string) (int, error) {
+	query := tx.Where("active = ?", true)
+	if item.OwnerID == "" {
+		query = query.Where("(owner_id IS NULL OR owner_id = '')")
+	} else {
+		grantees := tx.Model(&entities.ToDoShareEntity{}).
+			Select("grantee_id").
+			Where("item_id = ? AND grantee_type = ?", item.ID, entities.GranteeUser)
+		query = query.Where("owner_id = ? OR owner_id IN (?)", item.OwnerID, grantees)
+	}
+
+	var subscriptions []entities.WebhookSubscriptionEntity
+	err := query.Find(&subscriptions).Error
+	if err != nil {
+		return 0, err
+	}
+
+	payload, err := json.Marshal(WebhookPayload{Event: event, OccurredAt: occurred, Data: *item})
+	if err != nil {
+		return 0, err
+	}
+
+	queued := 0
+	for i := range subscriptions {
+		if !slices.Contains(subscriptions[i].Events, event) {
+			continue
+		}
+
+		delivery := entities.WebhookDeliveryEntity{
+			SubscriptionID: subscriptions[i].ID,
+			Event:          event,
+			ItemID:         item.ID,
+			Payload:        payload,
+			Status:         entities.DeliveryPending,
+			NextAttemptAt:  time.Now(),
+		}
+
+		create := tx
+		if dedupKey != nil {
+			key := dedupKey(&subscriptions[i])
+			delivery.DedupKey = &key
+			create = tx.Clauses(clause.OnConflict{DoNothing: true})
+		}
+
+		result := create.Create(&delivery)
+		if result.Error != nil {
+			return queued, result.Error
+		}
+		queued += int(result.RowsAffected)
+	}
+
+	return queued, nil
+}
+
+// validateSubscription checks the URL and events of a subscription, removing duplicate events.
+// The host of the URL must not resolve to an internal address; see CheckAddress.
+func (mgr *WebhookManager) validateSubscription(subscription *entities.WebhookSubscriptionEntity) error {
+	target, err := url.Parse(subscription.URL)
+	if err != nil || (target.Scheme != "https" && target.Scheme != "http") || target.Hostname() == "" {
+		return fmt.Errorf("%w: the URL must be an absolute http or https URL", ErrInvalid)
+	}
+
+	err = mgr.checkHost(mgr.ctx, target.Hostname())
+	if err != nil {
+		return err
+	}
+
+	if len(subscription.Events) == 0 {
+		return fmt.Errorf("%w: at least one event is required", ErrInvalid)
+	}
+
+	var events []string
+	for _, event := range subscription.Events {
+		if !slices.Contains(entities.WebhookEvents, event) {
+			return fmt.Errorf("%w: unknown event %q, expected one of %s", ErrInvalid, event, strings.Join(entities.WebhookEvents, ", "))
+		}
+		if !slices.Contains(events, event) {
+			events = append(events, event)
+		}
+	}
+	subscription.Events = events
+
+	return nil
+}
+
+// generateWebhookSecret generates a new random signing secret with 256 bits of entropy.
+func generateWebhookSecret() (string, error) {
+	random := make([]byte, 32)
+	_, err := rand.Read(random)
+	if err != nil {
+		return "", err
+	}
+
+	return WebhookSecretPrefix + base64.RawURLEncoding.EncodeToString(random), nil
+}
@@ -0,0 +1,256 @@
+package persistence_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"todo-api-go/entities"
+	"todo-api-go/persistence"
+	"todo-api-go/testsupport"
+)
+
+func TestWebhookSubscriptions(t *testing.T) {
+	assert := assert.New(t)
+
+	webhooks := persistence.NewWebhookManager(testsupport.CreateTestDatabase(t))
+	alice := webhooks.WithContext(principalContext("alice"))
+	bob := webhooks.WithContext(principalContext("bob"))
+
+	subscription := &entities.WebhookSubscriptionEntity{
+		URL:    "https://example.com/hook",
+		Events: []string{entities.WebhookItemCreated, entities.WebhookItemCreated},
+	}
+	err := alice.Create(subscription)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf("alice", subscription.OwnerID, "owner should be the creating principal")
+	assert.Equalf([]string{entities.WebhookItemCreated}, subscription.Events, "events should be deduplicated")
+	assert.Truef(subscription.Active, "subscription should be active")
+	assert.Containsf(subscription.Secret, persistence.WebhookSecretPrefix, "secret should be generated")
+
+	_, err = bob.FindOne(subscription.ID)
+	assert.ErrorIsf(err, persistence.ErrNotFound, "subscriptions of other principals should not be found")
+
+	err = alice.Create(&entities.WebhookSubscriptionEntity{URL: "ftp://example.com", Events: []string{entities.WebhookItemCreated}})
+	assert.ErrorIsf(err, persistence.ErrInvalid, "non-http URLs should be rejected")
+
+	err = alice.Create(&entities.WebhookSubscriptionEntity{URL: "https://example.com", Events: []string{"todo.renamed"}})
+	assert.ErrorIsf(err, persistence.ErrInvalid, "unknown events should be rejected")
+
+	update := &entities.WebhookSubscriptionEntity{ID: subscription.ID, URL: "https://example.com/other", Events: []string{entities.WebhookItemDeleted}}
+	err = alice.Update(update)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Falsef(update.Active, "subscription should be deactivated")
+	assert.Equalf(subscription.Secret, update.Secret, "secret should be kept")
+
+	err = bob.Delete(subscription.ID)
+	assert.ErrorIsf(err, persistence.ErrNotFound, "subscriptions of other principals should not be deleted")
+
+	err = alice.Delete(subscription.ID)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	found, err := alice.FindAll()
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Emptyf(found, "subscription should be deleted")
+
+	for _, internal := range []string{"http://127.0.0.1:8080/hook", "http://169.254.169.254/latest/meta-data", "http://10.0.0.1/hook", "http://[::1]/hook"} {
+		err = alice.Create(&entities.WebhookSubscriptionEntity{URL: internal, Events: []string{entities.WebhookItemCreated}})
+		assert.ErrorIsf(err, persistence.ErrInvalid, "internal addresses like %s should be rejected", internal)
+	}
+
+	var allowed persistence.Networks
+	err = allowed.Decode("10.0.0.0/8")
+	assert.Nilf(err, "error should be nil, not %s", err)
+	webhooks.AllowNetworks(allowed)
+
+	err = webhooks.WithContext(principalContext("alice")).Create(&entities.WebhookSubscriptionEntity{URL: "http://10.0.0.1/hook", Events: []string{entities.WebhookItemCreated}})
+	assert.Nilf(err, "allowed networks should be accepted, not %s", err)
+}
+
+func TestWebhookOutbox(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testsupport.CreateTestDatabase(t)
+	items := persistence.New(db).WithContext(principalContext("alice"))
+	webhooks := persistence.NewWebhookManager(db)
+	alice := webhooks.WithContext(principalContext("alice"))
+	bob := webhooks.WithContext(principalContext("bob"))
+
+	err := alice.Create(&entities.WebhookSubscriptionEntity{URL: "https://example.com/alice", Events: entities.WebhookEvents})
+	assert.Nilf(err, "error should be nil, not %s", err)
+	err = bob.Create(&entities.WebhookSubscriptionEntity{URL: "https://example.com/bob", Events: entities.WebhookEvents})
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	item := &entities.ToDoItemEntity{Description: "hooked"}
+	err = items.Create(item)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	// Changes other than the completion do not yield events
+	item.Description = "renamed"
+	err = items.Update(item)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	item.Completed = true
+	err = items.Update(item)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	err = items.Delete(item.ID)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	deliveries, total, err := alice.FindDeliveries(persistence.DeliveryFilter{})
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf(int64(3), total, "total should be 3")
+	if assert.Equalf(3, len(deliveries), "length should be 3") {
+		assert.Equalf(entities.WebhookItemDeleted, deliveries[0].Event, "newest delivery should be first")
+		assert.Equalf(entities.WebhookItemCompleted, deliveries[1].Event, "completion should be delivered")
+		assert.Equalf(entities.WebhookItemCreated, deliveries[2].Event, "creation should be delivered")
+		assert.Equalf(entities.DeliveryPending, deliveries[2].Status, "deliveries should be pending")
+
+		var payload persistence.WebhookPayload
+		err = json.Unmarshal(deliveries[1].Payload, &payload)
+		assert.Nilf(err, "error should be nil, not %s", err)
+		assert.Equalf(entities.WebhookItemCompleted, payload.Event, "payload should name the event")
+		assert.Equalf("renamed", payload.Data.Description, "payload should hold the item")
+	}
+
+	_, total, err = bob.FindDeliveries(persistence.DeliveryFilter{})
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf(int64(0), total, "items of other principals should not be delivered")
+}
+
+func TestWebhookDeliveryAttempts(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testsupport.CreateTestDatabase(t)
+	items := persistence.New(db).WithContext(principalContext("alice"))
+	webhooks := persistence.NewWebhookManager(db)
+	alice := webhooks.WithContext(principalContext("alice"))
+
+	subscription := &entities.WebhookSubscriptionEntity{URL: "https://example.com/alice", Events: []string{entities.WebhookItemCreated}}
+	err := alice.Create(subscription)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	err = items.Create(&entities.ToDoItemEntity{Description: "hooked"})
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	now := time.Now().Add(time.Second)
+	pending, err := webhooks.ClaimDue(now, 10, time.Minute)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	if !assert.Equalf(1, len(pending), "length should be 1") {
+		return
+	}
+	assert.Equalf(1, pending[0].Delivery.Attempts, "claim should count the attempt")
+	assert.Equalf(subscription.Secret, pending[0].Subscription.Secret, "subscription should be loaded")
+
+	claimed, err := webhooks.ClaimDue(now, 10, time.Minute)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Emptyf(claimed, "claimed deliveries should not be claimed again within the lease")
+
+	delivery := &pending[0].Delivery
+	delivery.Status = entities.DeliveryDead
+	delivery.LastError = "unexpected status 500"
+	err = webhooks.RecordAttempt(delivery, &entities.WebhookAttemptEntity{StatusCode: 500, Error: delivery.LastError})
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	dead, total, err := alice.FindDeliveries(persistence.DeliveryFilter{Status: entities.DeliveryDead})
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf(int64(1), total, "total should be 1")
+	assert.Equalf([]uint{delivery.ID}, collectDeliveryIds(dead), "dead delivery should be listed")
+
+	log, err := alice.FindDelivery(delivery.ID)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	if assert.Equalf(1, len(log.Log), "length should be 1") {
+		assert.Equalf(500, log.Log[0].StatusCode, "status code should be logged")
+		assert.Equalf(1, log.Log[0].Attempt, "attempt should be numbered")
+	}
+
+	_, err = webhooks.WithContext(principalContext("bob")).FindDelivery(delivery.ID)
+	assert.ErrorIsf(err, persistence.ErrNotFound, "deliveries of other principals should not be found")
+
+	retried, err := alice.Retry(delivery.ID)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf(entities.DeliveryPending, retried.Status, "retried delivery should be pending")
+	assert.Equalf(0, retried.Attempts, "attempts should be reset")
+
+	pending, err = webhooks.ClaimDue(now, 10, time.Minute)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	if assert.Equalf(1, len(pending), "retried delivery should be due") {
+		delivery = &pending[0].Delivery
+		delivery.Status = entities.DeliveryDelivered
+		delivery.DeliveredAt = now
+		err = webhooks.RecordAttempt(delivery, &entities.WebhookAttemptEntity{StatusCode: 204})
+		assert.Nilf(err, "error should be nil, not %s", err)
+	}
+
+	_, err = alice.Retry(delivery.ID)
+	assert.ErrorIsf(err, persistence.ErrInvalid, "delivered deliveries should not be retried")
+}
+
+func TestWebhookInactiveSubscriptions(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testsupport.CreateTestDatabase(t)
+	items := persistence.New(db).WithContext(principalContext("alice"))
+	webhooks := persistence.NewWebhookManager(db)
+	alice := webhooks.WithContext(principalContext("alice"))
+
+	subscription := &entities.WebhookSubscriptionEntity{URL: "https://example.com/alice", Events: []string{entities.WebhookItemCreated}}
+	err := alice.Create(subscription)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	err = items.Create(&entities.ToDoItemEntity{Description: "queued"})
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	subscription.Active = false
+	err = alice.Update(subscription)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	err = items.Create(&entities.ToDoItemEntity{Description: "not queued"})
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	_, total, err := alice.FindDeliveries(persistence.DeliveryFilter{SubscriptionID: subscription.ID})
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf(int64(1), total, "inactive subscriptions should not be queued")
+
+	pending, err := webhooks.ClaimDue(time.Now().Add(time.Second), 10, time.Minute)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Emptyf(pending, "deliveries of inactive subscriptions should be held back")
+}
+
+func TestEnqueueOverdue(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testsupport.CreateTestDatabase(t)
+	items := persistence.New(db).WithContext(principalContext("alice"))
+	webhooks := persistence.NewWebhookManager(db)
+	alice := webhooks.WithContext(principalContext("alice"))
+
+	err := alice.Create(&entities.WebhookSubscriptionEntity{URL: "https://example.com/alice", Events: []string{entities.WebhookItemOverdue}})
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	now := time.Now()
+	err = items.Create(&entities.ToDoItemEntity{Description: "overdue", DueDate: now.Add(-time.Hour)})
+	assert.Nilf(err, "error should be nil, not %s", err)
+	err = items.Create(&entities.ToDoItemEntity{Description: "done", DueDate: now.Add(-time.Hour), Completed: true})
+	assert.Nilf(err, "error should be nil, not %s", err)
+	err = items.Create(&entities.ToDoItemEntity{Description: "due", DueDate: now.Add(time.Hour)})
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	queued, err := webhooks.EnqueueOverdue(now.Add(-2*time.Hour), now)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf(1, queued, "open items that became overdue should be queued")
+
+	queued, err = webhooks.EnqueueOverdue(now.Add(-3*time.Hour), now)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf(0, queued, "overdue items should be queued once")
+}
+
+func collectDeliveryIds(deliveries []entities.WebhookDeliveryEntity) []uint {
+	ids := make([]uint, 0, len(deliveries))
+	for i := range deliveries {
+		ids = append(ids, deliveries[i].ID)
+	}
+	return ids
+}
@@ -0,0 +1,117 @@
+package persistence
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/kelseyhightower/envconfig"
+	"gorm.io/gorm"
+)
+
+type WebhookParameters struct {
+	// Private, loopback and link-local networks webhooks may nevertheless be delivered to,
+	// as comma separated CIDR blocks, for example "10.1.0.0/16,127.0.0.1/32"
+	AllowedNetworks Networks `split_words:"true"`
+}
+
+// Networks is a list of IP networks, decoded from comma separated CIDR blocks.
+type Networks []*net.IPNet
+
+// Decode implements envconfig.Decoder.
+func (networks *Networks) Decode(value string) error {
+	parsed := Networks{}
+	for _, block := range strings.Split(value, ",") {
+		if strings.TrimSpace(block) == "" {
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(strings.TrimSpace(block))
+		if err != nil {
+			return fmt.Errorf("invalid network %q: %w", block, err)
+		}
+		parsed = append(parsed, network)
+	}
+
+	*networks = parsed
+	return nil
+}
+
+// Contains reports whether one of the networks contains the IP address.
+func (networks Networks) Contains(ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// NewWebhookManagerFromEnv creates a WebhookManager configured from the "WEBHOOK_***" environment variables.
+//
+// orm: A pointer to a gorm.DB object representing the underlying GORM ORM instance.
+// Returns a pointer to WebhookManager and an error.
+func NewWebhookManagerFromEnv(orm *gorm.DB) (*WebhookManager, error) {
+	var params WebhookParameters
+
+	err := envconfig.Process("webhook", &params)
+	if err != nil {
+		return nil, err
+	}
+
+	mgr := NewWebhookManager(orm)
+	mgr.AllowNetworks(params.AllowedNetworks)
+	return mgr, nil
+}
+
+// AllowNetworks allows webhooks to be delivered to private, loopback or link-local addresses
+// within the specified networks, which CheckAddress rejects otherwise. It applies to the
+// managers derived from the manager with WithContext afterwards.
+//
+// Like observers, the networks are meant to be allowed during startup or in tests, before the
+// manager is used.
+func (mgr *WebhookManager) AllowNetworks(networks Networks) {
+	mgr.allowedNetworks = networks
+}
+
+// CheckAddress checks that webhooks may be delivered to an IP address.
+//
+// Loopback, private, link-local, multicast and unspecified addresses are rejected unless they
+// belong to an allowed network, so that subscriptions can not be used to reach the services
+// next to the server, such as cloud metadata endpoints.
+// It returns ErrInvalid if the address is rejected.
+func (mgr *WebhookManager) CheckAddress(ip net.IP) error {
+	internal := ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified()
+	if ip == nil || internal && !mgr.allowedNetworks.Contains(ip) {
+		return fmt.Errorf("%w: webhooks can not be delivered to the address %s", ErrInvalid, ip)
+	}
+
+	return nil
+}
+
+// checkHost checks that webhooks may be delivered to the addresses of a host.
+//
+// Host names that can not be resolved are accepted, as they may resolve by the time deliveries
+// are attempted; dispatchers are expected to check the addresses they connect to as well.
+func (mgr *WebhookManager) checkHost(ctx context.Context, host string) error {
+	if ip := net.ParseIP(host); ip != nil {
+		return mgr.CheckAddress(ip)
+	}
+
+	addresses, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil
+	}
+
+	for _, address := range addresses {
+		err = mgr.CheckAddress(address.IP)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,140 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Result describes the state of a bucket after an attempt to take a token from it.
+type Result struct {
+	// Whether a token was available
+	Allowed bool
+
+	// Number of tokens left in the bucket
+	Remaining int
+
+	// Time until the bucket is full again
+	ResetAfter time.Duration
+
+	// Time until the next token becomes available, if the attempt was denied
+	RetryAfter time.Duration
+}
+
+// Backend stores token buckets.
+//
+// The in-memory backend limits clients per instance. Running several instances behind a
+// load balancer requires a shared backend, such as one backed by Redis, implementing this interface.
+type Backend interface {
+	// Take attempts to take a token from the bucket identified by key, creating the
+	// bucket according to the limit if necessary.
+	Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error)
+
+	// Refund returns a token taken from the bucket identified by key, for a request that
+	// has been denied by another bucket after all.
+	Refund(ctx context.Context, key string, limit Limit, now time.Time) error
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	full    time.Time
+}
+
+type MemoryBackend struct {
+	mutex     sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// Interval between removals of buckets that have been refilled completely
+const sweepInterval = time.Minute
+
+// NewMemoryBackend creates a Backend keeping the token buckets in memory.
+//
+// Returns a pointer to MemoryBackend.
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Take implements Backend by refilling the bucket according to the time passed since it
+// was last used and taking a token from it.
+func (backend *MemoryBackend) Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error) {
+	backend.mutex.Lock()
+	defer backend.mutex.Unlock()
+
+	backend.sweep(now)
+
+	rate := limit.Rate()
+	capacity := float64(limit.Burst)
+
+	b, ok := backend.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, updated: now}
+		backend.buckets[key] = b
+	}
+
+	elapsed := now.Sub(b.updated).Seconds()
+	if elapsed > 0 {
+		b.tokens = math.Min(capacity, b.tokens+elapsed*rate)
+		b.updated = now
+	}
+
+	result := Result{}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = secondsToDuration((1 - b.tokens) / rate)
+	}
+
+	result.Remaining = int(math.Floor(b.tokens))
+	result.ResetAfter = secondsToDuration((capacity - b.tokens) / rate)
+	b.full = now.Add(result.ResetAfter)
+
+	return result, nil
+}
+
+// Refund implements Backend by putting a token back into the bucket, without exceeding its capacity.
+func (backend *MemoryBackend) Refund(ctx context.Context, key string, limit Limit, now time.Time) error {
+	backend.mutex.Lock()
+	defer backend.mutex.Unlock()
+
+	b, ok := backend.buckets[key]
+	if !ok {
+		return nil
+	}
+
+	capacity := float64(limit.Burst)
+	b.tokens = math.Min(capacity, b.tokens+1)
+	b.full = b.full.Add(-secondsToDuration(1 / limit.Rate()))
+	if b.full.Before(now) {
+		b.full = now
+	}
+
+	return nil
+}
+
+// sweep removes the buckets that have been refilled completely, as they are
+// indistinguishable from new buckets.
+func (backend *MemoryBackend) sweep(now time.Time) {
+	if now.Sub(backend.lastSweep) < sweepInterval {
+		return
+	}
+
+	for key, b := range backend.buckets {
+		if !now.Before(b.full) {
+			delete(backend.buckets, key)
+		}
+	}
+
+	backend.lastSweep = now
+}
+
+// secondsToDuration converts fractional seconds into a time.Duration.
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
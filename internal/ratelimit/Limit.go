@@ -0,0 +1,117 @@
+package ratelimit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Units that may be used for the period of a Limit
+var periodUnits = map[string]time.Duration{
+	"s": time.Second,
+	"m": time.Minute,
+	"h": time.Hour,
+}
+
+// Limit describes a token bucket: Count requests per Period, with bursts of up to Burst requests.
+//
+// Limits are configured using the form "<count>/<unit>[:<burst>]", where the unit is one of
+// "s", "m" or "h". For example, "100/m:20" allows 100 requests per minute in bursts of at most
+// 20 requests. The burst defaults to the count.
+type Limit struct {
+	Count  int
+	Period time.Duration
+	Burst  int
+}
+
+// Rate returns the number of tokens added to the bucket per second.
+func (limit Limit) Rate() float64 {
+	return float64(limit.Count) / limit.Period.Seconds()
+}
+
+// String formats the limit in its configuration form.
+func (limit Limit) String() string {
+	for unit, period := range periodUnits {
+		if period == limit.Period {
+			return fmt.Sprintf("%d/%s:%d", limit.Count, unit, limit.Burst)
+		}
+	}
+
+	return fmt.Sprintf("%d/%s:%d", limit.Count, limit.Period, limit.Burst)
+}
+
+// Decode implements envconfig.Decoder by parsing the configuration form of a limit.
+func (limit *Limit) Decode(value string) error {
+	parsed, err := ParseLimit(value)
+	if err != nil {
+		return err
+	}
+
+	*limit = parsed
+	return nil
+}
+
+// ParseLimit parses a limit in the form "<count>/<unit>[:<burst>]".
+//
+// It returns the parsed Limit and an error if the value is malformed.
+func ParseLimit(value string) (Limit, error) {
+	rate, burstValue, hasBurst := strings.Cut(strings.TrimSpace(value), ":")
+
+	countValue, unit, ok := strings.Cut(rate, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("invalid limit %q: expected <count>/<unit>[:<burst>]", value)
+	}
+
+	count, err := strconv.Atoi(countValue)
+	if err != nil || count <= 0 {
+		return Limit{}, fmt.Errorf("invalid limit %q: count must be a positive number", value)
+	}
+
+	period, ok := periodUnits[unit]
+	if !ok {
+		return Limit{}, fmt.Errorf("invalid limit %q: unit must be one of s, m or h", value)
+	}
+
+	burst := count
+	if hasBurst {
+		burst, err = strconv.Atoi(burstValue)
+		if err != nil || burst <= 0 {
+			return Limit{}, fmt.Errorf("invalid limit %q: burst must be a positive number", value)
+		}
+	}
+
+	return Limit{Count: count, Period: period, Burst: burst}, nil
+}
+
+// Limits maps names, such as routes or roles, onto limits.
+//
+// Limits are configured using the form "<name>=<limit>;<name>=<limit>", for example
+// "GET /api/todo=10/s:20;POST /api/todo=1/s:5".
+type Limits map[string]Limit
+
+// Decode implements envconfig.Decoder by parsing the configuration form of named limits.
+func (limits *Limits) Decode(value string) error {
+	parsed := Limits{}
+
+	for _, entry := range strings.Split(value, ";") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+
+		name, limitValue, ok := strings.Cut(entry, "=")
+		if !ok {
+			return fmt.Errorf("invalid limit entry %q: expected <name>=<limit>", entry)
+		}
+
+		limit, err := ParseLimit(limitValue)
+		if err != nil {
+			return err
+		}
+
+		parsed[strings.TrimSpace(name)] = limit
+	}
+
+	*limits = parsed
+	return nil
+}
@@ -0,0 +1,211 @@
+package ratelimit
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kelseyhightower/envconfig"
+
+	"todo-api-go/reqctx"
+)
+
+type LimiterParameters struct {
+	// Whether requests are rate limited at all
+	Enabled bool `default:"true"`
+
+	// Limit applied per client across all routes
+	Default Limit `default:"600/m:100"`
+
+	// Limit applied per IP address to all requests before they are authorized, so that requests
+	// with missing or invalid credentials are limited as well
+	Address Limit `default:"1200/m:200"`
+
+	// Limits per client replacing the default limit for principals holding one of the roles.
+	// The most generous limit of the roles held by a principal applies.
+	Roles Limits
+
+	// Limits per client on individual routes, keyed by "<METHOD> <route>", for example
+	// "POST /api/todo". These apply in addition to the default or role limit.
+	Routes Limits
+}
+
+type Limiter struct {
+	params  LimiterParameters
+	backend Backend
+}
+
+// check is a single bucket a request has to take a token from.
+type check struct {
+	key   string
+	limit Limit
+}
+
+// NewFromEnv creates a Limiter configured from the "RATELIMIT_***" environment variables.
+//
+// backend: The backend storing the token buckets.
+// Returns a pointer to Limiter and an error.
+func NewFromEnv(backend Backend) (*Limiter, error) {
+	var params LimiterParameters
+
+	err := envconfig.Process("ratelimit", &params)
+	if err != nil {
+		return nil, err
+	}
+
+	return New(params, backend), nil
+}
+
+// New creates a Limiter with the specified parameters.
+//
+// params: The limits to apply.
+// backend: The backend storing the token buckets.
+// Returns a pointer to Limiter.
+func New(params LimiterParameters, backend Backend) *Limiter {
+	return &Limiter{
+		params:  params,
+		backend: backend,
+	}
+}
+
+// Middleware returns a gin.HandlerFunc enforcing the configured limits.
+//
+// Clients are identified by the subject of the request's principal, or by their IP address
+// for anonymous requests, so the middleware has to run after authorization. Every response
+// carries the RateLimit-* headers of the most restrictive limit; rejected requests receive
+// a 429 status with a Retry-After header. Tokens taken for a rejected request are refunded,
+// so that requests denied by a route limit do not count against the client limit.
+//
+// Backend failures are logged and let the request pass.
+func (limiter *Limiter) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limiter.enforce(c, limiter.checksFor(c))
+	}
+}
+
+// AddressMiddleware returns a gin.HandlerFunc enforcing the address limit, which has to run
+// before authorization, so that attempts to guess credentials are limited.
+//
+// Clients are identified by the IP address gin determines for the request, so the trusted
+// proxies of the engine have to be configured for addresses forwarded by proxies to be used.
+// Responses carry the same headers as with Middleware.
+func (limiter *Limiter) AddressMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limiter.enforce(c, []check{{key: "addr:" + c.ClientIP(), limit: limiter.params.Address}})
+	}
+}
+
+// enforce takes a token from every bucket of a request, aborting the request if one of them
+// is exhausted.
+func (limiter *Limiter) enforce(c *gin.Context, checks []check) {
+	if !limiter.params.Enabled {
+		c.Next()
+		return
+	}
+
+	now := time.Now()
+
+	var tightest *Result
+	var tightestLimit Limit
+	var taken []check
+	for _, check := range checks {
+		result, err := limiter.backend.Take(c.Request.Context(), check.key, check.limit, now)
+		if err != nil {
+			slog.WarnContext(c.Request.Context(), "rate limit backend failed", "error", err)
+			continue
+		}
+
+		if tightest == nil || !result.Allowed || result.Remaining < tightest.Remaining {
+			tightest = &result
+			tightestLimit = check.limit
+		}
+
+		if !result.Allowed {
+			limiter.refund(c, taken, now)
+			break
+		}
+		taken = append(taken, check)
+	}
+
+	if tightest == nil {
+		c.Next()
+		return
+	}
+
+	c.Header("RateLimit-Limit", strconv.Itoa(tightestLimit.Count))
+	c.Header("RateLimit-Remaining", strconv.Itoa(tightest.Remaining))
+	c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(tightest.ResetAfter)))
+	c.Header("RateLimit-Policy", policyOf(checks))
+
+	if !tightest.Allowed {
+		c.Header("Retry-After", strconv.Itoa(ceilSeconds(tightest.RetryAfter)))
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+			"error": "rate limit exceeded",
+		})
+		return
+	}
+
+	c.Next()
+}
+
+// refund returns the tokens taken for a request that has been denied by a later bucket.
+func (limiter *Limiter) refund(c *gin.Context, taken []check, now time.Time) {
+	for _, check := range taken {
+		err := limiter.backend.Refund(c.Request.Context(), check.key, check.limit, now)
+		if err != nil {
+			slog.WarnContext(c.Request.Context(), "rate limit backend failed", "error", err)
+		}
+	}
+}
+
+// checksFor determines the buckets a request has to take a token from: the client bucket
+// governed by the default or role limit and, if configured, the bucket of the route.
+func (limiter *Limiter) checksFor(c *gin.Context) []check {
+	principal := reqctx.PrincipalFrom(c.Request.Context())
+
+	client := "ip:" + c.ClientIP()
+	if principal != nil && principal.Subject != "" {
+		client = "sub:" + principal.Subject
+	}
+
+	limit := limiter.params.Default
+	if principal != nil {
+		found := false
+		for _, role := range principal.Roles {
+			roleLimit, ok := limiter.params.Roles[role]
+			if ok && (!found || roleLimit.Rate() > limit.Rate()) {
+				limit = roleLimit
+				found = true
+			}
+		}
+	}
+
+	checks := []check{{key: client, limit: limit}}
+
+	route := c.Request.Method + " " + c.FullPath()
+	if routeLimit, ok := limiter.params.Routes[route]; ok {
+		checks = append(checks, check{key: route + "|" + client, limit: routeLimit})
+	}
+
+	return checks
+}
+
+// policyOf formats the RateLimit-Policy header describing the limits of a request.
+func policyOf(checks []check) string {
+	policies := make([]string, 0, len(checks))
+	for _, check := range checks {
+		policies = append(policies, fmt.Sprintf("%d;w=%d", check.limit.Count, ceilSeconds(check.limit.Period)))
+	}
+
+	return strings.Join(policies, ", ")
+}
+
+// ceilSeconds rounds a duration up to whole seconds.
+func ceilSeconds(duration time.Duration) int {
+	return int(math.Ceil(duration.Seconds()))
+}
@@ -0,0 +1,182 @@
+package ratelimit_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"todo-api-go/ratelimit"
+	"todo-api-go/reqctx"
+)
+
+func TestParseLimit(t *testing.T) {
+	assert := assert.New(t)
+
+	limit, err := ratelimit.ParseLimit("100/m:20")
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf(ratelimit.Limit{Count: 100, Period: time.Minute, Burst: 20}, limit, "limits should match")
+
+	limit, err = ratelimit.ParseLimit("5/s")
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf(5, limit.Burst, "burst should default to the count")
+
+	_, err = ratelimit.ParseLimit("5/d")
+	assert.NotNilf(err, "unknown units should be rejected")
+
+	var limits ratelimit.Limits
+	err = limits.Decode("GET /api/todo/:id=10/s:20;admin=1/h")
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf(ratelimit.Limit{Count: 10, Period: time.Second, Burst: 20}, limits["GET /api/todo/:id"], "route limits should match")
+	assert.Equalf(ratelimit.Limit{Count: 1, Period: time.Hour, Burst: 1}, limits["admin"], "role limits should match")
+}
+
+func TestMemoryBackend(t *testing.T) {
+	assert := assert.New(t)
+
+	backend := ratelimit.NewMemoryBackend()
+	limit := ratelimit.Limit{Count: 1, Period: time.Second, Burst: 2}
+	now := time.Now()
+
+	result, _ := backend.Take(context.Background(), "client", limit, now)
+	assert.Truef(result.Allowed, "first request should be allowed")
+	assert.Equalf(1, result.Remaining, "one token should remain")
+
+	result, _ = backend.Take(context.Background(), "client", limit, now)
+	assert.Truef(result.Allowed, "burst should be allowed")
+
+	result, _ = backend.Take(context.Background(), "client", limit, now)
+	assert.Falsef(result.Allowed, "exhausted bucket should deny")
+	assert.Equalf(time.Second, result.RetryAfter, "next token should arrive after a second")
+
+	result, _ = backend.Take(context.Background(), "other", limit, now)
+	assert.Truef(result.Allowed, "buckets should be kept per key")
+
+	result, _ = backend.Take(context.Background(), "client", limit, now.Add(time.Second))
+	assert.Truef(result.Allowed, "bucket should be refilled over time")
+}
+
+func TestMiddleware(t *testing.T) {
+	assert := assert.New(t)
+
+	limiter := ratelimit.New(ratelimit.LimiterParameters{
+		Enabled: true,
+		Default: ratelimit.Limit{Count: 2, Period: time.Hour, Burst: 2},
+		Roles:   ratelimit.Limits{"admin": {Count: 100, Period: time.Hour, Burst: 100}},
+		Routes:  ratelimit.Limits{"POST /limited": {Count: 1, Period: time.Hour, Burst: 1}},
+	}, ratelimit.NewMemoryBackend())
+
+	router := makeRouter(limiter)
+
+	recorder := makeRequest(router, "GET", "/open", "alice")
+	assert.Equalf(200, recorder.Code, "Expected successful response")
+	assert.Equalf("2", recorder.Header().Get("RateLimit-Limit"), "limit header should be set")
+	assert.Equalf("1", recorder.Header().Get("RateLimit-Remaining"), "remaining header should be set")
+
+	recorder = makeRequest(router, "GET", "/open", "alice")
+	assert.Equalf(200, recorder.Code, "Expected successful response")
+
+	recorder = makeRequest(router, "GET", "/open", "alice")
+	assert.Equalf(429, recorder.Code, "Expected too many requests response")
+	assert.Equalf("1800", recorder.Header().Get("Retry-After"), "retry after header should be set")
+
+	recorder = makeRequest(router, "GET", "/open", "bob")
+	assert.Equalf(200, recorder.Code, "clients should be limited independently")
+
+	recorder = makeRequest(router, "GET", "/open", "")
+	assert.Equalf(200, recorder.Code, "anonymous clients should be limited by address")
+
+	for i := 0; i < 5; i++ {
+		recorder = makeRequest(router, "GET", "/open", "root")
+		assert.Equalf(200, recorder.Code, "role limits should replace the default limit")
+	}
+
+	recorder = makeRequest(router, "POST", "/limited", "root")
+	assert.Equalf(200, recorder.Code, "Expected successful response")
+
+	recorder = makeRequest(router, "POST", "/limited", "root")
+	assert.Equalf(429, recorder.Code, "route limits should apply in addition")
+
+	recorder = makeRequest(router, "POST", "/limited", "carol")
+	assert.Equalf(200, recorder.Code, "Expected successful response")
+
+	recorder = makeRequest(router, "POST", "/limited", "carol")
+	assert.Equalf(429, recorder.Code, "route limits should apply in addition")
+
+	recorder = makeRequest(router, "GET", "/open", "carol")
+	assert.Equalf(200, recorder.Code, "requests denied by route limits should not count against the client limit")
+}
+
+func TestAddressMiddleware(t *testing.T) {
+	assert := assert.New(t)
+
+	limiter := ratelimit.New(ratelimit.LimiterParameters{
+		Enabled: true,
+		Default: ratelimit.Limit{Count: 100, Period: time.Hour, Burst: 100},
+		Address: ratelimit.Limit{Count: 2, Period: time.Hour, Burst: 2},
+	}, ratelimit.NewMemoryBackend())
+
+	// Requests are rejected by the authorization behind the address limit
+	router := gin.New()
+	err := router.SetTrustedProxies(nil)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	router.GET("/secured", limiter.AddressMiddleware(), func(c *gin.Context) {
+		c.AbortWithStatus(http.StatusUnauthorized)
+	})
+
+	request := func(forwardedFor string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/secured", nil)
+		req.RemoteAddr = "192.0.2.1:4711"
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	assert.Equalf(401, request("203.0.113.1").Code, "Expected unauthorized response")
+	assert.Equalf(401, request("203.0.113.2").Code, "Expected unauthorized response")
+
+	recorder := request("203.0.113.3")
+	assert.Equalf(429, recorder.Code, "unauthorized requests should be limited by address, regardless of forwarding headers")
+	assert.Equalf("1800", recorder.Header().Get("Retry-After"), "retry after header should be set")
+}
+
+func makeRouter(limiter *ratelimit.Limiter) *gin.Engine {
+	authenticate := func(c *gin.Context) {
+		subject := c.GetHeader("X-Subject")
+		if subject == "" {
+			return
+		}
+
+		principal := &reqctx.Principal{Subject: subject}
+		if subject == "root" {
+			principal.Roles = []string{"admin"}
+		}
+		c.Request = c.Request.WithContext(reqctx.WithPrincipal(c.Request.Context(), principal))
+	}
+
+	ok := func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	}
+
+	router := gin.Default()
+	router.GET("/open", authenticate, limiter.Middleware(), ok)
+	router.POST("/limited", authenticate, limiter.Middleware(), ok)
+
+	return router
+}
+
+func makeRequest(router *gin.Engine, method string, path string, subject string) *httptest.ResponseRecorder {
+	request, _ := http.NewRequest(method, path, nil)
+	request.Header.Set("X-Subject", subject)
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+
+	return recorder
+}
@@ -0,0 +1,508 @@
+package recurrence
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Frequencies of the supported recurrence rules
+const (
+	Daily   = "DAILY"
+	Weekly  = "WEEKLY"
+	Monthly = "MONTHLY"
+	Yearly  = "YEARLY"
+)
+
+// ErrInvalidRule is returned when a recurrence rule can not be parsed or is not supported
+var ErrInvalidRule = errors.New("invalid recurrence rule")
+
+// Largest number of periods examined for an occurrence, bounding the effort spent on rules
+// whose parts rarely or never select a day, such as the 30th of February
+const maxPeriods = 10000
+
+// Formats of the UNTIL part
+const (
+	untilUTCFormat      = "20060102T150405Z"
+	untilFloatingFormat = "20060102T150405"
+	untilDateFormat     = "20060102"
+)
+
+// Weekday names of the BYDAY and WKST parts
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+// WeekdayNum is a weekday of the BYDAY part, optionally restricted to its nth occurrence within
+// the month or year. Negative ordinals count from the end of the month or year.
+type WeekdayNum struct {
+	Ordinal int
+	Weekday time.Weekday
+}
+
+// Rule is a recurrence rule as described by the RRULE property of RFC 5545.
+//
+// The DAILY, WEEKLY, MONTHLY and YEARLY frequencies are supported, together with the INTERVAL,
+// COUNT, UNTIL, BYMONTH, BYMONTHDAY, BYDAY and WKST parts. Occurrences keep the time of day of
+// the start of the series, so rules selecting hours, minutes or seconds are not supported.
+type Rule struct {
+	Frequency  string
+	Interval   int
+	Count      int
+	ByMonth    []int
+	ByMonthDay []int
+	ByDay      []WeekdayNum
+	WeekStart  time.Weekday
+
+	// The UNTIL part as specified, as floating and date values are interpreted in the time zone
+	// of the series
+	until string
+}
+
+// Parse parses the value of an RRULE property, optionally prefixed with the property name.
+//
+// It returns the rule, or an error wrapping ErrInvalidRule if the rule is malformed or not supported.
+func Parse(value string) (*Rule, error) {
+	value = strings.TrimSpace(value)
+	if len(value) > len("RRULE:") && strings.EqualFold(value[:len("RRULE:")], "RRULE:") {
+		value = value[len("RRULE:"):]
+	}
+
+	rule := &Rule{Interval: 1, WeekStart: time.Monday}
+	seen := map[string]bool{}
+
+	for _, part := range strings.Split(value, ";") {
+		name, partValue, found := strings.Cut(part, "=")
+		name = strings.ToUpper(strings.TrimSpace(name))
+		if !found || partValue == "" {
+			return nil, fmt.Errorf("%w: malformed part %q", ErrInvalidRule, part)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("%w: repeated part %s", ErrInvalidRule, name)
+		}
+		seen[name] = true
+
+		err := rule.parsePart(name, strings.ToUpper(strings.TrimSpace(partValue)))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %w", ErrInvalidRule, name, err)
+		}
+	}
+
+	err := rule.validate()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidRule, err)
+	}
+
+	return rule, nil
+}
+
+// parsePart parses a part of a rule.
+func (rule *Rule) parsePart(name string, value string) error {
+	var err error
+
+	switch name {
+	case "FREQ":
+		switch value {
+		case Daily, Weekly, Monthly, Yearly:
+			rule.Frequency = value
+		default:
+			return fmt.Errorf("unsupported frequency %s", value)
+		}
+	case "INTERVAL":
+		rule.Interval, err = parseNumber(value, 1, maxPeriods)
+	case "COUNT":
+		rule.Count, err = parseNumber(value, 1, maxPeriods)
+	case "UNTIL":
+		_, err = parseUntil(value, time.UTC)
+		rule.until = value
+	case "BYMONTH":
+		rule.ByMonth, err = parseList(value, func(item string) (int, error) { return parseNumber(item, 1, 12) })
+	case "BYMONTHDAY":
+		rule.ByMonthDay, err = parseList(value, func(item string) (int, error) { return parseOrdinal(item, 31) })
+	case "BYDAY":
+		rule.ByDay, err = parseList(value, parseWeekdayNum)
+	case "WKST":
+		weekday, found := weekdays[value]
+		if !found {
+			return fmt.Errorf("unknown weekday %s", value)
+		}
+		rule.WeekStart = weekday
+	default:
+		return errors.New("unsupported part")
+	}
+
+	return err
+}
+
+// validate checks the combination of the parts of a rule.
+func (rule *Rule) validate() error {
+	if rule.Frequency == "" {
+		return errors.New("missing FREQ")
+	}
+
+	if rule.Count > 0 && rule.until != "" {
+		return errors.New("COUNT and UNTIL are mutually exclusive")
+	}
+
+	if rule.Frequency == Weekly && len(rule.ByMonthDay) > 0 {
+		return errors.New("BYMONTHDAY is not supported with WEEKLY")
+	}
+
+	if rule.Frequency == Daily || rule.Frequency == Weekly {
+		for _, day := range rule.ByDay {
+			if day.Ordinal != 0 {
+				return fmt.Errorf("BYDAY ordinals are not supported with %s", rule.Frequency)
+			}
+		}
+	}
+
+	return nil
+}
+
+// String formats the rule as the value of an RRULE property, with its parts in a canonical order.
+func (rule *Rule) String() string {
+	parts := []string{"FREQ=" + rule.Frequency}
+
+	if rule.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(rule.Interval))
+	}
+	if rule.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(rule.Count))
+	}
+	if rule.until != "" {
+		parts = append(parts, "UNTIL="+rule.until)
+	}
+	if len(rule.ByMonth) > 0 {
+		parts = append(parts, "BYMONTH="+formatList(rule.ByMonth, strconv.Itoa))
+	}
+	if len(rule.ByMonthDay) > 0 {
+		parts = append(parts, "BYMONTHDAY="+formatList(rule.ByMonthDay, strconv.Itoa))
+	}
+	if len(rule.ByDay) > 0 {
+		parts = append(parts, "BYDAY="+formatList(rule.ByDay, formatWeekdayNum))
+	}
+	if rule.WeekStart != time.Monday {
+		parts = append(parts, "WKST="+weekdayName(rule.WeekStart))
+	}
+
+	return strings.Join(parts, ";")
+}
+
+// Next returns the first occurrence of the rule later than the specified time, for a series
+// starting at start.
+//
+// The start is the first occurrence of the series, whether or not it matches the rule, as the
+// DTSTART of RFC 5545. Occurrences are computed in the location of start and keep its time of
+// day there, so that they keep their local time across daylight saving time changes.
+//
+// It returns false if the series has no occurrence later than after.
+func (rule *Rule) Next(start time.Time, after time.Time) (time.Time, bool) {
+	var next time.Time
+	found := false
+
+	rule.each(start, func(occurrence time.Time) bool {
+		if occurrence.After(after) {
+			next = occurrence
+			found = true
+			return false
+		}
+		return true
+	})
+
+	return next, found
+}
+
+// CountBefore returns the number of occurrences of the series starting at start that are
+// earlier than the specified time.
+func (rule *Rule) CountBefore(start time.Time, at time.Time) int {
+	count := 0
+
+	rule.each(start, func(occurrence time.Time) bool {
+		if !occurrence.Before(at) {
+			return false
+		}
+		count++
+		return true
+	})
+
+	return count
+}
+
+// each passes the occurrences of the series starting at start to yield in chronological order,
+// until yield returns false or the series ends.
+func (rule *Rule) each(start time.Time, yield func(time.Time) bool) {
+	location := start.Location()
+	until, _ := parseUntil(rule.until, location)
+	count := 0
+
+	emit := func(occurrence time.Time) bool {
+		if !until.IsZero() && occurrence.After(until) {
+			return false
+		}
+
+		count++
+		return yield(occurrence) && (rule.Count == 0 || count < rule.Count)
+	}
+
+	if !emit(start) {
+		return
+	}
+
+	// Days are computed in UTC, which has no daylight saving time, and combined with the time
+	// of day of the start in its location
+	first := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+
+	for period := 0; period < maxPeriods; period++ {
+		for _, day := range rule.expand(first, period*rule.Interval) {
+			occurrence := time.Date(day.Year(), day.Month(), day.Day(), start.Hour(), start.Minute(), start.Second(), start.Nanosecond(), location)
+			if !occurrence.After(start) {
+				continue
+			}
+
+			if !emit(occurrence) {
+				return
+			}
+		}
+	}
+}
+
+// expand returns the days selected by the rule within the period the specified number of
+// periods after the period of the first day, in chronological order.
+func (rule *Rule) expand(first time.Time, offset int) []time.Time {
+	switch rule.Frequency {
+	case Daily:
+		day := first.AddDate(0, 0, offset)
+		if rule.inMonths(day) && rule.inMonthDays(day) && rule.inDays(day, 0, 0) {
+			return []time.Time{day}
+		}
+		return nil
+
+	case Weekly:
+		weekStart := first.AddDate(0, 0, -((int(first.Weekday())-int(rule.WeekStart)+7)%7)+7*offset)
+
+		var days []time.Time
+		for i := 0; i < 7; i++ {
+			day := weekStart.AddDate(0, 0, i)
+			selected := day.Weekday() == first.Weekday()
+			if len(rule.ByDay) > 0 {
+				selected = rule.inDays(day, 0, 0)
+			}
+			if selected && rule.inMonths(day) {
+				days = append(days, day)
+			}
+		}
+		return days
+
+	case Monthly:
+		month := time.Date(first.Year(), first.Month()+time.Month(offset), 1, 0, 0, 0, 0, time.UTC)
+		if !rule.inMonths(month) {
+			return nil
+		}
+		return rule.monthDays(month, first.Day())
+
+	default:
+		year := first.Year() + offset
+
+		// Weekdays are counted within the year, unless restricted to months
+		if len(rule.ByDay) > 0 && len(rule.ByMonth) == 0 && len(rule.ByMonthDay) == 0 {
+			start := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+			length := int(start.AddDate(1, 0, 0).Sub(start).Hours() / 24)
+
+			var days []time.Time
+			for i := 0; i < length; i++ {
+				day := start.AddDate(0, 0, i)
+				if rule.inDays(day, i, length) {
+					days = append(days, day)
+				}
+			}
+			return days
+		}
+
+		months := rule.ByMonth
+		if len(months) == 0 {
+			months = []int{int(first.Month())}
+			if len(rule.ByMonthDay) > 0 {
+				months = []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}
+			}
+		}
+		months = slices.Clone(months)
+		slices.Sort(months)
+
+		var days []time.Time
+		for _, month := range slices.Compact(months) {
+			days = append(days, rule.monthDays(time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC), first.Day())...)
+		}
+		return days
+	}
+}
+
+// monthDays returns the days of a month selected by the BYMONTHDAY and BYDAY parts, or the
+// specified day of the month if neither is present.
+func (rule *Rule) monthDays(month time.Time, defaultDay int) []time.Time {
+	length := month.AddDate(0, 1, -1).Day()
+
+	var days []time.Time
+	for i := 0; i < length; i++ {
+		day := month.AddDate(0, 0, i)
+
+		selected := day.Day() == defaultDay
+		if len(rule.ByMonthDay) > 0 || len(rule.ByDay) > 0 {
+			selected = rule.inMonthDays(day) && rule.inDays(day, i, length)
+		}
+		if selected {
+			days = append(days, day)
+		}
+	}
+
+	return days
+}
+
+// inMonths reports whether a day is in a month of the BYMONTH part, if present.
+func (rule *Rule) inMonths(day time.Time) bool {
+	return len(rule.ByMonth) == 0 || slices.Contains(rule.ByMonth, int(day.Month()))
+}
+
+// inMonthDays reports whether a day is a day of the BYMONTHDAY part, if present.
+func (rule *Rule) inMonthDays(day time.Time) bool {
+	if len(rule.ByMonthDay) == 0 {
+		return true
+	}
+
+	length := day.AddDate(0, 1, -day.Day()).Day()
+	return slices.Contains(rule.ByMonthDay, day.Day()) || slices.Contains(rule.ByMonthDay, day.Day()-length-1)
+}
+
+// inDays reports whether a day is a weekday of the BYDAY part, if present. Ordinals are
+// matched against the index of the day within a month or year of the specified length.
+func (rule *Rule) inDays(day time.Time, index int, length int) bool {
+	if len(rule.ByDay) == 0 {
+		return true
+	}
+
+	for _, weekday := range rule.ByDay {
+		if weekday.Weekday != day.Weekday() {
+			continue
+		}
+
+		if weekday.Ordinal == 0 || weekday.Ordinal == index/7+1 || weekday.Ordinal == -((length-1-index)/7+1) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseUntil parses the UNTIL part. Floating times are interpreted in the specified location,
+// and dates include the whole day there. It returns the zero time for an empty value.
+func parseUntil(value string, location *time.Location) (time.Time, error) {
+	switch len(value) {
+	case 0:
+		return time.Time{}, nil
+	case len(untilUTCFormat):
+		return time.Parse(untilUTCFormat, value)
+	case len(untilFloatingFormat):
+		return time.ParseInLocation(untilFloatingFormat, value, location)
+	case len(untilDateFormat):
+		day, err := time.ParseInLocation(untilDateFormat, value, location)
+		return day.AddDate(0, 0, 1).Add(-time.Nanosecond), err
+	}
+
+	return time.Time{}, fmt.Errorf("malformed time %s", value)
+}
+
+// parseNumber parses a number within a range.
+func parseNumber(value string, min int, max int) (int, error) {
+	number, err := strconv.Atoi(value)
+	if err != nil || number < min || number > max {
+		return 0, fmt.Errorf("%s is not a number between %d and %d", value, min, max)
+	}
+
+	return number, nil
+}
+
+// parseOrdinal parses a non-zero number between -max and max.
+func parseOrdinal(value string, max int) (int, error) {
+	number, err := strconv.Atoi(value)
+	if err != nil || number == 0 || number < -max || number > max {
+		return 0, fmt.Errorf("%s is not a non-zero number between -%d and %d", value, max, max)
+	}
+
+	return number, nil
+}
+
+// parseWeekdayNum parses a weekday of the BYDAY part, such as MO, 1MO or -1FR.
+func parseWeekdayNum(value string) (WeekdayNum, error) {
+	if len(value) < 2 {
+		return WeekdayNum{}, fmt.Errorf("unknown weekday %s", value)
+	}
+
+	weekday, found := weekdays[value[len(value)-2:]]
+	if !found {
+		return WeekdayNum{}, fmt.Errorf("unknown weekday %s", value)
+	}
+
+	result := WeekdayNum{Weekday: weekday}
+	if ordinal := strings.TrimPrefix(value[:len(value)-2], "+"); ordinal != "" {
+		var err error
+		result.Ordinal, err = parseOrdinal(ordinal, 53)
+		if err != nil {
+			return WeekdayNum{}, err
+		}
+	}
+
+	return result, nil
+}
+
+// parseList parses a comma separated list of values.
+func parseList[T any](value string, parse func(string) (T, error)) ([]T, error) {
+	var items []T
+
+	for _, item := range strings.Split(value, ",") {
+		parsed, err := parse(strings.TrimSpace(item))
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, parsed)
+	}
+
+	return items, nil
+}
+
+// formatList formats a comma separated list of values.
+func formatList[T any](items []T, format func(T) string) string {
+	formatted := make([]string, len(items))
+	for i := range items {
+		formatted[i] = format(items[i])
+	}
+
+	return strings.Join(formatted, ",")
+}
+
+// formatWeekdayNum formats a weekday of the BYDAY part.
+func formatWeekdayNum(weekday WeekdayNum) string {
+	if weekday.Ordinal == 0 {
+		return weekdayName(weekday.Weekday)
+	}
+
+	return strconv.Itoa(weekday.Ordinal) + weekdayName(weekday.Weekday)
+}
+
+// weekdayName returns the name of a weekday in the BYDAY and WKST parts.
+func weekdayName(weekday time.Weekday) string {
+	for name, candidate := range weekdays {
+		if candidate == weekday {
+			return name
+		}
+	}
+
+	return ""
+}
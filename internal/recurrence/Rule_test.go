@@ -0,0 +1,128 @@
+package recurrence_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"todo-api-go/recurrence"
+)
+
+func TestParse(t *testing.T) {
+	assert := assert.New(t)
+
+	rule, err := recurrence.Parse("RRULE:freq=monthly;byday=-1FR,+2MO;interval=2;wkst=SU")
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf("FREQ=MONTHLY;INTERVAL=2;BYDAY=-1FR,2MO;WKST=SU", rule.String(), "rules should be formatted canonically")
+
+	for _, value := range []string{
+		"",
+		"INTERVAL=2",
+		"FREQ=HOURLY",
+		"FREQ=DAILY;BYHOUR=9",
+		"FREQ=DAILY;COUNT=3;UNTIL=20250101",
+		"FREQ=WEEKLY;BYDAY=1MO",
+		"FREQ=WEEKLY;BYMONTHDAY=1",
+		"FREQ=MONTHLY;BYMONTHDAY=0",
+		"FREQ=DAILY;FREQ=WEEKLY",
+		"FREQ=DAILY;UNTIL=tomorrow",
+	} {
+		_, err = recurrence.Parse(value)
+		assert.ErrorIsf(err, recurrence.ErrInvalidRule, "%q should be rejected", value)
+	}
+}
+
+func TestNext(t *testing.T) {
+	assert := assert.New(t)
+
+	cases := []struct {
+		rule     string
+		start    string
+		expected []string
+		ends     bool
+	}{
+		{"FREQ=DAILY;INTERVAL=3", "2025-01-30T09:00:00Z", []string{"2025-02-02T09:00:00Z", "2025-02-05T09:00:00Z"}, false},
+		{"FREQ=WEEKLY;BYDAY=MO,WE", "2025-01-01T09:00:00Z", []string{"2025-01-06T09:00:00Z", "2025-01-08T09:00:00Z", "2025-01-13T09:00:00Z"}, false},
+		{"FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE", "2025-01-08T09:00:00Z", []string{"2025-01-20T09:00:00Z", "2025-01-22T09:00:00Z"}, false},
+		{"FREQ=MONTHLY", "2025-01-31T09:00:00Z", []string{"2025-03-31T09:00:00Z", "2025-05-31T09:00:00Z"}, false},
+		{"FREQ=MONTHLY;BYMONTHDAY=-1", "2025-01-31T09:00:00Z", []string{"2025-02-28T09:00:00Z", "2025-03-31T09:00:00Z"}, false},
+		{"FREQ=MONTHLY;BYDAY=-1FR", "2025-01-01T09:00:00Z", []string{"2025-01-31T09:00:00Z", "2025-02-28T09:00:00Z"}, false},
+		{"FREQ=MONTHLY;BYDAY=2TU", "2025-01-01T09:00:00Z", []string{"2025-01-14T09:00:00Z", "2025-02-11T09:00:00Z"}, false},
+		{"FREQ=YEARLY", "2024-02-29T09:00:00Z", []string{"2028-02-29T09:00:00Z"}, false},
+		{"FREQ=YEARLY;BYMONTH=3,1;BYDAY=1SU", "2025-01-05T09:00:00Z", []string{"2025-03-02T09:00:00Z", "2026-01-04T09:00:00Z"}, false},
+		{"FREQ=YEARLY;BYDAY=-1MO", "2025-01-01T09:00:00Z", []string{"2025-12-29T09:00:00Z", "2026-12-28T09:00:00Z"}, false},
+		{"FREQ=WEEKLY;COUNT=3", "2025-01-01T09:00:00Z", []string{"2025-01-08T09:00:00Z", "2025-01-15T09:00:00Z"}, true},
+		{"FREQ=DAILY;UNTIL=20250102", "2025-01-01T09:00:00Z", []string{"2025-01-02T09:00:00Z"}, true},
+		{"FREQ=DAILY;UNTIL=20250102T000000Z", "2025-01-01T09:00:00Z", []string{}, true},
+	}
+
+	for _, c := range cases {
+		rule, err := recurrence.Parse(c.rule)
+		if !assert.Nilf(err, "error should be nil, not %s", err) {
+			continue
+		}
+
+		occurrences := []string{}
+		previous := parseTime(c.start)
+		for len(occurrences) < len(c.expected)+1 {
+			next, found := rule.Next(parseTime(c.start), previous)
+			if !found {
+				break
+			}
+			occurrences = append(occurrences, next.UTC().Format(time.RFC3339))
+			previous = next
+		}
+
+		if !c.ends && len(occurrences) > len(c.expected) {
+			occurrences = occurrences[:len(c.expected)]
+		}
+		assert.Equalf(c.expected, occurrences, "occurrences of %s should match", c.rule)
+	}
+}
+
+func TestNextAcrossDaylightSavingTime(t *testing.T) {
+	assert := assert.New(t)
+
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("time zone database not available")
+	}
+
+	rule, err := recurrence.Parse("FREQ=WEEKLY")
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	// Daylight saving time starts on March 30th 2025 in Berlin
+	start := time.Date(2025, time.March, 24, 9, 0, 0, 0, berlin)
+	next, found := rule.Next(start, start)
+	assert.Truef(found, "the series should continue")
+	assert.Equalf(time.Date(2025, time.March, 31, 9, 0, 0, 0, berlin), next, "the local time of day should be kept")
+	assert.Equalf(7*24*time.Hour-time.Hour, next.Sub(start), "the week should be an hour shorter")
+
+	// UNTIL dates cover the whole day in the time zone of the series
+	rule, err = recurrence.Parse("FREQ=DAILY;UNTIL=20250325")
+	assert.Nilf(err, "error should be nil, not %s", err)
+	_, found = rule.Next(start, start)
+	assert.Truef(found, "the last day should be included")
+}
+
+func TestCountBefore(t *testing.T) {
+	assert := assert.New(t)
+
+	rule, err := recurrence.Parse("FREQ=WEEKLY;COUNT=5")
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	start := parseTime("2025-01-01T09:00:00Z")
+	assert.Equalf(0, rule.CountBefore(start, start), "no occurrence should precede the start")
+	assert.Equalf(2, rule.CountBefore(start, parseTime("2025-01-15T09:00:00Z")), "earlier occurrences should be counted")
+	assert.Equalf(5, rule.CountBefore(start, parseTime("2026-01-01T00:00:00Z")), "the series should end after COUNT occurrences")
+}
+
+func parseTime(value string) time.Time {
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		panic(err)
+	}
+
+	return parsed
+}
@@ -0,0 +1,5 @@
+module todo-api-go/recurrence
+
+go 1.21.5
+
+require github.com/stretchr/testify v1.8.4
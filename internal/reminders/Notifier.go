@@ -0,0 +1,83 @@
+package reminders
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"todo-api-go/persistence"
+)
+
+// Channels of the notifiers provided by this package
+const (
+	InboxChannel   = "inbox"
+	WebhookChannel = "webhook"
+	SMTPChannel    = "smtp"
+)
+
+// Notifier sends reminders through a channel.
+//
+// Notify is called within the transaction that marks the reminder as sent. Notifications
+// recorded through the outbox are committed together with the reminder, and are therefore
+// recorded exactly once. Notifiers sending reminders to external systems implement Sender.
+type Notifier interface {
+	// Channel returns the name of the channel, as configured in the scheduler parameters
+	Channel() string
+
+	// Notify sends a reminder, returning an error if it should be retried
+	Notify(ctx context.Context, pending *persistence.PendingReminder, outbox *persistence.ReminderOutbox) error
+}
+
+// Sender is implemented by notifiers sending reminders to external systems, such as mail servers.
+//
+// Send is called before the transaction that marks the reminder as sent, so that the transaction
+// is not held open while the external system responds; Notify is called within the transaction
+// afterwards, like for other notifiers. The reminder is sent again if the transaction fails to
+// commit after it has been sent.
+type Sender interface {
+	// Send sends a reminder, returning an error if it should be retried
+	Send(ctx context.Context, pending *persistence.PendingReminder) error
+}
+
+// InboxNotifier adds reminders to the in-app inbox of their recipients.
+type InboxNotifier struct{}
+
+func (InboxNotifier) Channel() string {
+	return InboxChannel
+}
+
+func (InboxNotifier) Notify(ctx context.Context, pending *persistence.PendingReminder, outbox *persistence.ReminderOutbox) error {
+	subject, body := describe(pending)
+	return outbox.AddToInbox(subject, body)
+}
+
+// WebhookNotifier queues the todo.reminder event of reminders in the webhook outbox, from
+// which the webhook dispatcher delivers it to the subscriptions of the recipients.
+type WebhookNotifier struct{}
+
+func (WebhookNotifier) Channel() string {
+	return WebhookChannel
+}
+
+func (WebhookNotifier) Notify(ctx context.Context, pending *persistence.PendingReminder, outbox *persistence.ReminderOutbox) error {
+	_, err := outbox.EnqueueWebhooks()
+	return err
+}
+
+// describe returns the subject and body of a message about a reminder. The due date is
+// described in the time zone of the item, if it has one.
+func describe(pending *persistence.PendingReminder) (string, string) {
+	item := &pending.Item
+
+	due := item.DueDate.UTC()
+	if location, err := time.LoadLocation(item.TimeZone); err == nil && item.TimeZone != "" {
+		due = due.In(location)
+	}
+
+	subject := "Reminder: " + item.Description
+	if pending.Reminder.Offset > 0 {
+		return subject, fmt.Sprintf("%q was due on %s and is still open.", item.Description, due.Format(time.RFC1123))
+	}
+
+	return subject, fmt.Sprintf("%q is due on %s.", item.Description, due.Format(time.RFC1123))
+}
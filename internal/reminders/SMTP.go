@@ -0,0 +1,173 @@
+package reminders
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"time"
+
+	"todo-api-go/persistence"
+	"todo-api-go/reqctx"
+)
+
+type SMTPParameters struct {
+	// Host of the mail server. Reminders can not be sent by mail without it.
+	Host string
+	Port int `default:"25"`
+
+	// Sender of the reminders
+	From string `default:"todo-api-go@localhost"`
+
+	// Credentials for PLAIN authentication, which requires TLS unless the server is local
+	Username string
+	Password string
+
+	// Recipient of the reminders of items without owner. Reminders of owners whose email address
+	// is unknown are not sent by mail, rather than to this recipient.
+	DefaultTo string `split_words:"true"`
+
+	// Timeout of sending a reminder
+	Timeout time.Duration `default:"10s"`
+}
+
+// SMTPNotifier sends reminders by mail to the email addresses of the owners of their items, as
+// stored when the items were created, and the reminders of items without owner to the default
+// recipient, if any.
+//
+// Mail is sent before the reminder is marked as sent, outside of the transaction doing so, so
+// that a reminder may be sent twice if the database fails in between. Every reminder is sent
+// with the same Message-ID, which lets receivers discard duplicates.
+type SMTPNotifier struct {
+	params SMTPParameters
+}
+
+// NewSMTPNotifier creates an SMTPNotifier with the specified parameters.
+//
+// params: The configuration of the mail server.
+// Returns a pointer to SMTPNotifier.
+func NewSMTPNotifier(params SMTPParameters) *SMTPNotifier {
+	return &SMTPNotifier{params: params}
+}
+
+func (notifier *SMTPNotifier) Channel() string {
+	return SMTPChannel
+}
+
+// Send sends a reminder by mail. Reminders without an email address to send them to are skipped.
+//
+// Owners identified by an email address, rather than an opaque subject, receive their reminders
+// at that address if their email address was not known when the item was created. The default
+// recipient only receives the reminders of items without owner, as the reminders of owned items
+// would disclose the items to someone who may not see them.
+func (notifier *SMTPNotifier) Send(ctx context.Context, pending *persistence.PendingReminder) error {
+	var to string
+	switch {
+	case pending.Reminder.Recipient == "":
+		to = notifier.params.DefaultTo
+	case pending.Item.OwnerID == pending.Reminder.Recipient && pending.Item.OwnerEmail != "":
+		to = pending.Item.OwnerEmail
+	default:
+		if address, err := mail.ParseAddress(pending.Reminder.Recipient); err == nil {
+			to = address.Address
+		}
+	}
+
+	if to == "" {
+		reqctx.LoggerFrom(ctx, logComponent).DebugContext(ctx, "reminder without email address skipped", "reminder_id", pending.Reminder.ID)
+		return nil
+	}
+
+	subject, body := describe(pending)
+	return notifier.send(ctx, to, notifier.message(pending, to, subject, body))
+}
+
+// Notify records nothing, as the reminder has been mailed by Send.
+func (notifier *SMTPNotifier) Notify(context.Context, *persistence.PendingReminder, *persistence.ReminderOutbox) error {
+	return nil
+}
+
+// message formats a plain text message.
+func (notifier *SMTPNotifier) message(pending *persistence.PendingReminder, to string, subject string, body string) []byte {
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "From: %s\r\n", notifier.params.From)
+	fmt.Fprintf(&message, "To: %s\r\n", to)
+	fmt.Fprintf(&message, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&message, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&message, "Message-ID: <reminder.%d@todo-api-go>\r\n", pending.Reminder.ID)
+	fmt.Fprintf(&message, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&message, "Content-Type: text/plain; charset=utf-8\r\n")
+	fmt.Fprintf(&message, "Content-Transfer-Encoding: 8bit\r\n")
+	fmt.Fprintf(&message, "\r\n%s\r\n", body)
+
+	return message.Bytes()
+}
+
+// send sends a message to a recipient through the mail server, upgrading the connection to TLS
+// if the server supports it.
+func (notifier *SMTPNotifier) send(ctx context.Context, to string, message []byte) error {
+	if notifier.params.Host == "" {
+		return errors.New("no mail server configured")
+	}
+
+	dialer := net.Dialer{Timeout: notifier.params.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(notifier.params.Host, strconv.Itoa(notifier.params.Port)))
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(notifier.params.Timeout))
+
+	client, err := smtp.NewClient(conn, notifier.params.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if supported, _ := client.Extension("STARTTLS"); supported {
+		err = client.StartTLS(&tls.Config{ServerName: notifier.params.Host})
+		if err != nil {
+			return err
+		}
+	}
+
+	if notifier.params.Username != "" {
+		err = client.Auth(smtp.PlainAuth("", notifier.params.Username, notifier.params.Password, notifier.params.Host))
+		if err != nil {
+			return err
+		}
+	}
+
+	err = client.Mail(notifier.params.From)
+	if err != nil {
+		return err
+	}
+
+	err = client.Rcpt(to)
+	if err != nil {
+		return err
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+
+	_, err = writer.Write(message)
+	if err != nil {
+		return err
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
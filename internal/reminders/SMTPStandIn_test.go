@@ -0,0 +1,134 @@
+package reminders_test
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// smtpStandIn is a local stand-in for a mail server, accepting every message without
+// authentication or TLS, and recording the messages it received.
+type smtpStandIn struct {
+	listener net.Listener
+
+	mutex    sync.Mutex
+	messages []receivedMail
+}
+
+type receivedMail struct {
+	From string
+	To   []string
+	Data string
+}
+
+// startSMTPStandIn starts a mail server stand-in on a local port, which is closed at the end of the test.
+func startSMTPStandIn(t *testing.T) *smtpStandIn {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	standIn := &smtpStandIn{listener: listener}
+	go standIn.serve()
+	t.Cleanup(func() { listener.Close() })
+
+	return standIn
+}
+
+// Port returns the port the stand-in is listening on.
+func (standIn *smtpStandIn) Port() int {
+	return standIn.listener.Addr().(*net.TCPAddr).Port
+}
+
+// Messages returns the messages received so far.
+func (standIn *smtpStandIn) Messages() []receivedMail {
+	standIn.mutex.Lock()
+	defer standIn.mutex.Unlock()
+
+	return append([]receivedMail{}, standIn.messages...)
+}
+
+func (standIn *smtpStandIn) serve() {
+	for {
+		conn, err := standIn.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go standIn.session(conn)
+	}
+}
+
+// session runs the SMTP conversation of a connection.
+func (standIn *smtpStandIn) session(conn net.Conn) {
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	reply := func(code int, text string) {
+		conn.Write([]byte(strconv.Itoa(code) + " " + text + "\r\n"))
+	}
+
+	reply(220, "localhost stand-in")
+
+	var mail receivedMail
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+
+		switch verb {
+		case "EHLO", "HELO":
+			reply(250, "localhost")
+		case "MAIL":
+			mail = receivedMail{From: address(line)}
+			reply(250, "OK")
+		case "RCPT":
+			mail.To = append(mail.To, address(line))
+			reply(250, "OK")
+		case "DATA":
+			reply(354, "End data with <CR><LF>.<CR><LF>")
+
+			var data strings.Builder
+			for {
+				line, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(line, "."))
+			}
+			mail.Data = data.String()
+
+			standIn.mutex.Lock()
+			standIn.messages = append(standIn.messages, mail)
+			standIn.mutex.Unlock()
+			reply(250, "OK")
+		case "QUIT":
+			reply(221, "Bye")
+			return
+		case "RSET", "NOOP":
+			reply(250, "OK")
+		default:
+			reply(502, "Command not implemented")
+		}
+	}
+}
+
+// address extracts the address of a MAIL or RCPT command.
+func address(line string) string {
+	start := strings.Index(line, "<")
+	end := strings.LastIndex(line, ">")
+	if start < 0 || end < start {
+		return ""
+	}
+
+	return line[start+1 : end]
+}
@@ -0,0 +1,256 @@
+package reminders
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+
+	"todo-api-go/persistence"
+	"todo-api-go/reqctx"
+)
+
+// Component of the loggers used by this package
+const logComponent = "reminders"
+
+type SchedulerParameters struct {
+	// Whether reminders are sent by this instance
+	Enabled bool `default:"true"`
+
+	// Interval between polls for due reminders
+	PollInterval time.Duration `split_words:"true" default:"30s"`
+
+	// Offsets from the due dates at which reminders are sent, negative before the due date
+	Offsets []time.Duration `default:"-1h,0s"`
+
+	// Channels through which every reminder is sent, out of "inbox", "webhook" and "smtp"
+	Channels []string `default:"inbox,webhook"`
+
+	// Maximum number of reminders sent per poll
+	BatchSize int `split_words:"true" default:"50"`
+
+	// How long a reminder is leased to the instance sending it
+	Lease time.Duration `default:"2m"`
+
+	// Number of attempts after which a reminder is given up, and the delay between attempts
+	MaxAttempts int           `split_words:"true" default:"5"`
+	RetryDelay  time.Duration `split_words:"true" default:"1m"`
+
+	// How far back reminders that became due are looked for when the scheduler starts
+	Lookback time.Duration `default:"24h"`
+
+	// Name of this instance as the holder of leases, generated if empty
+	Instance string
+
+	// Mail server of the "smtp" channel
+	SMTP SMTPParameters
+}
+
+// Scheduler schedules reminders for the due dates of open items, and sends the reminders that
+// are due through the notifiers of their channels.
+//
+// Several instances may share the reminders: reminders are scheduled once per item, due date,
+// offset and channel, and every reminder is leased by one instance at a time. A reminder is
+// marked as sent in the transaction that records its notifications, so that reminders sent to
+// the inbox and through webhooks are sent exactly once.
+type Scheduler struct {
+	params    SchedulerParameters
+	reminders *persistence.ReminderManager
+	notifiers map[string]Notifier
+
+	// End of the period that has been checked for reminders becoming due
+	checked time.Time
+}
+
+// NewFromEnv creates a Scheduler configured from the "REMINDER_***" environment variables,
+// with the notifiers of the configured channels.
+//
+// reminders: The manager of the reminders.
+// Returns a pointer to Scheduler and an error if the configuration is invalid.
+func NewFromEnv(reminders *persistence.ReminderManager) (*Scheduler, error) {
+	var params SchedulerParameters
+
+	err := envconfig.Process("reminder", &params)
+	if err != nil {
+		return nil, err
+	}
+
+	if slices.Contains(params.Channels, SMTPChannel) && params.SMTP.Host == "" {
+		return nil, errors.New("the smtp reminder channel requires REMINDER_SMTP_HOST")
+	}
+
+	return New(params, reminders, InboxNotifier{}, WebhookNotifier{}, NewSMTPNotifier(params.SMTP))
+}
+
+// New creates a Scheduler with the specified parameters and notifiers.
+//
+// params: The configuration of the scheduler.
+// reminders: The manager of the reminders.
+// notifiers: The notifiers available to the channels of the scheduler.
+// Returns a pointer to Scheduler and an error if a channel has no notifier.
+func New(params SchedulerParameters, reminders *persistence.ReminderManager, notifiers ...Notifier) (*Scheduler, error) {
+	scheduler := &Scheduler{
+		params:    params,
+		reminders: reminders,
+		notifiers: map[string]Notifier{},
+	}
+
+	for _, notifier := range notifiers {
+		scheduler.notifiers[notifier.Channel()] = notifier
+	}
+
+	for _, channel := range params.Channels {
+		if _, found := scheduler.notifiers[channel]; !found {
+			return nil, fmt.Errorf("unknown reminder channel %q", channel)
+		}
+	}
+
+	if scheduler.params.Instance == "" {
+		scheduler.params.Instance = instanceName()
+	}
+
+	return scheduler, nil
+}
+
+// Run polls for due reminders and sends them until the context is canceled.
+// It returns immediately if the scheduler is disabled.
+func (scheduler *Scheduler) Run(ctx context.Context) {
+	if !scheduler.params.Enabled {
+		return
+	}
+
+	ticker := time.NewTicker(scheduler.params.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		_, err := scheduler.Send(ctx, time.Now())
+		if err != nil {
+			reqctx.LoggerFrom(ctx, logComponent).ErrorContext(ctx, "sending reminders failed", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Send schedules the reminders that became due since the previous call, and sends a batch of
+// due reminders concurrently.
+//
+// It takes the current time.
+// It returns the number of attempted reminders and an error if the reminders could not be read.
+// Failed attempts are recorded with the reminders rather than returned.
+func (scheduler *Scheduler) Send(ctx context.Context, now time.Time) (int, error) {
+	reminders := scheduler.reminders.WithContext(ctx)
+
+	if scheduler.checked.IsZero() {
+		scheduler.checked = now.Add(-scheduler.params.Lookback)
+	}
+
+	_, err := reminders.Schedule(scheduler.params.Offsets, scheduler.params.Channels, scheduler.checked, now)
+	if err != nil {
+		return 0, err
+	}
+	scheduler.checked = now
+
+	pending, err := reminders.Claim(scheduler.params.Instance, now, scheduler.params.BatchSize, scheduler.params.Lease)
+	if err != nil {
+		return 0, err
+	}
+
+	var wait sync.WaitGroup
+	for i := range pending {
+		wait.Add(1)
+		go func(pending *persistence.PendingReminder) {
+			defer wait.Done()
+			scheduler.send(ctx, reminders, pending)
+		}(&pending[i])
+	}
+	wait.Wait()
+
+	return len(pending), nil
+}
+
+// send sends a leased reminder through the notifier of its channel and records the outcome.
+func (scheduler *Scheduler) send(ctx context.Context, reminders *persistence.ReminderManager, pending *persistence.PendingReminder) {
+	reminder := &pending.Reminder
+	logger := reqctx.LoggerFrom(ctx, logComponent).With("reminder_id", reminder.ID, "item_id", reminder.ItemID, "channel", reminder.Channel, "attempt", reminder.Attempts)
+
+	// The notifier must complete within the lease, or the reminder may be sent by another instance
+	ctx, cancel := context.WithTimeout(ctx, scheduler.params.Lease)
+	defer cancel()
+
+	notifier, found := scheduler.notifiers[reminder.Channel]
+	err := fmt.Errorf("unknown reminder channel %q", reminder.Channel)
+	if found {
+		err = deliver(ctx, reminders, notifier, pending)
+	}
+
+	switch {
+	case err == nil:
+		logger.DebugContext(ctx, "reminder completed", "status", reminder.Status)
+		return
+
+	case errors.Is(err, persistence.ErrLeaseLost):
+		logger.WarnContext(ctx, "reminder lease lost to another instance")
+		return
+	}
+
+	var retryAt time.Time
+	if reminder.Attempts < scheduler.params.MaxAttempts {
+		retryAt = time.Now().Add(scheduler.params.RetryDelay)
+		logger.InfoContext(ctx, "reminder failed", "error", err, "retry_at", retryAt)
+	} else {
+		logger.WarnContext(ctx, "reminder given up", "error", err)
+	}
+
+	err = reminders.Fail(pending, err, retryAt)
+	if err != nil {
+		logger.ErrorContext(ctx, "reminder failure could not be recorded", "error", err)
+	}
+}
+
+// deliver sends a leased reminder through a notifier and completes it. Reminders of a Sender are
+// sent before they are completed, unless they are to be canceled.
+func deliver(ctx context.Context, reminders *persistence.ReminderManager, notifier Notifier, pending *persistence.PendingReminder) error {
+	if sender, ok := notifier.(Sender); ok {
+		due, err := reminders.Prepare(pending)
+		if err != nil {
+			return err
+		}
+
+		if due {
+			err = sender.Send(ctx, pending)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return reminders.Complete(pending, func(outbox *persistence.ReminderOutbox) error {
+		return notifier.Notify(ctx, pending, outbox)
+	})
+}
+
+// instanceName generates a name identifying this instance as the holder of leases, from the
+// host name and a random suffix distinguishing processes on the same host.
+func instanceName() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "todo-api-go"
+	}
+
+	random := make([]byte, 4)
+	_, _ = rand.Read(random)
+
+	return host + "-" + hex.EncodeToString(random)
+}
@@ -0,0 +1,229 @@
+package reminders_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"todo-api-go/entities"
+	"todo-api-go/persistence"
+	"todo-api-go/reminders"
+	"todo-api-go/reqctx"
+	"todo-api-go/testsupport"
+)
+
+func TestSend(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testsupport.CreateTestDatabase(t)
+	manager := persistence.NewReminderManager(db)
+	ctx := reqctx.WithPrincipal(context.Background(), &reqctx.Principal{Subject: "alice"})
+
+	subscription := &entities.WebhookSubscriptionEntity{URL: "https://example.com/hook", Events: []string{entities.WebhookItemReminder}}
+	err := persistence.NewWebhookManager(db).WithContext(ctx).Create(subscription)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	item := &entities.ToDoItemEntity{Description: "Renew the passport", DueDate: now.Add(30 * time.Minute)}
+	err = persistence.New(db).WithContext(ctx).Create(item)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	scheduler, err := reminders.New(testParameters(reminders.InboxChannel, reminders.WebhookChannel), manager, reminders.InboxNotifier{}, reminders.WebhookNotifier{})
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	attempted, err := scheduler.Send(context.Background(), now)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf(2, attempted, "the reminder before the due date should be sent through both channels")
+
+	messages, _, err := manager.WithContext(ctx).FindInbox(persistence.InboxFilter{})
+	assert.Nilf(err, "error should be nil, not %s", err)
+	if assert.Lenf(messages, 1, "the reminder should be added to the inbox") {
+		assert.Equalf(item.ID, messages[0].ItemID, "the message should refer to the item")
+		assert.Equalf("Reminder: Renew the passport", messages[0].Subject, "the message should describe the item")
+	}
+
+	deliveries, _, err := persistence.NewWebhookManager(db).FindDeliveries(persistence.DeliveryFilter{SubscriptionID: subscription.ID})
+	assert.Nilf(err, "error should be nil, not %s", err)
+	if assert.Lenf(deliveries, 1, "the reminder should be queued for the webhook") {
+		assert.Equalf(entities.WebhookItemReminder, deliveries[0].Event, "the delivery should be a reminder")
+	}
+
+	attempted, err = scheduler.Send(context.Background(), now.Add(time.Minute))
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf(0, attempted, "sent reminders should not be sent again")
+
+	attempted, err = scheduler.Send(context.Background(), now.Add(30*time.Minute))
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf(2, attempted, "the reminder at the due date should be sent")
+}
+
+func TestSendFromSeveralInstances(t *testing.T) {
+	assert := assert.New(t)
+
+	db := testsupport.CreateTestDatabase(t)
+	manager := persistence.NewReminderManager(db)
+	ctx := reqctx.WithPrincipal(context.Background(), &reqctx.Principal{Subject: "alice"})
+
+	now := time.Now().UTC().Truncate(time.Second)
+	for _, description := range []string{"Book the flights", "Book the hotel", "Rent a car"} {
+		err := persistence.New(db).WithContext(ctx).Create(&entities.ToDoItemEntity{Description: description, DueDate: now.Add(-time.Minute)})
+		assert.Nilf(err, "error should be nil, not %s", err)
+	}
+
+	var wait sync.WaitGroup
+	for _, instance := range []string{"a", "b", "c"} {
+		params := testParameters(reminders.InboxChannel)
+		params.Instance = instance
+		scheduler, err := reminders.New(params, manager, reminders.InboxNotifier{})
+		assert.Nilf(err, "error should be nil, not %s", err)
+
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			_, err := scheduler.Send(context.Background(), now)
+			assert.Nilf(err, "error should be nil, not %s", err)
+		}()
+	}
+	wait.Wait()
+
+	_, total, err := manager.WithContext(ctx).FindInbox(persistence.InboxFilter{})
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf(int64(3), total, "every reminder should be sent once")
+}
+
+func TestSendByMail(t *testing.T) {
+	assert := assert.New(t)
+
+	standIn := startSMTPStandIn(t)
+
+	db := testsupport.CreateTestDatabase(t)
+	manager := persistence.NewReminderManager(db)
+	ctx := reqctx.WithPrincipal(context.Background(), &reqctx.Principal{Subject: "270412863", Email: "alice@example.com"})
+
+	now := time.Now().UTC().Truncate(time.Second)
+	item := &entities.ToDoItemEntity{Description: "Pay the rent", DueDate: now.Add(-time.Minute)}
+	err := persistence.New(db).WithContext(ctx).Create(item)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	params := testParameters(reminders.SMTPChannel)
+	params.Offsets = []time.Duration{0}
+	params.MaxAttempts = 2
+	params.SMTP = reminders.SMTPParameters{Host: "127.0.0.1", Port: standIn.Port(), From: "todo@example.com", Timeout: time.Second}
+	scheduler, err := reminders.New(params, manager, reminders.NewSMTPNotifier(params.SMTP))
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	_, err = scheduler.Send(context.Background(), now)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	messages := standIn.Messages()
+	if assert.Lenf(messages, 1, "the reminder should be mailed") {
+		assert.Equalf("todo@example.com", messages[0].From, "the sender should be configured")
+		assert.Equalf([]string{"alice@example.com"}, messages[0].To, "the reminder should be mailed to the email address of the owner")
+		assert.Containsf(messages[0].Data, "Subject: Reminder: Pay the rent", "the subject should describe the item")
+	}
+
+	// Reminders are retried while the mail server is unavailable, and given up eventually
+	standIn.listener.Close()
+	item = &entities.ToDoItemEntity{Description: "Water the plants", DueDate: now.Add(time.Second)}
+	err = persistence.New(db).WithContext(ctx).Create(item)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	_, err = scheduler.Send(context.Background(), now.Add(time.Second))
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	found, err := manager.FindReminders(item.ID)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	if !assert.Lenf(found, 1, "the reminder should be scheduled") {
+		return
+	}
+	assert.Equalf(entities.ReminderPending, found[0].Status, "the reminder should be retried")
+	assert.NotEmptyf(found[0].LastError, "the error should be kept")
+
+	_, err = scheduler.Send(context.Background(), found[0].SendAt)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	found, err = manager.FindReminders(item.ID)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf(entities.ReminderDead, found[0].Status, "the reminder should be given up")
+}
+
+func TestNewFromEnv(t *testing.T) {
+	assert := assert.New(t)
+
+	manager := persistence.NewReminderManager(testsupport.CreateTestDatabase(t))
+
+	t.Setenv("REMINDER_CHANNELS", "inbox,pager")
+	_, err := reminders.NewFromEnv(manager)
+	assert.ErrorContainsf(err, "pager", "unknown channels should be rejected")
+
+	t.Setenv("REMINDER_CHANNELS", "smtp")
+	_, err = reminders.NewFromEnv(manager)
+	assert.ErrorContainsf(err, "REMINDER_SMTP_HOST", "mail should require a mail server")
+
+	t.Setenv("REMINDER_SMTP_HOST", "localhost")
+	_, err = reminders.NewFromEnv(manager)
+	assert.Nilf(err, "error should be nil, not %s", err)
+}
+
+func TestSendByMailToDefaultRecipient(t *testing.T) {
+	assert := assert.New(t)
+
+	standIn := startSMTPStandIn(t)
+
+	db := testsupport.CreateTestDatabase(t)
+	manager := persistence.NewReminderManager(db)
+	items := persistence.New(db)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	owned := &entities.ToDoItemEntity{Description: "Private matter", DueDate: now.Add(-time.Minute)}
+	err := items.WithContext(reqctx.WithPrincipal(context.Background(), &reqctx.Principal{Subject: "bob"})).Create(owned)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	unowned := &entities.ToDoItemEntity{Description: "Shared chore", DueDate: now.Add(-time.Minute)}
+	err = items.Create(unowned)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	params := testParameters(reminders.SMTPChannel)
+	params.Offsets = []time.Duration{0}
+	params.SMTP = reminders.SMTPParameters{Host: "127.0.0.1", Port: standIn.Port(), From: "todo@example.com", DefaultTo: "ops@example.com", Timeout: time.Second}
+
+	// One reminder at a time, as the test database does not support concurrent writes
+	params.BatchSize = 1
+	scheduler, err := reminders.New(params, manager, reminders.NewSMTPNotifier(params.SMTP))
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	for i := 0; i < 2; i++ {
+		sent, err := scheduler.Send(context.Background(), now)
+		assert.Nilf(err, "error should be nil, not %s", err)
+		assert.Equalf(1, sent, "both reminders should be completed")
+	}
+
+	messages := standIn.Messages()
+	if assert.Lenf(messages, 1, "only the reminder of the item without owner should be mailed") {
+		assert.Equalf([]string{"ops@example.com"}, messages[0].To, "the reminder should be mailed to the default recipient")
+		assert.Containsf(messages[0].Data, "Subject: Reminder: Shared chore", "the subject should describe the item")
+	}
+
+	found, err := manager.FindReminders(owned.ID)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	if assert.Lenf(found, 1, "the reminder should be scheduled") {
+		assert.Equalf(entities.ReminderSent, found[0].Status, "reminders of owners without email address should be skipped")
+	}
+}
+
+func testParameters(channels ...string) reminders.SchedulerParameters {
+	return reminders.SchedulerParameters{
+		Enabled:      true,
+		PollInterval: time.Second,
+		Offsets:      []time.Duration{-time.Hour, 0},
+		Channels:     channels,
+		BatchSize:    10,
+		Lease:        time.Minute,
+		MaxAttempts:  3,
+		RetryDelay:   time.Millisecond,
+		Lookback:     time.Hour,
+	}
+}
@@ -0,0 +1,8 @@
+module todo-api-go/reminders
+
+go 1.21.5
+
+require (
+	github.com/kelseyhightower/envconfig v1.4.0
+	github.com/stretchr/testify v1.8.4
+)
@@ -0,0 +1,48 @@
+package reqctx
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Attribute naming the component, usually a package, that a logger belongs to.
+// Log levels may be configured per component.
+const ComponentKey = "component"
+
+// Attribute carrying the subject of the principal a record was logged for
+const SubjectKey = "subject"
+
+type loggerKey struct{}
+
+// WithLogger returns a copy of the parent context carrying the specified request-scoped logger.
+//
+// ctx context.Context, logger *slog.Logger
+// context.Context
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// LoggerFrom returns the request-scoped logger carried by the context for the specified component.
+//
+// The logger falls back to the default logger if the context does not carry one. The subject
+// of the principal carried by the context is added, as the principal is usually only known
+// once the logger has been attached to the request.
+//
+// ctx context.Context, component string
+// *slog.Logger
+func LoggerFrom(ctx context.Context, component string) *slog.Logger {
+	var logger *slog.Logger
+	if ctx != nil {
+		logger, _ = ctx.Value(loggerKey{}).(*slog.Logger)
+	}
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	logger = logger.With(ComponentKey, component)
+	if principal := PrincipalFrom(ctx); principal != nil && principal.Subject != "" {
+		logger = logger.With(SubjectKey, principal.Subject)
+	}
+
+	return logger
+}
@@ -0,0 +1,72 @@
+package reqctx
+
+import (
+	"context"
+	"slices"
+)
+
+type principalKey struct{}
+
+// Principal describes the authenticated caller of a request.
+type Principal struct {
+	// Unique identifier of the caller (the "sub" claim)
+	Subject string
+
+	// Human readable name of the caller, if known
+	Name string
+
+	// Verified email address of the caller, if known
+	Email string
+
+	// Organization the caller belongs to
+	Tenant string
+
+	// Groups the caller is a member of
+	Groups []string
+
+	// Roles that have been granted to the caller
+	Roles []string
+}
+
+// HasRole reports whether the principal has been granted the specified role.
+//
+// It takes a role string as a parameter and returns a boolean.
+func (p *Principal) HasRole(role string) bool {
+	if p == nil {
+		return false
+	}
+
+	return slices.Contains(p.Roles, role)
+}
+
+// InGroup reports whether the principal is a member of the specified group.
+//
+// It takes a group string as a parameter and returns a boolean.
+func (p *Principal) InGroup(group string) bool {
+	if p == nil {
+		return false
+	}
+
+	return slices.Contains(p.Groups, group)
+}
+
+// WithPrincipal returns a copy of the parent context carrying the specified principal.
+//
+// ctx context.Context, principal *Principal
+// context.Context
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFrom returns the principal carried by the context.
+//
+// It returns nil if the context does not carry a principal, which is the case for
+// internal (non-request) callers.
+func PrincipalFrom(ctx context.Context) *Principal {
+	if ctx == nil {
+		return nil
+	}
+
+	principal, _ := ctx.Value(principalKey{}).(*Principal)
+	return principal
+}
@@ -0,0 +1,25 @@
+package reqctx
+
+import "context"
+
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of the parent context carrying the specified request ID.
+//
+// ctx context.Context, requestID string
+// context.Context
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestIDFrom returns the request ID carried by the context.
+//
+// It returns an empty string if the context does not carry a request ID.
+func RequestIDFrom(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
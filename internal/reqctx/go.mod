@@ -0,0 +1,3 @@
+module todo-api-go/reqctx
+
+go 1.21.5
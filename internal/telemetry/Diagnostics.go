@@ -0,0 +1,113 @@
+package telemetry
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	logssdk "github.com/agoda-com/opentelemetry-logs-go/sdk/logs"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Minimum interval between two diagnostics written for telemetry errors
+const diagnosticInterval = time.Minute
+
+// Diagnostics reports errors of the telemetry pipeline itself, such as failing exports.
+//
+// It implements otel.ErrorHandler, writing the errors to a local handler only, so that the
+// diagnostics do not depend on the pipeline they report on. Errors are written at most once
+// per minute, together with the number of errors suppressed in the meantime.
+type Diagnostics struct {
+	logger *slog.Logger
+
+	mutex      sync.Mutex
+	reported   time.Time
+	suppressed int
+
+	exportFailures atomic.Int64
+}
+
+// NewDiagnostics creates Diagnostics writing to the specified local handler.
+//
+// local slog.Handler
+// *Diagnostics
+func NewDiagnostics(local slog.Handler) *Diagnostics {
+	return &Diagnostics{logger: slog.New(local)}
+}
+
+// Handle implements otel.ErrorHandler.
+func (diagnostics *Diagnostics) Handle(err error) {
+	diagnostics.mutex.Lock()
+	defer diagnostics.mutex.Unlock()
+
+	now := time.Now()
+	if now.Sub(diagnostics.reported) < diagnosticInterval {
+		diagnostics.suppressed++
+		return
+	}
+
+	diagnostics.logger.Error("telemetry export failed", "error", err, "suppressed", diagnostics.suppressed)
+	diagnostics.reported = now
+	diagnostics.suppressed = 0
+}
+
+// ExportFailures returns the number of failed log exports.
+func (diagnostics *Diagnostics) ExportFailures() int64 {
+	return diagnostics.exportFailures.Load()
+}
+
+// wrapLogExporter counts the failures of a log record exporter.
+func (diagnostics *Diagnostics) wrapLogExporter(exporter logssdk.LogRecordExporter) logssdk.LogRecordExporter {
+	return &countingLogExporter{LogRecordExporter: exporter, failures: &diagnostics.exportFailures}
+}
+
+// registerLogMetrics registers instruments observing the records dropped by the log handler
+// and the failed log exports with the global meter provider.
+//
+// handler *FanoutHandler
+// error
+func (diagnostics *Diagnostics) registerLogMetrics(handler *FanoutHandler) error {
+	meter := otel.Meter(meterName)
+
+	dropped, err := meter.Int64ObservableCounter("telemetry.logs.dropped",
+		metric.WithUnit("{record}"),
+		metric.WithDescription("Number of log records not exported because the export queue was full."))
+	if err != nil {
+		return err
+	}
+
+	failures, err := meter.Int64ObservableCounter("telemetry.logs.export_failures",
+		metric.WithUnit("{export}"),
+		metric.WithDescription("Number of failed exports of log record batches."))
+	if err != nil {
+		return err
+	}
+
+	_, err = meter.RegisterCallback(func(ctx context.Context, observer metric.Observer) error {
+		observer.ObserveInt64(dropped, handler.Dropped())
+		observer.ObserveInt64(failures, diagnostics.ExportFailures())
+		return nil
+	}, dropped, failures)
+
+	return err
+}
+
+type countingLogExporter struct {
+	logssdk.LogRecordExporter
+	failures *atomic.Int64
+}
+
+// Export implements logssdk.LogRecordExporter by counting failed exports. The errors are
+// reported to the global error handler by the batch processor.
+func (exporter *countingLogExporter) Export(ctx context.Context, records []logssdk.ReadableLogRecord) error {
+	err := exporter.LogRecordExporter.Export(ctx, records)
+	if err != nil {
+		exporter.failures.Add(1)
+	}
+
+	return err
+}
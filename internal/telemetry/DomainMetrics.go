@@ -0,0 +1,158 @@
+package telemetry
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	"todo-api-go/entities"
+	"todo-api-go/reqctx"
+)
+
+// Attribute identifying the tenant of the principal causing a change
+const tenantAttribute = attribute.Key("todo.tenant")
+
+// ItemCounter counts the open and overdue items.
+//
+// It is implemented by persistence.ToDoEntityManager, which the telemetry package does not
+// import, so that the persistence package remains free to use it.
+type ItemCounter interface {
+	CountOpen(now time.Time) (open int64, overdue int64, err error)
+}
+
+// DomainMetrics records metrics of the to-do domain.
+//
+// It implements persistence.ItemObserver, counting created, completed and deleted items per
+// tenant and recording the time it took to complete items. The numbers of open and overdue
+// items are observed through an ItemCounter, at most once per refresh interval.
+type DomainMetrics struct {
+	created        metric.Int64Counter
+	completed      metric.Int64Counter
+	deleted        metric.Int64Counter
+	completionTime metric.Float64Histogram
+
+	counter  ItemCounter
+	refresh  time.Duration
+	mutex    sync.Mutex
+	counted  time.Time
+	open     int64
+	overdue  int64
+	observed bool
+}
+
+// NewDomainMetrics creates the instruments of the to-do domain using the global meter provider.
+//
+// counter: Counts the open and overdue items.
+// refresh: The minimum interval between counts, protecting the database from frequent collections.
+// Returns a pointer to DomainMetrics and an error if the instruments cannot be created.
+func NewDomainMetrics(counter ItemCounter, refresh time.Duration) (*DomainMetrics, error) {
+	meter := otel.Meter(meterName)
+	metrics := &DomainMetrics{counter: counter, refresh: refresh}
+
+	var err error
+	metrics.created, err = meter.Int64Counter("todo.items.created",
+		metric.WithUnit("{item}"),
+		metric.WithDescription("Number of created items."))
+	if err != nil {
+		return nil, err
+	}
+
+	metrics.completed, err = meter.Int64Counter("todo.items.completed",
+		metric.WithUnit("{item}"),
+		metric.WithDescription("Number of completed items."))
+	if err != nil {
+		return nil, err
+	}
+
+	metrics.deleted, err = meter.Int64Counter("todo.items.deleted",
+		metric.WithUnit("{item}"),
+		metric.WithDescription("Number of deleted items."))
+	if err != nil {
+		return nil, err
+	}
+
+	metrics.completionTime, err = meter.Float64Histogram("todo.items.completion_time",
+		metric.WithUnit("s"),
+		metric.WithDescription("Time from the creation to the completion of items."),
+		metric.WithExplicitBucketBoundaries(60, 300, 900, 3600, 4*3600, 24*3600, 3*24*3600, 7*24*3600, 30*24*3600))
+	if err != nil {
+		return nil, err
+	}
+
+	open, err := meter.Int64ObservableGauge("todo.items.open",
+		metric.WithUnit("{item}"),
+		metric.WithDescription("Number of items that have not been completed."))
+	if err != nil {
+		return nil, err
+	}
+
+	overdue, err := meter.Int64ObservableGauge("todo.items.overdue",
+		metric.WithUnit("{item}"),
+		metric.WithDescription("Number of items that have not been completed by their due date."))
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = meter.RegisterCallback(func(ctx context.Context, observer metric.Observer) error {
+		openCount, overdueCount, ok := metrics.count(ctx)
+		if ok {
+			observer.ObserveInt64(open, openCount)
+			observer.ObserveInt64(overdue, overdueCount)
+		}
+		return nil
+	}, open, overdue)
+	if err != nil {
+		return nil, err
+	}
+
+	return metrics, nil
+}
+
+// ItemChanged implements persistence.ItemObserver by recording the change.
+func (metrics *DomainMetrics) ItemChanged(ctx context.Context, action string, before *entities.ToDoItemEntity, after *entities.ToDoItemEntity) {
+	tenant := ""
+	if principal := reqctx.PrincipalFrom(ctx); principal != nil {
+		tenant = principal.Tenant
+	}
+	attributes := metric.WithAttributes(tenantAttribute.String(tenant))
+
+	switch action {
+	case entities.RevisionCreate:
+		metrics.created.Add(ctx, 1, attributes)
+	case entities.RevisionDelete:
+		metrics.deleted.Add(ctx, 1, attributes)
+	}
+
+	if after != nil && after.Completed && (before == nil || !before.Completed) {
+		metrics.completed.Add(ctx, 1, attributes)
+
+		if !after.CompletedAt.IsZero() && after.CompletedAt.After(after.CreatedAt) {
+			metrics.completionTime.Record(ctx, after.CompletedAt.Sub(after.CreatedAt).Seconds(), attributes)
+		}
+	}
+}
+
+// count returns the numbers of open and overdue items, counting them again if the refresh
+// interval has passed. It reports false if the items have never been counted successfully.
+func (metrics *DomainMetrics) count(ctx context.Context) (int64, int64, bool) {
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+
+	now := time.Now()
+	if !metrics.observed || now.Sub(metrics.counted) >= metrics.refresh {
+		open, overdue, err := metrics.counter.CountOpen(now)
+		if err != nil {
+			slog.WarnContext(ctx, "counting open items failed", "error", err)
+		} else {
+			metrics.open, metrics.overdue, metrics.observed = open, overdue, true
+			metrics.counted = now
+		}
+	}
+
+	return metrics.open, metrics.overdue, metrics.observed
+}
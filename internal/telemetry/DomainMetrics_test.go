@@ -0,0 +1,102 @@
+package telemetry_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	"todo-api-go/entities"
+	"todo-api-go/reqctx"
+	"todo-api-go/telemetry"
+)
+
+type fakeCounter struct {
+	calls int
+}
+
+func (counter *fakeCounter) CountOpen(now time.Time) (int64, int64, error) {
+	counter.calls++
+	return 7, 2, nil
+}
+
+func TestDomainMetrics(t *testing.T) {
+	assert := assert.New(t)
+
+	reader := metric.NewManualReader()
+	previous := otel.GetMeterProvider()
+	otel.SetMeterProvider(metric.NewMeterProvider(metric.WithReader(reader)))
+	t.Cleanup(func() { otel.SetMeterProvider(previous) })
+
+	counter := &fakeCounter{}
+	metrics, err := telemetry.NewDomainMetrics(counter, time.Hour)
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	ctx := reqctx.WithPrincipal(context.Background(), &reqctx.Principal{Subject: "alice", Tenant: "acme"})
+	created := time.Now().Add(-time.Hour)
+	open := &entities.ToDoItemEntity{ID: 1, CreatedAt: created}
+	done := &entities.ToDoItemEntity{ID: 1, CreatedAt: created, Completed: true, CompletedAt: time.Now()}
+
+	metrics.ItemChanged(ctx, entities.RevisionCreate, nil, open)
+	metrics.ItemChanged(ctx, entities.RevisionUpdate, open, done)
+	metrics.ItemChanged(ctx, entities.RevisionUpdate, done, done)
+	metrics.ItemChanged(ctx, entities.RevisionDelete, done, nil)
+
+	collected := collectMetrics(t, reader)
+	collectMetrics(t, reader)
+
+	assert.Equalf(int64(1), sumOf(collected["todo.items.created"]), "one item should be created")
+	assert.Equalf(int64(1), sumOf(collected["todo.items.completed"]), "one item should be completed")
+	assert.Equalf(int64(1), sumOf(collected["todo.items.deleted"]), "one item should be deleted")
+	assert.Equalf(int64(7), gaugeOf(collected["todo.items.open"]), "open items should be observed")
+	assert.Equalf(int64(2), gaugeOf(collected["todo.items.overdue"]), "overdue items should be observed")
+	assert.Equalf(1, counter.calls, "items should only be counted once per refresh interval")
+
+	histogram := collected["todo.items.completion_time"].Data.(metricdata.Histogram[float64])
+	assert.Lenf(histogram.DataPoints, 1, "completion time should be recorded")
+	assert.InDeltaf(3600, histogram.DataPoints[0].Sum, 5, "completion time should be an hour")
+
+	tenant, _ := histogram.DataPoints[0].Attributes.Value("todo.tenant")
+	assert.Equalf("acme", tenant.AsString(), "tenant should be recorded")
+}
+
+func collectMetrics(t *testing.T, reader metric.Reader) map[string]metricdata.Metrics {
+	var collected metricdata.ResourceMetrics
+	err := reader.Collect(context.Background(), &collected)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	metrics := map[string]metricdata.Metrics{}
+	for _, scope := range collected.ScopeMetrics {
+		for _, m := range scope.Metrics {
+			metrics[m.Name] = m
+		}
+	}
+
+	return metrics
+}
+
+func sumOf(m metricdata.Metrics) int64 {
+	var total int64
+	if sum, ok := m.Data.(metricdata.Sum[int64]); ok {
+		for _, point := range sum.DataPoints {
+			total += point.Value
+		}
+	}
+
+	return total
+}
+
+func gaugeOf(m metricdata.Metrics) int64 {
+	if gauge, ok := m.Data.(metricdata.Gauge[int64]); ok && len(gauge.DataPoints) > 0 {
+		return gauge.DataPoints[0].Value
+	}
+
+	return -1
+}
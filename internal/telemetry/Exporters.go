@@ -0,0 +1,288 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/agoda-com/opentelemetry-logs-go/exporters/otlp/otlplogs"
+	"github.com/agoda-com/opentelemetry-logs-go/exporters/otlp/otlplogs/otlplogsgrpc"
+	"github.com/agoda-com/opentelemetry-logs-go/exporters/otlp/otlplogs/otlplogshttp"
+	"github.com/agoda-com/opentelemetry-logs-go/exporters/stdout/stdoutlogs"
+	logssdk "github.com/agoda-com/opentelemetry-logs-go/sdk/logs"
+	"github.com/kelseyhightower/envconfig"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	otelprom "go.opentelemetry.io/otel/exporters/prometheus"
+	"go.opentelemetry.io/otel/exporters/stdout/stdoutmetric"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Exporter names accepted by the OTEL_*_EXPORTER environment variables
+const (
+	ExporterNone       = "none"
+	ExporterStdout     = "stdout"
+	ExporterConsole    = "console"
+	ExporterOtlp       = "otlp"
+	ExporterOtlpGrpc   = "otlp-grpc"
+	ExporterOtlpHttp   = "otlp-http"
+	ExporterPrometheus = "prometheus"
+)
+
+// OTLP protocols accepted by the OTEL_EXPORTER_OTLP_*PROTOCOL environment variables
+const (
+	ProtocolGrpc         = "grpc"
+	ProtocolHttpProtobuf = "http/protobuf"
+)
+
+// ExporterParameters selects the exporters of each signal.
+//
+// The parameters follow the OpenTelemetry environment variable specification, so that every
+// signal accepts a comma separated list of exporters, for example OTEL_TRACES_EXPORTER=otlp,stdout.
+// The "otlp" exporter uses the protocol configured by OTEL_EXPORTER_OTLP_PROTOCOL or its per-signal
+// counterpart, while "otlp-grpc" and "otlp-http" pin the protocol.
+//
+// Endpoints, headers, timeouts, batch delays (OTEL_BSP_*, OTEL_BLRP_*) and export intervals
+// (OTEL_METRIC_EXPORT_*) are read by the SDK and exporters themselves.
+type ExporterParameters struct {
+	// Exporters of spans
+	Traces []string `envconfig:"TRACES_EXPORTER" default:"otlp"`
+
+	// Exporters of metrics. "prometheus" serves the metrics for scraping on the Prometheus host and port.
+	Metrics []string `envconfig:"METRICS_EXPORTER" default:"otlp"`
+
+	// Exporters of log records, in addition to the JSON logs always written to stderr.
+	// With "none", logs are only written to stderr.
+	Logs []string `envconfig:"LOGS_EXPORTER" default:"otlp"`
+
+	// Protocol of the "otlp" exporters
+	Protocol string `envconfig:"EXPORTER_OTLP_PROTOCOL" default:"grpc"`
+
+	// Protocols of the "otlp" exporters per signal, overriding Protocol
+	TracesProtocol  string `envconfig:"EXPORTER_OTLP_TRACES_PROTOCOL"`
+	MetricsProtocol string `envconfig:"EXPORTER_OTLP_METRICS_PROTOCOL"`
+	LogsProtocol    string `envconfig:"EXPORTER_OTLP_LOGS_PROTOCOL"`
+
+	// Host and port of the admin listener serving /metrics for the "prometheus" exporter.
+	// Unlike the specification's default of localhost, it listens on all interfaces by
+	// default, so that it can be scraped inside a cluster.
+	PrometheusHost string `envconfig:"EXPORTER_PROMETHEUS_HOST"`
+	PrometheusPort int    `envconfig:"EXPORTER_PROMETHEUS_PORT" default:"9464"`
+}
+
+// exportersFromEnv reads the ExporterParameters from the "OTEL_***" environment variables.
+//
+// It returns the parameters and an error if an exporter or protocol is not supported.
+func exportersFromEnv() (ExporterParameters, error) {
+	var params ExporterParameters
+
+	err := envconfig.Process("otel", &params)
+	if err != nil {
+		return params, err
+	}
+
+	return params, params.validate()
+}
+
+// validate checks that every configured exporter and protocol is supported by its signal.
+func (params ExporterParameters) validate() error {
+	signals := []struct {
+		name       string
+		exporters  []string
+		protocol   string
+		prometheus bool
+	}{
+		{"traces", params.Traces, params.TracesProtocol, false},
+		{"metrics", params.Metrics, params.MetricsProtocol, true},
+		{"logs", params.Logs, params.LogsProtocol, false},
+	}
+
+	for _, signal := range signals {
+		for _, exporter := range signal.exporters {
+			switch normalizeExporter(exporter) {
+			case ExporterNone, ExporterStdout, ExporterOtlp, ExporterOtlpGrpc, ExporterOtlpHttp:
+			case ExporterPrometheus:
+				if !signal.prometheus {
+					return fmt.Errorf("exporter %q is not supported for %s", exporter, signal.name)
+				}
+			default:
+				return fmt.Errorf("unknown %s exporter %q", signal.name, exporter)
+			}
+		}
+
+		protocol := params.protocolOf(signal.protocol)
+		if protocol != ProtocolGrpc && protocol != ProtocolHttpProtobuf {
+			return fmt.Errorf("unsupported OTLP protocol %q for %s", protocol, signal.name)
+		}
+	}
+
+	return nil
+}
+
+// protocolOf returns the OTLP protocol of a signal, falling back to the general protocol.
+func (params ExporterParameters) protocolOf(signalProtocol string) string {
+	if signalProtocol != "" {
+		return signalProtocol
+	}
+
+	return params.Protocol
+}
+
+// normalizeExporter maps an exporter name onto its canonical form.
+//
+// The "console" alias of "stdout" is accepted for compatibility with other SDKs, and
+// "otlp" is resolved to the configured protocol later on.
+func normalizeExporter(exporter string) string {
+	exporter = strings.ToLower(strings.TrimSpace(exporter))
+	if exporter == ExporterConsole || exporter == "logging" {
+		return ExporterStdout
+	}
+
+	return exporter
+}
+
+// resolveOtlp maps the "otlp" exporter onto the exporter of the configured protocol.
+func resolveOtlp(exporter string, protocol string) string {
+	if exporter != ExporterOtlp {
+		return exporter
+	}
+
+	if protocol == ProtocolHttpProtobuf {
+		return ExporterOtlpHttp
+	}
+
+	return ExporterOtlpGrpc
+}
+
+// enabled reports whether any exporter other than "none" is configured in the list.
+func enabled(exporters []string) bool {
+	for _, exporter := range exporters {
+		if normalizeExporter(exporter) != ExporterNone && strings.TrimSpace(exporter) != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// configured reports whether the specified exporter is configured in the list.
+func configured(exporters []string, exporter string) bool {
+	for _, candidate := range exporters {
+		if normalizeExporter(candidate) == exporter {
+			return true
+		}
+	}
+
+	return false
+}
+
+// newSpanExporters creates the span exporters configured for traces.
+//
+// ctx context.Context, params ExporterParameters
+// []trace.SpanExporter, error
+func newSpanExporters(ctx context.Context, params ExporterParameters) ([]trace.SpanExporter, error) {
+	var exporters []trace.SpanExporter
+
+	for _, name := range params.Traces {
+		var exporter trace.SpanExporter
+		var err error
+
+		switch resolveOtlp(normalizeExporter(name), params.protocolOf(params.TracesProtocol)) {
+		case ExporterStdout:
+			exporter, err = stdouttrace.New()
+		case ExporterOtlpGrpc:
+			exporter, err = otlptracegrpc.New(ctx)
+		case ExporterOtlpHttp:
+			exporter, err = otlptracehttp.New(ctx)
+		default:
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+		exporters = append(exporters, exporter)
+	}
+
+	return exporters, nil
+}
+
+// newMetricReaders creates the readers of the exporters configured for metrics.
+//
+// Push exporters are wrapped into periodic readers, which honor OTEL_METRIC_EXPORT_INTERVAL
+// and OTEL_METRIC_EXPORT_TIMEOUT. The Prometheus exporter is a reader itself, which collects
+// on scrape and registers with the specified registry.
+//
+// ctx context.Context, params ExporterParameters, registry prometheus.Registerer
+// []metric.Reader, error
+func newMetricReaders(ctx context.Context, params ExporterParameters, registry prometheus.Registerer) ([]metric.Reader, error) {
+	var readers []metric.Reader
+
+	for _, name := range params.Metrics {
+		var exporter metric.Exporter
+		var err error
+
+		switch resolveOtlp(normalizeExporter(name), params.protocolOf(params.MetricsProtocol)) {
+		case ExporterStdout:
+			exporter, err = stdoutmetric.New()
+		case ExporterOtlpGrpc:
+			exporter, err = otlpmetricgrpc.New(ctx)
+		case ExporterOtlpHttp:
+			exporter, err = otlpmetrichttp.New(ctx)
+		case ExporterPrometheus:
+			var reader *otelprom.Exporter
+			reader, err = otelprom.New(otelprom.WithRegisterer(registry))
+			if err != nil {
+				return nil, err
+			}
+			readers = append(readers, reader)
+			continue
+		default:
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+		readers = append(readers, metric.NewPeriodicReader(exporter))
+	}
+
+	return readers, nil
+}
+
+// newLogExporters creates the log record exporters configured for logs.
+//
+// ctx context.Context, params ExporterParameters
+// []logssdk.LogRecordExporter, error
+func newLogExporters(ctx context.Context, params ExporterParameters) ([]logssdk.LogRecordExporter, error) {
+	var exporters []logssdk.LogRecordExporter
+
+	for _, name := range params.Logs {
+		var exporter logssdk.LogRecordExporter
+		var err error
+
+		switch resolveOtlp(normalizeExporter(name), params.protocolOf(params.LogsProtocol)) {
+		case ExporterStdout:
+			exporter, err = stdoutlogs.NewExporter()
+		case ExporterOtlpGrpc:
+			exporter, err = otlplogs.NewExporter(ctx, otlplogs.WithClient(otlplogsgrpc.NewClient()))
+		case ExporterOtlpHttp:
+			exporter, err = otlplogs.NewExporter(ctx, otlplogs.WithClient(otlplogshttp.NewClient()))
+		default:
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+		exporters = append(exporters, exporter)
+	}
+
+	return exporters, nil
+}
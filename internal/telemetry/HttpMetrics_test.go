@@ -0,0 +1,46 @@
+package telemetry_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"todo-api-go/telemetry"
+	"todo-api-go/testsupport"
+)
+
+func TestHTTPServerMetrics(t *testing.T) {
+	assert := assert.New(t)
+
+	recorded := testsupport.InstallTestTelemetry(t)
+
+	middleware, err := telemetry.HTTPServerMetrics()
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	router := gin.New()
+	router.Use(middleware)
+	router.GET("/api/todo/:id", func(c *gin.Context) {
+		c.Status(http.StatusNotFound)
+	})
+
+	req, _ := http.NewRequest("GET", "/api/todo/42", nil)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	// The route should be recorded instead of the path
+	recorded.AssertMetricValue("http.server.request.duration", 1,
+		attribute.String("http.route", "/api/todo/:id"),
+		attribute.Int("http.response.status_code", 404))
+	recorded.AssertMetricValue("http.server.active_requests", 0)
+
+	// Non-standard methods should not be recorded verbatim
+	req, _ = http.NewRequest("FROBNICATE", "/api/todo/42", nil)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	recorded.AssertMetricValue("http.server.request.duration", 1,
+		attribute.String("http.request.method", "_OTHER"))
+}
@@ -0,0 +1,159 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+)
+
+// Number of log records buffered for export before further records are dropped
+const DefaultLogQueueSize = 2048
+
+// FanoutHandler is a slog.Handler writing every record to a local handler, usually JSON
+// on stderr, and additionally passing it on to a remote handler, usually OpenTelemetry.
+//
+// Records are written to the local handler synchronously, so that logs are never lost
+// locally. They are queued for the remote handler, so that a slow or unavailable collector
+// does not block the application. When the queue is full, records are dropped for the
+// remote handler only and counted.
+type FanoutHandler struct {
+	local  slog.Handler
+	remote slog.Handler
+	queue  *logQueue
+}
+
+type queuedRecord struct {
+	ctx     context.Context
+	handler slog.Handler
+	record  slog.Record
+}
+
+// logQueue is shared by a FanoutHandler and the handlers derived from it.
+type logQueue struct {
+	records chan queuedRecord
+	dropped atomic.Int64
+	done    chan struct{}
+	mutex   sync.RWMutex
+	closed  bool
+}
+
+// NewFanoutHandler creates a FanoutHandler and starts forwarding records to the remote handler.
+//
+// local: The handler every record is written to synchronously.
+// remote: The handler records are passed on to asynchronously. It may be nil.
+// queueSize: The number of records buffered for the remote handler.
+// Returns a pointer to FanoutHandler, which has to be closed to flush the queued records.
+func NewFanoutHandler(local slog.Handler, remote slog.Handler, queueSize int) *FanoutHandler {
+	queue := &logQueue{
+		records: make(chan queuedRecord, queueSize),
+		done:    make(chan struct{}),
+	}
+
+	go queue.forward()
+
+	return &FanoutHandler{local: local, remote: remote, queue: queue}
+}
+
+// Enabled implements slog.Handler.
+func (handler *FanoutHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return handler.local.Enabled(ctx, level) || (handler.remote != nil && handler.remote.Enabled(ctx, level))
+}
+
+// Handle implements slog.Handler by writing the record locally and queueing it for the remote handler.
+func (handler *FanoutHandler) Handle(ctx context.Context, record slog.Record) error {
+	var err error
+	if handler.local.Enabled(ctx, record.Level) {
+		err = handler.local.Handle(ctx, record)
+	}
+
+	if handler.remote != nil && handler.remote.Enabled(ctx, record.Level) {
+		handler.queue.push(queuedRecord{ctx: ctx, handler: handler.remote, record: record.Clone()})
+	}
+
+	return err
+}
+
+// WithAttrs implements slog.Handler.
+func (handler *FanoutHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	derived := &FanoutHandler{local: handler.local.WithAttrs(attrs), queue: handler.queue}
+	if handler.remote != nil {
+		derived.remote = handler.remote.WithAttrs(attrs)
+	}
+
+	return derived
+}
+
+// WithGroup implements slog.Handler.
+func (handler *FanoutHandler) WithGroup(name string) slog.Handler {
+	derived := &FanoutHandler{local: handler.local.WithGroup(name), queue: handler.queue}
+	if handler.remote != nil {
+		derived.remote = handler.remote.WithGroup(name)
+	}
+
+	return derived
+}
+
+// Dropped returns the number of records that were not passed on to the remote handler
+// because the queue was full or the handler had been closed.
+func (handler *FanoutHandler) Dropped() int64 {
+	return handler.queue.dropped.Load()
+}
+
+// Local returns the handler every record is written to synchronously.
+func (handler *FanoutHandler) Local() slog.Handler {
+	return handler.local
+}
+
+// Close stops queueing records and waits until the queued records have been passed on to
+// the remote handler, or the context is done.
+//
+// Records handled after closing are only written locally.
+func (handler *FanoutHandler) Close(ctx context.Context) error {
+	handler.queue.close()
+
+	select {
+	case <-handler.queue.done:
+		return nil
+	case <-ctx.Done():
+		return errors.Join(errors.New("log queue not drained"), ctx.Err())
+	}
+}
+
+// push queues a record without blocking, dropping it if the queue is full or closed.
+func (queue *logQueue) push(record queuedRecord) {
+	queue.mutex.RLock()
+	defer queue.mutex.RUnlock()
+
+	if queue.closed {
+		queue.dropped.Add(1)
+		return
+	}
+
+	select {
+	case queue.records <- record:
+	default:
+		queue.dropped.Add(1)
+	}
+}
+
+// forward passes queued records on to their remote handler until the queue is closed.
+func (queue *logQueue) forward() {
+	defer close(queue.done)
+
+	for queued := range queue.records {
+		_ = queued.handler.Handle(queued.ctx, queued.record)
+	}
+}
+
+// close stops accepting records, letting forward finish once the queue is drained.
+func (queue *logQueue) close() {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	if !queue.closed {
+		queue.closed = true
+		close(queue.records)
+	}
+}
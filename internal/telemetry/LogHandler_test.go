@@ -0,0 +1,82 @@
+package telemetry_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"todo-api-go/telemetry"
+)
+
+// blockingHandler records the messages it handles, blocking until it is released.
+type blockingHandler struct {
+	release  chan struct{}
+	mutex    sync.Mutex
+	messages []string
+}
+
+func (handler *blockingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return true
+}
+
+func (handler *blockingHandler) Handle(ctx context.Context, record slog.Record) error {
+	<-handler.release
+
+	handler.mutex.Lock()
+	defer handler.mutex.Unlock()
+	handler.messages = append(handler.messages, record.Message)
+	return nil
+}
+
+func (handler *blockingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return handler
+}
+
+func (handler *blockingHandler) WithGroup(name string) slog.Handler {
+	return handler
+}
+
+func TestFanoutHandler(t *testing.T) {
+	assert := assert.New(t)
+
+	var local bytes.Buffer
+	remote := &blockingHandler{release: make(chan struct{})}
+	handler := telemetry.NewFanoutHandler(slog.NewJSONHandler(&local, nil), remote, 2)
+	logger := slog.New(handler).With("component", "test")
+
+	for i := 0; i < 10; i++ {
+		logger.Info("message")
+	}
+
+	assert.Equalf(10, strings.Count(local.String(), `"component":"test"`), "every record should be written locally")
+	assert.GreaterOrEqualf(handler.Dropped(), int64(7), "records exceeding the queue should be dropped")
+
+	close(remote.release)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err := handler.Close(ctx)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf(10-int(handler.Dropped()), len(remote.messages), "queued records should be passed on when closing")
+
+	logger.Info("after close")
+	assert.Equalf(11, strings.Count(local.String(), `"component":"test"`), "records should still be written locally after closing")
+}
+
+func TestDiagnostics(t *testing.T) {
+	assert := assert.New(t)
+
+	var local bytes.Buffer
+	diagnostics := telemetry.NewDiagnostics(slog.NewJSONHandler(&local, nil))
+
+	diagnostics.Handle(errors.New("collector unavailable"))
+	diagnostics.Handle(errors.New("collector unavailable"))
+
+	assert.Equalf(1, strings.Count(local.String(), "collector unavailable"), "repeated errors should be suppressed")
+}
@@ -0,0 +1,109 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/kelseyhightower/envconfig"
+
+	"todo-api-go/reqctx"
+)
+
+type LogParameters struct {
+	// Minimum level of records that are logged
+	Level slog.Level `default:"INFO"`
+
+	// Minimum levels per component, replacing Level for the loggers of those components
+	Levels Levels
+}
+
+// Levels maps components, usually package names, onto minimum log levels.
+//
+// Levels are configured using the form "<component>=<level>;<component>=<level>", for example
+// "persistence=DEBUG;access=WARN".
+type Levels map[string]slog.Level
+
+// Decode implements envconfig.Decoder by parsing the configuration form of component levels.
+func (levels *Levels) Decode(value string) error {
+	parsed := Levels{}
+
+	for _, entry := range strings.Split(value, ";") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+
+		component, levelValue, ok := strings.Cut(entry, "=")
+		if !ok {
+			return fmt.Errorf("invalid level entry %q: expected <component>=<level>", entry)
+		}
+
+		var level slog.Level
+		err := level.UnmarshalText([]byte(strings.TrimSpace(levelValue)))
+		if err != nil {
+			return fmt.Errorf("invalid level entry %q: %w", entry, err)
+		}
+
+		parsed[strings.TrimSpace(component)] = level
+	}
+
+	*levels = parsed
+	return nil
+}
+
+// LevelHandler is a slog.Handler filtering records by a minimum level, which may be configured
+// per component. The component of a logger is taken from its reqctx.ComponentKey attribute.
+type LevelHandler struct {
+	handler slog.Handler
+	params  LogParameters
+	level   slog.Level
+}
+
+// logParametersFromEnv reads the LogParameters from the "LOG_***" environment variables.
+func logParametersFromEnv() (LogParameters, error) {
+	var params LogParameters
+
+	err := envconfig.Process("log", &params)
+	return params, err
+}
+
+// NewLevelHandler creates a LevelHandler passing the records it accepts on to the specified handler.
+//
+// handler: The handler records are passed on to. It should accept records of all levels.
+// params: The minimum levels.
+// Returns a pointer to LevelHandler.
+func NewLevelHandler(handler slog.Handler, params LogParameters) *LevelHandler {
+	return &LevelHandler{handler: handler, params: params, level: params.Level}
+}
+
+// Enabled implements slog.Handler.
+func (handler *LevelHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= handler.level && handler.handler.Enabled(ctx, level)
+}
+
+// Handle implements slog.Handler.
+func (handler *LevelHandler) Handle(ctx context.Context, record slog.Record) error {
+	return handler.handler.Handle(ctx, record)
+}
+
+// WithAttrs implements slog.Handler, applying the level of the component if the attributes name one.
+func (handler *LevelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	level := handler.level
+	for _, attr := range attrs {
+		if attr.Key != reqctx.ComponentKey {
+			continue
+		}
+
+		if componentLevel, ok := handler.params.Levels[attr.Value.String()]; ok {
+			level = componentLevel
+		}
+	}
+
+	return &LevelHandler{handler: handler.handler.WithAttrs(attrs), params: handler.params, level: level}
+}
+
+// WithGroup implements slog.Handler.
+func (handler *LevelHandler) WithGroup(name string) slog.Handler {
+	return &LevelHandler{handler: handler.handler.WithGroup(name), params: handler.params, level: handler.level}
+}
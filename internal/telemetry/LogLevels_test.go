@@ -0,0 +1,43 @@
+package telemetry_test
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"todo-api-go/reqctx"
+	"todo-api-go/telemetry"
+)
+
+func TestLevelHandler(t *testing.T) {
+	assert := assert.New(t)
+
+	var levels telemetry.Levels
+	err := levels.Decode("persistence=DEBUG; access=WARN")
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	var output bytes.Buffer
+	handler := telemetry.NewLevelHandler(slog.NewJSONHandler(&output, &slog.HandlerOptions{Level: slog.LevelDebug}),
+		telemetry.LogParameters{Level: slog.LevelInfo, Levels: levels})
+	logger := slog.New(handler)
+
+	logger.Debug("default debug")
+	logger.Info("default info")
+	logger.With(reqctx.ComponentKey, "persistence").Debug("persistence debug")
+	logger.With(reqctx.ComponentKey, "access").Info("access info")
+	logger.With(reqctx.ComponentKey, "access").Warn("access warn")
+
+	logged := output.String()
+	assert.NotContainsf(logged, "default debug", "debug should be filtered by default")
+	assert.Containsf(logged, "default info", "info should be logged by default")
+	assert.Containsf(logged, "persistence debug", "component level should allow debug")
+	assert.NotContainsf(logged, "access info", "component level should filter info")
+	assert.Containsf(logged, "access warn", "component level should allow warnings")
+	assert.Equalf(3, strings.Count(logged, "\n"), "three records should be logged")
+
+	err = levels.Decode("persistence=LOUD")
+	assert.NotNilf(err, "unknown level should be rejected")
+}
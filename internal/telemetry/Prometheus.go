@@ -0,0 +1,54 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Path serving the metrics on the admin listener
+const MetricsPath = "/metrics"
+
+// startMetricsServer starts the admin HTTP server serving the metrics of the Prometheus
+// registry at /metrics.
+//
+// The server listens on a port separate from the API, so that scraping is neither exposed
+// through the API's ingress nor subject to its authorization and rate limits. The listener
+// is opened before returning, so that a port already in use is reported as an error.
+//
+// params ExporterParameters, registry *prometheus.Registry
+// Returns a function shutting the server down and an error.
+func startMetricsServer(params ExporterParameters, registry *prometheus.Registry) (func(context.Context) error, error) {
+	address := net.JoinHostPort(params.PrometheusHost, strconv.Itoa(params.PrometheusPort))
+
+	mux := http.NewServeMux()
+	mux.Handle(MetricsPath, promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+
+	server := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		slog.Info("Serving metrics", "address", listener.Addr().String(), "path", MetricsPath)
+
+		err := server.Serve(listener)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("metrics server failed", "error", err)
+		}
+	}()
+
+	return server.Shutdown, nil
+}
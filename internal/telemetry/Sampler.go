@@ -0,0 +1,259 @@
+package telemetry
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// Attributes identifying the route of a server span, as set by otelgin
+const (
+	routeAttribute  = attribute.Key("http.route")
+	methodAttribute = attribute.Key("http.method")
+)
+
+type SamplingParameters struct {
+	// Ratio of root spans that are sampled, between 0 and 1
+	Ratio float64 `default:"1"`
+
+	// Ratios replacing Ratio for root spans of individual routes, keyed by "<METHOD> <route>"
+	// or "<route>", for example "/health=0;GET /api/todo=0.1"
+	Routes Ratios `default:"/health=0"`
+
+	// Whether spans ending with an error status are exported even if they were not sampled
+	KeepErrors bool `split_words:"true" default:"true"`
+
+	// Spans lasting at least this long are exported even if they were not sampled.
+	// Zero disables the rule.
+	SlowThreshold time.Duration `split_words:"true" default:"1s"`
+}
+
+// Ratios maps routes onto sampling ratios.
+//
+// Ratios are configured using the form "<route>=<ratio>;<route>=<ratio>".
+type Ratios map[string]float64
+
+// Decode implements envconfig.Decoder by parsing the configuration form of route ratios.
+func (ratios *Ratios) Decode(value string) error {
+	parsed := Ratios{}
+
+	for _, entry := range strings.Split(value, ";") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+
+		route, ratioValue, ok := strings.Cut(entry, "=")
+		if !ok {
+			return fmt.Errorf("invalid ratio entry %q: expected <route>=<ratio>", entry)
+		}
+
+		ratio, err := strconv.ParseFloat(strings.TrimSpace(ratioValue), 64)
+		if err != nil || !validRatio(ratio) {
+			return fmt.Errorf("invalid ratio entry %q: ratio must be a number between 0 and 1", entry)
+		}
+
+		parsed[strings.TrimSpace(route)] = ratio
+	}
+
+	*ratios = parsed
+	return nil
+}
+
+// RuleSampler is a parent-based sampler whose ratio can be changed at runtime.
+//
+// Spans with a parent follow the sampling decision of the parent. Root spans are sampled
+// according to the ratio of their route, or the general ratio otherwise.
+//
+// As errors and durations are unknown when a span starts, spans that are not sampled are still
+// recorded, unless the ratio of their route is zero, which is meant for noise such as health
+// checks. The processor returned by Processor exports those ending with an error status or
+// lasting longer than the slow threshold. Only the failed or slow spans themselves are exported,
+// not the complete trace they belong to.
+type RuleSampler struct {
+	params SamplingParameters
+	ratio  atomic.Uint64
+}
+
+// NewSamplerFromEnv creates a RuleSampler configured from the "SAMPLING_***" environment variables.
+//
+// Returns a pointer to RuleSampler and an error.
+func NewSamplerFromEnv() (*RuleSampler, error) {
+	var params SamplingParameters
+
+	err := envconfig.Process("sampling", &params)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewSampler(params)
+}
+
+// NewSampler creates a RuleSampler with the specified parameters.
+//
+// params: The sampling rules.
+// Returns a pointer to RuleSampler and an error if the ratio is out of range.
+func NewSampler(params SamplingParameters) (*RuleSampler, error) {
+	sampler := &RuleSampler{params: params}
+
+	err := sampler.SetRatio(params.Ratio)
+	if err != nil {
+		return nil, err
+	}
+
+	return sampler, nil
+}
+
+// Ratio returns the ratio of root spans that are currently sampled.
+func (sampler *RuleSampler) Ratio() float64 {
+	return math.Float64frombits(sampler.ratio.Load())
+}
+
+// SetRatio changes the ratio of root spans that are sampled, taking effect immediately.
+// Route ratios are not affected.
+//
+// It returns an error if the ratio is not between 0 and 1.
+func (sampler *RuleSampler) SetRatio(ratio float64) error {
+	if !validRatio(ratio) {
+		return fmt.Errorf("invalid sampling ratio %v: must be between 0 and 1", ratio)
+	}
+
+	sampler.ratio.Store(math.Float64bits(ratio))
+	return nil
+}
+
+// ShouldSample implements trace.Sampler.
+func (sampler *RuleSampler) ShouldSample(params trace.SamplingParameters) trace.SamplingResult {
+	parent := oteltrace.SpanContextFromContext(params.ParentContext)
+
+	if parent.IsValid() {
+		if parent.IsSampled() {
+			return sampler.result(trace.RecordAndSample, parent)
+		}
+		return sampler.result(sampler.unsampled(), parent)
+	}
+
+	ratio, ok := sampler.routeRatio(params)
+	if ok && ratio <= 0 {
+		return sampler.result(trace.Drop, parent)
+	}
+	if !ok {
+		ratio = sampler.Ratio()
+	}
+
+	if trace.TraceIDRatioBased(ratio).ShouldSample(params).Decision == trace.RecordAndSample {
+		return sampler.result(trace.RecordAndSample, parent)
+	}
+
+	return sampler.result(sampler.unsampled(), parent)
+}
+
+// Description implements trace.Sampler.
+func (sampler *RuleSampler) Description() string {
+	return fmt.Sprintf("RuleSampler{ratio:%v,routes:%d,keepErrors:%t,slowThreshold:%s}",
+		sampler.Ratio(), len(sampler.params.Routes), sampler.params.KeepErrors, sampler.params.SlowThreshold)
+}
+
+// Processor wraps a span processor, usually a batch span processor, so that spans which were
+// not sampled are passed on to it if they failed or were slow.
+//
+// next trace.SpanProcessor
+// trace.SpanProcessor
+func (sampler *RuleSampler) Processor(next trace.SpanProcessor) trace.SpanProcessor {
+	return &keepingProcessor{SpanProcessor: next, sampler: sampler}
+}
+
+// routeRatio returns the ratio configured for the route of a root span, if any.
+func (sampler *RuleSampler) routeRatio(params trace.SamplingParameters) (float64, bool) {
+	var route, method string
+	for _, attr := range params.Attributes {
+		switch attr.Key {
+		case routeAttribute:
+			route = attr.Value.AsString()
+		case methodAttribute:
+			method = attr.Value.AsString()
+		}
+	}
+
+	if route == "" {
+		route = params.Name
+	}
+
+	if ratio, ok := sampler.params.Routes[method+" "+route]; ok {
+		return ratio, true
+	}
+
+	ratio, ok := sampler.params.Routes[route]
+	return ratio, ok
+}
+
+// unsampled returns the decision for spans that are not sampled: they are recorded if a rule
+// may still export them.
+func (sampler *RuleSampler) unsampled() trace.SamplingDecision {
+	if sampler.params.KeepErrors || sampler.params.SlowThreshold > 0 {
+		return trace.RecordOnly
+	}
+
+	return trace.Drop
+}
+
+// result creates a SamplingResult preserving the trace state of the parent.
+func (sampler *RuleSampler) result(decision trace.SamplingDecision, parent oteltrace.SpanContext) trace.SamplingResult {
+	return trace.SamplingResult{
+		Decision:   decision,
+		Tracestate: parent.TraceState(),
+	}
+}
+
+// keep reports whether a span that was not sampled is exported anyway.
+func (sampler *RuleSampler) keep(span trace.ReadOnlySpan) bool {
+	if sampler.params.KeepErrors && span.Status().Code == codes.Error {
+		return true
+	}
+
+	threshold := sampler.params.SlowThreshold
+	return threshold > 0 && span.EndTime().Sub(span.StartTime()) >= threshold
+}
+
+type keepingProcessor struct {
+	trace.SpanProcessor
+	sampler *RuleSampler
+}
+
+// OnEnd implements trace.SpanProcessor by passing on sampled spans, as well as spans that were
+// only recorded if the sampler keeps them.
+func (processor *keepingProcessor) OnEnd(span trace.ReadOnlySpan) {
+	if span.SpanContext().IsSampled() {
+		processor.SpanProcessor.OnEnd(span)
+		return
+	}
+
+	if processor.sampler.keep(span) {
+		processor.SpanProcessor.OnEnd(keptSpan{span})
+	}
+}
+
+// keptSpan presents a recorded span as sampled, so that processors and exporters accept it.
+type keptSpan struct {
+	trace.ReadOnlySpan
+}
+
+// SpanContext returns the span context of the span with the sampled flag set.
+func (span keptSpan) SpanContext() oteltrace.SpanContext {
+	spanContext := span.ReadOnlySpan.SpanContext()
+	return spanContext.WithTraceFlags(spanContext.TraceFlags().WithSampled(true))
+}
+
+// validRatio reports whether a ratio is between 0 and 1.
+func validRatio(ratio float64) bool {
+	return ratio >= 0 && ratio <= 1
+}
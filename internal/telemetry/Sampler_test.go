@@ -0,0 +1,82 @@
+package telemetry_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	oteltrace "go.opentelemetry.io/otel/trace"
+
+	"todo-api-go/telemetry"
+)
+
+func TestRuleSampler(t *testing.T) {
+	assert := assert.New(t)
+
+	sampler, err := telemetry.NewSampler(telemetry.SamplingParameters{
+		Ratio:      0,
+		Routes:     telemetry.Ratios{"/health": 0, "GET /api/todo": 1},
+		KeepErrors: true,
+	})
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := trace.NewTracerProvider(
+		trace.WithSampler(sampler),
+		trace.WithSpanProcessor(sampler.Processor(recorder)),
+	)
+	tracer := provider.Tracer("test")
+	ctx := context.Background()
+
+	_, span := tracer.Start(ctx, "/api/todo/:id")
+	span.End()
+	assert.Emptyf(recorder.Ended(), "span should not be sampled")
+
+	_, span = tracer.Start(ctx, "/api/todo/:id")
+	span.SetStatus(codes.Error, "failed")
+	span.End()
+	assert.Lenf(recorder.Ended(), 1, "failed span should be kept")
+	assert.Truef(recorder.Ended()[0].SpanContext().IsSampled(), "kept span should be exported as sampled")
+
+	_, span = tracer.Start(ctx, "/health", oteltrace.WithAttributes(attribute.String("http.route", "/health")))
+	span.RecordError(errors.New("failed"))
+	span.SetStatus(codes.Error, "failed")
+	span.End()
+	assert.Lenf(recorder.Ended(), 1, "health check should never be recorded")
+
+	parentCtx, parent := tracer.Start(ctx, "/api/todo",
+		oteltrace.WithAttributes(attribute.String("http.route", "/api/todo"), attribute.String("http.method", "GET")))
+	_, child := tracer.Start(parentCtx, "query")
+	child.End()
+	parent.End()
+	assert.Lenf(recorder.Ended(), 3, "route ratio should sample the span and its child")
+
+	err = sampler.SetRatio(1)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf(1.0, sampler.Ratio(), "ratio should be changed")
+
+	_, span = tracer.Start(ctx, "/api/todo/:id")
+	span.End()
+	assert.Lenf(recorder.Ended(), 4, "span should be sampled after changing the ratio")
+
+	err = sampler.SetRatio(1.5)
+	assert.NotNilf(err, "ratio out of range should be rejected")
+}
+
+func TestRatiosDecode(t *testing.T) {
+	assert := assert.New(t)
+
+	var ratios telemetry.Ratios
+	err := ratios.Decode("/health=0; GET /api/todo=0.5")
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf(telemetry.Ratios{"/health": 0, "GET /api/todo": 0.5}, ratios, "ratios should match")
+
+	err = ratios.Decode("/health=2")
+	assert.NotNilf(err, "ratio out of range should be rejected")
+}
@@ -0,0 +1,125 @@
+package telemetry
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"runtime/debug"
+
+	"github.com/kelseyhightower/envconfig"
+)
+
+// Name of the service, unless overridden by OTEL_SERVICE_NAME
+const ServiceName = "todo-api-go"
+
+// Build information that may be set when linking, for example
+//
+//	go build -ldflags "-X todo-api-go/telemetry.Version=v1.2.3 -X todo-api-go/telemetry.Revision=$(git rev-parse HEAD)"
+//
+// Values that are not set are taken from the build information embedded by the Go toolchain.
+var (
+	Version      string
+	Revision     string
+	RevisionTime string
+)
+
+// Version reported when neither the linker nor the Go toolchain provide one
+const develVersion = "(devel)"
+
+type ServiceParameters struct {
+	// Deployment environment, such as "production" or "staging"
+	Environment string `default:"development"`
+
+	// Identifier of this instance of the service. Defaults to the host name, which is
+	// unique per pod or container.
+	InstanceID string `split_words:"true"`
+}
+
+// ServiceInfo describes the running service and its build.
+type ServiceInfo struct {
+	Name         string
+	Version      string
+	Revision     string
+	RevisionTime string
+	Modified     bool
+	GoVersion    string
+	Environment  string
+	InstanceID   string
+}
+
+// NewServiceInfoFromEnv describes the running service, reading its deployment from the
+// "SERVICE_***" environment variables and its version from the build information.
+//
+// Returns a ServiceInfo and an error.
+func NewServiceInfoFromEnv() (ServiceInfo, error) {
+	var params ServiceParameters
+
+	err := envconfig.Process("service", &params)
+	if err != nil {
+		return ServiceInfo{}, err
+	}
+
+	return NewServiceInfo(params), nil
+}
+
+// NewServiceInfo describes the running service deployed as specified.
+//
+// Version and VCS information set when linking take precedence over the information
+// embedded by the Go toolchain.
+//
+// params: The deployment of the service.
+// Returns a ServiceInfo.
+func NewServiceInfo(params ServiceParameters) ServiceInfo {
+	info := ServiceInfo{
+		Name:        ServiceName,
+		Version:     develVersion,
+		Environment: params.Environment,
+		InstanceID:  params.InstanceID,
+	}
+
+	if build, ok := debug.ReadBuildInfo(); ok {
+		info.GoVersion = build.GoVersion
+		if build.Main.Version != "" {
+			info.Version = build.Main.Version
+		}
+
+		for _, setting := range build.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				info.Revision = setting.Value
+			case "vcs.time":
+				info.RevisionTime = setting.Value
+			case "vcs.modified":
+				info.Modified = setting.Value == "true"
+			}
+		}
+	}
+
+	if Version != "" {
+		info.Version = Version
+	}
+	if Revision != "" {
+		info.Revision = Revision
+	}
+	if RevisionTime != "" {
+		info.RevisionTime = RevisionTime
+	}
+
+	if info.InstanceID == "" {
+		info.InstanceID = defaultInstanceID()
+	}
+
+	return info
+}
+
+// defaultInstanceID returns the host name, or a random identifier if it is unknown.
+func defaultInstanceID() string {
+	hostName, err := os.Hostname()
+	if err == nil && hostName != "" {
+		return hostName
+	}
+
+	random := make([]byte, 16)
+	_, _ = rand.Read(random)
+	return hex.EncodeToString(random)
+}
@@ -0,0 +1,32 @@
+package telemetry_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"todo-api-go/telemetry"
+)
+
+func TestServiceInfo(t *testing.T) {
+	assert := assert.New(t)
+
+	info := telemetry.NewServiceInfo(telemetry.ServiceParameters{Environment: "staging", InstanceID: "instance-1"})
+	assert.Equalf(telemetry.ServiceName, info.Name, "name should match")
+	assert.Equalf("staging", info.Environment, "environment should match")
+	assert.Equalf("instance-1", info.InstanceID, "instance ID should match")
+	assert.NotEmptyf(info.Version, "version should default to the build information")
+	assert.NotEmptyf(info.GoVersion, "Go version should be taken from the build information")
+
+	telemetry.Version = "v1.2.3"
+	telemetry.Revision = "abc123"
+	t.Cleanup(func() {
+		telemetry.Version = ""
+		telemetry.Revision = ""
+	})
+
+	info = telemetry.NewServiceInfo(telemetry.ServiceParameters{})
+	assert.Equalf("v1.2.3", info.Version, "linked version should take precedence")
+	assert.Equalf("abc123", info.Revision, "linked revision should take precedence")
+	assert.NotEmptyf(info.InstanceID, "instance ID should default to the host name")
+}
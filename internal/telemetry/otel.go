@@ -5,17 +5,14 @@ import (
 	"errors"
 	"log/slog"
 	"os"
-	"time"
 
 	"github.com/agoda-com/opentelemetry-go/otelslog"
-	"github.com/agoda-com/opentelemetry-logs-go/exporters/otlp/otlplogs"
 	logssdk "github.com/agoda-com/opentelemetry-logs-go/sdk/logs"
+	"github.com/prometheus/client_golang/prometheus"
 
+	"go.opentelemetry.io/contrib/instrumentation/runtime"
 	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
-	"go.opentelemetry.io/otel/exporters/stdout/stdoutmetric"
-	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/sdk/metric"
 	"go.opentelemetry.io/otel/sdk/resource"
@@ -24,9 +21,14 @@ import (
 	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
 )
 
+// Attribute carrying the VCS revision the service was built from, which has no semantic convention yet
+const vcsRevisionAttribute = attribute.Key("service.vcs.revision")
+
 // setupOTelSDK bootstraps the OpenTelemetry pipeline.
+// Root spans are sampled by the specified sampler, whose ratio may be changed at runtime.
+// The telemetry is attributed to the service described by info.
 // If it does not return an error, make sure to call shutdown for proper cleanup.
-func SetupOTelSDK(ctx context.Context) (shutdown func(context.Context) error, err error) {
+func SetupOTelSDK(ctx context.Context, sampler *RuleSampler, info ServiceInfo) (shutdown func(context.Context) error, err error) {
 	var shutdownFuncs []func(context.Context) error
 
 	// shutdown calls cleanup functions registered via shutdownFuncs.
@@ -46,28 +48,62 @@ func SetupOTelSDK(ctx context.Context) (shutdown func(context.Context) error, er
 		err = errors.Join(inErr, shutdown(ctx))
 	}
 
+	// Log locally until the pipeline is set up, and report its own errors locally.
+	// Levels are filtered by the level handler wrapping the handlers.
+	logParams, err := logParametersFromEnv()
+	if err != nil {
+		handleErr(err)
+		return
+	}
+
+	localHandler := slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug})
+	slog.SetDefault(slog.New(NewLevelHandler(localHandler, logParams)))
+	diagnostics := NewDiagnostics(localHandler)
+	otel.SetErrorHandler(diagnostics)
+
 	// Some common variables
 	backgroundCtx := context.Background()
-	resource := newResource(backgroundCtx)
+	resource, err := newResource(backgroundCtx, info)
+	if err != nil {
+		handleErr(err)
+		return
+	}
+
+	exporters, err := exportersFromEnv()
+	if err != nil {
+		handleErr(err)
+		return
+	}
 
 	// Set up propagator.
 	prop := newPropagator()
 	otel.SetTextMapPropagator(prop)
 
 	// Set up logger.
-	loggerProvider, err := newLoggerProvider(backgroundCtx, resource)
+	loggerProvider, err := newLoggerProvider(backgroundCtx, resource, exporters, diagnostics)
 	if err != nil {
 		handleErr(err)
 		return
 	}
-	shutdownFuncs = append(shutdownFuncs, loggerProvider.Shutdown)
 
-	// Wire up logger to OpenTelemetry
-	otelLogger := slog.New(otelslog.NewOtelHandler(loggerProvider, &otelslog.HandlerOptions{}))
-	slog.SetDefault(otelLogger)
+	// Wire up logger to OpenTelemetry, unless log export has been disabled. Logs are always
+	// written locally, so that they are not lost when the collector is unavailable.
+	var remoteHandler slog.Handler
+	if enabled(exporters.Logs) {
+		remoteHandler = otelslog.NewOtelHandler(loggerProvider, &otelslog.HandlerOptions{Level: slog.LevelDebug})
+	}
+	logHandler := NewFanoutHandler(localHandler, remoteHandler, DefaultLogQueueSize)
+	slog.SetDefault(slog.New(NewLevelHandler(logHandler, logParams)))
+
+	shutdownFuncs = append(shutdownFuncs, func(ctx context.Context) error {
+		err := logHandler.Close(ctx)
+		slog.SetDefault(slog.New(NewLevelHandler(localHandler, logParams)))
+		return errors.Join(err, loggerProvider.Shutdown(ctx))
+	})
 
 	// Set up meter provider.
-	meterProvider, err := newMeterProvider(backgroundCtx)
+	registry := prometheus.NewRegistry()
+	meterProvider, err := newMeterProvider(backgroundCtx, resource, exporters, registry)
 	if err != nil {
 		handleErr(err)
 		return
@@ -75,8 +111,32 @@ func SetupOTelSDK(ctx context.Context) (shutdown func(context.Context) error, er
 	shutdownFuncs = append(shutdownFuncs, meterProvider.Shutdown)
 	otel.SetMeterProvider(meterProvider)
 
+	// Observe the health of the log pipeline
+	err = diagnostics.registerLogMetrics(logHandler)
+	if err != nil {
+		handleErr(err)
+		return
+	}
+
+	// Record Go runtime metrics
+	err = runtime.Start(runtime.WithMeterProvider(meterProvider))
+	if err != nil {
+		handleErr(err)
+		return
+	}
+
+	// Serve the metrics for scraping on the admin port
+	if configured(exporters.Metrics, ExporterPrometheus) {
+		shutdownMetricsServer, serverErr := startMetricsServer(exporters, registry)
+		if serverErr != nil {
+			handleErr(serverErr)
+			return
+		}
+		shutdownFuncs = append(shutdownFuncs, shutdownMetricsServer)
+	}
+
 	// Set up trace provider.
-	tracerProvider, err := newTraceProvider(backgroundCtx, resource)
+	tracerProvider, err := newTraceProvider(backgroundCtx, resource, exporters, sampler)
 	if err != nil {
 		handleErr(err)
 		return
@@ -91,16 +151,23 @@ func SetupOTelSDK(ctx context.Context) (shutdown func(context.Context) error, er
 // NOTE: No official logger provider exists in OpenTelemetry,
 // so using a temporary implemementation.
 //
-// ctx context.Context, resource *resource.Resource
+// Every configured exporter gets its own batch processor, which honors the OTEL_BLRP_*
+// environment variables. Failed exports are counted by the diagnostics.
+//
+// ctx context.Context, resource *resource.Resource, params ExporterParameters, diagnostics *Diagnostics
 // *logssdk.LoggerProvider, error
-func newLoggerProvider(ctx context.Context, resource *resource.Resource) (*logssdk.LoggerProvider, error) {
-	logExporter, _ := otlplogs.NewExporter(ctx)
-	loggerProvider := logssdk.NewLoggerProvider(
-		logssdk.WithBatcher(logExporter),
-		logssdk.WithResource(resource),
-	)
+func newLoggerProvider(ctx context.Context, resource *resource.Resource, params ExporterParameters, diagnostics *Diagnostics) (*logssdk.LoggerProvider, error) {
+	logExporters, err := newLogExporters(ctx, params)
+	if err != nil {
+		return nil, err
+	}
 
-	return loggerProvider, nil
+	options := []logssdk.LoggerProviderOption{logssdk.WithResource(resource)}
+	for _, logExporter := range logExporters {
+		options = append(options, logssdk.WithBatcher(diagnostics.wrapLogExporter(logExporter)))
+	}
+
+	return logssdk.NewLoggerProvider(options...), nil
 }
 
 // Create a new TextMapPropagator.
@@ -116,76 +183,91 @@ func newPropagator() propagation.TextMapPropagator {
 
 // Creates a new OpenTelemetry resource that represents this service.
 //
-// ctx context.Context
-// *resource.Resource
-func newResource(ctx context.Context) *resource.Resource {
-	hostName, _ := os.Hostname()
-	res, _ := resource.New(ctx,
-		resource.WithAttributes(
-			// the service name used to display traces in backends
-			semconv.ServiceName("todo-api-go"),
-			semconv.ServiceVersion("v1.0.0"),
-			semconv.HostName(hostName),
-		),
+// The resource describes the service, its build and deployment, as well as the host, operating
+// system, process and container it runs in. Attributes from OTEL_RESOURCE_ATTRIBUTES and
+// OTEL_SERVICE_NAME take precedence. Detectors that only partially succeed, for example the
+// container detector outside of a container, are logged rather than treated as errors.
+//
+// ctx context.Context, info ServiceInfo
+// *resource.Resource, error
+func newResource(ctx context.Context, info ServiceInfo) (*resource.Resource, error) {
+	attributes := []attribute.KeyValue{
+		// the service name used to display traces in backends
+		semconv.ServiceName(info.Name),
+		semconv.ServiceVersion(info.Version),
+		semconv.ServiceInstanceID(info.InstanceID),
+		semconv.DeploymentEnvironment(info.Environment),
+	}
+	if info.Revision != "" {
+		attributes = append(attributes, vcsRevisionAttribute.String(info.Revision))
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithTelemetrySDK(),
+		resource.WithHost(),
+		resource.WithOS(),
+		resource.WithContainer(),
+		// Command line arguments are left out, as they may contain secrets
+		resource.WithProcessPID(),
+		resource.WithProcessExecutableName(),
+		resource.WithProcessOwner(),
+		resource.WithProcessRuntimeName(),
+		resource.WithProcessRuntimeVersion(),
+		resource.WithProcessRuntimeDescription(),
+		resource.WithAttributes(attributes...),
+		resource.WithFromEnv(),
 	)
+	if errors.Is(err, resource.ErrPartialResource) {
+		slog.Warn("resource detection partially failed", "error", err)
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
 
-	return res
+	return res, nil
 }
 
 // Create a new trace.TracerProvider and an error.
 //
-// No parameters.
+// Every configured exporter gets its own batch span processor, which honors the
+// OTEL_BSP_* environment variables. The processors are wrapped by the sampler, so that
+// failed and slow spans are exported even if they were not sampled.
+//
+// ctx context.Context, resource *resource.Resource, params ExporterParameters, sampler *RuleSampler
 // Returns a *trace.TracerProvider and an error.
-func newTraceProvider(ctx context.Context, resource *resource.Resource) (*trace.TracerProvider, error) {
-	stdoutTraceExporter, err := stdouttrace.New(stdouttrace.WithPrettyPrint())
+func newTraceProvider(ctx context.Context, resource *resource.Resource, params ExporterParameters, sampler *RuleSampler) (*trace.TracerProvider, error) {
+	spanExporters, err := newSpanExporters(ctx, params)
 	if err != nil {
 		return nil, err
 	}
 
-	otlpTraceExporter, err := otlptracegrpc.New(ctx)
-	if err != nil {
-		return nil, err
-	}
-
-	traceProvider := trace.NewTracerProvider(
+	options := []trace.TracerProviderOption{
 		trace.WithResource(resource),
+		trace.WithSampler(sampler),
+	}
+	for _, spanExporter := range spanExporters {
+		processor := trace.NewBatchSpanProcessor(spanExporter)
+		options = append(options, trace.WithSpanProcessor(sampler.Processor(processor)))
+	}
 
-		trace.WithBatcher(stdoutTraceExporter,
-			// Default is 5s. Set to 1s for demonstrative purposes.
-			trace.WithBatchTimeout(time.Second)),
-
-		trace.WithBatcher(otlpTraceExporter,
-			// Default is 5s. Set to 1s for demonstrative purposes.
-			trace.WithBatchTimeout(time.Second)),
-	)
-
-	return traceProvider, nil
+	return trace.NewTracerProvider(options...), nil
 }
 
 // Create a new MeterProvider.
 //
-// No parameters.
+// ctx context.Context, resource *resource.Resource, params ExporterParameters, registry prometheus.Registerer
 // Returns a *metric.MeterProvider and an error.
-func newMeterProvider(ctx context.Context) (*metric.MeterProvider, error) {
-	stdoutMetricExporter, err := stdoutmetric.New()
+func newMeterProvider(ctx context.Context, resource *resource.Resource, params ExporterParameters, registry prometheus.Registerer) (*metric.MeterProvider, error) {
+	readers, err := newMetricReaders(ctx, params, registry)
 	if err != nil {
 		return nil, err
 	}
 
-	otlpMetricExporter, err := otlpmetricgrpc.New(ctx)
-	if err != nil {
-		return nil, err
+	options := []metric.Option{metric.WithResource(resource)}
+	for _, reader := range readers {
+		options = append(options, metric.WithReader(reader))
 	}
 
-	meterProvider := metric.NewMeterProvider(
-		metric.WithReader(metric.NewPeriodicReader(stdoutMetricExporter,
-			// Default is 1m. Set to 3s for demonstrative purposes.
-			metric.WithInterval(3*time.Second))),
-
-		metric.WithReader(metric.NewPeriodicReader(otlpMetricExporter,
-			// Default is 1m. Set to 3s for demonstrative purposes.
-			metric.WithInterval(3*time.Second))),
-	)
-
-	return meterProvider, nil
+	return metric.NewMeterProvider(options...), nil
 }
@@ -0,0 +1,284 @@
+package testsupport
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"testing"
+
+	"github.com/agoda-com/opentelemetry-go/otelslog"
+	logssdk "github.com/agoda-com/opentelemetry-logs-go/sdk/logs"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// TestTelemetry captures the spans, metrics and log records emitted during a test in memory.
+//
+// Spans and log records are exported synchronously, so they can be inspected as soon as
+// the span has ended or the record has been logged. Metrics are collected on demand.
+type TestTelemetry struct {
+	t       *testing.T
+	spans   *tracetest.InMemoryExporter
+	metrics *metric.ManualReader
+	logs    *InMemoryLogExporter
+}
+
+// InstallTestTelemetry installs in-memory exporters as the global tracer, meter and
+// logger providers for the duration of a test.
+//
+// The default slog logger is replaced by a logger exporting to the in-memory log exporter.
+// The previous providers and logger are restored at the end of the test. As the providers
+// are global, tests using them must not run in parallel.
+//
+// Components creating their instruments on construction, such as the HTTP and domain
+// metrics, must be created after the telemetry has been installed.
+//
+// This function takes a testing.T instance as a parameter and returns a *TestTelemetry.
+func InstallTestTelemetry(t *testing.T) *TestTelemetry {
+	telemetry := &TestTelemetry{
+		t:       t,
+		spans:   tracetest.NewInMemoryExporter(),
+		metrics: metric.NewManualReader(),
+		logs:    &InMemoryLogExporter{},
+	}
+
+	tracerProvider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(telemetry.spans))
+	meterProvider := metric.NewMeterProvider(metric.WithReader(telemetry.metrics))
+	loggerProvider := logssdk.NewLoggerProvider(logssdk.WithSyncer(telemetry.logs))
+
+	previousTracerProvider := otel.GetTracerProvider()
+	previousMeterProvider := otel.GetMeterProvider()
+	previousLogger := slog.Default()
+
+	otel.SetTracerProvider(tracerProvider)
+	otel.SetMeterProvider(meterProvider)
+	slog.SetDefault(slog.New(otelslog.NewOtelHandler(loggerProvider, &otelslog.HandlerOptions{Level: slog.LevelDebug})))
+
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previousTracerProvider)
+		otel.SetMeterProvider(previousMeterProvider)
+		slog.SetDefault(previousLogger)
+
+		ctx := context.Background()
+		_ = tracerProvider.Shutdown(ctx)
+		_ = meterProvider.Shutdown(ctx)
+		_ = loggerProvider.Shutdown(ctx)
+	})
+
+	return telemetry
+}
+
+// Spans returns the spans that have ended so far, in the order they ended.
+func (telemetry *TestTelemetry) Spans() tracetest.SpanStubs {
+	return telemetry.spans.GetSpans()
+}
+
+// FindSpan returns the last span that ended with the specified name and carries the
+// specified attributes, or nil if there is none.
+func (telemetry *TestTelemetry) FindSpan(name string, attributes ...attribute.KeyValue) *tracetest.SpanStub {
+	spans := telemetry.Spans()
+	for i := len(spans) - 1; i >= 0; i-- {
+		if spans[i].Name == name && hasAttributes(spans[i].Attributes, attributes) {
+			return &spans[i]
+		}
+	}
+
+	return nil
+}
+
+// AssertSpan asserts that a span with the specified name and attributes has ended.
+//
+// It returns the span, or nil after failing the test if there is none.
+func (telemetry *TestTelemetry) AssertSpan(name string, attributes ...attribute.KeyValue) *tracetest.SpanStub {
+	telemetry.t.Helper()
+
+	span := telemetry.FindSpan(name, attributes...)
+	if span == nil {
+		telemetry.t.Errorf("expected span %q with attributes %v, got %v", name, attributes, spanNames(telemetry.Spans()))
+	}
+
+	return span
+}
+
+// CollectMetrics collects the current state of all metrics, keyed by metric name.
+func (telemetry *TestTelemetry) CollectMetrics() map[string]metricdata.Metrics {
+	telemetry.t.Helper()
+
+	var collected metricdata.ResourceMetrics
+	err := telemetry.metrics.Collect(context.Background(), &collected)
+	if err != nil {
+		telemetry.t.Fatal(err)
+	}
+
+	metrics := map[string]metricdata.Metrics{}
+	for _, scope := range collected.ScopeMetrics {
+		for _, m := range scope.Metrics {
+			metrics[m.Name] = m
+		}
+	}
+
+	return metrics
+}
+
+// MetricValue returns the value of a metric, summed over the data points carrying the
+// specified attributes.
+//
+// The value of a sum or gauge is the value of its data points, while the value of a
+// histogram is the number of recorded measurements. It returns false if the metric has
+// not been recorded or no data point carries the attributes.
+func (telemetry *TestTelemetry) MetricValue(name string, attributes ...attribute.KeyValue) (float64, bool) {
+	telemetry.t.Helper()
+
+	m, ok := telemetry.CollectMetrics()[name]
+	if !ok {
+		return 0, false
+	}
+
+	return metricValue(m.Data, attributes)
+}
+
+// AssertMetricValue asserts that the value of a metric, as returned by MetricValue, equals
+// the expected value.
+func (telemetry *TestTelemetry) AssertMetricValue(name string, expected float64, attributes ...attribute.KeyValue) {
+	telemetry.t.Helper()
+
+	value, ok := telemetry.MetricValue(name, attributes...)
+	switch {
+	case !ok:
+		telemetry.t.Errorf("expected metric %q with attributes %v to be recorded", name, attributes)
+	case value != expected:
+		telemetry.t.Errorf("expected metric %q with attributes %v to equal %v, got %v", name, attributes, expected, value)
+	}
+}
+
+// Logs returns the log records emitted so far, in the order they were emitted.
+func (telemetry *TestTelemetry) Logs() []logssdk.ReadableLogRecord {
+	return telemetry.logs.Records()
+}
+
+// FindLog returns the last log record with the specified message and attributes, or nil
+// if there is none.
+func (telemetry *TestTelemetry) FindLog(message string, attributes ...attribute.KeyValue) logssdk.ReadableLogRecord {
+	records := telemetry.Logs()
+	for i := len(records) - 1; i >= 0; i-- {
+		body := records[i].Body()
+		if body != nil && *body == message && records[i].Attributes() != nil && hasAttributes(*records[i].Attributes(), attributes) {
+			return records[i]
+		}
+	}
+
+	return nil
+}
+
+// AssertLog asserts that a log record with the specified message and attributes has been emitted.
+//
+// It returns the log record, or nil after failing the test if there is none.
+func (telemetry *TestTelemetry) AssertLog(message string, attributes ...attribute.KeyValue) logssdk.ReadableLogRecord {
+	telemetry.t.Helper()
+
+	record := telemetry.FindLog(message, attributes...)
+	if record == nil {
+		telemetry.t.Errorf("expected log record %q with attributes %v", message, attributes)
+	}
+
+	return record
+}
+
+// InMemoryLogExporter is a log record exporter keeping the exported records in memory.
+type InMemoryLogExporter struct {
+	mutex   sync.Mutex
+	records []logssdk.ReadableLogRecord
+}
+
+// Export implements logssdk.LogRecordExporter.
+func (exporter *InMemoryLogExporter) Export(ctx context.Context, batch []logssdk.ReadableLogRecord) error {
+	exporter.mutex.Lock()
+	defer exporter.mutex.Unlock()
+
+	exporter.records = append(exporter.records, batch...)
+	return nil
+}
+
+// Shutdown implements logssdk.LogRecordExporter.
+func (exporter *InMemoryLogExporter) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+// Records returns a copy of the exported records.
+func (exporter *InMemoryLogExporter) Records() []logssdk.ReadableLogRecord {
+	exporter.mutex.Lock()
+	defer exporter.mutex.Unlock()
+
+	return append([]logssdk.ReadableLogRecord(nil), exporter.records...)
+}
+
+// hasAttributes reports whether a set of attributes contains all the expected attributes.
+func hasAttributes(actual []attribute.KeyValue, expected []attribute.KeyValue) bool {
+	set := attribute.NewSet(actual...)
+	for _, attr := range expected {
+		value, ok := set.Value(attr.Key)
+		if !ok || value != attr.Value {
+			return false
+		}
+	}
+
+	return true
+}
+
+// metricValue sums the data points of a metric carrying the specified attributes.
+func metricValue(data metricdata.Aggregation, attributes []attribute.KeyValue) (float64, bool) {
+	var value float64
+	var found bool
+
+	add := func(set attribute.Set, v float64) {
+		if hasAttributes(set.ToSlice(), attributes) {
+			value += v
+			found = true
+		}
+	}
+
+	switch data := data.(type) {
+	case metricdata.Sum[int64]:
+		for _, point := range data.DataPoints {
+			add(point.Attributes, float64(point.Value))
+		}
+	case metricdata.Sum[float64]:
+		for _, point := range data.DataPoints {
+			add(point.Attributes, point.Value)
+		}
+	case metricdata.Gauge[int64]:
+		for _, point := range data.DataPoints {
+			add(point.Attributes, float64(point.Value))
+		}
+	case metricdata.Gauge[float64]:
+		for _, point := range data.DataPoints {
+			add(point.Attributes, point.Value)
+		}
+	case metricdata.Histogram[int64]:
+		for _, point := range data.DataPoints {
+			add(point.Attributes, float64(point.Count))
+		}
+	case metricdata.Histogram[float64]:
+		for _, point := range data.DataPoints {
+			add(point.Attributes, float64(point.Count))
+		}
+	}
+
+	return value, found
+}
+
+// spanNames lists the names of spans for failure messages.
+func spanNames(spans tracetest.SpanStubs) string {
+	names := make([]string, 0, len(spans))
+	for i := range spans {
+		names = append(names, spans[i].Name)
+	}
+
+	return fmt.Sprint(names)
+}
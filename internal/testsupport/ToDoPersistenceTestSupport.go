@@ -4,17 +4,18 @@ import (
 	"gorm.io/driver/sqlite" // Sqlite driver based on CGO
 	"gorm.io/gorm"
 
-	"todo-api-go/entities"
 	"todo-api-go/persistence"
 
 	"fmt"
 	"testing"
 )
 
-// CreateTestManager creates a ToDoEntityManager instance for testing.
+// CreateTestDatabase opens an in-memory database for testing.
 //
-// This function takes a testing.T instance as a parameter and returns a *persistence.ToDoEntityManager.
-func CreateTestManager(t *testing.T) *persistence.ToDoEntityManager {
+// The schema of all persistent entities is created and loaded with some test data.
+// The connection is closed at the end of the test.
+// This function takes a testing.T instance as a parameter and returns a *gorm.DB.
+func CreateTestDatabase(t *testing.T) *gorm.DB {
 	dsn := "file::memory:?cache=shared"
 	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{
 		PrepareStmt: true,
@@ -29,24 +30,34 @@ func CreateTestManager(t *testing.T) *persistence.ToDoEntityManager {
 	}
 
 	// Set up the schema and load some test data
-	err = db.AutoMigrate(&entities.ToDoItemEntity{})
+	err = persistence.Migrate(db)
 	if err != nil {
 		t.Fatal(err)
 	}
 	loadTestData(t, db)
 
-	// Wrap the database connection in a ToDoEntityManager
-	mgr := persistence.New(db)
-	if mgr == nil {
-		t.Fatal("mgr is nil")
-	}
-
 	// Defer the closing of the database connection until
 	// the end of the test
 	t.Cleanup(func() {
-		mgr.Close()
+		sqlDB, err := db.DB()
+		if err == nil {
+			sqlDB.Close()
+		}
 	})
 
+	return db
+}
+
+// CreateTestManager creates a ToDoEntityManager instance for testing.
+//
+// This function takes a testing.T instance as a parameter and returns a *persistence.ToDoEntityManager.
+func CreateTestManager(t *testing.T) *persistence.ToDoEntityManager {
+	// Wrap the database connection in a ToDoEntityManager
+	mgr := persistence.New(CreateTestDatabase(t))
+	if mgr == nil {
+		t.Fatal("mgr is nil")
+	}
+
 	return mgr
 }
 
@@ -0,0 +1,273 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+
+	"todo-api-go/entities"
+	"todo-api-go/persistence"
+	"todo-api-go/reqctx"
+)
+
+// Component of the loggers used by this package
+const logComponent = "webhooks"
+
+// Headers of webhook deliveries
+const (
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+	SignatureHeader = "X-Webhook-Signature"
+)
+
+// Longest part of a response body kept in the delivery log
+const maxLoggedResponse = 1024
+
+type DispatcherParameters struct {
+	// Whether deliveries are dispatched by this instance
+	Enabled bool `default:"true"`
+
+	// Interval between polls of the outbox
+	PollInterval time.Duration `split_words:"true" default:"5s"`
+
+	// Maximum number of deliveries attempted per poll
+	BatchSize int `split_words:"true" default:"50"`
+
+	// Timeout of a delivery attempt
+	Timeout time.Duration `default:"10s"`
+
+	// Number of attempts after which a delivery is given up
+	MaxAttempts int `split_words:"true" default:"8"`
+
+	// Delay before the first retry, doubling with every further retry up to BackoffMax
+	BackoffBase time.Duration `split_words:"true" default:"10s"`
+	BackoffMax  time.Duration `split_words:"true" default:"1h"`
+
+	// How far back items that became overdue are looked for when the dispatcher starts
+	OverdueLookback time.Duration `split_words:"true" default:"24h"`
+}
+
+// Dispatcher delivers the webhook deliveries queued in the outbox to their subscriptions.
+//
+// Deliveries are posted as JSON, signed with the secret of the subscription, and retried with
+// exponential backoff until the receiver responds with a 2xx status or the attempts are
+// exhausted. Several dispatchers may share an outbox, as deliveries are claimed before they
+// are attempted.
+type Dispatcher struct {
+	params DispatcherParameters
+	outbox *persistence.WebhookManager
+	client *http.Client
+
+	// End of the period that has been checked for overdue items
+	overdueChecked time.Time
+}
+
+// NewFromEnv creates a Dispatcher configured from the "WEBHOOK_***" environment variables.
+//
+// outbox: The manager of the webhook outbox.
+// Returns a pointer to Dispatcher and an error.
+func NewFromEnv(outbox *persistence.WebhookManager) (*Dispatcher, error) {
+	var params DispatcherParameters
+
+	err := envconfig.Process("webhook", &params)
+	if err != nil {
+		return nil, err
+	}
+
+	return New(params, outbox), nil
+}
+
+// New creates a Dispatcher with the specified parameters.
+//
+// params: The configuration of the dispatcher.
+// outbox: The manager of the webhook outbox.
+// Returns a pointer to Dispatcher.
+func New(params DispatcherParameters, outbox *persistence.WebhookManager) *Dispatcher {
+	return &Dispatcher{
+		params: params,
+		outbox: outbox,
+		client: &http.Client{
+			Timeout:   params.Timeout,
+			Transport: newTransport(outbox),
+			// Redirects are not followed, so that deliveries only reach the subscribed URL
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// newTransport creates the transport posting deliveries. It checks the address of every
+// connection with the outbox, as the host of a subscription may resolve to another address
+// than when the subscription was registered. Proxies are not used, as their address would be
+// checked instead.
+func newTransport(outbox *persistence.WebhookManager) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout: 30 * time.Second,
+		Control: func(network string, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+
+			return outbox.CheckAddress(net.ParseIP(host))
+		},
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return transport
+}
+
+// Run polls the outbox and dispatches due deliveries until the context is canceled.
+// It returns immediately if the dispatcher is disabled.
+func (dispatcher *Dispatcher) Run(ctx context.Context) {
+	if !dispatcher.params.Enabled {
+		return
+	}
+
+	ticker := time.NewTicker(dispatcher.params.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		_, err := dispatcher.Dispatch(ctx)
+		if err != nil {
+			reqctx.LoggerFrom(ctx, logComponent).ErrorContext(ctx, "webhook dispatch failed", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Dispatch queues the todo.overdue events of items that became overdue since the previous
+// call, and attempts a batch of due deliveries concurrently.
+//
+// It returns the number of attempted deliveries and an error if the outbox could not be read.
+// Failed attempts are recorded in the outbox rather than returned.
+func (dispatcher *Dispatcher) Dispatch(ctx context.Context) (int, error) {
+	outbox := dispatcher.outbox.WithContext(ctx)
+	now := time.Now()
+
+	if dispatcher.overdueChecked.IsZero() {
+		dispatcher.overdueChecked = now.Add(-dispatcher.params.OverdueLookback)
+	}
+
+	_, err := outbox.EnqueueOverdue(dispatcher.overdueChecked, now)
+	if err != nil {
+		return 0, err
+	}
+	dispatcher.overdueChecked = now
+
+	// The lease outlasts the attempt, so that deliveries are not attempted twice at once
+	lease := dispatcher.params.Timeout + time.Minute
+
+	pending, err := outbox.ClaimDue(now, dispatcher.params.BatchSize, lease)
+	if err != nil {
+		return 0, err
+	}
+
+	var wait sync.WaitGroup
+	for i := range pending {
+		wait.Add(1)
+		go func(pending *persistence.PendingDelivery) {
+			defer wait.Done()
+			dispatcher.deliver(ctx, outbox, pending)
+		}(&pending[i])
+	}
+	wait.Wait()
+
+	return len(pending), nil
+}
+
+// deliver attempts a claimed delivery and records the outcome in the outbox.
+func (dispatcher *Dispatcher) deliver(ctx context.Context, outbox *persistence.WebhookManager, pending *persistence.PendingDelivery) {
+	delivery := &pending.Delivery
+	logger := reqctx.LoggerFrom(ctx, logComponent).With("delivery_id", delivery.ID, "event", delivery.Event, "attempt", delivery.Attempts)
+
+	started := time.Now()
+	attempt := dispatcher.post(ctx, pending)
+	attempt.DurationMs = time.Since(started).Milliseconds()
+
+	now := time.Now()
+	switch {
+	case attempt.Error == "":
+		delivery.Status = entities.DeliveryDelivered
+		delivery.DeliveredAt = now
+		delivery.LastError = ""
+		logger.DebugContext(ctx, "webhook delivered", "status", attempt.StatusCode)
+
+	case delivery.Attempts >= dispatcher.params.MaxAttempts:
+		delivery.Status = entities.DeliveryDead
+		delivery.LastError = attempt.Error
+		logger.WarnContext(ctx, "webhook delivery given up", "error", attempt.Error)
+
+	default:
+		delivery.NextAttemptAt = now.Add(dispatcher.backoff(delivery.Attempts))
+		delivery.LastError = attempt.Error
+		logger.InfoContext(ctx, "webhook delivery failed", "error", attempt.Error, "retry_at", delivery.NextAttemptAt)
+	}
+
+	err := outbox.RecordAttempt(delivery, attempt)
+	if err != nil {
+		logger.ErrorContext(ctx, "webhook attempt could not be recorded", "error", err)
+	}
+}
+
+// post sends a delivery to the URL of its subscription, describing the outcome as an attempt
+// whose error is empty if the receiver accepted the delivery.
+func (dispatcher *Dispatcher) post(ctx context.Context, pending *persistence.PendingDelivery) *entities.WebhookAttemptEntity {
+	attempt := &entities.WebhookAttemptEntity{}
+	body := []byte(pending.Delivery.Payload)
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, pending.Subscription.URL, bytes.NewReader(body))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "todo-api-go-webhooks")
+	request.Header.Set(EventHeader, pending.Delivery.Event)
+	request.Header.Set(DeliveryHeader, strconv.FormatUint(uint64(pending.Delivery.ID), 10))
+	request.Header.Set(SignatureHeader, Sign(pending.Subscription.Secret, time.Now(), body))
+
+	response, err := dispatcher.client.Do(request)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer response.Body.Close()
+
+	logged, _ := io.ReadAll(io.LimitReader(response.Body, maxLoggedResponse))
+	attempt.StatusCode = response.StatusCode
+	attempt.Response = string(logged)
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		attempt.Error = "unexpected status " + response.Status
+	}
+
+	return attempt
+}
+
+// backoff returns the delay before the retry following the specified number of attempts.
+func (dispatcher *Dispatcher) backoff(attempts int) time.Duration {
+	delay := dispatcher.params.BackoffBase
+	for i := 1; i < attempts && delay < dispatcher.params.BackoffMax; i++ {
+		delay *= 2
+	}
+
+	return min(delay, dispatcher.params.BackoffMax)
+}
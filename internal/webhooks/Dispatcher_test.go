@@ -0,0 +1,202 @@
+package webhooks_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"todo-api-go/entities"
+	"todo-api-go/persistence"
+	"todo-api-go/reqctx"
+	"todo-api-go/testsupport"
+	"todo-api-go/webhooks"
+)
+
+// receiver records the deliveries posted to a test server, responding with a fixed status
+type receiver struct {
+	mutex    sync.Mutex
+	status   int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (receiver *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	receiver.mutex.Lock()
+	defer receiver.mutex.Unlock()
+	receiver.requests = append(receiver.requests, r)
+	receiver.bodies = append(receiver.bodies, body)
+
+	w.WriteHeader(receiver.status)
+}
+
+func TestDispatch(t *testing.T) {
+	assert := assert.New(t)
+
+	receiver := &receiver{status: http.StatusNoContent}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	outbox, items := createTestOutbox(t)
+	subscription := subscribe(t, outbox, server.URL)
+
+	err := items.Create(&entities.ToDoItemEntity{Description: "hooked"})
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	dispatcher := webhooks.New(testParameters(), outbox)
+	attempted, err := dispatcher.Dispatch(context.Background())
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf(1, attempted, "delivery should be attempted")
+
+	if assert.Equalf(1, len(receiver.requests), "delivery should be received") {
+		request := receiver.requests[0]
+		assert.Equalf(entities.WebhookItemCreated, request.Header.Get(webhooks.EventHeader), "event should be named")
+		assert.NotEmptyf(request.Header.Get(webhooks.DeliveryHeader), "delivery should be identified")
+
+		err = webhooks.Verify(subscription.Secret, request.Header.Get(webhooks.SignatureHeader), receiver.bodies[0], time.Minute)
+		assert.Nilf(err, "signature should be valid, not %s", err)
+	}
+
+	deliveries, _, err := outbox.FindDeliveries(persistence.DeliveryFilter{Status: entities.DeliveryDelivered})
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf(1, len(deliveries), "delivery should be delivered")
+
+	attempted, err = dispatcher.Dispatch(context.Background())
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf(0, attempted, "delivered deliveries should not be attempted again")
+}
+
+func TestDispatchRetries(t *testing.T) {
+	assert := assert.New(t)
+
+	receiver := &receiver{status: http.StatusInternalServerError}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	outbox, items := createTestOutbox(t)
+	subscribe(t, outbox, server.URL)
+
+	err := items.Create(&entities.ToDoItemEntity{Description: "hooked"})
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	params := testParameters()
+	params.MaxAttempts = 2
+	params.BackoffBase = time.Millisecond
+	dispatcher := webhooks.New(params, outbox)
+
+	_, err = dispatcher.Dispatch(context.Background())
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	deliveries, _, err := outbox.FindDeliveries(persistence.DeliveryFilter{})
+	assert.Nilf(err, "error should be nil, not %s", err)
+	if !assert.Equalf(1, len(deliveries), "length should be 1") {
+		return
+	}
+	assert.Equalf(entities.DeliveryPending, deliveries[0].Status, "failed delivery should be retried")
+	assert.Equalf("unexpected status 500 Internal Server Error", deliveries[0].LastError, "error should be kept")
+
+	time.Sleep(10 * time.Millisecond)
+	_, err = dispatcher.Dispatch(context.Background())
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	log, err := outbox.FindDelivery(deliveries[0].ID)
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Equalf(entities.DeliveryDead, log.Status, "delivery should be given up after the last attempt")
+	assert.Equalf(2, len(log.Log), "attempts should be logged")
+	assert.Equalf(2, len(receiver.requests), "delivery should be attempted twice")
+}
+
+func TestDispatchToInternalAddress(t *testing.T) {
+	assert := assert.New(t)
+
+	receiver := &receiver{status: http.StatusNoContent}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	outbox, items := createTestOutbox(t)
+	subscribe(t, outbox, server.URL)
+
+	// Hosts may resolve to internal addresses after they have been registered
+	outbox.AllowNetworks(nil)
+
+	err := items.Create(&entities.ToDoItemEntity{Description: "hooked"})
+	assert.Nilf(err, "error should be nil, not %s", err)
+
+	_, err = webhooks.New(testParameters(), outbox).Dispatch(context.Background())
+	assert.Nilf(err, "error should be nil, not %s", err)
+	assert.Emptyf(receiver.requests, "internal addresses should not be reached")
+
+	deliveries, _, err := outbox.FindDeliveries(persistence.DeliveryFilter{})
+	assert.Nilf(err, "error should be nil, not %s", err)
+	if assert.Equalf(1, len(deliveries), "length should be 1") {
+		assert.Containsf(deliveries[0].LastError, "can not be delivered to the address", "error should be kept")
+	}
+}
+
+func TestSignature(t *testing.T) {
+	assert := assert.New(t)
+
+	body := []byte(`{"Event":"todo.created"}`)
+	header := webhooks.Sign("secret", time.Now(), body)
+
+	assert.Nilf(webhooks.Verify("secret", header, body, time.Minute), "signature should be valid")
+	assert.ErrorIsf(webhooks.Verify("other", header, body, time.Minute), webhooks.ErrInvalidSignature, "secret should be checked")
+	assert.ErrorIsf(webhooks.Verify("secret", header, []byte("{}"), time.Minute), webhooks.ErrInvalidSignature, "body should be checked")
+	assert.ErrorIsf(webhooks.Verify("secret", "v1=abc", body, time.Minute), webhooks.ErrInvalidSignature, "timestamp should be required")
+
+	old := webhooks.Sign("secret", time.Now().Add(-time.Hour), body)
+	assert.ErrorIsf(webhooks.Verify("secret", old, body, time.Minute), webhooks.ErrInvalidSignature, "old signatures should be rejected")
+	assert.Nilf(webhooks.Verify("secret", old, body, 0), "age should not be checked without tolerance")
+}
+
+func createTestOutbox(t *testing.T) (*persistence.WebhookManager, *persistence.ToDoEntityManager) {
+	db := testsupport.CreateTestDatabase(t)
+	ctx := reqctx.WithPrincipal(context.Background(), &reqctx.Principal{Subject: "alice"})
+
+	// The test servers listen on the loopback interface
+	outbox := persistence.NewWebhookManager(db)
+	outbox.AllowNetworks(loopback(t))
+
+	return outbox, persistence.New(db).WithContext(ctx)
+}
+
+func loopback(t *testing.T) persistence.Networks {
+	var networks persistence.Networks
+	err := networks.Decode("127.0.0.0/8,::1/128")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return networks
+}
+
+func subscribe(t *testing.T, outbox *persistence.WebhookManager, url string) *entities.WebhookSubscriptionEntity {
+	ctx := reqctx.WithPrincipal(context.Background(), &reqctx.Principal{Subject: "alice"})
+
+	subscription := &entities.WebhookSubscriptionEntity{URL: url, Events: []string{entities.WebhookItemCreated}}
+	err := outbox.WithContext(ctx).Create(subscription)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return subscription
+}
+
+func testParameters() webhooks.DispatcherParameters {
+	return webhooks.DispatcherParameters{
+		Enabled:      true,
+		PollInterval: time.Second,
+		BatchSize:    10,
+		Timeout:      time.Second,
+		MaxAttempts:  3,
+		BackoffBase:  time.Second,
+		BackoffMax:   time.Minute,
+	}
+}
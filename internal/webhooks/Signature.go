@@ -0,0 +1,71 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidSignature is returned by Verify when a signature does not match the body
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// Sign computes the value of the signature header of a delivery: "t=<unix time>,v1=<signature>",
+// where the signature is the hex encoded HMAC-SHA256 of "<unix time>.<body>" keyed with the
+// secret of the subscription.
+//
+// Including the time in the signature lets receivers reject replayed deliveries.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	unix := strconv.FormatInt(timestamp.Unix(), 10)
+	return "t=" + unix + ",v1=" + signature(secret, unix, body)
+}
+
+// Verify checks the signature header of a delivery, as computed by Sign, for receivers of
+// webhooks written in Go.
+//
+// It takes the secret of the subscription, the header, the body and the maximum age of the
+// signature, where zero disables the check.
+// It returns ErrInvalidSignature if the header is malformed, does not match or is too old.
+func Verify(secret string, header string, body []byte, tolerance time.Duration) error {
+	var unix string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			unix = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+
+	seconds, err := strconv.ParseInt(unix, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	if tolerance > 0 && time.Since(time.Unix(seconds, 0)).Abs() > tolerance {
+		return ErrInvalidSignature
+	}
+
+	expected := signature(secret, unix, body)
+	for _, candidate := range signatures {
+		if hmac.Equal([]byte(candidate), []byte(expected)) {
+			return nil
+		}
+	}
+
+	return ErrInvalidSignature
+}
+
+// signature returns the hex encoded HMAC-SHA256 of "<unix time>.<body>".
+func signature(secret string, unix string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unix + "."))
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}